@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// maxEMASample is the largest sample the EMA takes: the average never
+// exceeds its largest sample, so alpha*x + (emaScale-alpha)*ema stays below
+// emaScale*maxEMASample.
+var maxEMASample = new(big.Int).Div(sdk.MaxUint248, big.NewInt(emaScale))
+
+// defineAggregation adds the outputs selected by c.Spec.Aggregation after the
+// total emissions output.
+func (c *AppCircuit) defineAggregation(api *sdk.CircuitAPI, in sdk.DataInput, emissions *sdk.DataStream[sdk.Uint248]) error {
+	switch c.Spec.Aggregation {
+	case AggregationTopK:
+		c.outputTopK(api, in)
+	case AggregationSorted:
+		u248 := api.Uint248
+		sdk.AssertSorted(emissions, func(a, b sdk.Uint248) sdk.Uint248 {
+			return u248.Not(u248.IsGreaterThan(a, b))
+		})
+	case AggregationWindowAvg:
+		api.OutputUint(248, windowAverage(api, emissions, c.Spec.Window))
+	case AggregationEMA:
+		api.OutputUint(248, exponentialMovingAverage(api, emissions, c.Spec.AlphaBps))
+	case AggregationMerkle:
+		api.OutputBytes32(c.merkleRoot(api, in))
+	case AggregationMin:
+		api.OutputUint(248, smallest(api, emissions))
+	case AggregationMax:
+		api.OutputUint(248, sdk.Max(emissions))
+	case AggregationMean:
+		api.OutputUint(248, mean(api, emissions))
+	case AggregationCount:
+		u248 := api.Uint248
+		nonzero := sdk.Filter(emissions, func(v sdk.Uint248) sdk.Uint248 {
+			return u248.Not(u248.IsZero(v))
+		})
+		api.OutputUint(32, sdk.Count(nonzero))
+	}
+	return nil
+}
+
+// outputTopK outputs the slot and value of the k queried slots with the
+// largest weighted values, largest first. Slots sharing a value are ranked
+// by slot index, lowest first, so each is output in its own rank; ranks
+// beyond the number of queried slots are output as zero.
+func (c *AppCircuit) outputTopK(api *sdk.CircuitAPI, in sdk.DataInput) {
+	u248 := api.Uint248
+	n := len(in.StorageSlots.Raw)
+	values := make([]sdk.Uint248, n)
+	// open flags the queried slots not yet output.
+	open := make([]sdk.Uint248, n)
+	for i, slot := range in.StorageSlots.Raw {
+		values[i] = c.weightedValue(api, slot)
+		open[i] = sdk.Uint248{Val: in.StorageSlots.Toggles[i]}
+	}
+	for rank := 0; rank < c.Spec.TopK; rank++ {
+		// A later slot displaces the pick only with a strictly larger value,
+		// which ranks ties by index.
+		found, top, pick := sdk.ConstUint248(0), sdk.ConstUint248(0), sdk.ConstUint248(0)
+		holder := sdk.ConstFromBigEndianBytes(nil)
+		for i, slot := range in.StorageSlots.Raw {
+			better := u248.And(open[i], u248.Or(u248.Not(found), u248.IsGreaterThan(values[i], top)))
+			top = u248.Select(better, values[i], top)
+			pick = u248.Select(better, sdk.ConstUint248(i), pick)
+			holder = api.Bytes32.Select(better, slot.Slot, holder)
+			found = u248.Or(found, open[i])
+		}
+
+		api.OutputBytes32(holder)
+		api.OutputUint(248, top)
+
+		for i := range open {
+			open[i] = u248.And(open[i], u248.Not(u248.IsEqual(sdk.ConstUint248(i), pick)))
+		}
+	}
+}
+
+// smallest returns the smallest sample. At least one sample is required,
+// since sdk.Min of an empty stream is MaxUint248.
+func smallest(api *sdk.CircuitAPI, samples *sdk.DataStream[sdk.Uint248]) sdk.Uint248 {
+	u248 := api.Uint248
+	u248.AssertIsEqual(u248.IsZero(sdk.Count(samples)), sdk.ConstUint248(0))
+	return sdk.Min(samples)
+}
+
+// mean returns the average of the samples, rounded down. At least one sample
+// is required.
+func mean(api *sdk.CircuitAPI, samples *sdk.DataStream[sdk.Uint248]) sdk.Uint248 {
+	u248 := api.Uint248
+	u248.AssertIsEqual(u248.IsZero(sdk.Count(samples)), sdk.ConstUint248(0))
+	return sdk.Mean(samples)
+}
+
+// windowAverage returns the mean of the last full window of size consecutive
+// samples. Samples are taken in stream order, so queries must be added oldest
+// first. At least one full window is required.
+func windowAverage(api *sdk.CircuitAPI, samples *sdk.DataStream[sdk.Uint248], size int) sdk.Uint248 {
+	u248 := api.Uint248
+	windows := sdk.WindowUnderlying(samples, size, 1)
+	u248.AssertIsEqual(u248.IsZero(sdk.Count(windows)), sdk.ConstUint248(0))
+
+	initial := make(sdk.List[sdk.Uint248], size)
+	for i := range initial {
+		initial[i] = sdk.ConstUint248(0)
+	}
+	last := sdk.Reduce(windows, initial, func(_ sdk.List[sdk.Uint248], window sdk.List[sdk.Uint248]) sdk.List[sdk.Uint248] {
+		return window
+	})
+
+	sum := sdk.ConstUint248(0)
+	for _, v := range last {
+		sum = u248.Add(sum, v)
+	}
+	avg, _ := u248.Div(sum, sdk.ConstUint248(size))
+	return avg
+}
+
+// exponentialMovingAverage folds the samples in stream order into
+// ema = (alpha*x + (emaScale-alpha)*ema) / emaScale, seeded with the first
+// sample. Each step rounds down. Samples must be at most maxEMASample, so
+// that the products stay within 248 bits rather than wrapping in the field.
+func exponentialMovingAverage(api *sdk.CircuitAPI, samples *sdk.DataStream[sdk.Uint248], alphaBps int) sdk.Uint248 {
+	u248 := api.Uint248
+	limit := sdk.ConstUint248(maxEMASample)
+	sdk.AssertEach(samples, func(x sdk.Uint248) sdk.Uint248 {
+		return u248.Not(u248.IsGreaterThan(x, limit))
+	})
+	alpha := sdk.ConstUint248(alphaBps)
+	keep := sdk.ConstUint248(emaScale - alphaBps)
+	scale := sdk.ConstUint248(emaScale)
+
+	// acc[0] flags whether the average has been seeded, acc[1] is the average.
+	initial := sdk.List[sdk.Uint248]{sdk.ConstUint248(0), sdk.ConstUint248(0)}
+	acc := sdk.Reduce(samples, initial, func(acc sdk.List[sdk.Uint248], x sdk.Uint248) sdk.List[sdk.Uint248] {
+		next, _ := u248.Div(u248.Add(u248.Mul(alpha, x), u248.Mul(keep, acc[1])), scale)
+		return sdk.List[sdk.Uint248]{sdk.ConstUint248(1), u248.Select(acc[0], next, x)}
+	})
+	return acc[1]
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// allocationSamples is how many recent proofs per spec the recommendation
+// is based on.
+const allocationSamples = 1000
+
+var (
+	// slotUsage holds the storage slot count of recent proofs, keyed by spec.
+	slotUsage      = map[string][]int{}
+	slotUsageMutex sync.Mutex
+)
+
+// recordSlotUsage notes how many of the allocated storage slots an emissions
+// proof used. Stock flow proofs always use two.
+func recordSlotUsage(spec CircuitSpec, in sdk.CircuitInput) {
+	if spec.Circuit != CircuitEmissions {
+		return
+	}
+	used := 0
+	for _, t := range in.StorageSlots.Toggles {
+		if toggleSet(t) {
+			used++
+		}
+	}
+	slotUsageMutex.Lock()
+	defer slotUsageMutex.Unlock()
+	// Variants share the base spec's record so the advice covers every size.
+	key := spec.base().String()
+	samples := append(slotUsage[key], used)
+	if len(samples) > allocationSamples {
+		samples = samples[len(samples)-allocationSamples:]
+	}
+	slotUsage[key] = samples
+}
+
+type allocationAdvice struct {
+	Spec        string `json:"spec"`
+	Samples     int    `json:"samples"`
+	Allocated   int    `json:"allocated"`
+	P50         int    `json:"p50"`
+	P95         int    `json:"p95"`
+	Max         int    `json:"max"`
+	Recommended int    `json:"recommended"`
+	// ProveTimeSaving assumes proving time scales with the slot allocation,
+	// which holds roughly since the per-slot checks dominate the circuit.
+	ProveTimeSaving float64 `json:"prove_time_saving"`
+	Message         string  `json:"message"`
+}
+
+// adviseAllocation recommends the smallest allocation covering 95% of the
+// recorded proofs: a power of two, which is the size BuildCircuitInput pads
+// to, and no less than minSlots.
+func adviseAllocation(spec string, samples []int) allocationAdvice {
+	sorted := append([]int(nil), samples...)
+	sort.Ints(sorted)
+	allocated := circuitSizes[len(circuitSizes)-1]
+	a := allocationAdvice{
+		Spec:      spec,
+		Samples:   len(sorted),
+		Allocated: allocated,
+		P50:       sorted[len(sorted)/2],
+		P95:       sorted[(len(sorted)*95+99)/100-1],
+		Max:       sorted[len(sorted)-1],
+	}
+	a.Recommended = minSlots
+	for a.Recommended < a.P95 {
+		a.Recommended *= 2
+	}
+	if a.Recommended >= allocated {
+		a.Recommended = allocated
+		a.Message = fmt.Sprintf("95%% of requests use <=%d slots; a %d-slot allocation is the smallest that fits", a.P95, allocated)
+		return a
+	}
+	a.ProveTimeSaving = 1 - float64(a.Recommended)/float64(allocated)
+	a.Message = fmt.Sprintf("95%% of requests use <=%d slots; adding a %d-slot circuit to BREVIS_CIRCUIT_SIZES would cut prove time about %.0f%%", a.P95, a.Recommended, a.ProveTimeSaving*100)
+	return a
+}
+
+// handleAdminAllocation reports allocation advice for every spec proven
+// since startup.
+func handleAdminAllocation(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	slotUsageMutex.Lock()
+	advice := []allocationAdvice{}
+	for spec, samples := range slotUsage {
+		advice = append(advice, adviseAllocation(spec, samples))
+	}
+	slotUsageMutex.Unlock()
+	sort.Slice(advice, func(i, j int) bool { return advice[i].Samples > advice[j].Samples })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(advice)
+}
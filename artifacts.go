@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+)
+
+var (
+	// artifactBucket names the bucket of artifactStore, which compiled
+	// circuits are published to. Empty keeps artifacts on local disk only.
+	artifactBucket = ""
+	artifactPrefix = ""
+	// artifactCacheDir holds downloaded artifacts, one directory per spec,
+	// evicted least recently used first once they exceed artifactCacheBytes.
+	artifactCacheDir   = "./brevis-cache"
+	artifactCacheBytes = 64 << 30
+
+	artifactMutex sync.Mutex
+)
+
+// loadArtifactSettings reads the BREVIS_ARTIFACT_* settings. Prover workers
+// call it too, since they load artifacts themselves.
+func loadArtifactSettings() error {
+	artifactBucket = os.Getenv("BREVIS_ARTIFACT_BUCKET")
+	artifactPrefix = os.Getenv("BREVIS_ARTIFACT_PREFIX")
+	if v := os.Getenv("BREVIS_ARTIFACT_CACHE_DIR"); v != "" {
+		artifactCacheDir = v
+	}
+	var err error
+	if artifactCacheBytes, err = envInt("BREVIS_ARTIFACT_CACHE_BYTES", artifactCacheBytes); err != nil {
+		return err
+	}
+	if artifactBucket != "" {
+		artifactStore, err = newBlobStore(artifactBucket)
+	}
+	return err
+}
+
+var artifactFiles = []string{"compiledCircuit", "pk", "vk", circuitSpecFile, circuitHashFile}
+
+// artifactKey names a spec's artifacts in the bucket and the cache.
+func artifactKey(spec string) string {
+	sum := sha256.Sum256([]byte(spec))
+	return hex.EncodeToString(sum[:8])
+}
+
+// uploadArtifacts publishes the artifacts compiled into dir for spec.
+func uploadArtifacts(ctx context.Context, dir string, spec CircuitSpec) error {
+	key := artifactKey(spec.String())
+	for _, name := range artifactFiles {
+		if err := putBlobFile(ctx, blobKey(key, name), filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("uploading %s: %v", name, err)
+		}
+	}
+	slog.InfoContext(ctx, "Published circuit artifacts", "spec", spec, "object", artifactStore.URL(blobKey(key)))
+	return nil
+}
+
+// cachedArtifacts returns the local directory holding spec's artifacts,
+// downloading them on first use.
+func cachedArtifacts(spec string) (string, error) {
+	artifactMutex.Lock()
+	defer artifactMutex.Unlock()
+
+	key := artifactKey(spec)
+	dir := filepath.Join(artifactCacheDir, key)
+	if _, err := os.Stat(filepath.Join(dir, "pk")); err == nil {
+		now := time.Now()
+		return dir, os.Chtimes(dir, now, now)
+	}
+
+	tmp := dir + ".partial"
+	if err := os.MkdirAll(tmp, os.ModePerm); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	start := time.Now()
+	for _, name := range artifactFiles {
+		if err := getBlobFile(context.Background(), blobKey(key, name), filepath.Join(tmp, name)); err != nil {
+			return "", fmt.Errorf("downloading %s: %v", name, err)
+		}
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	slog.Info("Downloaded circuit artifacts", "key", key, "duration_ms", time.Since(start).Milliseconds())
+	evictArtifacts(key)
+	return dir, nil
+}
+
+// evictArtifacts removes the least recently used cached specs, other than
+// keep, until the cache fits artifactCacheBytes.
+func evictArtifacts(keep string) {
+	entries, err := os.ReadDir(artifactCacheDir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		dir  string
+		used time.Time
+		size int64
+	}
+	var all []cached
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(artifactCacheDir, e.Name())
+		var size int64
+		filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				size += fi.Size()
+			}
+			return nil
+		})
+		total += size
+		if e.Name() != keep {
+			all = append(all, cached{dir, info.ModTime(), size})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].used.Before(all[j].used) })
+	for _, c := range all {
+		if total <= int64(artifactCacheBytes) {
+			return
+		}
+		if err := os.RemoveAll(c.dir); err != nil {
+			slog.Error("Error evicting cached circuit artifacts", "dir", c.dir, "err", err)
+			continue
+		}
+		total -= c.size
+		slog.Info("Evicted cached circuit artifacts", "dir", c.dir)
+	}
+}
+
+// loadArtifacts reads the compiled circuit and proving key for spec,
+// downloading them if this node did not compile the circuit itself.
+func loadArtifacts(spec string) (constraint.ConstraintSystem, plonk.ProvingKey, error) {
+	dir, err := cachedArtifacts(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	ccs, err := sdk.ReadCircuitFrom(filepath.Join(dir, "compiledCircuit"))
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := sdk.ReadPkFrom(filepath.Join(dir, "pk"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ccs, pk, nil
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// API key scopes. A key with ScopeAdmin may call everything.
+const (
+	ScopePrepare = "prepare"
+	ScopeSubmit  = "submit"
+	ScopeRead    = "read"
+	ScopeAdmin   = "admin"
+)
+
+var apiScopes = []string{ScopePrepare, ScopeSubmit, ScopeRead, ScopeAdmin}
+
+// API key environments. A key bound to one may only read from and deliver
+// to the served chains of that kind; a key with none may use any.
+const (
+	EnvTestnet = "testnet"
+	EnvMainnet = "mainnet"
+)
+
+func checkEnvironment(env string) error {
+	switch env {
+	case "", EnvTestnet, EnvMainnet:
+		return nil
+	}
+	return fmt.Errorf("unknown environment %q, want %s or %s", env, EnvTestnet, EnvMainnet)
+}
+
+// APIKeyConfig grants a named key scopes. The key is given either as is or
+// as the hex SHA-256 of it, so config files need not hold the secret. Limits
+// left zero keep the defaults.
+type APIKeyConfig struct {
+	Name      string   `json:"name"`
+	Key       string   `json:"key,omitempty"`
+	KeySHA256 string   `json:"key_sha256,omitempty"`
+	Scopes    []string `json:"scopes"`
+	// Environment binds the key to testnet or mainnet chains.
+	Environment string `json:"environment,omitempty"`
+	clientLimits
+}
+
+// apiKey is a key callers authenticate with, as found by its hash.
+type apiKey struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Environment string   `json:"environment,omitempty"`
+}
+
+func (k apiKey) allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// configKeys are the keys of config.APIKeys or BREVIS_API_KEYS, by hash.
+var configKeys = map[string]apiKey{}
+
+const apiKeySchema = `CREATE TABLE IF NOT EXISTS api_keys (
+	name TEXT PRIMARY KEY,
+	key_sha256 TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	revoked_at TEXT NOT NULL DEFAULT ''
+)`
+
+// authEnabled is set once any key is configured or stored. Until then the
+// server stays open, as it was before keys existed, except for /admin/*:
+// the first admin key must come from config, not be minted by whoever asks
+// first.
+var authEnabled atomic.Bool
+
+// loadAPIKeys reads config.APIKeys, or BREVIS_API_KEYS, a JSON array of the
+// same form, when set, and creates the request store's key and tenant
+// settings tables. It runs after loadRequestStore.
+func loadAPIKeys() error {
+	list := config.APIKeys
+	if v := os.Getenv("BREVIS_API_KEYS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &list); err != nil {
+			return fmt.Errorf("invalid BREVIS_API_KEYS: %v", err)
+		}
+	}
+	configKeys, keyLimits = map[string]apiKey{}, map[string]clientLimits{}
+	for _, c := range list {
+		if c.Name == "" {
+			return fmt.Errorf("API key requires a name")
+		}
+		if err := checkScopes(c.Scopes); err != nil {
+			return fmt.Errorf("API key %s: %v", c.Name, err)
+		}
+		if err := checkEnvironment(c.Environment); err != nil {
+			return fmt.Errorf("API key %s: %v", c.Name, err)
+		}
+		hash := strings.ToLower(c.KeySHA256)
+		switch {
+		case c.Key != "" && hash == "":
+			hash = hashAPIKey(c.Key)
+		case c.Key == "" && len(hash) == 2*sha256.Size:
+			if _, err := hex.DecodeString(hash); err != nil {
+				return fmt.Errorf("API key %s: invalid key_sha256: %v", c.Name, err)
+			}
+		default:
+			return fmt.Errorf("API key %s requires one of key or a 32-byte hex key_sha256", c.Name)
+		}
+		if l := c.clientLimits; l.RateLimit < 0 || l.RateBurst < 0 || l.DailyProofs < 0 || l.MonthlyProofs < 0 ||
+			l.DailySpend != nil && l.DailySpend.Sign() < 0 || l.MonthlySpend != nil && l.MonthlySpend.Sign() < 0 {
+			return fmt.Errorf("API key %s: limits must not be negative", c.Name)
+		}
+		configKeys[hash] = apiKey{Name: c.Name, Scopes: c.Scopes, Environment: c.Environment}
+		keyLimits[c.Name] = c.clientLimits
+	}
+	enabled := len(configKeys) > 0
+
+	if requestDB != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := requestDB.ExecContext(ctx, apiKeySchema); err != nil {
+			return fmt.Errorf("creating API key table: %v", err)
+		}
+		if _, err := requestDB.ExecContext(ctx, "SELECT environment FROM api_keys LIMIT 0"); err != nil {
+			if _, err := requestDB.ExecContext(ctx, "ALTER TABLE api_keys ADD COLUMN environment TEXT NOT NULL DEFAULT ''"); err != nil {
+				return fmt.Errorf("adding API key column environment: %v", err)
+			}
+		}
+		if _, err := requestDB.ExecContext(ctx, tenantSettingsSchema); err != nil {
+			return fmt.Errorf("creating tenant settings table: %v", err)
+		}
+		var stored int
+		if err := requestDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_keys WHERE revoked_at = ''").Scan(&stored); err != nil {
+			return fmt.Errorf("reading API keys: %v", err)
+		}
+		enabled = enabled || stored > 0
+	}
+	authEnabled.Store(enabled)
+	if !enabled {
+		slog.Warn("No API keys configured; every endpoint but /admin/* is open. Configure an admin key in api_keys or BREVIS_API_KEYS to use /admin/*")
+	}
+	return nil
+}
+
+func checkScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required, from %v", apiScopes)
+	}
+	for _, s := range scopes {
+		if !slices.Contains(apiScopes, s) {
+			return fmt.Errorf("unknown scope %q, want one of %v", s, apiScopes)
+		}
+	}
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey finds the key presented, in config first, then in the store.
+func lookupAPIKey(ctx context.Context, key string) (apiKey, bool, error) {
+	hash := hashAPIKey(key)
+	for h, k := range configKeys {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			return k, true, nil
+		}
+	}
+	if requestDB == nil {
+		return apiKey{}, false, nil
+	}
+	var k apiKey
+	var scopes string
+	err := requestDB.QueryRowContext(ctx, "SELECT name, scopes, environment FROM api_keys WHERE key_sha256 = $1 AND revoked_at = ''", hash).Scan(&k.Name, &scopes, &k.Environment)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiKey{}, false, nil
+	}
+	if err != nil {
+		return apiKey{}, false, err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+	return k, true, nil
+}
+
+// routeScope is the scope a request needs, or "" for health checks and
+// metrics, which stay open to probes and scrapers.
+func routeScope(r *http.Request) string {
+	switch p := r.URL.Path; {
+	case p == "/status" || p == "/metrics" || p == "/healthz" || p == "/readyz" || p == "/openapi.json":
+		return ""
+	case strings.HasPrefix(p, "/admin/"):
+		return ScopeAdmin
+	case p == "/prepare-download":
+		return ScopePrepare
+	case p == "/submit-proof" || p == "/submit-proofs" || p == "/ws" || p == "/negative-test" || p == "/canary/prove",
+		r.Method == http.MethodDelete && strings.HasPrefix(p, "/jobs/"),
+		r.Method == http.MethodPost && strings.HasPrefix(p, "/requests/"):
+		return ScopeSubmit
+	}
+	return ScopeRead
+}
+
+// presentedKey is the key of an Authorization: Bearer or X-API-Key header.
+func presentedKey(r *http.Request) string {
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+type apiKeyNameKey struct{}
+
+// withAPIKeyName tags ctx, and every line logged with it, with the name of
+// the key a request came with.
+func withAPIKeyName(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, apiKeyNameKey{}, name)
+}
+
+type apiKeyAdminKey struct{}
+
+type apiKeyEnvironmentKey struct{}
+
+// withAPIKey tags ctx with the name of key k, whether it is an admin key
+// and the environment it is bound to.
+func withAPIKey(ctx context.Context, k apiKey) context.Context {
+	ctx = withAPIKeyName(ctx, k.Name)
+	if k.allows(ScopeAdmin) {
+		ctx = context.WithValue(ctx, apiKeyAdminKey{}, true)
+	}
+	if k.Environment != "" {
+		ctx = context.WithValue(ctx, apiKeyEnvironmentKey{}, k.Environment)
+	}
+	return ctx
+}
+
+// checkKeyEnvironment refuses, with 403, chains outside the environment the
+// key ctx carries is bound to, so that a testnet key cannot spend mainnet
+// fees and a mainnet key cannot mix testnet data into its results.
+func checkKeyEnvironment(ctx context.Context, opts submitOptions) error {
+	env, _ := ctx.Value(apiKeyEnvironmentKey{}).(string)
+	if env == "" {
+		return nil
+	}
+	for _, id := range []uint64{opts.SrcChainID, opts.DstChainID} {
+		c, err := chainFor(id)
+		if err != nil {
+			return err
+		}
+		if c.Mainnet != (env == EnvMainnet) {
+			return &statusError{http.StatusForbidden, fmt.Errorf("chain %d is not a %s chain; API key %s is bound to %s", id, env, apiKeyName(ctx), env)}
+		}
+	}
+	return nil
+}
+
+// mayActOn reports whether the caller ctx carries may act on what the key
+// named owner made: a key on its own, an admin key on anyone's. Without
+// auth every caller may.
+func mayActOn(ctx context.Context, owner string) bool {
+	if !authEnabled.Load() {
+		return true
+	}
+	return isAdmin(ctx) || apiKeyName(ctx) == owner
+}
+
+// isAdmin reports whether ctx carries an admin key.
+func isAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(apiKeyAdminKey{}).(bool)
+	return admin
+}
+
+// apiKeyName is the key name ctx is tagged with, or "".
+func apiKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+// withAPIKeys admits requests carrying a key with the route's scope once
+// auth is enabled, tagging them with the key's name. Until then admin
+// routes are refused.
+func withAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := routeScope(r)
+		// CORS preflights carry no credentials.
+		if scope == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !authEnabled.Load() {
+			if scope == ScopeAdmin {
+				http.Error(w, "Admin endpoints are closed until an admin API key is configured in api_keys or BREVIS_API_KEYS", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := presentedKey(r)
+		if key == "" && sharedRoute(r) {
+			// The handler decides, by the request's visibility.
+			next.ServeHTTP(w, r)
+			return
+		}
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "API key required; send Authorization: Bearer <key>", http.StatusUnauthorized)
+			return
+		}
+		k, ok, err := lookupAPIKey(r.Context(), key)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error looking up API key", "err", err)
+			http.Error(w, "Error checking API key", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if !k.allows(scope) {
+			http.Error(w, fmt.Sprintf("API key %s lacks scope %q", k.Name, scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAPIKey(r.Context(), k)))
+	})
+}
+
+// storedAPIKey is a key of the store as GET /admin/api-keys lists it.
+type storedAPIKey struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Environment string   `json:"environment,omitempty"`
+	Created     string   `json:"created"`
+	Revoked     string   `json:"revoked,omitempty"`
+}
+
+// handleAdminAPIKeys lists the store's keys on GET. POST creates a key
+// named name with the comma-separated scopes, bound to environment if
+// given, and returns it; this is the only time the key is shown. POST with
+// revoke=true revokes name instead.
+func handleAdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store to keep API keys in; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Get("revoke") == "true":
+		res, err := requestDB.ExecContext(r.Context(), "UPDATE api_keys SET revoked_at = $1 WHERE name = $2 AND revoked_at = ''",
+			time.Now().UTC().Format(storeTimeLayout), q.Get("name"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error revoking API key: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, fmt.Sprintf("No active API key %q", q.Get("name")), http.StatusNotFound)
+			return
+		}
+		slog.InfoContext(r.Context(), "Revoked API key", "name", q.Get("name"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost:
+		name, scopes, env := q.Get("name"), strings.Split(q.Get("scopes"), ","), q.Get("environment")
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if err := checkScopes(scopes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkEnvironment(env); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			http.Error(w, fmt.Sprintf("Error generating API key: %v", err), http.StatusInternalServerError)
+			return
+		}
+		key := "bk_" + hex.EncodeToString(secret)
+		_, err := requestDB.ExecContext(r.Context(), "INSERT INTO api_keys (name, key_sha256, scopes, created_at, environment) VALUES ($1, $2, $3, $4, $5)",
+			name, hashAPIKey(key), strings.Join(scopes, ","), time.Now().UTC().Format(storeTimeLayout), env)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating API key %q: %v", name, err), http.StatusConflict)
+			return
+		}
+		authEnabled.Store(true)
+		slog.InfoContext(r.Context(), "Created API key", "name", name, "scopes", scopes, "environment", env)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":        name,
+			"scopes":      scopes,
+			"environment": env,
+			"key":         key,
+		})
+
+	default:
+		rows, err := requestDB.QueryContext(r.Context(), "SELECT name, scopes, environment, created_at, revoked_at FROM api_keys ORDER BY created_at")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading API keys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		keys := []storedAPIKey{}
+		for rows.Next() {
+			var k storedAPIKey
+			var scopes string
+			if err := rows.Scan(&k.Name, &scopes, &k.Environment, &k.Created, &k.Revoked); err != nil {
+				http.Error(w, fmt.Sprintf("Error reading API keys: %v", err), http.StatusInternalServerError)
+				return
+			}
+			k.Scopes = strings.Split(scopes, ",")
+			keys = append(keys, k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": keys,
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// maxBatchRequests bounds the query sets of one /submit-proofs call.
+	maxBatchRequests = 100
+	// maxBatchBody bounds the /submit-proofs request body.
+	maxBatchBody = 8 << 20
+)
+
+// batchBody is the /submit-proofs request body: query sets, each the body
+// /submit-proof takes, proven under the spec and options of the query
+// string.
+type batchBody struct {
+	Requests []json.RawMessage `json:"requests" openapi:"QueryBody,required"`
+}
+
+// handleSubmitProofs queues a job for each query set in the body and
+// answers 202 with their IDs, in order. Every set is checked before any is
+// queued, and a batch that cannot be queued whole is not queued at all.
+//
+// The sets share the spec's compiled circuit and keys, which are prepared
+// once per spec. Nothing else is amortized: each job builds its own
+// BrevisApp, which holds that job's queried data, and is proven and
+// submitted on its own.
+func handleSubmitProofs(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON body of requests", http.StatusMethodNotAllowed)
+		return
+	}
+	if isDraining() {
+		http.Error(w, errDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBatchBody))
+	dec.DisallowUnknownFields()
+	var body batchBody
+	if err := dec.Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(body.Requests) == 0 || len(body.Requests) > maxBatchRequests {
+		http.Error(w, fmt.Sprintf("requests must hold 1 to %d query sets, got %d", maxBatchRequests, len(body.Requests)), http.StatusBadRequest)
+		return
+	}
+
+	subs := make([]*submission, len(body.Requests))
+	for i, raw := range body.Requests {
+		req := r.Clone(r.Context())
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+		sub, err := parseSubmission(req)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("request %d: %v", i, err), httpStatus(err))
+			return
+		}
+		subs[i] = sub
+	}
+
+	client := clientFor(r)
+	var queued []*job
+	// undo gives back what the batch took once part of it is refused.
+	undo := func() {
+		for _, j := range queued {
+			cancelJob(r.Context(), j.ID)
+			releaseProofQuota(r.Context(), client)
+		}
+	}
+	for i, sub := range subs {
+		if err := useProofQuota(r.Context(), client); err != nil {
+			undo()
+			setQuotaRetryAfter(w, r)
+			http.Error(w, fmt.Sprintf("request %d: %v", i, err), httpStatus(err))
+			return
+		}
+		j, err := enqueueJob(r.Context(), sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
+		if err != nil {
+			releaseProofQuota(r.Context(), client)
+			undo()
+			http.Error(w, fmt.Sprintf("request %d: %v", i, err), httpStatus(err))
+			return
+		}
+		queued = append(queued, j)
+	}
+
+	ids := make([]string, len(queued))
+	for i, j := range queued {
+		ids[i] = j.ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_ids": ids,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// blobStore is storage shared by every replica: compiled circuits, the SRS,
+// the exported job queue, and the witnesses and proofs jobs checkpoint all
+// go there, so another replica, or this one after a restart with an empty
+// disk, can pick them up. Keys are paths under artifactPrefix.
+type blobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get writes the object to w, or returns errBlobNotFound.
+	Get(ctx context.Context, key string, w io.WriterAt) error
+	Delete(ctx context.Context, key string) error
+	// URL names the object in logs.
+	URL(key string) string
+}
+
+var errBlobNotFound = errors.New("blob not found")
+
+// artifactStore is the store BREVIS_ARTIFACT_BUCKET names, or nil when
+// everything stays on local disk.
+var artifactStore blobStore
+
+// newBlobStore opens the bucket a BREVIS_ARTIFACT_BUCKET value names:
+// gs://name for Google Cloud Storage, s3://name or a bare name for S3.
+func newBlobStore(bucket string) (blobStore, error) {
+	switch {
+	case strings.HasPrefix(bucket, "gs://"):
+		return newGCSStore(strings.TrimPrefix(bucket, "gs://"))
+	case strings.HasPrefix(bucket, "s3://"):
+		return newS3Store(strings.TrimPrefix(bucket, "s3://"), "s3")
+	case strings.Contains(bucket, "://"):
+		return nil, fmt.Errorf("unsupported artifact bucket %q, want s3:// or gs://", bucket)
+	}
+	return newS3Store(bucket, "s3")
+}
+
+// blobKey joins parts under artifactPrefix.
+func blobKey(parts ...string) string {
+	return path.Join(append([]string{artifactPrefix}, parts...)...)
+}
+
+// s3Store keeps blobs in an S3 bucket, with the credentials and region of
+// the default AWS chain.
+type s3Store struct {
+	scheme     string
+	bucket     string
+	client     *s3.S3
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+}
+
+func newS3Store(bucket, scheme string, cfgs ...*aws.Config) (*s3Store, error) {
+	if bucket == "" {
+		return nil, errors.New("artifact bucket has no name")
+	}
+	sess, err := session.NewSession(cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{
+		scheme:     scheme,
+		bucket:     bucket,
+		client:     s3.New(sess),
+		uploader:   s3manager.NewUploader(sess),
+		downloader: s3manager.NewDownloader(sess),
+	}, nil
+}
+
+// newGCSStore keeps blobs in a Cloud Storage bucket through its
+// S3-compatible XML API, authenticated with the HMAC key in
+// BREVIS_GCS_HMAC_ACCESS_ID and BREVIS_GCS_HMAC_SECRET.
+func newGCSStore(bucket string) (*s3Store, error) {
+	id, secret := os.Getenv("BREVIS_GCS_HMAC_ACCESS_ID"), os.Getenv("BREVIS_GCS_HMAC_SECRET")
+	if id == "" || secret == "" {
+		return nil, errors.New("a gs:// artifact bucket needs BREVIS_GCS_HMAC_ACCESS_ID and BREVIS_GCS_HMAC_SECRET")
+	}
+	return newS3Store(bucket, "gs", &aws.Config{
+		Endpoint:         aws.String("https://storage.googleapis.com"),
+		Region:           aws.String("auto"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials(id, secret, ""),
+	})
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string, w io.WriterAt) error {
+	_, err := s.downloader.DownloadWithContext(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return errBlobNotFound
+	}
+	return err
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3Store) URL(key string) string {
+	return fmt.Sprintf("%s://%s/%s", s.scheme, s.bucket, key)
+}
+
+// getBlobFile downloads key to name, through a temporary file so a failed
+// download leaves nothing behind.
+func getBlobFile(ctx context.Context, key, name string) error {
+	tmp := name + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	err = artifactStore.Get(ctx, key, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// putBlobFile uploads the file name to key.
+func putBlobFile(ctx context.Context, key, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return artifactStore.Put(ctx, key, f)
+}
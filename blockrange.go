@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// blockRangeSlots is the storage allocation of a block range circuit, and so
+// the most blocks a range can be sampled at.
+const blockRangeSlots = 32
+
+// BlockRangeParams identify the storage slot holding a cumulative emissions
+// counter.
+type BlockRangeParams struct {
+	Contract common.Address `json:"contract"`
+	Slot     common.Hash    `json:"slot"`
+}
+
+func parseBlockRangeParams(q url.Values) (*BlockRangeParams, error) {
+	for _, name := range []string{"contract", "slot"} {
+		if q.Get(name) == "" {
+			return nil, fmt.Errorf("circuit %q requires %s", CircuitBlockRange, name)
+		}
+	}
+	contract, err := parseAddress("contract", q.Get("contract"))
+	if err != nil {
+		return nil, err
+	}
+	slot, err := parseSlotKey(q.Get("slot"))
+	if err != nil {
+		return nil, err
+	}
+	return &BlockRangeParams{Contract: contract, Slot: slot}, nil
+}
+
+// blockRange is the range a block range circuit samples its counter over:
+// at start, end and, when samples is above 2, evenly spaced blocks between.
+type blockRange struct {
+	start, end uint64
+	samples    int
+}
+
+// parseBlockRange reads start_block, end_block and samples.
+func parseBlockRange(q url.Values) (blockRange, error) {
+	rng := blockRange{samples: 2}
+	for name, block := range map[string]*uint64{"start_block": &rng.start, "end_block": &rng.end} {
+		v := q.Get(name)
+		if v == "" {
+			return rng, fmt.Errorf("circuit %q requires %s", CircuitBlockRange, name)
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return rng, fmt.Errorf("invalid %s %q: %v", name, v, err)
+		}
+		*block = n
+	}
+	if q.Get("samples") != "" {
+		var err error
+		if rng.samples, err = intParam(q, "samples"); err != nil {
+			return rng, err
+		}
+	}
+	return rng, nil
+}
+
+// queries samples the counter over rng, oldest first.
+func (p *BlockRangeParams) queries(rng blockRange) ([]sdk.StorageData, error) {
+	start, end, samples := rng.start, rng.end, rng.samples
+	if start == 0 || start >= end {
+		return nil, fmt.Errorf("start_block must be positive and below end_block, got %d and %d", start, end)
+	}
+	if samples < 2 || samples > blockRangeSlots {
+		return nil, fmt.Errorf("samples must be between 2 and %d, got %d", blockRangeSlots, samples)
+	}
+	if uint64(samples-1) > end-start {
+		return nil, fmt.Errorf("a range of %d blocks has fewer than %d blocks to sample", end-start+1, samples)
+	}
+
+	span := new(big.Int).SetUint64(end - start)
+	queries := make([]sdk.StorageData, samples)
+	for i := range queries {
+		offset := new(big.Int).Mul(span, big.NewInt(int64(i)))
+		offset.Div(offset, big.NewInt(int64(samples-1)))
+		queries[i] = sdk.StorageData{
+			BlockNum: offset.Add(offset, new(big.Int).SetUint64(start)),
+			Address:  p.Contract,
+			Slot:     p.Slot,
+		}
+	}
+	return queries, nil
+}
+
+// rangeQueries returns the storage queries of a block range spec, built from
+// the request instead of its body; other specs keep the body's queries.
+func rangeQueries(spec CircuitSpec, q url.Values, queries []sdk.StorageData) ([]sdk.StorageData, error) {
+	if spec.Circuit != CircuitBlockRange || len(queries) > 0 {
+		return sampledQueries(spec, blockRange{}, queries)
+	}
+	rng, err := parseBlockRange(q)
+	if err != nil {
+		return nil, err
+	}
+	return sampledQueries(spec, rng, queries)
+}
+
+// sampledQueries is rangeQueries over a range already read.
+func sampledQueries(spec CircuitSpec, rng blockRange, queries []sdk.StorageData) ([]sdk.StorageData, error) {
+	if spec.Circuit != CircuitBlockRange {
+		return queries, nil
+	}
+	if len(queries) > 0 {
+		return nil, fmt.Errorf("circuit %q queries its counter itself; give start_block and end_block instead of storage queries", CircuitBlockRange)
+	}
+	return spec.BlockRange.queries(rng)
+}
+
+// BlockRangeCircuit proves the amount emitted over a block range as the
+// change of a cumulative emissions counter between its start and end block.
+// Storage slots hold the counter at ascending blocks, the first at the start;
+// the counter must never decrease between them, so the last and largest
+// sample is the end.
+type BlockRangeCircuit struct {
+	BlockRangeParams
+}
+
+var _ sdk.AppCircuit = &BlockRangeCircuit{}
+
+func (c *BlockRangeCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return 0, blockRangeSlots, 0
+}
+
+func (c *BlockRangeCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u248 := api.Uint248
+	u32 := api.Uint32
+	contract := sdk.ConstUint248(c.Contract)
+	counterSlot := sdk.ConstFromBigEndianBytes(c.Slot[:])
+
+	slots := sdk.NewDataStream(api, in.StorageSlots)
+	u248.AssertIsLessOrEqual(sdk.ConstUint248(2), sdk.Count(slots))
+	sdk.AssertEach(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		return u248.And(
+			u248.IsEqual(slot.Contract, contract),
+			api.Bytes32.IsEqual(slot.Slot, counterSlot),
+		)
+	})
+	sdk.AssertSorted(slots, func(a, b sdk.StorageSlot) sdk.Uint248 {
+		return u248.And(
+			api.ToUint248(u32.IsLessThan(a.BlockNum, b.BlockNum)),
+			u248.Not(u248.IsGreaterThan(api.ToUint248(a.Value), api.ToUint248(b.Value))),
+		)
+	})
+
+	start := sdk.GetUnderlying(slots, 0)
+	startValue := api.ToUint248(start.Value)
+	endValue := sdk.Max(sdk.Map(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		return api.ToUint248(slot.Value)
+	}))
+	endBlock := sdk.Max(sdk.Map(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		return api.ToUint248(slot.BlockNum)
+	}))
+
+	api.OutputAddress(contract)
+	api.OutputBytes32(counterSlot)
+	api.OutputUint32(32, start.BlockNum)
+	api.OutputUint(32, endBlock)
+	api.OutputUint(248, startValue)
+	api.OutputUint(248, endValue)
+	api.OutputUint(248, u248.Sub(endValue, startValue))
+	return nil
+}
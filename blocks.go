@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	// blockTimes caches block timestamps per chain. Block times never change
+	// below the reorg horizon, and the search only caches blocks it reads.
+	blockTimes  = map[uint64]map[uint64]uint64{}
+	blockTimeMu sync.Mutex
+)
+
+// parseTimestamp accepts RFC 3339 or unix seconds.
+func parseTimestamp(s string) (uint64, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q: want RFC 3339 or unix seconds", s)
+	}
+	if t.Unix() < 0 {
+		return 0, fmt.Errorf("timestamp %q is before 1970", s)
+	}
+	return uint64(t.Unix()), nil
+}
+
+// resolveBlockByTimestamp returns the last block on chainID whose timestamp
+// is at or before ts, and that block's timestamp.
+func resolveBlockByTimestamp(ctx context.Context, chainID uint64, rpcURL string, ts uint64) (uint64, uint64, error) {
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return 0, 0, fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+
+	blockTime := func(n uint64) (uint64, error) {
+		blockTimeMu.Lock()
+		t, ok := blockTimes[chainID][n]
+		blockTimeMu.Unlock()
+		if ok {
+			return t, nil
+		}
+		header, err := ec.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return 0, fmt.Errorf("fetching block %d: %v", n, err)
+		}
+		blockTimeMu.Lock()
+		if blockTimes[chainID] == nil {
+			blockTimes[chainID] = map[uint64]uint64{}
+		}
+		blockTimes[chainID][n] = header.Time
+		blockTimeMu.Unlock()
+		return header.Time, nil
+	}
+
+	// The head moves, so it is read fresh rather than cached.
+	head, err := ec.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("fetching latest block: %v", err)
+	}
+	// A later block could still land at or before a future timestamp, so
+	// only timestamps the chain has already passed resolve.
+	if ts > head.Time {
+		return 0, 0, fmt.Errorf("timestamp %d is after the latest block %d (%d)", ts, head.Number, head.Time)
+	}
+	if ts == head.Time {
+		return head.Number.Uint64(), head.Time, nil
+	}
+	genesis, err := blockTime(0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ts < genesis {
+		return 0, 0, fmt.Errorf("timestamp %d is before the genesis block (%d)", ts, genesis)
+	}
+
+	// Invariant: time(lo) <= ts < time(hi).
+	lo, hi := uint64(0), head.Number.Uint64()
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		t, err := blockTime(mid)
+		if err != nil {
+			return 0, 0, err
+		}
+		if t <= ts {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	t, err := blockTime(lo)
+	return lo, t, err
+}
+
+func handleBlockByTimestamp(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	ts, err := parseTimestamp(r.URL.Query().Get("timestamp"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chain := activeProfile
+	if v := r.URL.Query().Get("chain_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chain_id %q: %v", v, err), http.StatusBadRequest)
+			return
+		}
+		if chain, err = chainFor(id); err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+	}
+	block, blockTs, err := resolveBlockByTimestamp(r.Context(), chain.ChainID, pickChainRPC(chain.ChainID), ts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error resolving block: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chain_id":        chain.ChainID,
+		"timestamp":       ts,
+		"block_number":    block,
+		"block_timestamp": blockTs,
+	})
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spendWindow is the fee spend of the service, or of one tenant, in one
+// budget period.
+type spendWindow struct {
+	// Tenant is the API key a tenant's window counts; it is empty for the
+	// service's.
+	Tenant string    `json:"tenant,omitempty"`
+	Period string    `json:"period"`
+	Cap    *big.Int  `json:"cap,omitempty"`
+	Spent  *big.Int  `json:"spent"`
+	Start  time.Time `json:"start"`
+}
+
+// spendCaps cap the Brevis fees of every request this service prepares, in
+// the fee token's smallest unit, by period. API keys can cap their own
+// spend below them with daily_spend_cap and monthly_spend_cap. Spend is
+// counted in the request store, shared by every replica and kept across
+// restarts; without one it is kept in memory.
+var spendCaps = map[string]*big.Int{}
+
+// heldJobCheck is how often held jobs are checked against the budget.
+var heldJobCheck = time.Minute
+
+// loadSpendCaps reads BREVIS_DAILY_SPEND_CAP and BREVIS_MONTHLY_SPEND_CAP
+// and creates the request store's usage table. Unset leaves the period
+// unlimited. It runs after loadAPIKeys.
+func loadSpendCaps() error {
+	spendCaps = map[string]*big.Int{}
+	for _, period := range usagePeriods {
+		name := "BREVIS_" + strings.ToUpper(period) + "_SPEND_CAP"
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		c, ok := new(big.Int).SetString(v, 10)
+		if !ok || c.Sign() < 0 {
+			return fmt.Errorf("invalid %s %q: want an amount in the fee token's smallest unit", name, v)
+		}
+		spendCaps[period] = c
+		slog.Info("Capping spend", "period", period, "cap", c.String(), "fee_token", activeProfile.FeeToken)
+	}
+	var err error
+	if heldJobCheck, err = envDuration("BREVIS_HELD_JOB_CHECK", heldJobCheck); err != nil {
+		return err
+	}
+	if heldJobCheck <= 0 {
+		return fmt.Errorf("BREVIS_HELD_JOB_CHECK must be positive, got %s", heldJobCheck)
+	}
+	return createUsageTable()
+}
+
+// periodStart is when the daily or monthly period holding t began, in UTC.
+func periodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == "daily" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// periodEnd is when the period beginning at start ends.
+func periodEnd(period string, start time.Time) time.Time {
+	if period == "daily" {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// spendCap is the cap of tenant's spend in period, or of the service's when
+// tenant is empty, or nil when it is unlimited.
+func spendCap(tenant, period string) *big.Int {
+	if tenant == "" {
+		return spendCaps[period]
+	}
+	l := limitsFor(tenant)
+	if period == "daily" {
+		return l.DailySpend
+	}
+	return l.MonthlySpend
+}
+
+// budgetScopes are the budgets tenant's proofs are counted against: the
+// service's, and the tenant's own when it has one.
+func budgetScopes(tenant string) []string {
+	if tenant == "" {
+		return []string{""}
+	}
+	return []string{"", tenant}
+}
+
+// spendWindows reads tenant's spend, or the service's, in the current
+// periods.
+func spendWindows(ctx context.Context, tenant string) ([]spendWindow, error) {
+	now := time.Now()
+	var windows []spendWindow
+	for _, period := range usagePeriods {
+		k := newUsageKey(usageSpend, tenant, period, now)
+		spent, err := readUsage(ctx, k)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s spend: %v", period, err)
+		}
+		windows = append(windows, spendWindow{Tenant: tenant, Period: period, Cap: spendCap(tenant, period), Spent: spent, Start: k.start})
+	}
+	return windows, nil
+}
+
+func (sw spendWindow) spent() bool {
+	return sw.Cap != nil && sw.Spent.Cmp(sw.Cap) >= 0
+}
+
+func (sw spendWindow) String() string {
+	if sw.Tenant == "" {
+		return sw.Period + " spend cap"
+	}
+	return fmt.Sprintf("%s spend cap of key %s", sw.Period, sw.Tenant)
+}
+
+// checkBudget refuses tenant's jobs once any period's cap, the service's or
+// the tenant's, is spent, to hold them rather than queue them. It reserves
+// nothing; attempts reserve their expected fee with reserveBudget as they
+// start.
+func checkBudget(ctx context.Context, tenant string) error {
+	for _, scope := range budgetScopes(tenant) {
+		windows, err := spendWindows(ctx, scope)
+		if err != nil {
+			return err
+		}
+		for _, sw := range windows {
+			if sw.spent() {
+				return &statusError{http.StatusTooManyRequests, fmt.Errorf("%s of %s %s is used up until %s", sw, sw.Cap, activeProfile.FeeToken, periodEnd(sw.Period, sw.Start).Format(time.RFC3339))}
+			}
+		}
+	}
+	return nil
+}
+
+// budgetReservation is the expected fee of one proof attempt, counted
+// against the capped periods of its tenant's budget and the service's from
+// before the attempt runs until its request's fee is known. Attempts that
+// start together therefore cannot all pass a cap that none of them has
+// recorded spend against yet.
+type budgetReservation struct {
+	keys   []usageKey
+	amount *big.Int
+}
+
+type budgetReservationKey struct{}
+
+// withBudgetReservation has the first proof attempt run under ctx count its
+// fee against r instead of reserving its own.
+func withBudgetReservation(ctx context.Context, r *budgetReservation) context.Context {
+	return context.WithValue(ctx, budgetReservationKey{}, r)
+}
+
+// expectedFee is what an attempt of spec on chainID is reserved for: the
+// median fee of recent attempts of the spec, or of its stored requests, and
+// at least 1 so that a spent cap refuses it.
+func expectedFee(ctx context.Context, spec CircuitSpec, chainID uint64) *big.Int {
+	if n, _, median := sampleMedians(spec); n > 0 && median.Sign() > 0 {
+		return median
+	}
+	if n, median, err := storedFeeMedian(ctx, spec, chainID); err == nil && n > 0 && median.Sign() > 0 {
+		return median
+	}
+	return big.NewInt(1)
+}
+
+// reserveBudget counts amount against every capped period of tenant's
+// budget and the service's, and refuses with 429, reserving nothing, when
+// one has no room for it.
+//
+// Reservations bound how far spend passes a cap: by at most how much the
+// fees of the attempts reserved at once exceed their estimates.
+func reserveBudget(ctx context.Context, tenant string, amount *big.Int) (*budgetReservation, error) {
+	r := &budgetReservation{amount: amount}
+	now := time.Now()
+	for _, scope := range budgetScopes(tenant) {
+		for _, period := range usagePeriods {
+			c := spendCap(scope, period)
+			if c == nil {
+				continue
+			}
+			k := newUsageKey(usageSpend, scope, period, now)
+			_, ok, err := addUsage(ctx, k, amount, c)
+			if err == nil && !ok {
+				sw := spendWindow{Tenant: scope, Period: period, Cap: c, Start: k.start}
+				err = &statusError{http.StatusTooManyRequests, fmt.Errorf("%s of %s %s has no room for an attempt's expected fee of %s until %s", sw, c, activeProfile.FeeToken, amount, periodEnd(period, k.start).Format(time.RFC3339))}
+			}
+			if err != nil {
+				r.release(ctx)
+				return nil, err
+			}
+			r.keys = append(r.keys, k)
+		}
+	}
+	return r, nil
+}
+
+// take removes k from the reservation, reporting whether it held it.
+func (r *budgetReservation) take(k usageKey) bool {
+	if r == nil {
+		return false
+	}
+	for i, held := range r.keys {
+		if held == k {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release gives back what r still holds, such as when its attempt fails
+// before preparing a request.
+func (r *budgetReservation) release(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	// Given back even when the attempt's context has ended.
+	ctx = context.WithoutCancel(ctx)
+	for _, k := range r.keys {
+		if err := subtractUsage(ctx, k, r.amount); err != nil {
+			slog.ErrorContext(ctx, "Error releasing reserved spend; it stays counted until the period ends", "period", k.period, "tenant", k.client, "amount", r.amount.String(), "err", err)
+		}
+	}
+	r.keys = nil
+}
+
+// recordSpend counts a prepared request's fee in every period of the
+// service's budget and of the budget of the tenant whose key ctx carries,
+// in place of what r reserved for it, and alerts when it takes one to its
+// cap. Only the replica whose fee crosses the cap alerts.
+//
+// Brevis fees are the service's only spend: the request and fulfillment
+// transactions are paid by the caller and by Brevis, so there is no gas to
+// count.
+func recordSpend(ctx context.Context, fee *big.Int, r *budgetReservation) {
+	defer r.release(ctx)
+	now := time.Now()
+	for _, scope := range budgetScopes(apiKeyName(ctx)) {
+		for _, period := range usagePeriods {
+			k := newUsageKey(usageSpend, scope, period, now)
+			delta := new(big.Int).Set(fee)
+			if r.take(k) {
+				delta.Sub(delta, r.amount)
+			}
+			var total *big.Int
+			var err error
+			if delta.Sign() < 0 {
+				if err = subtractUsage(ctx, k, new(big.Int).Neg(delta)); err == nil {
+					total, err = readUsage(ctx, k)
+				}
+			} else {
+				total, _, err = addUsage(ctx, k, delta, nil)
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error recording spend; it is not counted against the budget", "period", period, "tenant", scope, "fee", fee.String(), "err", err)
+				continue
+			}
+			sw := spendWindow{Tenant: scope, Period: period, Cap: spendCap(scope, period), Spent: total, Start: k.start}
+			if sw.spent() && new(big.Int).Sub(total, delta).Cmp(sw.Cap) < 0 {
+				slog.ErrorContext(ctx, "ALERT: spend reached its cap; new jobs are held until the period ends", "period", period, "tenant", scope, "spent", total.String(), "cap", sw.Cap.String(), "fee_token", activeProfile.FeeToken, "until", periodEnd(period, k.start))
+			}
+		}
+	}
+}
+
+// budgetRetryAfter is how long until every period whose cap tenant's proofs
+// are refused for has reset.
+func budgetRetryAfter(ctx context.Context, tenant string) time.Duration {
+	var wait time.Duration
+	for _, scope := range budgetScopes(tenant) {
+		windows, err := spendWindows(ctx, scope)
+		if err != nil {
+			continue
+		}
+		for _, sw := range windows {
+			if sw.spent() {
+				wait = max(wait, time.Until(periodEnd(sw.Period, sw.Start)))
+			}
+		}
+	}
+	return wait
+}
+
+// handleAdminBudget reports the spend and cap of each period, the service's
+// and those of every key with caps of its own, and how many jobs are held.
+func handleAdminBudget(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	windows, err := spendWindows(r.Context(), "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tenants := map[string][]spendWindow{}
+	for name, l := range keyLimits {
+		if l.DailySpend == nil && l.MonthlySpend == nil {
+			continue
+		}
+		if tenants[name], err = spendWindows(r.Context(), name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	held, err := countHeldJobs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"fee_token": activeProfile.FeeToken,
+		"windows":   windows,
+		"tenants":   tenants,
+		"held_jobs": held,
+	})
+}
+
+// setRetryAfter tells a caller refused for budget when to retry.
+func setRetryAfter(w http.ResponseWriter, r *http.Request) {
+	if d := budgetRetryAfter(r.Context(), apiKeyName(r.Context())); d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+	}
+}
+
+// holdJob parks queued job j, which its tenant's budget or the service's
+// has no room for, until releaseHeldJobs finds room. A held job taken from
+// the Redis queue goes back to the queue's keeping, for runRedisJob to move
+// to the held list.
+func holdJob(ctx context.Context, j *job, reason error) {
+	jobsMutex.Lock()
+	if draining || j.setStatus(ctx, JobHeld) != nil {
+		jobsMutex.Unlock()
+		return
+	}
+	j.consumed = false
+	j.notify()
+	jobsMutex.Unlock()
+	if redisQueue == nil {
+		saveJobState(j)
+	}
+	slog.WarnContext(ctx, "Holding job until the budget allows it", "job", j.ID, "reason", reason)
+}
+
+// releaseHeldJobs requeues held jobs, oldest first, as their budgets allow,
+// checking every heldJobCheck.
+func releaseHeldJobs(ctx context.Context) {
+	ticker := time.NewTicker(heldJobCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if isDraining() {
+			continue
+		}
+		if redisQueue != nil {
+			if err := releaseRedisHeld(ctx); err != nil {
+				slog.Error("Error releasing held jobs", "err", err)
+			}
+			continue
+		}
+		releaseLocalHeld(ctx)
+	}
+}
+
+// releaseLocalHeld requeues the held jobs of the in-process queue that the
+// budget has room for, while the queue does.
+func releaseLocalHeld(ctx context.Context) {
+	jobsMutex.Lock()
+	var held []*job
+	for _, j := range jobs {
+		if j.Status == JobHeld {
+			held = append(held, j)
+		}
+	}
+	jobsMutex.Unlock()
+	sort.Slice(held, func(i, k int) bool { return held[i].Created.Before(held[k].Created) })
+
+	for _, j := range held {
+		if checkBudget(ctx, j.APIKey) != nil {
+			continue
+		}
+		jobsMutex.Lock()
+		if draining || j.setStatus(ctx, JobQueued) != nil {
+			jobsMutex.Unlock()
+			continue
+		}
+		select {
+		case jobQueue <- j:
+		default:
+			// Full; the rest wait for the next check.
+			j.setStatus(ctx, JobHeld)
+			jobsMutex.Unlock()
+			return
+		}
+		j.notify()
+		jobsMutex.Unlock()
+		saveJobState(j)
+		slog.InfoContext(withCorrelationID(ctx, j.CorrelationID), "Released held job", "job", j.ID)
+	}
+}
+
+// countHeldJobs counts the jobs held for budget.
+func countHeldJobs(ctx context.Context) (int64, error) {
+	if redisQueue != nil {
+		return redisQueue.LLen(ctx, redisHeldKey).Result()
+	}
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	var n int64
+	for _, j := range jobs {
+		if j.Status == JobHeld {
+			n++
+		}
+	}
+	return n, nil
+}
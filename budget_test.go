@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReserveBudgetBoundsConcurrentAttempts(t *testing.T) {
+	defer func(caps map[string]*big.Int) { spendCaps = caps }(spendCaps)
+	spendCaps = map[string]*big.Int{"daily": big.NewInt(10)}
+	usageMutex.Lock()
+	localUsage = map[usageKey]*big.Int{}
+	usageMutex.Unlock()
+	ctx := context.Background()
+	daily := newUsageKey(usageSpend, "", "daily", time.Now())
+
+	first, err := reserveBudget(ctx, "", big.NewInt(6))
+	if err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+	// A second attempt starting before the first records its fee finds the
+	// cap taken by the reservation.
+	if _, err := reserveBudget(ctx, "", big.NewInt(6)); httpStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("second reservation: got %v, want a 429", err)
+	}
+
+	// The fee replaces the reservation.
+	recordSpend(ctx, big.NewInt(5), first)
+	if spent, _ := readUsage(ctx, daily); spent.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("spent %s after recording a fee of 5, want 5", spent)
+	}
+	second, err := reserveBudget(ctx, "", big.NewInt(5))
+	if err != nil {
+		t.Fatalf("reservation within the cap: %v", err)
+	}
+	second.release(ctx)
+	if spent, _ := readUsage(ctx, daily); spent.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("spent %s after releasing a reservation, want 5", spent)
+	}
+}
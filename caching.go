@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// finishedMaxAge is how long a client may reuse a finished job, request or
+// proof without asking again. Finished results do not change.
+var finishedMaxAge = time.Hour
+
+// writeCachedJSON answers r with v as JSON under an ETag of its encoding,
+// or with 304 when r's If-None-Match already holds that tag. A finished
+// resource may be reused for finishedMaxAge; anything still changing must
+// be revalidated, which is cheap for pollers whose copy is current.
+// Responses are private since they belong to the caller's key.
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, v interface{}, finished bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if finished {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", int(finishedMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag or is "*".
+// Weak tags match their strong form, as RFC 9110 has If-None-Match compare
+// weakly.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// callbackSecret signs callback payloads. Without it /submit-proof
+	// refuses a callback_url.
+	callbackSecret  = ""
+	callbackRetries = 3
+	callbackTimeout = 10 * time.Second
+)
+
+// Callbacks carry the Unix time they were signed at, and an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with callbackSecret, as "sha256=<hex>".
+const (
+	callbackTimestampHeader = "X-Brevis-Timestamp"
+	callbackSignatureHeader = "X-Brevis-Signature"
+)
+
+// callbackPayload tells a submission's callback_url how it ended.
+type callbackPayload struct {
+	// Status is finalized, expired or failed.
+	Status        string    `json:"status"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Transaction   string    `json:"transaction,omitempty"`
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// loadCallbackSettings reads BREVIS_CALLBACK_SECRET, BREVIS_CALLBACK_RETRIES
+// and BREVIS_CALLBACK_TIMEOUT.
+func loadCallbackSettings() error {
+	callbackSecret = os.Getenv("BREVIS_CALLBACK_SECRET")
+	var err error
+	if callbackRetries, err = envInt("BREVIS_CALLBACK_RETRIES", callbackRetries); err != nil {
+		return err
+	}
+	if callbackTimeout, err = envDuration("BREVIS_CALLBACK_TIMEOUT", callbackTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newCallbackPayload describes how a submission's attempts ended.
+func newCallbackPayload(ctx context.Context, attempts []*proofAttempt, err error) callbackPayload {
+	p := callbackPayload{Status: RequestFailed, Attempts: len(attempts), CorrelationID: correlationID(ctx), Time: time.Now().UTC()}
+	if len(attempts) > 0 {
+		final := attempts[len(attempts)-1]
+		p.RequestID, p.Transaction = final.RequestID, final.Transaction
+		if err == nil {
+			switch final.Status {
+			case AttemptFulfilled:
+				p.Status = RequestFinalized
+			case AttemptExpired:
+				p.Status = RequestExpired
+				err = fmt.Errorf("Request %s expired unfulfilled after %d attempt(s)", final.RequestID, len(attempts))
+			}
+		}
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	return p
+}
+
+func signCallback(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(callbackSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverCallback posts p to url, retrying network errors and 5xx and 429
+// answers with exponential backoff.
+func deliverCallback(ctx context.Context, url string, p callbackPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding callback", "err", err)
+		return
+	}
+	client := &http.Client{Timeout: callbackTimeout}
+	for attempt := 1; attempt <= callbackRetries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(1<<(attempt-2)) * time.Second)
+		}
+		retry, err := postCallback(ctx, client, url, body)
+		if err == nil {
+			slog.InfoContext(ctx, "Delivered callback", "url", url, "status", p.Status, "request", p.RequestID, "attempt", attempt)
+			return
+		}
+		slog.ErrorContext(ctx, "Error delivering callback", "url", url, "request", p.RequestID, "attempt", attempt, "err", err)
+		if !retry {
+			return
+		}
+	}
+}
+
+// postCallback makes one delivery try, signed afresh, and reports whether a
+// failure is worth retrying.
+func postCallback(ctx context.Context, client *http.Client, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackTimestampHeader, timestamp)
+	req.Header.Set(callbackSignatureHeader, signCallback(timestamp, body))
+	if id := correlationID(ctx); id != "" {
+		req.Header.Set(correlationHeader, id)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+}
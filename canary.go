@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// canaryURL is a candidate deployment, such as a build against a newer
+	// brevis-sdk, that sampled submissions are also proven on. Empty
+	// disables canaries.
+	canaryURL = ""
+	// canaryPercent is the share of finalized submissions proven on the
+	// candidate too.
+	canaryPercent = 0.0
+	// canaryInterval replays the last canaried inputs on both sides on a
+	// schedule, so a quiet deployment still exercises the candidate. Zero
+	// disables it.
+	canaryInterval time.Duration
+	// canaryCandidate serves /canary/prove, making this deployment a
+	// candidate others can compare against.
+	canaryCandidate = false
+	canaryTimeout   = 15 * time.Minute
+)
+
+// maxCanaryResults is how many recent comparisons /admin/canary keeps.
+const maxCanaryResults = 100
+
+// canaryRequest is the inputs a candidate proves: the queries of one
+// submission, proven at the same blocks, for the same variant spec.
+type canaryRequest struct {
+	Spec     CircuitSpec       `json:"spec"`
+	Queries  []sdk.StorageData `json:"queries,omitempty"`
+	Receipts []receiptQuery    `json:"receipts,omitempty"`
+}
+
+// canaryProof is a candidate's answer to a canaryRequest.
+type canaryProof struct {
+	SDKVersion string        `json:"sdk_version"`
+	Output     hexutil.Bytes `json:"output"`
+	Timings    timings       `json:"timings"`
+}
+
+// canaryResult compares the baseline and candidate proofs of one input.
+type canaryResult struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Synthetic bool      `json:"synthetic,omitempty"`
+	Spec      string    `json:"spec"`
+	// Diverged is set when the outputs differ or the candidate failed.
+	Diverged          bool          `json:"diverged"`
+	BaselineSDK       string        `json:"baseline_sdk"`
+	CandidateSDK      string        `json:"candidate_sdk,omitempty"`
+	BaselineOutput    hexutil.Bytes `json:"baseline_output"`
+	CandidateOutput   hexutil.Bytes `json:"candidate_output,omitempty"`
+	BaselineProveMs   int64         `json:"baseline_prove_ms"`
+	CandidateProveMs  int64         `json:"candidate_prove_ms,omitempty"`
+	CandidateSlowdown float64       `json:"candidate_slowdown,omitempty"`
+	Error             string        `json:"error,omitempty"`
+}
+
+var (
+	canaryResults []canaryResult
+	// canaryLast is the most recently canaried input, replayed by the
+	// schedule.
+	canaryLast  *canaryRequest
+	canaryMutex sync.Mutex
+)
+
+// loadCanarySettings reads BREVIS_CANARY_URL, BREVIS_CANARY_PERCENT,
+// BREVIS_CANARY_INTERVAL, BREVIS_CANARY_TIMEOUT and BREVIS_CANARY_CANDIDATE.
+func loadCanarySettings() error {
+	canaryURL = os.Getenv("BREVIS_CANARY_URL")
+	if v := os.Getenv("BREVIS_CANARY_PERCENT"); v != "" {
+		var err error
+		if canaryPercent, err = strconv.ParseFloat(v, 64); err != nil || canaryPercent < 0 || canaryPercent > 100 {
+			return fmt.Errorf("invalid BREVIS_CANARY_PERCENT %q: want a number from 0 to 100", v)
+		}
+	}
+	var err error
+	if canaryInterval, err = envDuration("BREVIS_CANARY_INTERVAL", canaryInterval); err != nil {
+		return err
+	}
+	if canaryTimeout, err = envDuration("BREVIS_CANARY_TIMEOUT", canaryTimeout); err != nil {
+		return err
+	}
+	if canaryCandidate, err = envBool("BREVIS_CANARY_CANDIDATE", canaryCandidate); err != nil {
+		return err
+	}
+	if canaryURL == "" && (canaryPercent > 0 || canaryInterval > 0) {
+		return fmt.Errorf("BREVIS_CANARY_PERCENT and BREVIS_CANARY_INTERVAL require BREVIS_CANARY_URL")
+	}
+	if canaryURL != "" {
+		slog.Info("Canarying submissions", "percent", canaryPercent, "url", canaryURL)
+	}
+	return nil
+}
+
+// sdkVersion is the brevis-sdk version this binary was built with.
+func sdkVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, d := range info.Deps {
+		if d.Path == "github.com/brevis-network/brevis-sdk" {
+			if d.Replace != nil {
+				d = d.Replace
+			}
+			return d.Version
+		}
+	}
+	return "unknown"
+}
+
+// sampleCanary reports whether a finalized submission should be canaried.
+func sampleCanary() bool {
+	return canaryURL != "" && rand.Float64()*100 < canaryPercent
+}
+
+// runCanary proves the inputs of a finalized attempt on the candidate and
+// records how its output and timings compare.
+func runCanary(ctx context.Context, req canaryRequest, baseline *proofAttempt) {
+	canaryMutex.Lock()
+	canaryLast = &req
+	canaryMutex.Unlock()
+	recordCanary(ctx, compareCanary(ctx, req, baseline.RequestID, baseline.Output, baseline.Timings, false))
+}
+
+// replayCanaries proves the last canaried inputs on both sides every
+// canaryInterval.
+func replayCanaries(ctx context.Context) {
+	if canaryInterval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(canaryInterval):
+		}
+		canaryMutex.Lock()
+		req := canaryLast
+		canaryMutex.Unlock()
+		if req == nil {
+			continue
+		}
+		// Each replay is traced on its own.
+		replay := withCorrelationID(ctx, newJobID())
+		output, t, err := proveCanary(replay, *req)
+		if err != nil {
+			slog.ErrorContext(replay, "Error proving synthetic canary baseline", "err", err)
+			continue
+		}
+		recordCanary(replay, compareCanary(replay, *req, "", output, t, true))
+	}
+}
+
+func compareCanary(ctx context.Context, req canaryRequest, requestID string, output []byte, t timings, synthetic bool) canaryResult {
+	res := canaryResult{
+		Time:            time.Now().UTC(),
+		RequestID:       requestID,
+		Synthetic:       synthetic,
+		Spec:            req.Spec.String(),
+		BaselineSDK:     sdkVersion(),
+		BaselineOutput:  output,
+		BaselineProveMs: t.WitnessMs + t.ProveMs,
+	}
+	candidate, err := postCanary(ctx, req)
+	if err != nil {
+		res.Diverged, res.Error = true, err.Error()
+		return res
+	}
+	res.CandidateSDK, res.CandidateOutput = candidate.SDKVersion, candidate.Output
+	res.CandidateProveMs = candidate.Timings.WitnessMs + candidate.Timings.ProveMs
+	if res.BaselineProveMs > 0 {
+		res.CandidateSlowdown = float64(res.CandidateProveMs) / float64(res.BaselineProveMs)
+	}
+	if !bytes.Equal(output, candidate.Output) {
+		res.Diverged = true
+		res.Error = "outputs differ"
+	}
+	return res
+}
+
+// postCanary passes the correlation ID on, so the candidate's log lines for
+// the proof trace back here.
+func postCanary(ctx context.Context, req canaryRequest) (*canaryProof, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, canaryURL+"/canary/prove", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set(correlationHeader, correlationID(ctx))
+	client := &http.Client{Timeout: canaryTimeout}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("candidate answered %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var proof canaryProof
+	if err := json.NewDecoder(resp.Body).Decode(&proof); err != nil {
+		return nil, fmt.Errorf("decoding candidate answer: %v", err)
+	}
+	return &proof, nil
+}
+
+func recordCanary(ctx context.Context, res canaryResult) {
+	if res.Diverged {
+		slog.WarnContext(ctx, "Canary diverged", "spec", res.Spec, "request", res.RequestID, "err", res.Error)
+	}
+	canaryMutex.Lock()
+	defer canaryMutex.Unlock()
+	canaryResults = append(canaryResults, res)
+	if len(canaryResults) > maxCanaryResults {
+		canaryResults = canaryResults[len(canaryResults)-maxCanaryResults:]
+	}
+}
+
+// proveCanary proves req with its prepared circuit without submitting it.
+func proveCanary(ctx context.Context, req canaryRequest) ([]byte, timings, error) {
+	if findVariant(req.Spec) == nil {
+		return nil, timings{}, &statusError{http.StatusConflict, fmt.Errorf("circuit for spec %s is not prepared", req.Spec)}
+	}
+	rpcURL := pickRPC()
+	app, err := activeProfile.newBrevisApp(rpcURL, config.OutputDir)
+	if err != nil {
+		return nil, timings{}, fmt.Errorf("Error initializing BrevisApp: %v", err)
+	}
+	attempt := newProofAttempt()
+	if _, _, err := proveAttempt(ctx, app, rpcURL, req.Spec, req.Queries, req.Receipts, nil, attempt, nil); err != nil {
+		return nil, timings{}, err
+	}
+	return attempt.Output, attempt.Timings, nil
+}
+
+// handleCanaryProve proves a canaryRequest with this deployment's SDK and
+// prepared circuit and returns the output and timings. It is only served
+// with BREVIS_CANARY_CANDIDATE set.
+func handleCanaryProve(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if !canaryCandidate {
+		http.Error(w, "Not a canary candidate; set BREVIS_CANARY_CANDIDATE", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req canaryRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxQueryBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid canary request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Spec.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	output, t, err := proveCanary(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(canaryProof{SDKVersion: sdkVersion(), Output: output, Timings: t})
+}
+
+// handleAdminCanary lists the most recent canary comparisons, newest last.
+func handleAdminCanary(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	canaryMutex.Lock()
+	results := append([]canaryResult{}, canaryResults...)
+	canaryMutex.Unlock()
+	diverged := 0
+	for _, res := range results {
+		if res.Diverged {
+			diverged++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":         canaryURL,
+		"percent":     canaryPercent,
+		"interval":    canaryInterval.String(),
+		"sdk_version": sdkVersion(),
+		"diverged":    diverged,
+		"results":     results,
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ChainConfig registers a chain besides the profile's, to read queries from
+// or deliver results to. Settings left empty keep the profile's; the app
+// contract defaults to the chain's registered callback contract.
+type ChainConfig struct {
+	ChainID       uint64   `json:"chain_id"`
+	RPCURLs       []string `json:"rpc_urls"`
+	Mainnet       bool     `json:"mainnet,omitempty"`
+	FeeToken      string   `json:"fee_token,omitempty"`
+	AppContract   string   `json:"app_contract,omitempty"`
+	RefundAddress string   `json:"refund_address,omitempty"`
+	ExplorerURL   string   `json:"explorer_url,omitempty"`
+}
+
+// chains holds every chain this deployment serves, the profile's among
+// them, keyed by chain ID. Each shares the profile's gateway.
+var chains = map[uint64]Profile{}
+
+// loadChains registers the profile's chain and those of config.Chains, or of
+// BREVIS_CHAINS, a JSON array of the same form, when set.
+func loadChains(p Profile) error {
+	chains = map[uint64]Profile{p.ChainID: p}
+	list := config.Chains
+	if v := os.Getenv("BREVIS_CHAINS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &list); err != nil {
+			return fmt.Errorf("invalid BREVIS_CHAINS: %v", err)
+		}
+	}
+	for _, c := range list {
+		if c.ChainID == 0 || len(c.RPCURLs) == 0 {
+			return fmt.Errorf("chain %d requires chain_id and rpc_urls", c.ChainID)
+		}
+		if _, ok := chains[c.ChainID]; ok {
+			return fmt.Errorf("chain %d is configured twice", c.ChainID)
+		}
+		chain := Profile{
+			Name:          fmt.Sprintf("chain-%d", c.ChainID),
+			ChainID:       c.ChainID,
+			RPCURL:        c.RPCURLs[0],
+			GatewayURL:    p.GatewayURL,
+			Mainnet:       c.Mainnet,
+			FeeToken:      p.FeeToken,
+			AppContract:   contractRegistry[c.ChainID].Callback,
+			RefundAddress: p.RefundAddress,
+			ExplorerURL:   strings.TrimSuffix(c.ExplorerURL, "/"),
+		}
+		if c.FeeToken != "" {
+			chain.FeeToken = c.FeeToken
+		}
+		for name, setting := range map[string]struct {
+			value string
+			addr  *common.Address
+		}{
+			"app_contract":   {c.AppContract, &chain.AppContract},
+			"refund_address": {c.RefundAddress, &chain.RefundAddress},
+		} {
+			if setting.value == "" {
+				continue
+			}
+			if !common.IsHexAddress(setting.value) {
+				return fmt.Errorf("chain %d: invalid %s %q", c.ChainID, name, setting.value)
+			}
+			*setting.addr = common.HexToAddress(setting.value)
+		}
+		chains[c.ChainID] = chain
+		addRPCProviders(c.ChainID, c.RPCURLs)
+	}
+	return nil
+}
+
+// chainIDs lists the served chains in ascending order.
+func chainIDs() []uint64 {
+	ids := make([]uint64, 0, len(chains))
+	for id := range chains {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// chainFor returns a served chain, or a 400 naming the served ones.
+func chainFor(id uint64) (Profile, error) {
+	c, ok := chains[id]
+	if !ok {
+		return Profile{}, &statusError{http.StatusBadRequest, fmt.Errorf("chain %d is not supported; this deployment serves chains %v", id, chainIDs())}
+	}
+	return c, nil
+}
+
+// destinationFor returns a served chain that can take results: one with an
+// app contract and refund address.
+func destinationFor(id uint64) (Profile, error) {
+	c, err := chainFor(id)
+	if err != nil {
+		return c, err
+	}
+	if c.AppContract == (common.Address{}) || c.RefundAddress == (common.Address{}) {
+		return Profile{}, &statusError{http.StatusBadRequest, fmt.Errorf("chain %d has no app_contract and refund_address to deliver results to", id)}
+	}
+	return c, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// jobStateDir holds a directory per unfinished job with the job and the
+// stages its current attempt has completed, so a restarted process resumes
+// the job where it stopped. "off" keeps none.
+var jobStateDir = "./brevis-job-state"
+
+// Stages an attempt checkpoints, in order.
+const (
+	CheckpointFetched   = "fetched"
+	CheckpointWitness   = "witness"
+	CheckpointProven    = "proven"
+	CheckpointSubmitted = "submitted"
+)
+
+var checkpointOrder = map[string]int{CheckpointFetched: 1, CheckpointWitness: 2, CheckpointProven: 3, CheckpointSubmitted: 4}
+
+const (
+	jobStateFile     = "job.json"
+	attemptStateFile = "attempt.json"
+	witnessStateFile = "witness.bin"
+	proofStateFile   = "proof.bin"
+)
+
+// stageCheckpoint is what an attempt has completed: the data it fetched and
+// what it recorded of it, and, past CheckpointFetched, its witness and proof
+// in their own files.
+type stageCheckpoint struct {
+	Stage    string            `json:"stage"`
+	Attempt  proofAttempt      `json:"attempt"`
+	Storage  []sdk.StorageData `json:"storage,omitempty"`
+	Receipts []sdk.ReceiptData `json:"receipts,omitempty"`
+
+	witness witness.Witness
+	proof   plonk.Proof
+}
+
+// reached reports whether the attempt got past stage.
+func (c *stageCheckpoint) reached(stage string) bool {
+	return c != nil && checkpointOrder[c.Stage] >= checkpointOrder[stage]
+}
+
+// witnessAndProof returns what the attempt has of its witness and proof.
+func (c *stageCheckpoint) witnessAndProof() (witness.Witness, plonk.Proof) {
+	if c == nil {
+		return nil, nil
+	}
+	return c.witness, c.proof
+}
+
+// with returns a copy of attempt as it stands with timings t, to
+// checkpoint.
+func (a *proofAttempt) with(t timings) proofAttempt {
+	c := *a
+	c.Timings = t
+	return c
+}
+
+// loadJobStateDir reads BREVIS_JOB_STATE_DIR and creates it.
+func loadJobStateDir() error {
+	if v := os.Getenv("BREVIS_JOB_STATE_DIR"); v != "" {
+		jobStateDir = v
+	}
+	if jobStateDir == "off" {
+		return nil
+	}
+	return os.MkdirAll(jobStateDir, 0755)
+}
+
+type jobStateKey struct{}
+
+// withJobState has the attempts run under ctx checkpoint into the state of
+// job id.
+func withJobState(ctx context.Context, id string) context.Context {
+	if jobStateDir == "off" {
+		return ctx
+	}
+	return context.WithValue(ctx, jobStateKey{}, filepath.Join(jobStateDir, id))
+}
+
+// jobStatePath is the state directory ctx checkpoints into, or "" for
+// proofs not run by a job.
+func jobStatePath(ctx context.Context) string {
+	dir, _ := ctx.Value(jobStateKey{}).(string)
+	return dir
+}
+
+func writeFileAtomic(name string, b []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// saveJobState records j and what it needs to run, to be resumed if the
+// process stops before it finishes.
+func saveJobState(j *job) {
+	if jobStateDir == "off" {
+		return
+	}
+	dir := filepath.Join(jobStateDir, j.ID)
+	b, err := json.Marshal(jobCheckpoint{job: *j, CircuitSpec: j.spec, Queries: j.queries, Receipts: j.receipts, Pin: j.pin})
+	if err == nil {
+		if err = os.MkdirAll(dir, 0755); err == nil {
+			err = writeFileAtomic(filepath.Join(dir, jobStateFile), b)
+		}
+	}
+	if err != nil {
+		slog.Error("Error saving job state; the job will not resume after a restart", "job", j.ID, "err", err)
+	}
+}
+
+// removeJobState drops the state of a finished job.
+func removeJobState(id string) {
+	if jobStateDir == "off" {
+		return
+	}
+	dir := filepath.Join(jobStateDir, id)
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Error("Error removing job state", "job", id, "err", err)
+	}
+	deleteSharedState(context.Background(), dir)
+}
+
+// jobStateObject is where artifactStore keeps the file name of the job
+// state in dir. Only the attempt, witness and proof are shared: a replica
+// resuming a job another one exported from a drain, or that lost its disk,
+// picks them up from there instead of redoing the stages.
+func jobStateObject(dir, name string) string {
+	return blobKey("jobs", filepath.Base(dir), name)
+}
+
+// writeStateFile writes the file name of the job state in dir, sharing it
+// through artifactStore as well.
+func writeStateFile(ctx context.Context, dir, name string, b []byte) error {
+	if err := writeFileAtomic(filepath.Join(dir, name), b); err != nil {
+		return err
+	}
+	if artifactStore == nil {
+		return nil
+	}
+	if err := artifactStore.Put(ctx, jobStateObject(dir, name), bytes.NewReader(b)); err != nil {
+		return fmt.Errorf("sharing %s: %v", name, err)
+	}
+	return nil
+}
+
+// pullSharedState copies the shared attempt state of dir into it.
+func pullSharedState(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, name := range []string{witnessStateFile, proofStateFile, attemptStateFile} {
+		err := getBlobFile(ctx, jobStateObject(dir, name), filepath.Join(dir, name))
+		if err != nil && !errors.Is(err, errBlobNotFound) {
+			return fmt.Errorf("fetching shared %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// deleteSharedState drops the shared attempt state of dir.
+func deleteSharedState(ctx context.Context, dir string) {
+	if artifactStore == nil {
+		return
+	}
+	for _, name := range []string{attemptStateFile, witnessStateFile, proofStateFile} {
+		if err := artifactStore.Delete(ctx, jobStateObject(dir, name)); err != nil {
+			slog.ErrorContext(ctx, "Error removing shared job state", "object", artifactStore.URL(jobStateObject(dir, name)), "err", err)
+		}
+	}
+}
+
+// saveCheckpoint records that the attempt under ctx completed c.Stage,
+// first writing the witness or proof that stage produced. A failure is
+// logged: it only costs the work a restart would redo.
+func saveCheckpoint(ctx context.Context, c *stageCheckpoint) {
+	dir := jobStatePath(ctx)
+	if dir == "" {
+		return
+	}
+	err := func() error {
+		var blob io.WriterTo
+		var name string
+		switch c.Stage {
+		case CheckpointWitness:
+			blob, name = c.witness, witnessStateFile
+		case CheckpointProven:
+			blob, name = c.proof, proofStateFile
+		}
+		if blob != nil {
+			var buf bytes.Buffer
+			if _, err := blob.WriteTo(&buf); err != nil {
+				return err
+			}
+			if err := writeStateFile(ctx, dir, name, buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return writeStateFile(ctx, dir, attemptStateFile, b)
+	}()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checkpointing attempt", "stage", c.Stage, "err", err)
+		return
+	}
+	slog.DebugContext(ctx, "Checkpointed attempt", "stage", c.Stage)
+}
+
+// loadCheckpoint returns what the attempt under ctx completed before the
+// process last stopped, or nil to start afresh. With an artifact bucket, an
+// attempt checkpointed by another replica is picked up from there.
+func loadCheckpoint(ctx context.Context) (*stageCheckpoint, error) {
+	dir := jobStatePath(ctx)
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, attemptStateFile)); os.IsNotExist(err) && artifactStore != nil {
+		if err := pullSharedState(ctx, dir); err != nil {
+			return nil, err
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dir, attemptStateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c stageCheckpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", attemptStateFile, err)
+	}
+	if c.reached(CheckpointWitness) {
+		w, err := witness.New(ecc.BN254.ScalarField())
+		if err != nil {
+			return nil, err
+		}
+		if err := readStateFile(dir, witnessStateFile, w); err != nil {
+			return nil, err
+		}
+		c.witness = w
+	}
+	if c.reached(CheckpointProven) {
+		proof := plonk.NewProof(ecc.BN254)
+		if err := readStateFile(dir, proofStateFile, proof); err != nil {
+			return nil, err
+		}
+		c.proof = proof
+	}
+	return &c, nil
+}
+
+func readStateFile(dir, name string, into io.ReaderFrom) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := into.ReadFrom(f); err != nil {
+		return fmt.Errorf("reading %s: %v", name, err)
+	}
+	return nil
+}
+
+// clearCheckpoint forgets the stages of the attempt under ctx, once it has
+// ended and any next attempt starts afresh.
+func clearCheckpoint(ctx context.Context) {
+	dir := jobStatePath(ctx)
+	if dir == "" {
+		return
+	}
+	for _, name := range []string{attemptStateFile, witnessStateFile, proofStateFile} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			slog.ErrorContext(ctx, "Error clearing attempt checkpoint", "file", name, "err", err)
+		}
+	}
+	// The attempt may have ended because ctx did.
+	deleteSharedState(context.WithoutCancel(ctx), dir)
+}
+
+// recoverJobs requeues the jobs a previous process left unfinished in
+// jobStateDir, after restoreJobs has taken any drained queue. Each resumes
+// from the last stage its attempt checkpointed.
+func recoverJobs() error {
+	if jobStateDir == "off" {
+		return nil
+	}
+	entries, err := os.ReadDir(jobStateDir)
+	if err != nil {
+		return err
+	}
+	var recovered []*job
+	jobsMutex.Lock()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(jobStateDir, e.Name(), jobStateFile))
+		if err != nil {
+			slog.Warn("Skipping job state", "dir", e.Name(), "err", err)
+			continue
+		}
+		var c jobCheckpoint
+		if err := json.Unmarshal(b, &c); err != nil {
+			slog.Warn("Skipping job state", "dir", e.Name(), "err", err)
+			continue
+		}
+		// A job restored from a drain is already queued.
+		if _, ok := jobs[c.ID]; ok {
+			continue
+		}
+		j := c.job
+		j.spec, j.queries, j.receipts, j.pin = c.CircuitSpec, c.Queries, c.Receipts, c.Pin
+		if j.Status != JobQueued {
+			if err := j.setStatus(context.Background(), JobQueued); err != nil {
+				slog.Warn("Skipping job state", "dir", e.Name(), "err", err)
+				continue
+			}
+		}
+		j.Started, j.ETA = nil, nil
+		jobs[j.ID] = &j
+		recovered = append(recovered, &j)
+	}
+	jobsMutex.Unlock()
+	go func() {
+		for _, j := range recovered {
+			jobQueue <- j
+		}
+	}()
+	if len(recovered) > 0 {
+		slog.Info("Resuming jobs interrupted by a restart", "jobs", len(recovered))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/constraint"
+)
+
+// circuitHashFile in a variant directory holds the hash of the constraint
+// system compiled into it, which proofs are tagged with.
+const circuitHashFile = "circuit_hash"
+
+// circuitHash fingerprints the constraints of ccs: its variables, every
+// instruction and every coefficient. Debug info, which carries source
+// positions, is left out, so moving code around does not change it but
+// changing what the circuit asserts does.
+func circuitHash(ccs constraint.ConstraintSystem) string {
+	h := sha256.New()
+	internal, secret, public := ccs.GetNbVariables()
+	writeUints(h, uint64(internal), uint64(secret), uint64(public), uint64(ccs.GetNbConstraints()))
+	for i := 0; i < ccs.GetNbInstructions(); i++ {
+		inst := ccs.GetInstruction(i)
+		writeUints(h, uint64(inst.ConstraintOffset), uint64(inst.WireOffset), uint64(len(inst.Calldata)))
+		for _, c := range inst.Calldata {
+			writeUints(h, uint64(c))
+		}
+	}
+	for i := 0; i < ccs.GetNbCoefficients(); i++ {
+		c := ccs.GetCoefficient(i)
+		writeUints(h, c[:]...)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeUints(h hash.Hash, vs ...uint64) {
+	var b [8]byte
+	for _, v := range vs {
+		binary.BigEndian.PutUint64(b[:], v)
+		h.Write(b[:])
+	}
+}
+
+// definitionHashes caches definitionHash by spec, which a build's circuit
+// definitions fix.
+var definitionHashes sync.Map
+
+// definitionHash compiles spec's circuit as this build defines it, without
+// the setup, and returns its hash.
+func definitionHash(spec CircuitSpec) (string, error) {
+	if h, ok := definitionHashes.Load(spec.String()); ok {
+		return h.(string), nil
+	}
+	ccs, err := sdk.CompileOnly(spec.newCircuit())
+	if err != nil {
+		return "", err
+	}
+	h := circuitHash(ccs)
+	definitionHashes.Store(spec.String(), h)
+	return h, nil
+}
+
+// staleVariant returns why the variant compiled into dir for spec no longer
+// matches the circuit this build defines, or "".
+func staleVariant(dir string, spec CircuitSpec) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, circuitHashFile))
+	if err != nil {
+		return "", err
+	}
+	current, err := definitionHash(spec)
+	if err != nil {
+		return "", err
+	}
+	if compiled := strings.TrimSpace(string(b)); compiled != current {
+		return "circuit definition changed since compile: compiled " + compiled + ", now " + current, nil
+	}
+	return "", nil
+}
+
+// recompiling holds the specs recompileInBackground is compiling.
+var recompiling sync.Map
+
+// recompileInBackground starts compiling spec again, found stale on use,
+// unless that is already under way.
+func recompileInBackground(spec CircuitSpec) {
+	if _, busy := recompiling.LoadOrStore(spec.String(), true); busy {
+		return
+	}
+	go func() {
+		defer recompiling.Delete(spec.String())
+		recompileStale(context.Background(), []CircuitSpec{spec})
+	}()
+}
+
+// recompileStale compiles again the specs whose circuits changed since they
+// were prepared, one at a time.
+func recompileStale(ctx context.Context, specs []CircuitSpec) {
+	for _, spec := range specs {
+		slog.InfoContext(ctx, "Recompiling circuit changed since it was prepared", "spec", spec)
+		if _, err := prepareCircuit(ctx, spec); err != nil {
+			slog.ErrorContext(ctx, "Error recompiling changed circuit", "spec", spec, "err", err)
+		}
+	}
+}
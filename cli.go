@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// statusCommand lists the jobs a stopped server left unfinished, from its
+// job state, instead of starting one.
+const statusCommand = "status"
+
+// cliCommands run one operation with the same pipeline code the server
+// uses, without serving HTTP, once the server's settings are loaded. Their
+// parameters are /submit-proof's or /prepare-download's, given as
+// name=value arguments.
+var cliCommands = map[string]func(args []string) error{
+	"prove":   runProveCommand,
+	"compile": runCompileCommand,
+	"submit":  runSubmitCommand,
+}
+
+// runCLI runs a subcommand to completion, exiting on failure.
+func runCLI(cmd func(args []string) error, args []string) {
+	if err := cmd(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatal(err)
+	}
+}
+
+// cliContext ends on an interrupt, so a stopped command stops its proof.
+func cliContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(withCorrelationID(context.Background(), newJobID()), os.Interrupt, syscall.SIGTERM)
+}
+
+// cliFlags is the flag set of a subcommand, printing its usage on error.
+func cliFlags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n", filepath.Base(os.Args[0]), name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// cliRequest builds the request the server would have been sent for path:
+// params as its query and the file body, or standard input for "-", as its
+// body.
+func cliRequest(ctx context.Context, path string, params []string, body string) (*http.Request, error) {
+	q := url.Values{}
+	for _, p := range params {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("parameter %q is not name=value", p)
+		}
+		q.Add(name, value)
+	}
+	var b []byte
+	var err error
+	switch body {
+	case "":
+	case "-":
+		b, err = io.ReadAll(os.Stdin)
+	default:
+		b, err = os.ReadFile(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %v", err)
+	}
+	return http.NewRequestWithContext(ctx, http.MethodPost, path+"?"+q.Encode(), bytes.NewReader(b))
+}
+
+// printJSON writes v to standard output; logs go to standard error.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runCompileCommand compiles every variant of a spec into the circuit
+// directory and records it as prepared, as /prepare-download does,
+// so images can ship with it.
+func runCompileCommand(args []string) error {
+	fs := cliFlags("compile", "[name=value ...]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := cliContext()
+	defer cancel()
+	r, err := cliRequest(ctx, "/prepare-download", fs.Args(), "")
+	if err != nil {
+		return err
+	}
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		return fmt.Errorf("Invalid circuit spec: %v", err)
+	}
+	if len(spec.variants()) == 0 {
+		return fmt.Errorf("Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec)
+	}
+	repaired, err := prepareCircuit(ctx, spec)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{
+		"spec":        spec.String(),
+		"circuit_dir": circuitDir,
+		"quarantined": repaired,
+	})
+}
+
+// runProveCommand proves a /submit-proof request against the prepared
+// circuit without submitting it, printing the output and timings and
+// writing the proof to -out.
+func runProveCommand(args []string) error {
+	fs := cliFlags("prove", "[-body file] [-out file] [name=value ...]")
+	body := fs.String("body", "", "file with the request body, or - for standard input")
+	out := fs.String("out", "", "file to write the proof to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := cliContext()
+	defer cancel()
+	r, err := cliRequest(ctx, "/submit-proof", fs.Args(), *body)
+	if err != nil {
+		return err
+	}
+	sub, err := parseSubmission(r)
+	if err != nil {
+		return err
+	}
+	src, err := chainFor(sub.opts.SrcChainID)
+	if err != nil {
+		return err
+	}
+	rpcURL := pickChainRPC(src.ChainID)
+	app, err := src.newBrevisApp(rpcURL, config.OutputDir)
+	if err != nil {
+		return fmt.Errorf("Error initializing BrevisApp: %v", err)
+	}
+	attempt := newProofAttempt()
+	_, proof, err := proveAttempt(ctx, app, rpcURL, sub.spec, sub.queries, sub.receipts, sub.pin, attempt, nil)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		var buf bytes.Buffer
+		if _, err := proof.WriteTo(&buf); err != nil {
+			return fmt.Errorf("Error encoding proof: %v", err)
+		}
+		if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return printJSON(map[string]interface{}{
+		"spec":            sub.spec.String(),
+		"output":          hexutil.Bytes(attempt.Output),
+		"merkle":          attempt.Merkle,
+		"provenance":      attempt.Provenance,
+		"unproven_inputs": attempt.UnprovenInputs,
+		"timings":         attempt.Timings,
+	})
+}
+
+// runSubmitCommand proves and submits a /submit-proof request until it is
+// fulfilled, as ?wait=true does, printing the response.
+func runSubmitCommand(args []string) error {
+	fs := cliFlags("submit", "[-body file] [name=value ...]")
+	body := fs.String("body", "", "file with the request body, or - for standard input")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := cliContext()
+	defer cancel()
+	r, err := cliRequest(ctx, "/submit-proof", fs.Args(), *body)
+	if err != nil {
+		return err
+	}
+	sub, err := parseSubmission(r)
+	if err != nil {
+		return err
+	}
+	response, err := runSubmission(ctx, sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
+	if err != nil {
+		return err
+	}
+	return printJSON(response)
+}
+
+// jobStateView is a job as the status command reports it, with the last
+// stage its attempt checkpointed.
+type jobStateView struct {
+	job
+	CircuitSpec     CircuitSpec   `json:"circuit_spec"`
+	CheckpointStage string        `json:"checkpoint_stage,omitempty"`
+	Attempt         *proofAttempt `json:"attempt,omitempty"`
+}
+
+// runStatusCommand prints the jobs left in the job state directory, or with
+// a job ID that job and its checkpointed attempt.
+func runStatusCommand(args []string) error {
+	fs := cliFlags(statusCommand, "[job-id]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("at most one job ID")
+	}
+	if err := loadJobStateDir(); err != nil {
+		return fmt.Errorf("Invalid job state dir: %v", err)
+	}
+	if jobStateDir == "off" {
+		return errors.New("job state is off; BREVIS_JOB_STATE_DIR keeps none")
+	}
+	if fs.NArg() == 1 {
+		v, err := readJobState(fs.Arg(0), true)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("No unfinished job %q in %s", fs.Arg(0), jobStateDir)
+		}
+		if err != nil {
+			return err
+		}
+		return printJSON(v)
+	}
+	entries, err := os.ReadDir(jobStateDir)
+	if err != nil {
+		return err
+	}
+	views := []jobStateView{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		v, err := readJobState(e.Name(), false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping job state %s: %v\n", e.Name(), err)
+			continue
+		}
+		views = append(views, v)
+	}
+	return printJSON(views)
+}
+
+// readJobState reads job id's state, with its checkpointed attempt when
+// withAttempt is set.
+func readJobState(id string, withAttempt bool) (jobStateView, error) {
+	var v jobStateView
+	b, err := os.ReadFile(filepath.Join(jobStateDir, id, jobStateFile))
+	if err != nil {
+		return v, err
+	}
+	var c jobCheckpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return v, fmt.Errorf("reading %s: %v", jobStateFile, err)
+	}
+	v.job, v.CircuitSpec = c.job, c.CircuitSpec
+	// The attempt alone; its witness and proof are not shown.
+	b, err = os.ReadFile(filepath.Join(jobStateDir, id, attemptStateFile))
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return v, err
+	}
+	var saved stageCheckpoint
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return v, fmt.Errorf("reading %s: %v", attemptStateFile, err)
+	}
+	v.CheckpointStage = saved.Stage
+	if withAttempt {
+		v.Attempt = &saved.Attempt
+	}
+	return v, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// compileLockKey is the Postgres advisory lock replicas compile spec under.
+func compileLockKey(spec CircuitSpec) int64 {
+	sum := sha256.Sum256([]byte("compile:" + spec.String()))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// lockCompile takes the lock on compiling spec across replicas, waiting
+// while another replica holds it, and returns its release. Replicas
+// coordinate through advisory locks of a postgres request store, and only
+// with an artifact bucket to share what they compile through; otherwise
+// compileMutex alone applies. The lock lives with its connection, so a
+// replica that dies mid-compile releases it.
+func lockCompile(ctx context.Context, spec CircuitSpec) (func(), error) {
+	if requestDB == nil || !strings.HasPrefix(requestStoreURL, "postgres") || artifactStore == nil {
+		return func() {}, nil
+	}
+	conn, err := requestDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := compileLockKey(spec)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		slog.InfoContext(ctx, "Waiting for another replica compiling the circuit", "spec", spec)
+		start := time.Now()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Another replica finished compiling the circuit", "spec", spec, "waited_ms", time.Since(start).Milliseconds())
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			slog.ErrorContext(ctx, "Error releasing compile lock", "spec", spec, "err", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+// sharedVariants loads every variant of spec from the artifact bucket, as
+// another replica compiled it, or returns nil if any is missing or was
+// compiled from a different circuit definition than this build's, which
+// stale reports.
+func sharedVariants(ctx context.Context, spec CircuitSpec) (variants []*circuitVariant, stale bool) {
+	if artifactStore == nil {
+		return nil, false
+	}
+	for _, v := range spec.variants() {
+		ccs, pk, err := loadArtifacts(v.String())
+		if err != nil {
+			slog.DebugContext(ctx, "No shared circuit artifacts", "spec", v, "err", err)
+			return nil, false
+		}
+		hash := circuitHash(ccs)
+		current, err := definitionHash(v)
+		if err != nil || hash != current {
+			slog.InfoContext(ctx, "Shared circuit artifacts are stale", "spec", v, "compiled", hash, "now", current, "err", err)
+			dropCachedArtifacts(v.String())
+			return nil, true
+		}
+		variants = append(variants, &circuitVariant{Spec: v, CCS: ccs, PK: pk, Hash: hash})
+	}
+	return variants, false
+}
+
+// dropCachedArtifacts removes spec's artifacts from the artifact cache, so
+// the next use downloads them again.
+func dropCachedArtifacts(spec string) {
+	artifactMutex.Lock()
+	defer artifactMutex.Unlock()
+	if err := os.RemoveAll(filepath.Join(artifactCacheDir, artifactKey(spec))); err != nil {
+		slog.Error("Error dropping cached circuit artifacts", "spec", spec, "err", err)
+	}
+}
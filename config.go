@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config is the deployment's chain, RPC and storage settings. It is read
+// from the JSON file named by BREVIS_CONFIG, then each setting's environment
+// variable overrides the file. Chain settings left empty keep the profile's
+// value.
+type Config struct {
+	Env           string `json:"env"`            // BREVIS_ENV
+	ChainID       uint64 `json:"chain_id"`       // BREVIS_CHAIN_ID
+	RPCURL        string `json:"rpc_url"`        // BREVIS_RPC_URL
+	GatewayURL    string `json:"gateway_url"`    // BREVIS_GATEWAY_URL
+	FeeToken      string `json:"fee_token"`      // BREVIS_FEE_TOKEN
+	AppContract   string `json:"app_contract"`   // BREVIS_APP_CONTRACT
+	RefundAddress string `json:"refund_address"` // BREVIS_REFUND_ADDRESS
+	ExplorerURL   string `json:"explorer_url"`   // BREVIS_EXPLORER_URL
+
+	OutputDir  string `json:"output_dir"`  // BREVIS_OUTPUT_DIR
+	CircuitDir string `json:"circuit_dir"` // BREVIS_CIRCUIT_DIR
+	SRSDir     string `json:"srs_dir"`     // BREVIS_SRS_DIR
+	Port       string `json:"port"`        // PORT
+
+	// Chains registers further chains to read from or deliver to.
+	Chains []ChainConfig `json:"chains"` // BREVIS_CHAINS
+	// APIKeys are the keys callers authenticate with, and their scopes.
+	APIKeys []APIKeyConfig `json:"api_keys"` // BREVIS_API_KEYS
+	// WSOrigins are the browser origins, such as https://app.example.com,
+	// allowed to open /ws besides the server's own; "*" allows any.
+	WSOrigins []string `json:"ws_origins"` // BREVIS_WS_ORIGINS, comma-separated
+}
+
+var config = Config{
+	Env:        "staging",
+	OutputDir:  "./brevis-output",
+	CircuitDir: "./brevis-circuit",
+	SRSDir:     "./",
+	Port:       "8080",
+}
+
+// loadConfig reads the config file and environment overrides into config.
+// Prover workers load it too, so they find the same directories.
+func loadConfig() error {
+	if path := os.Getenv("BREVIS_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading config: %v", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&config); err != nil {
+			return fmt.Errorf("parsing config %s: %v", path, err)
+		}
+		slog.Info("Loaded config", "path", path)
+	}
+
+	for env, v := range map[string]*string{
+		"BREVIS_ENV":            &config.Env,
+		"BREVIS_RPC_URL":        &config.RPCURL,
+		"BREVIS_GATEWAY_URL":    &config.GatewayURL,
+		"BREVIS_FEE_TOKEN":      &config.FeeToken,
+		"BREVIS_APP_CONTRACT":   &config.AppContract,
+		"BREVIS_REFUND_ADDRESS": &config.RefundAddress,
+		"BREVIS_EXPLORER_URL":   &config.ExplorerURL,
+		"BREVIS_OUTPUT_DIR":     &config.OutputDir,
+		"BREVIS_CIRCUIT_DIR":    &config.CircuitDir,
+		"BREVIS_SRS_DIR":        &config.SRSDir,
+		"PORT":                  &config.Port,
+	} {
+		if s := os.Getenv(env); s != "" {
+			*v = s
+		}
+	}
+	if s := os.Getenv("BREVIS_CHAIN_ID"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BREVIS_CHAIN_ID %q", s)
+		}
+		config.ChainID = id
+	}
+
+	if s := os.Getenv("BREVIS_WS_ORIGINS"); s != "" {
+		config.WSOrigins = strings.Split(s, ",")
+	}
+	for i, o := range config.WSOrigins {
+		config.WSOrigins[i] = strings.TrimSuffix(strings.TrimSpace(o), "/")
+	}
+
+	for name, dir := range map[string]string{"output_dir": config.OutputDir, "circuit_dir": config.CircuitDir, "srs_dir": config.SRSDir} {
+		if dir == "" {
+			return fmt.Errorf("config %s must not be empty", name)
+		}
+	}
+	circuitDir = config.CircuitDir
+	quarantineDir = circuitDir + "-quarantine"
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ChainContracts are the on-chain contracts a proof request touches on one
+// chain: the BrevisRequest contract fees are paid to and the app contract
+// receiving the callback. A zero address means "not configured".
+type ChainContracts struct {
+	BrevisRequest common.Address `json:"brevis_request"`
+	Callback      common.Address `json:"callback"`
+}
+
+var contractRegistry = map[uint64]ChainContracts{
+	11155111: {
+		Callback: common.HexToAddress("0xbd2F3813637Ed399D5ddBC2307D3bf4Ab1695B48"),
+	},
+}
+
+// loadContractOverrides merges the JSON file named by BREVIS_CONTRACTS_FILE,
+// keyed by chain ID, over the built-in registry. Only non-zero addresses
+// override, so a fork can replace a single contract.
+func loadContractOverrides() error {
+	path := os.Getenv("BREVIS_CONTRACTS_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading contract overrides: %v", err)
+	}
+	var overrides map[string]ChainContracts
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("parsing contract overrides %s: %v", path, err)
+	}
+	for key, o := range overrides {
+		chainID, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid chain id %q in contract overrides", key)
+		}
+		c := contractRegistry[chainID]
+		if o.BrevisRequest != (common.Address{}) {
+			c.BrevisRequest = o.BrevisRequest
+		}
+		if o.Callback != (common.Address{}) {
+			c.Callback = o.Callback
+		}
+		contractRegistry[chainID] = c
+	}
+	return nil
+}
+
+// verifyContractCode checks that every configured contract for the chain has
+// code deployed, catching typos and contracts missing from a fork. An
+// unreachable RPC only skips the check so a provider outage can't block
+// startup.
+func verifyContractCode(chainID uint64, rpcURL string, contracts ChainContracts) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		slog.Warn("Skipping contract code check: dialing RPC failed", "rpc", rpcURL, "err", err)
+		return nil
+	}
+	defer ec.Close()
+
+	for name, addr := range map[string]common.Address{
+		"brevis_request": contracts.BrevisRequest,
+		"callback":       contracts.Callback,
+	} {
+		if addr == (common.Address{}) {
+			continue
+		}
+		code, err := ec.CodeAt(ctx, addr, nil)
+		if err != nil {
+			slog.Warn("Skipping contract code check: fetching code failed", "contract", name, "address", addr.Hex(), "chain_id", chainID, "err", err)
+			return nil
+		}
+		if len(code) == 0 {
+			return fmt.Errorf("%s contract %s has no code on chain %d", name, addr.Hex(), chainID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/big"
+	"runtime"
+)
+
+// cost attributes what one proof attempt spent. Brevis fees are paid in the
+// chain's native token, in its smallest unit.
+type cost struct {
+	FeeToken  string `json:"fee_token"`
+	FeeAmount string `json:"fee_amount"`
+	// ServiceGasUsed is gas paid for transactions this service sends
+	// itself. It sends none today: the request and fulfillment
+	// transactions are paid by the caller and by Brevis.
+	ServiceGasUsed uint64 `json:"service_gas_used"`
+	// FulfillmentGasUsed is the gas of the fulfillment transaction, for
+	// reference; it is not paid by the service.
+	FulfillmentGasUsed uint64 `json:"fulfillment_gas_used,omitempty"`
+	// ProverCPUSeconds estimates compute as witness and proving wall time
+	// times the cores the prover may use.
+	ProverCPUSeconds float64 `json:"prover_cpu_seconds"`
+}
+
+func attemptCost(fee *big.Int, t timings) cost {
+	wall := float64(t.WitnessMs+t.ProveMs) / 1000
+	return cost{
+		FeeToken:         activeProfile.FeeToken,
+		FeeAmount:        fee.String(),
+		ProverCPUSeconds: wall * float64(runtime.GOMAXPROCS(0)),
+	}
+}
+
+// totalCost sums the cost of every attempt of one proof, since each
+// re-proven attempt pays its own fee.
+func totalCost(attempts []*proofAttempt) cost {
+	total := cost{FeeToken: activeProfile.FeeToken}
+	fee := new(big.Int)
+	for _, a := range attempts {
+		amount, _ := new(big.Int).SetString(a.Cost.FeeAmount, 10)
+		if amount != nil {
+			fee.Add(fee, amount)
+		}
+		total.ServiceGasUsed += a.Cost.ServiceGasUsed
+		total.FulfillmentGasUsed += a.Cost.FulfillmentGasUsed
+		total.ProverCPUSeconds += a.Cost.ProverCPUSeconds
+	}
+	total.FeeAmount = fee.String()
+	return total
+}
+
+// feeFloat is fee as a float for metrics, which need not be exact.
+func feeFloat(fee *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(fee).Float64()
+	return f
+}
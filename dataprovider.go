@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// DataProvider fills in the block base fee, block timestamp and value of a
+// storage query. Whatever the source, Brevis checks the values it is given
+// against chain data when it fulfills the request, so a faster source can
+// only trade freshness for speed, not soundness.
+type DataProvider interface {
+	Name() string
+	FetchStorage(ctx context.Context, q sdk.StorageData) (sdk.StorageData, error)
+}
+
+var (
+	// indexerURL serves storage queries for the active chain instead of
+	// the RPC providers. Empty fetches from RPC.
+	indexerURL = ""
+	// dataCrossChecks is how many queries per attempt fetched from the
+	// indexer are compared against RPC.
+	dataCrossChecks = 1
+)
+
+// loadDataProvider reads BREVIS_DATA_PROVIDER_<CHAIN ID>, or
+// BREVIS_DATA_PROVIDER for every chain: "rpc" or "indexer:<url>". It also
+// reads BREVIS_DATA_CROSS_CHECKS.
+func loadDataProvider(chainID uint64) error {
+	name := "BREVIS_DATA_PROVIDER_" + strconv.FormatUint(chainID, 10)
+	v := os.Getenv(name)
+	if v == "" {
+		name = "BREVIS_DATA_PROVIDER"
+		v = os.Getenv(name)
+	}
+	kind, arg, _ := strings.Cut(v, ":")
+	switch {
+	case v == "" || v == "rpc":
+	case kind == "indexer" && arg != "":
+		indexerURL = strings.TrimSuffix(arg, "/")
+		slog.Info("Fetching storage queries from indexer", "chain_id", chainID, "indexer", indexerURL)
+	default:
+		return fmt.Errorf("invalid %s %q: want \"rpc\" or \"indexer:<url>\"", name, v)
+	}
+	var err error
+	if dataCrossChecks, err = envInt("BREVIS_DATA_CROSS_CHECKS", dataCrossChecks); err != nil {
+		return err
+	}
+	if dataCrossChecks < 0 {
+		return fmt.Errorf("BREVIS_DATA_CROSS_CHECKS must not be negative")
+	}
+	return nil
+}
+
+// rpcDataProvider reads storage from an RPC provider.
+type rpcDataProvider struct {
+	ec *ethclient.Client
+}
+
+func (p rpcDataProvider) Name() string { return "rpc" }
+
+func (p rpcDataProvider) FetchStorage(ctx context.Context, q sdk.StorageData) (sdk.StorageData, error) {
+	return fetchStorage(ctx, p.ec, q)
+}
+
+// indexerDataProvider reads storage from an indexer of decoded chain state,
+// as GET <url>/storage?chain_id=&address=&slot=&block= answering
+// {"value": "0x...", "block_timestamp": 1700000000, "block_base_fee": "7"}.
+type indexerDataProvider struct {
+	URL     string
+	ChainID uint64
+}
+
+func (p indexerDataProvider) Name() string { return "indexer" }
+
+func (p indexerDataProvider) FetchStorage(ctx context.Context, q sdk.StorageData) (sdk.StorageData, error) {
+	params := url.Values{
+		"chain_id": {strconv.FormatUint(p.ChainID, 10)},
+		"address":  {q.Address.Hex()},
+		"slot":     {q.Slot.Hex()},
+		"block":    {q.BlockNum.String()},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+"/storage?"+params.Encode(), nil)
+	if err != nil {
+		return q, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return q, fmt.Errorf("querying indexer: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return q, fmt.Errorf("indexer answered %s for slot %s of %s at block %d", resp.Status, q.Slot.Hex(), q.Address.Hex(), q.BlockNum)
+	}
+	var row struct {
+		Value          common.Hash `json:"value"`
+		BlockTimestamp uint64      `json:"block_timestamp"`
+		BlockBaseFee   string      `json:"block_base_fee"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&row); err != nil {
+		return q, fmt.Errorf("decoding indexer answer: %v", err)
+	}
+	// Blocks before London have no base fee.
+	var fee *big.Int
+	if row.BlockBaseFee != "" {
+		var ok bool
+		if fee, ok = new(big.Int).SetString(row.BlockBaseFee, 10); !ok {
+			return q, fmt.Errorf("indexer returned invalid block_base_fee %q", row.BlockBaseFee)
+		}
+	}
+	q.Value, q.BlockTimestamp, q.BlockBaseFee = row.Value, row.BlockTimestamp, fee
+	return q, nil
+}
+
+// newDataProvider returns the configured provider for the chain, reading
+// from ec when it is RPC. The indexer only serves the profile's chain.
+func newDataProvider(ec *ethclient.Client, chainID uint64) DataProvider {
+	if indexerURL != "" && chainID == activeProfile.ChainID {
+		return indexerDataProvider{URL: indexerURL, ChainID: activeProfile.ChainID}
+	}
+	return rpcDataProvider{ec: ec}
+}
+
+// crossCheckStorage compares dataCrossChecks randomly chosen queries fetched
+// from a non-RPC provider against RPC, failing the attempt on any
+// disagreement.
+func crossCheckStorage(ctx context.Context, ec *ethclient.Client, fetched []sdk.StorageData) error {
+	for _, i := range rand.Perm(len(fetched))[:min(dataCrossChecks, len(fetched))] {
+		chain, err := fetchStorage(ctx, ec, fetched[i])
+		if err != nil {
+			return fmt.Errorf("cross-checking storage query %d against RPC: %v", i, err)
+		}
+		q := fetched[i]
+		fee := chain.BlockBaseFee == nil && q.BlockBaseFee == nil ||
+			chain.BlockBaseFee != nil && q.BlockBaseFee != nil && chain.BlockBaseFee.Cmp(q.BlockBaseFee) == 0
+		if chain.Value != q.Value || chain.BlockTimestamp != q.BlockTimestamp || !fee {
+			return &statusError{http.StatusBadGateway, fmt.Errorf("indexer and RPC disagree on slot %s of %s at block %d: value %s vs %s, timestamp %d vs %d, base fee %v vs %v",
+				q.Slot.Hex(), q.Address.Hex(), q.BlockNum, q.Value.Hex(), chain.Value.Hex(), q.BlockTimestamp, chain.BlockTimestamp, q.BlockBaseFee, chain.BlockBaseFee)}
+		}
+	}
+	return nil
+}
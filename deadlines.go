@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Pipeline stages with their own deadline. Waiting for the receipt is
+// bounded by receiptTimeout.
+const (
+	StageSnapshot       = "snapshot"
+	StageFetch          = "fetch"
+	StageProvenance     = "provenance"
+	StageBuildInput     = "build_input"
+	StageWitness        = "witness"
+	StageProve          = "prove"
+	StageSubmitProof    = "submit_proof"
+	StagePrepareRequest = "prepare_request"
+	// StageFinality waits for fulfillment. A request past its fulfillment
+	// window expires; the stage's deadline is the grace beyond the window
+	// for a gateway status poll that never answers.
+	StageFinality = "finality"
+)
+
+// stageDeadlines bounds each stage of a proof attempt.
+var stageDeadlines = map[string]time.Duration{
+	StageSnapshot:       30 * time.Second,
+	StageFetch:          2 * time.Minute,
+	StageProvenance:     2 * time.Minute,
+	StageBuildInput:     5 * time.Minute,
+	StageWitness:        2 * time.Minute,
+	StageProve:          30 * time.Minute,
+	StageSubmitProof:    2 * time.Minute,
+	StagePrepareRequest: 2 * time.Minute,
+	StageFinality:       2 * time.Minute,
+}
+
+// stageTimeout is the failure of a stage that ran past its deadline.
+type stageTimeout struct {
+	Stage    string
+	Deadline time.Duration
+}
+
+func (e *stageTimeout) Error() string {
+	return fmt.Sprintf("stage %s exceeded its %s deadline", e.Stage, e.Deadline)
+}
+
+// timedOutStage is the stage whose deadline err reports, or "".
+func timedOutStage(err error) string {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return ""
+	}
+	if t, ok := se.err.(*stageTimeout); ok {
+		return t.Stage
+	}
+	return ""
+}
+
+// loadStageDeadlines applies BREVIS_DEADLINE_<STAGE> overrides, such as
+// BREVIS_DEADLINE_PROVE=45m.
+func loadStageDeadlines() error {
+	for stage, d := range stageDeadlines {
+		v, err := envDuration("BREVIS_DEADLINE_"+strings.ToUpper(stage), d)
+		if err != nil {
+			return err
+		}
+		stageDeadlines[stage] = v
+	}
+	return nil
+}
+
+// stageContext derives the context a context-aware stage runs under.
+func stageContext(ctx context.Context, stage string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, stageDeadlines[stage])
+}
+
+// runStage runs fn, which cannot be cancelled, under the stage's deadline.
+// The SDK calls take no context, so on timeout or cancellation fn keeps
+// running in the background and its result is dropped; the attempt fails
+// with a 504 instead of holding the request open.
+func runStage[T any](ctx context.Context, stage string, fn func() (T, error)) (T, error) {
+	return runStageWithin(ctx, stage, stageDeadlines[stage], fn)
+}
+
+// runStageWithin is runStage with a deadline other than the stage's.
+func runStageWithin[T any](ctx context.Context, stage string, d time.Duration, fn func() (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, deadlineError(ctx, stage, d)
+	}
+}
+
+// stageError reports why a stage's context ended.
+func stageError(ctx context.Context, stage string) error {
+	return deadlineError(ctx, stage, stageDeadlines[stage])
+}
+
+func deadlineError(ctx context.Context, stage string, d time.Duration) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &statusError{http.StatusGatewayTimeout, &stageTimeout{stage, d}}
+	}
+	return fmt.Errorf("stage %s cancelled: %v", stage, ctx.Err())
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// drainCommand is the argument that drains a running server instead of
+// starting one.
+const drainCommand = "drain"
+
+// jobCheckpointFile holds the exported queue when there is no artifact
+// bucket.
+var jobCheckpointFile = "./brevis-jobs.json"
+
+// draining is set once a drain starts; from then on no job is accepted or
+// started. It is guarded by jobsMutex.
+var draining bool
+
+// shutdownTimeout bounds how long a signalled shutdown waits for running
+// jobs and in-flight requests. Zero waits however long they take.
+var shutdownTimeout time.Duration
+
+// drainCancelWait bounds how long a drain waits for the jobs it cancelled
+// to stop.
+const drainCancelWait = 30 * time.Second
+
+var errDraining = &statusError{http.StatusServiceUnavailable, errors.New("server is draining for migration; submit to the new deployment")}
+
+var (
+	// server is shut down once a drain has exported the queue.
+	server = &http.Server{}
+	// drained is closed once that shutdown has finished.
+	drained      = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// jobCheckpoint is a job as exported by a drain, including what a queued
+// job needs to run on the deployment that restores it.
+type jobCheckpoint struct {
+	job
+	CircuitSpec CircuitSpec       `json:"circuit_spec"`
+	Queries     []sdk.StorageData `json:"queries,omitempty"`
+	Receipts    []receiptQuery    `json:"receipts,omitempty"`
+	Pin         *snapshotPin      `json:"pin,omitempty"`
+	// Stages is what the attempt of a job a drain interrupted had
+	// checkpointed, for the deployment restoring it to resume from.
+	Stages *exportedStages `json:"stages,omitempty"`
+}
+
+// exportedStages are the files of a stage checkpoint.
+type exportedStages struct {
+	Attempt json.RawMessage `json:"attempt"`
+	Witness []byte          `json:"witness,omitempty"`
+	Proof   []byte          `json:"proof,omitempty"`
+}
+
+type queueCheckpoint struct {
+	Exported time.Time       `json:"exported"`
+	Jobs     []jobCheckpoint `json:"jobs"`
+}
+
+func isDraining() bool {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return draining
+}
+
+// drainJobs stops intake, waits for running jobs to finish and exports every
+// job left, queued or finished, to the artifact store. With a positive wait,
+// jobs still running after it are cancelled and exported as queued with the
+// stages they checkpointed, so the deployment restoring them resumes them
+// there; one that already submitted its proof is exported as failed instead,
+// since running it again would submit and pay for another. With a Redis
+// queue nothing is exported: jobs still running go back on the queue, their
+// checkpoints shared through the artifact store.
+func drainJobs(wait time.Duration) (queueCheckpoint, error) {
+	jobsMutex.Lock()
+	draining = true
+	jobsMutex.Unlock()
+	slog.Info("Draining: intake stopped, waiting for running jobs")
+	if !waitForJobs(wait) {
+		slog.Warn("Draining: cancelling jobs still running to export their checkpoints", "wait", wait.String())
+		jobsMutex.Lock()
+		for _, j := range jobs {
+			if j.Status == JobRunning && j.cancel != nil {
+				j.drained = true
+				j.cancel()
+			}
+		}
+		jobsMutex.Unlock()
+		if !waitForJobs(drainCancelWait) {
+			slog.Error("Draining: cancelled jobs did not stop; exporting them as they stand", "wait", drainCancelWait.String())
+		}
+	}
+
+	now := time.Now()
+	jobsMutex.Lock()
+	cp := queueCheckpoint{Exported: now}
+	var submitted []redisJob
+	for _, j := range jobs {
+		if j.Status == JobRunning && j.pastSubmission() {
+			ctx := withCorrelationID(context.Background(), j.CorrelationID)
+			slog.WarnContext(ctx, "Failing job interrupted after submitting its proof", "job", j.ID)
+			j.setStatus(ctx, JobFailed)
+			j.Finished = &now
+			j.Error = "interrupted by a drain after submitting its proof; submit it again only if its request is not fulfilled"
+			j.ErrorStatus, j.ErrorClass = http.StatusConflict, ErrorFatal
+			j.notify()
+			if j.consumed {
+				submitted = append(submitted, j.record())
+			}
+		}
+		if redisQueue != nil {
+			continue
+		}
+		c := jobCheckpoint{job: *j, CircuitSpec: j.spec, Queries: j.queries, Receipts: j.receipts, Pin: j.pin}
+		if c.Status == JobRunning {
+			stages, err := exportStages(j.ID)
+			if err != nil {
+				slog.WarnContext(withCorrelationID(context.Background(), j.CorrelationID), "Exporting job without its checkpoint; it restarts from the beginning", "job", j.ID, "err", err)
+			}
+			c.setStatus(context.Background(), JobQueued)
+			c.Started, c.ETA, c.Stages = nil, nil, stages
+		}
+		cp.Jobs = append(cp.Jobs, c)
+	}
+	jobsMutex.Unlock()
+
+	if redisQueue != nil {
+		// Queued jobs wait in Redis for other nodes; those still running
+		// here go back on the queue instead of into an export, once those
+		// that must not run again are recorded failed.
+		ctx := context.Background()
+		for _, rj := range submitted {
+			if err := saveRedisJob(ctx, rj); err != nil {
+				return queueCheckpoint{}, fmt.Errorf("recording job %s failed: %v", rj.ID, err)
+			}
+		}
+		return queueCheckpoint{Exported: now}, requeueProcessing(ctx)
+	}
+	sort.Slice(cp.Jobs, func(i, k int) bool { return cp.Jobs[i].Created.Before(cp.Jobs[k].Created) })
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return cp, err
+	}
+	if err := putCheckpoint(b); err != nil {
+		return cp, fmt.Errorf("exporting job queue: %v", err)
+	}
+	return cp, nil
+}
+
+// waitForJobs waits for running jobs to finish, up to wait if it is
+// positive, and reports whether they did.
+func waitForJobs(wait time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		jobsRunning.Wait()
+		close(finished)
+	}()
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timeout = time.After(wait)
+	}
+	select {
+	case <-finished:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// stoppedByDrain reports whether ctx, ended, is that of a job a drain
+// cancelled, which finishes on the deployment restoring it.
+func stoppedByDrain(ctx context.Context) bool {
+	j, _ := ctx.Value(jobKey{}).(*job)
+	if j == nil || ctx.Err() == nil {
+		return false
+	}
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return j.drained
+}
+
+// pastSubmission reports whether j has submitted a proof. The caller holds
+// jobsMutex.
+func (j *job) pastSubmission() bool {
+	for _, e := range j.events {
+		if e.Stage == ProgressSubmitted {
+			return true
+		}
+	}
+	return false
+}
+
+// exportStages reads the stage checkpoint of job id, or returns nil if it
+// has none.
+func exportStages(id string) (*exportedStages, error) {
+	if jobStateDir == "off" {
+		return nil, nil
+	}
+	dir := filepath.Join(jobStateDir, id)
+	attempt, err := os.ReadFile(filepath.Join(dir, attemptStateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &exportedStages{Attempt: attempt}
+	for name, into := range map[string]*[]byte{witnessStateFile: &s.Witness, proofStateFile: &s.Proof} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		*into = b
+	}
+	return s, nil
+}
+
+// importStages writes the stage checkpoint a drain exported for job id,
+// for its attempt to resume from.
+func importStages(id string, s *exportedStages) error {
+	if jobStateDir == "off" {
+		return nil
+	}
+	dir := filepath.Join(jobStateDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, b := range map[string][]byte{witnessStateFile: s.Witness, proofStateFile: s.Proof} {
+		if b == nil {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(dir, name), b); err != nil {
+			return err
+		}
+	}
+	// The attempt goes last: it names the stage the other files complete.
+	return writeFileAtomic(filepath.Join(dir, attemptStateFile), s.Attempt)
+}
+
+func checkpointObject() string {
+	return blobKey("queue", "jobs.json")
+}
+
+func putCheckpoint(b []byte) error {
+	if artifactBucket == "" {
+		tmp := jobCheckpointFile + ".tmp"
+		if err := os.WriteFile(tmp, b, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, jobCheckpointFile)
+	}
+	return artifactStore.Put(context.Background(), checkpointObject(), bytes.NewReader(b))
+}
+
+// takeCheckpoint reads and removes the exported queue. It returns nil if no
+// drain left one.
+func takeCheckpoint() ([]byte, error) {
+	if artifactBucket == "" {
+		b, err := os.ReadFile(jobCheckpointFile)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return b, os.Remove(jobCheckpointFile)
+	}
+	ctx := context.Background()
+	buf := aws.NewWriteAtBuffer(nil)
+	err := artifactStore.Get(ctx, checkpointObject(), buf)
+	if errors.Is(err, errBlobNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), artifactStore.Delete(ctx, checkpointObject())
+}
+
+// restoreJobs takes over the queue a drained deployment exported: finished
+// jobs stay pollable under their IDs and queued ones run here. The first
+// instance to start takes the whole queue.
+func restoreJobs() error {
+	b, err := takeCheckpoint()
+	if err != nil || b == nil {
+		return err
+	}
+	var cp queueCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return fmt.Errorf("reading exported job queue: %v", err)
+	}
+
+	var queued []*job
+	jobsMutex.Lock()
+	for _, c := range cp.Jobs {
+		j := c.job
+		j.spec, j.queries, j.receipts, j.pin = c.CircuitSpec, c.Queries, c.Receipts, c.Pin
+		jobs[j.ID] = &j
+		if c.Stages != nil {
+			if err := importStages(j.ID, c.Stages); err != nil {
+				slog.Warn("Restoring job without its checkpoint; it restarts from the beginning", "job", j.ID, "err", err)
+			}
+		}
+		if j.Status == JobQueued {
+			queued = append(queued, &j)
+		}
+	}
+	jobsMutex.Unlock()
+	// The export can hold more queued jobs than the queue has room for.
+	go func() {
+		for _, j := range queued {
+			jobQueue <- j
+		}
+	}()
+	slog.Info("Restored drained jobs", "jobs", len(cp.Jobs), "queued", len(queued), "exported", cp.Exported)
+	return nil
+}
+
+// handleAdminDrain drains the server for a migration: it stops intake,
+// finishes running jobs, exports the rest and shuts the server down, which
+// exits the process successfully.
+func handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	cp, err := drainJobs(0)
+	if err != nil {
+		// Keep serving; a retried drain exports again.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	queued := 0
+	for _, j := range cp.Jobs {
+		if j.Status == JobQueued {
+			queued++
+		}
+	}
+	slog.InfoContext(r.Context(), "Drained, shutting down", "exported", len(cp.Jobs), "queued", queued)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exported": len(cp.Jobs),
+		"queued":   queued,
+	})
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	go shutdownServer(0)
+}
+
+// shutdownServer stops the server once in-flight requests, including
+// wait=true proofs and compiles, finish or wait passes; a positive wait
+// abandons them then. Artifacts a compile leaves partial are quarantined by
+// the repair on the next start.
+func shutdownServer(wait time.Duration) {
+	shutdownOnce.Do(func() {
+		ctx := context.Background()
+		if wait > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, wait)
+			defer cancel()
+		}
+		if grpcServer != nil {
+			go func() {
+				<-ctx.Done()
+				grpcServer.Stop()
+			}()
+			grpcServer.GracefulStop()
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("Shutting down with requests in flight", "err", err)
+		}
+		close(drained)
+	})
+}
+
+// handleSignals drains and shuts down on SIGINT or SIGTERM, within
+// shutdownTimeout for each. A second signal exits at once.
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		slog.Info("Received signal, draining before exit", "signal", sig.String())
+		go func() {
+			log.Fatalf("Received %s again, exiting without draining", <-sigs)
+		}()
+		cp, err := drainJobs(shutdownTimeout)
+		if err != nil {
+			slog.Error("Error exporting job queue, exiting anyway", "err", err)
+		} else {
+			slog.Info("Drained", "exported", len(cp.Jobs))
+		}
+		shutdownServer(shutdownTimeout)
+	}()
+}
+
+// runDrain asks the server on the configured port, or at url, to drain, and
+// reports whether it did. It authenticates with the admin key in
+// BREVIS_ADMIN_KEY.
+func runDrain(url string) error {
+	if url == "" {
+		url = "http://localhost:" + config.Port
+	}
+	key := os.Getenv("BREVIS_ADMIN_KEY")
+	if key == "" {
+		return fmt.Errorf("drain requires BREVIS_ADMIN_KEY, an API key with the admin scope")
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/admin/drain", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("drain failed: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	slog.Info("Drained", "response", string(bytes.TrimSpace(b)))
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// feeEstimate is what a draft query set is expected to cost, in the fee
+// token's smallest unit, before any witness is built.
+type feeEstimate struct {
+	Spec       string `json:"spec"`
+	SrcChainID uint64 `json:"chain_id"`
+	DstChainID uint64 `json:"dst_chain_id"`
+	// StartBlock and EndBlock bound the blocks the storage queries read.
+	StartBlock     uint64 `json:"start_block,omitempty"`
+	EndBlock       uint64 `json:"end_block,omitempty"`
+	StorageQueries int    `json:"storage_queries"`
+	ReceiptQueries int    `json:"receipt_queries"`
+	Chunks         int    `json:"chunks"`
+	// BrevisFee is the median fee of recent requests of the same variant,
+	// per chunk, from this process's attempts or else the request store;
+	// FeeSamples is how many it comes from. Without any it is left out.
+	BrevisFee  string `json:"brevis_fee,omitempty"`
+	FeeSamples int    `json:"fee_samples"`
+	FeeSource  string `json:"fee_source,omitempty"`
+	// CallbackGasLimit is the gas each chunk's callback may use;
+	// CallbackGasCost is all of it at the destination chain's suggested
+	// GasPrice.
+	CallbackGasLimit uint64 `json:"callback_gas_limit"`
+	GasPrice         string `json:"gas_price,omitempty"`
+	CallbackGasCost  string `json:"callback_gas_cost,omitempty"`
+	// Total is the Brevis fee and callback gas cost together, set once both
+	// are known.
+	Total    string   `json:"total,omitempty"`
+	FeeToken string   `json:"fee_token"`
+	Warnings []string `json:"warnings"`
+}
+
+// handleEstimateFee estimates the Brevis fee and callback gas of a draft
+// /submit-proof body and query string, without building a witness or
+// proving anything.
+func handleEstimateFee(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	tenant, err := lookupTenantSettings(r.Context(), apiKeyName(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	opts, err := parseSubmitOptions(r, tenant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkKeyEnvironment(r.Context(), opts); err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	queries, receipts, err := parseQueries(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if queries, err = rangeQueries(spec, r.URL.Query(), queries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkQueryKinds(spec, len(queries), len(receipts)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	variants := spec.variants()
+	if len(variants) == 0 {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec), http.StatusBadRequest)
+		return
+	}
+	dst, err := destinationFor(opts.DstChainID)
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
+	est := feeEstimate{
+		Spec:             spec.String(),
+		SrcChainID:       opts.SrcChainID,
+		DstChainID:       opts.DstChainID,
+		StorageQueries:   len(queries),
+		ReceiptQueries:   len(receipts),
+		CallbackGasLimit: opts.CallbackGasLimit,
+		FeeToken:         dst.FeeToken,
+		Warnings:         []string{},
+	}
+	for i, q := range queries {
+		block := q.BlockNum.Uint64()
+		if i == 0 || block < est.StartBlock {
+			est.StartBlock = block
+		}
+		est.EndBlock = max(est.EndBlock, block)
+	}
+	variant, needed, capacity, chunks := fitVariant(spec, variants, len(queries), len(receipts))
+	est.Chunks = chunks
+	if chunks > 1 {
+		est.Warnings = append(est.Warnings, fmt.Sprintf("%d queries exceed the largest allocation of %d; split them into %d submissions", needed, capacity, chunks))
+	}
+
+	fee := new(big.Int)
+	if n, _, median := sampleMedians(variant); n > 0 {
+		est.FeeSamples, est.FeeSource = n, "recent_attempts"
+		fee.Set(median)
+	} else if n, median, err := storedFeeMedian(r.Context(), variant, opts.SrcChainID); err != nil {
+		est.Warnings = append(est.Warnings, fmt.Sprintf("Could not read past fees from the request store: %v", err))
+	} else if n > 0 {
+		est.FeeSamples, est.FeeSource = n, "request_store"
+		fee.Set(median)
+	}
+	if est.FeeSamples > 0 {
+		est.BrevisFee = fee.Mul(fee, big.NewInt(int64(chunks))).String()
+	} else {
+		est.Warnings = append(est.Warnings, fmt.Sprintf("No past requests of variant %s on chain %d to estimate the Brevis fee from", variant, opts.SrcChainID))
+	}
+
+	gasPrice, err := suggestGasPrice(r.Context(), dst.ChainID)
+	if err != nil {
+		est.Warnings = append(est.Warnings, fmt.Sprintf("Could not read the gas price of chain %d: %v", dst.ChainID, err))
+	} else {
+		gas := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(opts.CallbackGasLimit*uint64(chunks)))
+		est.GasPrice, est.CallbackGasCost = gasPrice.String(), gas.String()
+		if est.FeeSamples > 0 {
+			est.Total = new(big.Int).Add(fee, gas).String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(est)
+}
+
+// storedFeeMedian returns how many recent stored requests of variant read
+// chainID with a known fee, and their median fee.
+func storedFeeMedian(ctx context.Context, variant CircuitSpec, chainID uint64) (int, *big.Int, error) {
+	if requestDB == nil {
+		return 0, nil, nil
+	}
+	rows, err := requestDB.QueryContext(ctx, fmt.Sprintf("SELECT fee FROM proof_requests WHERE spec = $1 AND chain_id = $2 AND request_id != '' ORDER BY created_at DESC LIMIT %d", planSamples),
+		variant.String(), int64(chainID))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var fees []*big.Int
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return 0, nil, err
+		}
+		if fee, ok := new(big.Int).SetString(v, 10); ok {
+			fees = append(fees, fee)
+		}
+	}
+	if err := rows.Err(); err != nil || len(fees) == 0 {
+		return 0, nil, err
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Cmp(fees[j]) < 0 })
+	return len(fees), fees[len(fees)/2], nil
+}
+
+// suggestGasPrice asks one of chainID's providers for its gas price.
+func suggestGasPrice(ctx context.Context, chainID uint64) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ec, err := ethclient.DialContext(ctx, pickChainRPC(chainID))
+	if err != nil {
+		return nil, err
+	}
+	defer ec.Close()
+	return ec.SuggestGasPrice(ctx)
+}
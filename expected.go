@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// defaultExpectedEmission is the value every queried slot must hold when a
+// spec leaves expected_emission unset.
+var defaultExpectedEmission = big.NewInt(10000)
+
+// parseExpectedEmission reads an expected emission: a positive decimal
+// integer.
+func parseExpectedEmission(s string) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid expected_emission %q: want a positive integer", s)
+	}
+	return v, nil
+}
+
+// canonicalExpectedEmission normalizes s so specs proving the same circuit
+// compare equal; the default becomes "".
+func canonicalExpectedEmission(s string) string {
+	v, err := parseExpectedEmission(s)
+	if err != nil {
+		return s
+	}
+	if v.Cmp(defaultExpectedEmission) == 0 {
+		return ""
+	}
+	return v.String()
+}
+
+// expectedEmission is the value the circuit checks every slot against.
+func (s CircuitSpec) expectedEmission() *big.Int {
+	if s.ExpectedEmission == "" {
+		return defaultExpectedEmission
+	}
+	v, _ := parseExpectedEmission(s.ExpectedEmission)
+	return v
+}
+
+// validateExpectedEmission checks that the expected value is one a slot can
+// hold in the spec's value mode, and that the total of a full allocation of
+// it, scaled, still fits the 248-bit output.
+func (s CircuitSpec) validateExpectedEmission() error {
+	if s.ExpectedEmission == "" {
+		return nil
+	}
+	v, err := parseExpectedEmission(s.ExpectedEmission)
+	if err != nil {
+		return err
+	}
+	if s.ValueMode == ValueModeSplit {
+		if v.BitLen() > 256 {
+			return fmt.Errorf("expected_emission %s exceeds 256 bits", v)
+		}
+		return nil
+	}
+	for _, f := range s.Fields {
+		if f.Name == emissionsField && v.BitLen() > f.Bits {
+			return fmt.Errorf("expected_emission %s does not fit the %d-bit packed emissions field", v, f.Bits)
+		}
+	}
+	if v.Cmp(sdk.MaxUint248) > 0 {
+		return fmt.Errorf("expected_emission %s exceeds 248 bits; use value_mode=%s", v, ValueModeSplit)
+	}
+	scaled := v
+	if s.ScaleFactor != "" {
+		f, err := parseFixedPoint(s.ScaleFactor)
+		if err != nil {
+			return nil // reported by validateScaleFactor
+		}
+		if v.Cmp(new(big.Int).Div(sdk.MaxUint248, f.numerator)) > 0 {
+			return fmt.Errorf("expected_emission %s overflows 248 bits when scaled by %s", v, s.ScaleFactor)
+		}
+		scaled = fixedMulInt(v, f)
+	}
+	total := new(big.Int).Mul(scaled, big.NewInt(int64(s.slots())))
+	if total.Cmp(sdk.MaxUint248) > 0 {
+		return fmt.Errorf("expected_emission %s over %d slots totals more than 248 bits", v, s.slots())
+	}
+	return nil
+}
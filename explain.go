@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// provenRead is a storage slot a job's proof read.
+type provenRead struct {
+	Contract common.Address `json:"contract"`
+	Slot     common.Hash    `json:"slot"`
+	Block    uint64         `json:"block"`
+	Value    common.Hash    `json:"value"`
+}
+
+// explainedTransaction is an on-chain transaction a job's proof read a
+// receipt of, or that fulfilled it. URL links it on the chain's explorer,
+// when one is configured.
+type explainedTransaction struct {
+	Kind    string `json:"kind"`
+	ChainID uint64 `json:"chain_id"`
+	Hash    string `json:"hash"`
+	URL     string `json:"url,omitempty"`
+}
+
+// jobExplanation is what GET /jobs/{id}/explain answers: Summary in plain
+// sentences for a report, and the same facts as fields.
+type jobExplanation struct {
+	ID           string                 `json:"id"`
+	Status       string                 `json:"status"`
+	Summary      []string               `json:"summary"`
+	Circuit      string                 `json:"circuit"`
+	Assertions   []string               `json:"assertions"`
+	Reads        []provenRead           `json:"reads"`
+	Receipts     []receiptQuery         `json:"receipts,omitempty"`
+	RequestID    string                 `json:"request_id,omitempty"`
+	Outputs      []decodedOutput        `json:"outputs,omitempty"`
+	Transactions []explainedTransaction `json:"transactions"`
+}
+
+// explorerLink links transaction hash on chainID's explorer, or is empty.
+func explorerLink(chainID uint64, hash string) string {
+	c, ok := chains[chainID]
+	if !ok || c.ExplorerURL == "" || hash == "" {
+		return ""
+	}
+	return c.ExplorerURL + "/tx/" + hash
+}
+
+// assertions describes what spec's circuit proves of what it reads.
+func (s CircuitSpec) assertions() []string {
+	var a []string
+	switch p, r, b := s.StockFlow, s.ReceiptEmissions, s.BlockRange; {
+	case p != nil:
+		a = append(a, fmt.Sprintf("The change of the emissions counter at slot %s of registry %s between the two blocks read equals the sum of the amounts of the %s events in between.", p.CounterSlot.Hex(), p.Registry.Hex(), p.EventID.Hex()))
+	case r != nil:
+		a = append(a, fmt.Sprintf("Every receipt read holds a %s event emitted by %s; the emissions are the amounts those events report.", r.EventID.Hex(), r.Emitter.Hex()))
+	case b != nil:
+		a = append(a, fmt.Sprintf("The emissions counter at slot %s of %s was read at each block sampled; the emissions are its change over the range.", b.Slot.Hex(), b.Contract.Hex()))
+	default:
+		expected := s.ExpectedEmission
+		if expected == "" {
+			expected = defaultExpectedEmission.String()
+		}
+		if s.Mode == ModeThreshold {
+			a = append(a, fmt.Sprintf("Every slot read holds at most %s.", expected))
+			if s.TotalCap != "" {
+				a = append(a, fmt.Sprintf("The total of the slots is at most %s.", s.TotalCap))
+			}
+		} else {
+			a = append(a, fmt.Sprintf("Every slot read holds exactly %s.", expected))
+		}
+	}
+	switch s.Aggregation {
+	case AggregationSum:
+		a = append(a, "It outputs the total of the emissions.")
+	case AggregationTopK:
+		a = append(a, fmt.Sprintf("It outputs the total and the %d largest emissions, with their slots.", s.TopK))
+	case AggregationSorted:
+		a = append(a, "The emissions are in ascending order; it outputs their total.")
+	case AggregationWindowAvg:
+		a = append(a, fmt.Sprintf("It outputs the total and the average of the last %d emissions.", s.Window))
+	case AggregationEMA:
+		a = append(a, fmt.Sprintf("It outputs the total and the emissions' moving average weighted %d/%d to the latest.", s.AlphaBps, emaScale))
+	case AggregationMerkle:
+		a = append(a, "It outputs the total and a Merkle root committing to every emission.")
+	case AggregationMin, AggregationMax, AggregationMean:
+		a = append(a, fmt.Sprintf("It outputs the total and the %s of the emissions.", s.Aggregation))
+	case AggregationCount:
+		a = append(a, "It outputs the total and the number of nonzero emissions.")
+	}
+	if s.Bucket != "" {
+		a = append(a, fmt.Sprintf("The total is given only as the bounds of its bucket of width %s.", s.Bucket))
+	}
+	return a
+}
+
+// explain builds j's explanation from what it was asked to prove and, once
+// it is finalized, its result.
+func (j *job) explain() (*jobExplanation, error) {
+	view := j.view()
+	e := &jobExplanation{ID: view.ID, Status: view.Status, Circuit: j.spec.Circuit, Assertions: j.spec.assertions(),
+		Reads: []provenRead{}, Receipts: j.receipts, Transactions: []explainedTransaction{}}
+
+	contracts := map[common.Address]bool{}
+	var lowest, highest uint64
+	for i, q := range j.queries {
+		var block uint64
+		if q.BlockNum != nil {
+			block = q.BlockNum.Uint64()
+		}
+		e.Reads = append(e.Reads, provenRead{Contract: q.Address, Slot: q.Slot, Block: block, Value: q.Value})
+		contracts[q.Address] = true
+		if i == 0 || block < lowest {
+			lowest = block
+		}
+		highest = max(highest, block)
+	}
+	src, dst := view.Options.SrcChainID, view.Options.DstChainID
+	for _, q := range j.receipts {
+		hash := q.TxHash.Hex()
+		e.Transactions = append(e.Transactions, explainedTransaction{"receipt", src, hash, explorerLink(src, hash)})
+	}
+
+	switch {
+	case len(e.Reads) > 0 && lowest == highest:
+		e.Summary = append(e.Summary, fmt.Sprintf("The proof reads %d storage slot(s) of %d contract(s) on chain %d at block %d.", len(e.Reads), len(contracts), src, lowest))
+	case len(e.Reads) > 0:
+		e.Summary = append(e.Summary, fmt.Sprintf("The proof reads %d storage slot(s) of %d contract(s) on chain %d at blocks %d to %d.", len(e.Reads), len(contracts), src, lowest, highest))
+	}
+	if len(j.receipts) > 0 {
+		e.Summary = append(e.Summary, fmt.Sprintf("It reads the event logs of %d transaction receipt(s) on chain %d.", len(j.receipts), src))
+	}
+	e.Summary = append(e.Summary, e.Assertions...)
+
+	if view.Result == nil {
+		switch {
+		case view.Error != "":
+			e.Summary = append(e.Summary, fmt.Sprintf("The job is %s: %s", view.Status, view.Error))
+		default:
+			e.Summary = append(e.Summary, fmt.Sprintf("The job is %s; it has no result yet.", view.Status))
+		}
+		return e, nil
+	}
+	// Read back through JSON, so that a result kept here and one read from
+	// the Redis queue take the same form, numbers left as written.
+	b, err := json.Marshal(view.Result)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		RequestID   string          `json:"request_id"`
+		Transaction string          `json:"transaction"`
+		Outputs     []decodedOutput `json:"outputs"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding the result of job %s: %v", view.ID, err)
+	}
+	e.RequestID, e.Outputs = result.RequestID, result.Outputs
+	if len(result.Outputs) > 0 {
+		values := make([]string, len(result.Outputs))
+		for i, o := range result.Outputs {
+			values[i] = fmt.Sprintf("%s = %v", o.Name, o.Value)
+		}
+		e.Summary = append(e.Summary, "The proven outputs are "+strings.Join(values, ", ")+".")
+	}
+	if result.Transaction != "" {
+		e.Transactions = append(e.Transactions, explainedTransaction{"fulfillment", dst, result.Transaction, explorerLink(dst, result.Transaction)})
+		e.Summary = append(e.Summary, fmt.Sprintf("Brevis request %s delivered them to chain %d in transaction %s.", result.RequestID, dst, result.Transaction))
+	}
+	return e, nil
+}
+
+// handleJobExplain answers with a readable account of a job: the slots its
+// proof reads and at which blocks, what its circuit asserts, the outputs
+// it proved and the transactions involved, linked on the chain's explorer.
+func handleJobExplain(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	j, err := lookupJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	e, err := j.explain()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error explaining job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// maxScaleDecimals bounds the fractional digits of a scale factor, matching
+// the 18 decimals most ERC-20 style fixed-point values use.
+const maxScaleDecimals = 18
+
+// fixedPoint is a non-negative decimal held as numerator / 10^decimals.
+type fixedPoint struct {
+	numerator *big.Int
+	decimals  int
+}
+
+// parseFixedPoint parses a plain decimal such as "0.4193" or "2".
+func parseFixedPoint(s string) (fixedPoint, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || strings.ContainsAny(whole+frac, "+-") {
+		return fixedPoint{}, fmt.Errorf("invalid scale factor %q", s)
+	}
+	if len(frac) > maxScaleDecimals {
+		return fixedPoint{}, fmt.Errorf("scale factor %q has more than %d decimals", s, maxScaleDecimals)
+	}
+	n, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok {
+		return fixedPoint{}, fmt.Errorf("invalid scale factor %q", s)
+	}
+	if n.Sign() == 0 {
+		return fixedPoint{}, fmt.Errorf("scale factor must be greater than zero")
+	}
+	if n.BitLen() > 128 {
+		return fixedPoint{}, fmt.Errorf("scale factor %q exceeds 128 bits", s)
+	}
+	return fixedPoint{numerator: n, decimals: len(frac)}, nil
+}
+
+func (f fixedPoint) denominator() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(f.decimals)), nil)
+}
+
+// fixedMul returns floor(v * f). v is range checked so the intermediate
+// product stays within 248 bits rather than wrapping in the field.
+func fixedMul(api *sdk.CircuitAPI, v sdk.Uint248, f fixedPoint) sdk.Uint248 {
+	u248 := api.Uint248
+	maxInput := new(big.Int).Div(sdk.MaxUint248, f.numerator)
+	u248.AssertIsLessOrEqual(v, sdk.ConstUint248(maxInput))
+	product := u248.Mul(v, sdk.ConstUint248(f.numerator))
+	quotient, _ := u248.Div(product, sdk.ConstUint248(f.denominator()))
+	return quotient
+}
+
+// fixedMulInt is fixedMul on values outside the circuit.
+func fixedMulInt(v *big.Int, f fixedPoint) *big.Int {
+	product := new(big.Int).Mul(v, f.numerator)
+	return product.Div(product, f.denominator())
+}
+
+// weightedValue is emissionValue scaled by the spec's scale factor, if any.
+// It is the value the circuit aggregates and outputs.
+func (c *AppCircuit) weightedValue(api *sdk.CircuitAPI, slot sdk.StorageSlot) sdk.Uint248 {
+	v := c.emissionValue(api, slot)
+	if c.Spec.ScaleFactor == "" {
+		return v
+	}
+	f, _ := parseFixedPoint(c.Spec.ScaleFactor)
+	return fixedMul(api, v, f)
+}
+
+// checkScaledRange reports the first queried slot whose value is too large to
+// scale, or with the EMA aggregation to average, without overflowing 248
+// bits, which would otherwise only surface as an unsatisfied constraint
+// during witness generation.
+func (c *AppCircuit) checkScaledRange(in sdk.CircuitInput) error {
+	if c.Spec.ScaleFactor == "" && c.Spec.Aggregation != AggregationEMA {
+		return nil
+	}
+	for i, slot := range in.StorageSlots.Raw {
+		if !toggleSet(in.StorageSlots.Toggles[i]) {
+			continue
+		}
+		if c.Spec.ScaleFactor != "" {
+			f, _ := parseFixedPoint(c.Spec.ScaleFactor)
+			spec := c.Spec
+			spec.ScaleFactor = ""
+			value := (&AppCircuit{Spec: spec}).offCircuitWeighted(bytes32Int(slot.Value))
+			if value.Cmp(new(big.Int).Div(sdk.MaxUint248, f.numerator)) > 0 {
+				return fmt.Errorf("storage slot %d value %s overflows 248 bits when scaled by %s", i, value, c.Spec.ScaleFactor)
+			}
+		}
+		if c.Spec.Aggregation == AggregationEMA {
+			if value := c.offCircuitWeighted(bytes32Int(slot.Value)); value.Cmp(maxEMASample) > 0 {
+				return fmt.Errorf("storage slot %d value %s exceeds %s, the largest the EMA can weight without overflowing 248 bits", i, value, maxEMASample)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package main
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative brevis.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	brevispb "brevis_api/proto"
+)
+
+// grpcPort serves the gRPC API of proto/brevis.proto beside the HTTP one.
+// Empty serves none.
+var grpcPort = ""
+
+var grpcServer *grpc.Server
+
+// grpcScopes is the API key scope each method needs, as routeScope is for
+// the endpoint it mirrors.
+var grpcScopes = map[string]string{
+	brevispb.Prover_PrepareCircuit_FullMethodName:  ScopePrepare,
+	brevispb.Prover_SubmitProof_FullMethodName:     ScopeSubmit,
+	brevispb.Prover_GetJob_FullMethodName:          ScopeRead,
+	brevispb.Prover_StreamJobEvents_FullMethodName: ScopeRead,
+}
+
+// startGRPCServer serves the gRPC API on grpcPort, if set, until
+// shutdownServer stops it.
+func startGRPCServer() error {
+	grpcPort = os.Getenv("BREVIS_GRPC_PORT")
+	if grpcPort == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		return fmt.Errorf("gRPC server: %v", err)
+	}
+	grpcServer = grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := admitGRPC(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := handler(ctx, req)
+			return resp, grpcError(err)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := admitGRPC(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return grpcError(handler(srv, &grpcStream{ss, ctx}))
+		}),
+	)
+	brevispb.RegisterProverServer(grpcServer, proverService{})
+	go func() {
+		if err := grpcServer.Serve(ln); err != nil {
+			slog.Error("gRPC server stopped", "err", err)
+		}
+	}()
+	slog.Info("gRPC server running", "port", grpcPort)
+	return nil
+}
+
+// grpcStream runs a stream under the context admitGRPC tagged.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context { return s.ctx }
+
+// admitGRPC does for a call what withCorrelation, withAPIKeys and
+// withRateLimit do for a request: it tags ctx with a correlation ID, echoed
+// in the x-request-id header, and the caller's key once auth is enabled,
+// and refuses callers over their rate limit.
+func admitGRPC(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := firstMetadata(md, strings.ToLower(correlationHeader))
+	if id == "" || len(id) > 128 {
+		id = newJobID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(correlationHeader), id))
+	ctx = withCorrelationID(ctx, id)
+
+	if authEnabled.Load() {
+		key := firstMetadata(md, "x-api-key")
+		if v, ok := strings.CutPrefix(firstMetadata(md, "authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(v)
+		}
+		if key == "" {
+			return nil, status.Error(codes.Unauthenticated, "API key required; send authorization: Bearer <key>")
+		}
+		k, ok, err := lookupAPIKey(ctx, key)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error looking up API key", "err", err)
+			return nil, status.Error(codes.Internal, "Error checking API key")
+		}
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "Invalid API key")
+		}
+		if scope := grpcScopes[method]; !k.allows(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "API key %s lacks scope %q", k.Name, scope)
+		}
+		ctx = withAPIKey(ctx, k)
+	}
+
+	client := grpcClient(ctx)
+	if _, ok := takeToken(client); !ok {
+		rateLimitedTotal.WithLabelValues("rate").Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "Rate limit of %d requests a minute exceeded; try again later", limitsFor(client).RateLimit)
+	}
+	return ctx, nil
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// grpcClient is the client a call counts against, as clientFor is for a
+// request.
+func grpcClient(ctx context.Context) string {
+	if name := apiKeyName(ctx); name != "" {
+		return name
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "addr:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "addr:" + host
+}
+
+// grpcError maps the HTTP status of err to a gRPC code.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Internal
+	switch httpStatus(err) {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+// circuitSpec is the spec m selects, with the defaults and checks
+// parseCircuitSpec gives the same parameters.
+func circuitSpec(m *brevispb.CircuitSpec) (CircuitSpec, error) {
+	if m == nil {
+		return CircuitSpec{}, errors.New("spec is required")
+	}
+	spec := CircuitSpec{Circuit: m.Circuit, Aggregation: m.Aggregation, TopK: int(m.K), Window: int(m.Window), AlphaBps: int(m.AlphaBps),
+		ValueMode: m.ValueMode, ScaleFactor: m.ScaleFactor, Bucket: m.Bucket, ExpectedEmission: m.ExpectedEmission, Mode: m.Mode, TotalCap: m.TotalCap, Slots: int(m.Slots)}
+	for _, f := range m.Fields {
+		spec.Fields = append(spec.Fields, PackedField{Name: f.Name, Offset: int(f.Offset), Bits: int(f.Bits)})
+	}
+	spec.setDefaults()
+	for _, p := range []struct {
+		circuit string
+		given   bool
+	}{
+		{CircuitStockFlow, m.StockFlow != nil},
+		{CircuitReceiptEmissions, m.ReceiptEmissions != nil},
+		{CircuitBlockRange, m.BlockRange != nil},
+	} {
+		if p.given && spec.Circuit != p.circuit {
+			return spec, fmt.Errorf("%s is only valid with circuit %q", p.circuit, p.circuit)
+		}
+		if !p.given && spec.Circuit == p.circuit {
+			return spec, fmt.Errorf("circuit %q requires %s", p.circuit, p.circuit)
+		}
+	}
+
+	var err error
+	if m := m.StockFlow; m != nil {
+		p := &StockFlowParams{AmountIndex: int(m.AmountIndex)}
+		if p.Registry, err = parseAddress("registry", m.Registry); err != nil {
+			return spec, err
+		}
+		if p.CounterSlot, err = parseSlotKey(m.CounterSlot); err != nil {
+			return spec, fmt.Errorf("counter_slot: %v", err)
+		}
+		if p.EventID, err = parseHash("event_id", m.EventId); err != nil {
+			return spec, err
+		}
+		if p.AmountIndex < 0 {
+			return spec, fmt.Errorf("amount_index must not be negative, got %d", p.AmountIndex)
+		}
+		spec.StockFlow = p
+	}
+	if m := m.ReceiptEmissions; m != nil {
+		p := &ReceiptEmissionsParams{AmountIndex: int(m.AmountIndex), AmountIsTopic: m.AmountIsTopic, MaxReceipts: int(m.MaxReceipts)}
+		if p.MaxReceipts == 0 {
+			p.MaxReceipts = defaultMaxReceipts
+		}
+		if p.Emitter, err = parseAddress("emitter", m.Emitter); err != nil {
+			return spec, err
+		}
+		if p.EventID, err = parseHash("event_id", m.EventId); err != nil {
+			return spec, err
+		}
+		if err := p.validate(); err != nil {
+			return spec, err
+		}
+		spec.ReceiptEmissions = p
+	}
+	if m := m.BlockRange; m != nil {
+		p := &BlockRangeParams{}
+		if p.Contract, err = parseAddress("contract", m.Contract); err != nil {
+			return spec, err
+		}
+		if p.Slot, err = parseSlotKey(m.Slot); err != nil {
+			return spec, err
+		}
+		spec.BlockRange = p
+	}
+	if errs := spec.violations(); len(errs) > 0 {
+		return spec, errs[0]
+	}
+	return spec, nil
+}
+
+// submitOptionsOf returns the options m sets over the tenant's defaults t, as
+// parseSubmitOptions reads them from a request.
+func submitOptionsOf(m *brevispb.SubmitOptions, t tenantSettings) (submitOptions, error) {
+	opts := defaultSubmitOptions()
+	if err := t.apply(&opts); err != nil {
+		return opts, err
+	}
+	if m == nil {
+		return opts, opts.check()
+	}
+	if m.SubmitTimeout != nil {
+		opts.SubmitTimeout = m.SubmitTimeout.AsDuration()
+	}
+	if m.SubmitRetries != nil {
+		opts.SubmitRetries = int(*m.SubmitRetries)
+	}
+	if m.FulfillmentWindow != nil {
+		opts.FulfillmentWindow = m.FulfillmentWindow.AsDuration()
+	}
+	if m.CallbackUrl != "" {
+		opts.CallbackURL = m.CallbackUrl
+	}
+	if m.ChainId != 0 {
+		opts.SrcChainID = m.ChainId
+	}
+	if m.DstChainId != 0 {
+		opts.DstChainID = m.DstChainId
+	}
+	if m.CallbackContract != "" {
+		addr, err := parseAddress("callback_contract", m.CallbackContract)
+		if err != nil {
+			return opts, err
+		}
+		opts.CallbackContract = addr
+	}
+	if m.CallbackGasLimit != 0 {
+		opts.CallbackGasLimit = m.CallbackGasLimit
+	}
+	if m.QueryOption != "" {
+		option, ok := queryOptions[m.QueryOption]
+		if !ok {
+			return opts, fmt.Errorf("invalid query_option %q: want zk or op", m.QueryOption)
+		}
+		opts.QueryOption = option
+	}
+	return opts, opts.check()
+}
+
+// submissionOf is the submission req asks for, checked as parseSubmission
+// checks a /submit-proof request.
+func submissionOf(ctx context.Context, req *brevispb.SubmitProofRequest) (*submission, error) {
+	var spec CircuitSpec
+	var err error
+	if name := req.GetCircuitName(); name != "" {
+		spec, err = activeCircuitSpec(name)
+	} else {
+		spec, err = circuitSpec(req.GetSpec())
+	}
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, fmt.Errorf("Invalid circuit spec: %v", err)}
+	}
+
+	var pin *snapshotPin
+	if p := req.Snapshot; p != nil {
+		hash, err := parseHash("snapshot block_hash", p.BlockHash)
+		if err != nil {
+			return nil, &statusError{http.StatusBadRequest, err}
+		}
+		pin = &snapshotPin{Name: p.Name, BlockNumber: p.BlockNumber, BlockHash: hash}
+	}
+
+	tenant, err := lookupTenantSettings(ctx, apiKeyName(ctx))
+	if err != nil {
+		return nil, err
+	}
+	opts, err := submitOptionsOf(req.Options, tenant)
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+
+	all := make([]storageQuery, len(req.Queries))
+	for i, q := range req.Queries {
+		all[i] = storageQuery{Contract: q.Contract, Slot: q.Slot, BlockNumber: q.BlockNumber}
+	}
+	queries, err := storageData(all)
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+	receipts := make([]receiptQuery, len(req.Receipts))
+	for i, q := range req.Receipts {
+		receipts[i].LogIndex = uint(q.LogIndex)
+		if receipts[i].TxHash, err = parseHash("tx_hash", q.TxHash); err != nil {
+			return nil, &statusError{http.StatusBadRequest, fmt.Errorf("receipt %d: %v", i, err)}
+		}
+		for _, t := range q.Topics {
+			topic, err := parseHash("topic", t)
+			if err != nil {
+				return nil, &statusError{http.StatusBadRequest, fmt.Errorf("receipt %d: %v", i, err)}
+			}
+			receipts[i].Topics = append(receipts[i].Topics, topic)
+		}
+	}
+	if err := checkReceipts(receipts); err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+
+	rng := blockRange{samples: 2}
+	if r := req.Range; r != nil {
+		rng.start, rng.end = r.StartBlock, r.EndBlock
+		if r.Samples != 0 {
+			rng.samples = int(r.Samples)
+		}
+	} else if spec.Circuit == CircuitBlockRange && len(queries) == 0 {
+		return nil, &statusError{http.StatusBadRequest, fmt.Errorf("circuit %q requires range", CircuitBlockRange)}
+	}
+	if queries, err = sampledQueries(spec, rng, queries); err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+
+	sub := &submission{spec: spec, queries: queries, receipts: receipts, pin: pin, opts: opts}
+	if err := sub.route(ctx, tenant, req.GetOptions().GetConfirmMainnet()); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+type proverService struct {
+	brevispb.UnimplementedProverServer
+}
+
+func (proverService) PrepareCircuit(ctx context.Context, req *brevispb.PrepareCircuitRequest) (*brevispb.PrepareCircuitResponse, error) {
+	spec, err := circuitSpec(req.Spec)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid circuit spec: %v", err)
+	}
+	if len(spec.variants()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec)
+	}
+	repaired, err := prepareCircuit(ctx, spec)
+	if err != nil {
+		slog.ErrorContext(ctx, "Circuit preparation failed", "spec", spec, "err", err)
+		return nil, err
+	}
+	return &brevispb.PrepareCircuitResponse{Spec: spec.String(), Quarantined: repaired}, nil
+}
+
+func (proverService) SubmitProof(ctx context.Context, req *brevispb.SubmitProofRequest) (*brevispb.Job, error) {
+	if isDraining() {
+		return nil, errDraining
+	}
+	sub, err := submissionOf(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	client := grpcClient(ctx)
+	if err := useProofQuota(ctx, client); err != nil {
+		return nil, err
+	}
+	j, err := enqueueJob(ctx, sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
+	if err != nil {
+		releaseProofQuota(ctx, client)
+		return nil, err
+	}
+	view := j.view()
+	return jobMessage(&view)
+}
+
+func (proverService) GetJob(ctx context.Context, req *brevispb.GetJobRequest) (*brevispb.Job, error) {
+	j, err := lookupJob(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	view := j.view()
+	return jobMessage(&view)
+}
+
+func (proverService) StreamJobEvents(req *brevispb.StreamJobEventsRequest, stream brevispb.Prover_StreamJobEventsServer) error {
+	ctx := stream.Context()
+	j, err := watchJob(ctx, req.Id)
+	if err != nil {
+		return err
+	}
+	if req.After < 0 {
+		return status.Errorf(codes.InvalidArgument, "Invalid after %d", req.After)
+	}
+
+	sent := int(req.After)
+	var sendErr error
+	final, ok := followJob(ctx, j, sent, nil, func(e jobEvent) {
+		sent++
+		if sendErr == nil {
+			sendErr = stream.Send(&brevispb.JobEvent{Sequence: int32(sent), Stage: e.Stage, Time: timestamppb.New(e.Time)})
+		}
+	}, func() {})
+	if sendErr != nil {
+		return sendErr
+	}
+	if !ok {
+		return ctx.Err()
+	}
+	done, err := jobMessage(&final)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&brevispb.JobEvent{Done: done})
+}
+
+// jobMessage is j as the gRPC API returns it.
+func jobMessage(j *job) (*brevispb.Job, error) {
+	m := &brevispb.Job{
+		Id:            j.ID,
+		Status:        j.Status,
+		Spec:          j.Spec,
+		Created:       timestamppb.New(j.Created),
+		Started:       optionalTimestamp(j.Started),
+		Finished:      optionalTimestamp(j.Finished),
+		Eta:           optionalTimestamp(j.ETA),
+		Stage:         j.Stage,
+		Error:         j.Error,
+		ErrorStatus:   int32(j.ErrorStatus),
+		ErrorClass:    j.ErrorClass,
+		TimeoutStage:  j.TimeoutStage,
+		CorrelationId: j.CorrelationID,
+	}
+	if j.Result != nil {
+		// The result holds typed values; its JSON form is what a Struct
+		// carries.
+		b, err := json.Marshal(j.Result)
+		if err != nil {
+			return nil, err
+		}
+		var generic map[string]interface{}
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return nil, err
+		}
+		if m.Result, err = structpb.NewStruct(generic); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// handleHealthz answers 200 for as long as the process serves requests.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz answers 200 once the instance can take /submit-proof traffic:
+// at least one circuit is prepared, the SRS is on disk, the profile's chain has a
+// reachable RPC provider and no drain has started. Otherwise it answers 503
+// naming the checks that failed.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"circuit": "ok",
+		"srs":     "ok",
+		"rpc":     "ok",
+		"drain":   "ok",
+	}
+	if preparedCount() == 0 {
+		checks["circuit"] = "not prepared"
+	}
+	if fi, err := os.Stat(filepath.Join(config.SRSDir, srsFile)); err != nil || fi.Size() == 0 {
+		checks["srs"] = "not downloaded"
+	}
+	if !rpcReachable(activeProfile.ChainID) {
+		checks["rpc"] = "no reachable provider"
+	}
+	if isDraining() {
+		checks["drain"] = "draining"
+	}
+
+	status := http.StatusOK
+	for _, c := range checks {
+		if c != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":  status == http.StatusOK,
+		"checks": checks,
+	})
+}
+
+// rpcReachable reports whether a provider of the chain has answered a probe
+// and is not failing most calls.
+func rpcReachable(chainID uint64) bool {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID && !p.LastProbed.IsZero() && p.ErrorRate < rpcHealthyErrorRate {
+			return true
+		}
+	}
+	return false
+}
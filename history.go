@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jobHistorySchema keeps every status change and progress stage of every
+// job, with a snapshot of the job as it was then. Rows are only inserted,
+// so a job's history outlives jobRetention and answers later disputes.
+const jobHistorySchema = `CREATE TABLE IF NOT EXISTS job_history (
+	job_id TEXT NOT NULL,
+	api_key TEXT NOT NULL DEFAULT '',
+	kind TEXT NOT NULL,
+	from_state TEXT NOT NULL DEFAULT '',
+	to_state TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	correlation_id TEXT NOT NULL DEFAULT '',
+	snapshot TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS job_history_job_id ON job_history (job_id, created_at)`
+
+// Kinds of job history event.
+const (
+	historyStatus = "status"
+	historyStage  = "stage"
+)
+
+// jobHistoryEvent is one change of a job: its status moving From To, or
+// its attempt reaching stage To. Actor names the key it was made under,
+// the job's own for changes its run makes, and is empty for the service's
+// own, such as releasing a held job. Snapshot is the job after the change.
+type jobHistoryEvent struct {
+	JobID         string          `json:"-"`
+	APIKey        string          `json:"-"`
+	Kind          string          `json:"kind"`
+	From          string          `json:"from,omitempty"`
+	To            string          `json:"to"`
+	Actor         string          `json:"actor,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Time          time.Time       `json:"time"`
+	Snapshot      json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// jobHistory carries events to writeJobHistory, in order. Nil without a
+// request store.
+var jobHistory chan jobHistoryEvent
+
+// loadJobHistory creates the history table and starts its writer. It runs
+// after loadRequestStore.
+func loadJobHistory() error {
+	if requestDB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, stmt := range strings.Split(jobHistorySchema, ";") {
+		if _, err := requestDB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating job history table: %v", err)
+		}
+	}
+	jobHistory = make(chan jobHistoryEvent, 1024)
+	go writeJobHistory()
+	return nil
+}
+
+// recordHistory queues an event of j for the history. The caller holds
+// jobsMutex for a job in the jobs map.
+func (j *job) recordHistory(ctx context.Context, kind, from, to string) {
+	if jobHistory == nil {
+		return
+	}
+	snapshot, err := json.Marshal(j)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording job history", "job", j.ID, "err", err)
+		return
+	}
+	e := jobHistoryEvent{JobID: j.ID, APIKey: j.APIKey, Kind: kind, From: from, To: to, Actor: apiKeyName(ctx),
+		CorrelationID: correlationID(ctx), Time: time.Now().UTC(), Snapshot: snapshot}
+	select {
+	case jobHistory <- e:
+	default:
+		slog.WarnContext(ctx, "Job history event dropped: writer behind", "job", j.ID, "kind", kind, "to", to)
+	}
+}
+
+// writeJobHistory inserts the events recordHistory queues.
+func writeJobHistory() {
+	for e := range jobHistory {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := requestDB.ExecContext(ctx, `INSERT INTO job_history
+			(job_id, api_key, kind, from_state, to_state, actor, correlation_id, snapshot, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			e.JobID, e.APIKey, e.Kind, e.From, e.To, e.Actor, e.CorrelationID, string(e.Snapshot), e.Time.Format(storeTimeLayout))
+		cancel()
+		if err != nil {
+			slog.Error("Error writing job history", "job", e.JobID, "kind", e.Kind, "to", e.To, "err", err)
+		}
+	}
+}
+
+// storedJobHistory reads job id's events, oldest first, and the key that
+// queued it.
+func storedJobHistory(ctx context.Context, id string) ([]jobHistoryEvent, string, error) {
+	rows, err := requestDB.QueryContext(ctx, `SELECT api_key, kind, from_state, to_state, actor, correlation_id, snapshot, created_at
+		FROM job_history WHERE job_id = $1 ORDER BY created_at`, id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var events []jobHistoryEvent
+	var owner string
+	for rows.Next() {
+		var e jobHistoryEvent
+		var snapshot, created string
+		if err := rows.Scan(&owner, &e.Kind, &e.From, &e.To, &e.Actor, &e.CorrelationID, &snapshot, &created); err != nil {
+			return nil, "", err
+		}
+		e.Snapshot = json.RawMessage(snapshot)
+		if t := parseStoreTime(created); t != nil {
+			e.Time = *t
+		}
+		events = append(events, e)
+	}
+	return events, owner, rows.Err()
+}
+
+// replayHistory is the state events lead to: the last status and stage,
+// and when the job was queued and finished.
+func replayHistory(events []jobHistoryEvent) map[string]interface{} {
+	state := map[string]interface{}{}
+	for _, e := range events {
+		switch e.Kind {
+		case historyStatus:
+			if e.From == "" {
+				state["created"] = e.Time
+			}
+			state["status"] = e.To
+			if len(jobTransitions[e.To]) == 0 {
+				state["finished"] = e.Time
+			}
+		case historyStage:
+			state["stage"] = e.To
+		}
+	}
+	return state
+}
+
+// handleJobHistory answers with a job's full history, each change with who
+// made it, when and a snapshot of the job after it, and the state replayed
+// from it. The history outlives the job's retention. Without a request
+// store, only a job still kept is answered, from its statuses and stages
+// and without snapshots.
+func handleJobHistory(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	id := r.PathValue("id")
+	var events []jobHistoryEvent
+	if requestDB != nil {
+		var owner string
+		var err error
+		events, owner, err = storedJobHistory(r.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading job history: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(events) == 0 || !mayActOn(r.Context(), owner) {
+			http.Error(w, fmt.Sprintf("No job %q", id), http.StatusNotFound)
+			return
+		}
+	} else {
+		j, err := lookupJob(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		view := j.view()
+		from := ""
+		for _, s := range view.States {
+			events = append(events, jobHistoryEvent{Kind: historyStatus, From: from, To: s.Status, Time: s.Time})
+			from = s.Status
+		}
+		jobsMutex.Lock()
+		for _, e := range j.events {
+			events = append(events, jobHistoryEvent{Kind: historyStage, To: e.Stage, Time: e.Time})
+		}
+		jobsMutex.Unlock()
+		slices.SortStableFunc(events, func(a, b jobHistoryEvent) int { return a.Time.Compare(b.Time) })
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     id,
+		"events": events,
+		"state":  replayHistory(events),
+	})
+}
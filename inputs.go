@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// The checks here run on every value a request supplies, as it is parsed
+// and before anything reaches the SDK, so that a bad address, slot or block
+// is answered at once instead of failing a job mid-proof.
+
+// parseAddress reads address s, the request's name parameter: 0x and 40
+// hex digits, in one case or, when mixed, in its EIP-55 checksum case.
+func parseAddress(name, s string) (common.Address, error) {
+	hex, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(hex) != 2*common.AddressLength || !isHex(hex) {
+		return common.Address{}, fmt.Errorf("invalid %s %q: want 0x and 40 hex digits", name, s)
+	}
+	addr := common.HexToAddress(s)
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && s != addr.Hex() {
+		return common.Address{}, fmt.Errorf("invalid %s %q: mixed case does not match its EIP-55 checksum %s", name, s, addr.Hex())
+	}
+	return addr, nil
+}
+
+// parseSlotKey reads a slot key given as 0x-prefixed hex of up to 32 bytes,
+// such as "0x0" or a full keccak-derived mapping key.
+func parseSlotKey(s string) (common.Hash, error) {
+	hex, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(hex) == 0 || len(hex) > 2*common.HashLength || !isHex(hex) {
+		return common.Hash{}, fmt.Errorf("invalid slot %q: want 0x-prefixed hex of up to 32 bytes", s)
+	}
+	return common.HexToHash(s), nil
+}
+
+// parseHash reads hash s, the request's name parameter: 0x and exactly 64
+// hex digits.
+func parseHash(name, s string) (common.Hash, error) {
+	hex, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(hex) != 2*common.HashLength || !isHex(hex) {
+		return common.Hash{}, fmt.Errorf("invalid %s %q: want 0x and 64 hex digits", name, s)
+	}
+	return common.HexToHash(s), nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkBlocks checks that every block of a submission to chainID is one its
+// providers can serve: not past the chain head and, when none of them keeps
+// historical state, within the prunedStateDepth blocks a pruned node does.
+// Block 0 is refused outright. When the head cannot be read the blocks are
+// let through for the pipeline to fail on.
+func checkBlocks(ctx context.Context, chainID uint64, blocks []uint64) error {
+	var highest uint64
+	for _, b := range blocks {
+		if b == 0 {
+			return &statusError{http.StatusBadRequest, fmt.Errorf("block 0 is the genesis block and holds no queryable state")}
+		}
+		highest = max(highest, b)
+	}
+	if highest == 0 {
+		return nil
+	}
+	head, err := chainHead(ctx, chainID, highest)
+	if err != nil {
+		slog.WarnContext(ctx, "Query blocks not checked against the chain head", "chain", chainID, "err", err)
+		return nil
+	}
+	if highest > head {
+		return &statusError{http.StatusBadRequest, fmt.Errorf("block %d is past the head of chain %d, block %d", highest, chainID, head)}
+	}
+	if chainHasArchive(chainID) {
+		return nil
+	}
+	for _, b := range blocks {
+		if head-b > prunedStateDepth {
+			return &statusError{http.StatusUnprocessableEntity, fmt.Errorf("block %d is %d blocks behind the head of chain %d; its RPC providers keep state for the latest %d", b, head-b, chainID, prunedStateDepth)}
+		}
+	}
+	return nil
+}
+
+// checkSubmissionBlocks checks the blocks sub queries and pins against its
+// source chain.
+func checkSubmissionBlocks(ctx context.Context, sub *submission) error {
+	blocks := make([]uint64, 0, len(sub.queries)+1)
+	for _, q := range sub.queries {
+		blocks = append(blocks, q.BlockNum.Uint64())
+	}
+	if sub.pin != nil {
+		blocks = append(blocks, sub.pin.BlockNumber)
+	}
+	return checkBlocks(ctx, sub.opts.SrcChainID, blocks)
+}
+
+// chainHead is the head of chainID. The head the providers reported when
+// last probed is used while it is at least atLeast; otherwise a provider is
+// asked for the current one.
+func chainHead(ctx context.Context, chainID, atLeast uint64) (uint64, error) {
+	rpcMutex.Lock()
+	var head uint64
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID {
+			head = max(head, p.Head)
+		}
+	}
+	rpcMutex.Unlock()
+	if head >= atLeast {
+		return head, nil
+	}
+
+	url := pickChainRPC(chainID)
+	if url == "" {
+		return 0, fmt.Errorf("chain %d has no RPC provider", chainID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ec, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	defer ec.Close()
+	start := time.Now()
+	head, err = ec.BlockNumber(ctx)
+	observeRPC(url, time.Since(start), err)
+	if err != nil {
+		return 0, err
+	}
+	recordHead(url, head)
+	return head, nil
+}
+
+// recordHead notes head as the latest block the provider at url reported.
+func recordHead(url string, head uint64) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	for _, p := range rpcProviders {
+		if p.URL == url && head > p.Head {
+			p.Head = head
+		}
+	}
+}
+
+// chainHasArchive reports whether a provider of chainID passed the archive
+// probe.
+func chainHasArchive(chainID uint64) bool {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID && p.Archive {
+			return true
+		}
+	}
+	return false
+}
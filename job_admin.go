@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jobFilter selects the jobs a bulk admin operation acts on.
+type jobFilter struct {
+	APIKey   string
+	Statuses []string
+	// OlderThan matches jobs created at least this long ago.
+	OlderThan time.Duration
+}
+
+// parseJobFilter reads api_key, status (comma-separated) and older_than (a
+// duration such as 30m). At least one is required, so that a bare call
+// does not act on every job.
+func parseJobFilter(q url.Values) (jobFilter, error) {
+	f := jobFilter{APIKey: q.Get("api_key")}
+	if v := q.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			switch s {
+			case JobQueued, JobHeld, JobRunning, JobSucceeded, JobFailed, JobCancelled, JobTimedOut:
+			default:
+				return f, fmt.Errorf("invalid status %q", s)
+			}
+			f.Statuses = append(f.Statuses, s)
+		}
+	}
+	if v := q.Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return f, fmt.Errorf("invalid older_than %q: want a positive duration such as 30m", v)
+		}
+		f.OlderThan = d
+	}
+	if f.APIKey == "" && f.Statuses == nil && f.OlderThan == 0 {
+		return f, fmt.Errorf("give at least one of api_key, status or older_than")
+	}
+	return f, nil
+}
+
+func (f jobFilter) matches(j *job, now time.Time) bool {
+	if f.APIKey != "" && j.APIKey != f.APIKey {
+		return false
+	}
+	if f.Statuses != nil && !slices.Contains(f.Statuses, j.Status) {
+		return false
+	}
+	return f.OlderThan == 0 || now.Sub(j.Created) >= f.OlderThan
+}
+
+// matchingJobs lists the IDs of the jobs f matches, oldest first. With a
+// Redis queue these are the queue's records, which cover every node's jobs;
+// otherwise this node's.
+func matchingJobs(ctx context.Context, f jobFilter) ([]string, error) {
+	now := time.Now()
+	var found []*job
+	if redisQueue != nil {
+		iter := redisQueue.Scan(ctx, 0, redisJobKey("*"), 100).Iterator()
+		for iter.Next(ctx) {
+			rj, err := loadRedisJob(ctx, strings.TrimPrefix(iter.Val(), redisJobKey("")))
+			if httpStatus(err) == http.StatusNotFound {
+				// Expired since the scan saw it.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if j := fromRecord(rj); f.matches(j, now) {
+				found = append(found, j)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		jobsMutex.Lock()
+		for _, j := range jobs {
+			if f.matches(j, now) {
+				found = append(found, j)
+			}
+		}
+		jobsMutex.Unlock()
+	}
+	slices.SortFunc(found, func(a, b *job) int { return a.Created.Compare(b.Created) })
+	ids := make([]string, len(found))
+	for i, j := range found {
+		ids[i] = j.ID
+	}
+	return ids, nil
+}
+
+// requeueJob stops running job id and puts it back on the queue, to start
+// over from its checkpoints: the way out for jobs stuck on a gateway or
+// RPC that has since been replaced. With a Redis queue, a job another node
+// is running is requeued by that node.
+func requeueJob(ctx context.Context, id string) error {
+	jobsMutex.Lock()
+	j, ok := jobs[id]
+	local := ok && (redisQueue == nil || j.consumed)
+	var err error
+	switch {
+	case !local:
+	case j.Status != JobRunning || j.cancelled:
+		err = &statusError{http.StatusConflict, fmt.Errorf("job %s is %s, not running", id, j.Status)}
+	case !j.requeued:
+		j.requeued = true
+		j.cancel()
+	}
+	jobsMutex.Unlock()
+	if local {
+		if err == nil {
+			slog.InfoContext(ctx, "Requeueing job", "job", id)
+		}
+		return err
+	}
+	if redisQueue == nil {
+		return &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	rj, err := loadRedisJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rj.Status != JobRunning {
+		return &statusError{http.StatusConflict, fmt.Errorf("job %s is %s, not running", id, rj.Status)}
+	}
+	return redisQueue.Publish(ctx, redisRequeueChannel, id).Err()
+}
+
+// requeueStopped puts job j, whose attempt requeueJob stopped, back in the
+// queue. Its state is kept for it to resume from. The Redis queue's
+// runRedisJob pushes it back itself.
+func requeueStopped(ctx context.Context, j *job) {
+	jobsMutex.Lock()
+	j.requeued = false
+	if err := j.setStatus(ctx, JobQueued); err != nil {
+		jobsMutex.Unlock()
+		slog.ErrorContext(ctx, "Not requeueing job", "job", j.ID, "err", err)
+		return
+	}
+	j.Started, j.ETA, j.cancel = nil, nil, nil
+	j.notify()
+	jobsMutex.Unlock()
+	slog.InfoContext(ctx, "Job requeued", "job", j.ID)
+	if redisQueue != nil {
+		return
+	}
+	saveJobState(j)
+	// Sent from its own goroutine, as the worker sending it reads the queue
+	// too.
+	go func() { jobQueue <- j }()
+}
+
+// handleAdminJobs cancels or requeues every job matching the filter in the
+// query. POST /admin/jobs/cancel cancels queued, held and running jobs;
+// POST /admin/jobs/requeue restarts running ones. Jobs the operation does
+// not apply to are listed as skipped with the reason.
+func handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var act func(ctx context.Context, id string) error
+	switch r.PathValue("action") {
+	case "cancel":
+		act = func(ctx context.Context, id string) error {
+			_, err := cancelJob(ctx, id)
+			return err
+		}
+	case "requeue":
+		act = requeueJob
+	default:
+		http.Error(w, fmt.Sprintf("Unknown action %q: want cancel or requeue", r.PathValue("action")), http.StatusNotFound)
+		return
+	}
+	f, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, err := matchingJobs(r.Context(), f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	done := []string{}
+	skipped := map[string]string{}
+	for _, id := range ids {
+		if err := act(r.Context(), id); err != nil {
+			skipped[id] = err.Error()
+			continue
+		}
+		done = append(done, id)
+	}
+	slog.InfoContext(r.Context(), "Bulk job operation", "action", r.PathValue("action"), "matched", len(ids), "done", len(done), "skipped", len(skipped))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matched": len(ids),
+		"done":    done,
+		"skipped": skipped,
+	})
+}
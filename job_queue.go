@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Node roles. An API node queues jobs for prover nodes to run; a prover
+// node runs jobs from the queue; "all" does both.
+const (
+	RoleAll    = "all"
+	RoleAPI    = "api"
+	RoleProver = "prover"
+)
+
+var (
+	// jobQueueURL is the Redis the job queue lives in, as redis://host:port/db.
+	// Empty keeps the queue in process.
+	jobQueueURL = ""
+	nodeRole    = RoleAll
+	// consumerID names this node's in-progress list in the queue. Jobs a
+	// prover node was running when it stopped are requeued when a node with
+	// the same ID starts, so it should be stable across restarts, such as a
+	// StatefulSet pod name.
+	consumerID = ""
+
+	redisQueue *redis.Client
+	// jobUpdates carries the changes of jobs this node runs from the queue
+	// to publishJobUpdates, in order.
+	jobUpdates = make(chan redisJob, 1024)
+)
+
+const (
+	redisQueueKey       = "brevis:jobs:queue"
+	redisHeldKey        = "brevis:jobs:held"
+	redisUpdatesChannel = "brevis:jobs:updates"
+	redisCancelChannel  = "brevis:jobs:cancel"
+	redisRequeueChannel = "brevis:jobs:requeue"
+)
+
+func redisJobKey(id string) string {
+	return "brevis:job:" + id
+}
+
+func redisProcessingKey() string {
+	return "brevis:jobs:processing:" + consumerID
+}
+
+// redisJob is a job as the queue keeps and publishes it, with what it needs
+// to run and the progress it has reported.
+type redisJob struct {
+	jobCheckpoint
+	Events []jobEvent `json:"events,omitempty"`
+}
+
+// loadJobQueue reads BREVIS_JOB_QUEUE_URL, BREVIS_ROLE and
+// BREVIS_CONSUMER_ID and connects to the queue.
+func loadJobQueue() error {
+	jobQueueURL = os.Getenv("BREVIS_JOB_QUEUE_URL")
+	if v := os.Getenv("BREVIS_ROLE"); v != "" {
+		nodeRole = v
+	}
+	switch nodeRole {
+	case RoleAll:
+	case RoleAPI, RoleProver:
+		if jobQueueURL == "" {
+			return fmt.Errorf("BREVIS_ROLE %s requires BREVIS_JOB_QUEUE_URL", nodeRole)
+		}
+	default:
+		return fmt.Errorf("invalid BREVIS_ROLE %q: want all, api or prover", nodeRole)
+	}
+	if jobQueueURL == "" {
+		return nil
+	}
+	consumerID = os.Getenv("BREVIS_CONSUMER_ID")
+	if consumerID == "" {
+		var err error
+		if consumerID, err = os.Hostname(); err != nil {
+			return fmt.Errorf("naming queue consumer: %v", err)
+		}
+	}
+	opts, err := redis.ParseURL(jobQueueURL)
+	if err != nil {
+		return fmt.Errorf("invalid BREVIS_JOB_QUEUE_URL: %v", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("connecting to job queue: %v", err)
+	}
+	redisQueue = client
+	slog.Info("Using Redis job queue", "role", nodeRole, "consumer", consumerID)
+	return nil
+}
+
+// startRedisJobs starts the goroutines that keep this node's copies of jobs
+// current and, unless it only serves the API, run jobs from the queue.
+func startRedisJobs() error {
+	go followJobUpdates()
+	if nodeRole == RoleAPI {
+		return nil
+	}
+	if err := requeueProcessing(context.Background()); err != nil {
+		return fmt.Errorf("requeueing interrupted jobs: %v", err)
+	}
+	go publishJobUpdates()
+	go followCancels()
+	for i := 0; i < max(jobWorkers, 1); i++ {
+		go consumeRedisJobs()
+	}
+	return nil
+}
+
+// saveRedisJob writes j's record, expiring it jobRetention after it
+// finishes.
+func saveRedisJob(ctx context.Context, rj redisJob) error {
+	b, err := json.Marshal(rj)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if rj.Finished != nil {
+		ttl = jobRetention
+	}
+	return redisQueue.Set(ctx, redisJobKey(rj.ID), b, ttl).Err()
+}
+
+func loadRedisJob(ctx context.Context, id string) (*redisJob, error) {
+	b, err := redisQueue.Get(ctx, redisJobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rj redisJob
+	if err := json.Unmarshal(b, &rj); err != nil {
+		return nil, fmt.Errorf("decoding job %s: %v", id, err)
+	}
+	return &rj, nil
+}
+
+// record is j as the queue keeps it. The caller holds jobsMutex.
+func (j *job) record() redisJob {
+	return redisJob{
+		jobCheckpoint: jobCheckpoint{job: *j, CircuitSpec: j.spec, Queries: j.queries, Receipts: j.receipts, Pin: j.pin},
+		Events:        append([]jobEvent(nil), j.events...),
+	}
+}
+
+// fromRecord is the job rj records.
+func fromRecord(rj *redisJob) *job {
+	j := rj.job
+	j.spec, j.queries, j.receipts, j.pin = rj.CircuitSpec, rj.Queries, rj.Receipts, rj.Pin
+	j.events = rj.Events
+	j.updated, j.cancel, j.cancelled, j.consumed = nil, nil, false, false
+	return &j
+}
+
+// pushRedisJob queues j for a prover node, refusing it once jobQueueSize
+// jobs are waiting.
+func pushRedisJob(ctx context.Context, j *job) error {
+	n, err := redisQueue.LLen(ctx, redisQueueKey).Result()
+	if err != nil {
+		return err
+	}
+	if n >= int64(jobQueueSize) {
+		return &statusError{http.StatusServiceUnavailable, fmt.Errorf("job queue is full (%d jobs); try again later", n)}
+	}
+	jobsMutex.Lock()
+	rj := j.record()
+	jobsMutex.Unlock()
+	if err := saveRedisJob(ctx, rj); err != nil {
+		return err
+	}
+	return redisQueue.LPush(ctx, redisQueueKey, j.ID).Err()
+}
+
+// consumeRedisJobs runs jobs from the queue one at a time, moving each to
+// this node's in-progress list while it runs so that it is requeued if the
+// node stops first.
+func consumeRedisJobs() {
+	ctx := context.Background()
+	for {
+		if isDraining() {
+			return
+		}
+		id, err := redisQueue.BLMove(ctx, redisQueueKey, redisProcessingKey(), "RIGHT", "LEFT", 5*time.Second).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Error taking job from queue", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		runRedisJob(ctx, id)
+	}
+}
+
+func runRedisJob(ctx context.Context, id string) {
+	defer redisQueue.LRem(ctx, redisProcessingKey(), 1, id)
+	rj, err := loadRedisJob(ctx, id)
+	if err != nil {
+		slog.Error("Skipping queued job", "job", id, "err", err)
+		return
+	}
+	// A job cancelled while queued stays in the queue until taken.
+	if rj.Status != JobQueued {
+		return
+	}
+
+	jobsMutex.Lock()
+	j, ok := jobs[id]
+	if !ok {
+		j = fromRecord(rj)
+		jobs[id] = j
+	}
+	j.consumed = true
+	jobsMutex.Unlock()
+	// From here followJobUpdates passes cancels of the job on to it. One
+	// made since the record was read is only in the record.
+	if rj, err := loadRedisJob(ctx, id); err == nil && rj.Status == JobCancelled {
+		jobsMutex.Lock()
+		j.consumed = false
+		j.apply(rj)
+		jobsMutex.Unlock()
+		slog.Info("Skipping job cancelled as it was taken", "job", id)
+		return
+	}
+	saveJobState(j)
+	runJob(j)
+
+	jobsMutex.Lock()
+	stillQueued, held := j.Status == JobQueued, j.Status == JobHeld
+	record := j.record()
+	jobsMutex.Unlock()
+	if held {
+		// runJob found it over budget.
+		if err := holdRedisRecord(ctx, record); err != nil {
+			slog.Error("Error holding job", "job", id, "err", err)
+		}
+		return
+	}
+	if stillQueued {
+		// runJob left it for a drain, or requeueJob stopped it; put it back
+		// for another node, recorded as queued first so that the node
+		// taking it runs it.
+		if err := saveRedisJob(ctx, record); err != nil {
+			slog.Error("Error saving requeued job", "job", id, "err", err)
+		}
+		if err := redisQueue.RPush(ctx, redisQueueKey, id).Err(); err != nil {
+			slog.Error("Error requeueing job", "job", id, "err", err)
+		}
+	}
+}
+
+// holdRedisJob records j, over budget, as held until a node's
+// releaseHeldJobs finds room for it.
+func holdRedisJob(ctx context.Context, j *job) error {
+	jobsMutex.Lock()
+	rj := j.record()
+	jobsMutex.Unlock()
+	return holdRedisRecord(ctx, rj)
+}
+
+func holdRedisRecord(ctx context.Context, rj redisJob) error {
+	b, err := json.Marshal(rj)
+	if err != nil {
+		return err
+	}
+	_, err = redisQueue.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, redisJobKey(rj.ID), b, 0)
+		p.LPush(ctx, redisHeldKey, rj.ID)
+		p.Publish(ctx, redisUpdatesChannel, b)
+		return nil
+	})
+	return err
+}
+
+// releaseRedisHeld moves the held jobs the budget has room for back to the
+// front of the queue, oldest first. Every node checks; the watch on a job's
+// record lets only one release it, and keeps a cancel from being undone.
+func releaseRedisHeld(ctx context.Context) error {
+	ids, err := redisQueue.LRange(ctx, redisHeldKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		err := redisQueue.Watch(ctx, func(tx *redis.Tx) error {
+			rj, err := loadRedisJob(ctx, id)
+			if httpStatus(err) == http.StatusNotFound || err == nil && rj.Status != JobHeld {
+				// Expired or cancelled.
+				return redisQueue.LRem(ctx, redisHeldKey, 1, id).Err()
+			}
+			if err != nil {
+				return err
+			}
+			if checkBudget(ctx, rj.APIKey) != nil {
+				return nil
+			}
+			if err := rj.setStatus(ctx, JobQueued); err != nil {
+				return err
+			}
+			b, err := json.Marshal(rj)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				p.LRem(ctx, redisHeldKey, 1, id)
+				p.Set(ctx, redisJobKey(id), b, 0)
+				p.RPush(ctx, redisQueueKey, id)
+				p.Publish(ctx, redisUpdatesChannel, b)
+				return nil
+			})
+			if err == nil {
+				slog.InfoContext(withCorrelationID(ctx, rj.CorrelationID), "Released held job", "job", id)
+			}
+			return err
+		}, redisJobKey(id))
+		if err != nil && !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeueProcessing puts the jobs this node was running back on the queue,
+// to start over from their checkpoints.
+func requeueProcessing(ctx context.Context) error {
+	for {
+		id, err := redisQueue.LMove(ctx, redisProcessingKey(), redisQueueKey, "RIGHT", "RIGHT").Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rj, err := loadRedisJob(ctx, id)
+		if err != nil {
+			slog.Warn("Requeued job without a record", "job", id, "err", err)
+			continue
+		}
+		if rj.Status == JobRunning {
+			rj.setStatus(ctx, JobQueued)
+			rj.Started, rj.ETA = nil, nil
+			if err := saveRedisJob(ctx, *rj); err != nil {
+				return err
+			}
+		}
+		slog.Info("Requeued job interrupted on this node", "job", id)
+	}
+}
+
+// publish hands a change of a job this node runs from the queue to
+// publishJobUpdates. The caller holds jobsMutex.
+func (j *job) publish() {
+	if redisQueue == nil || !j.consumed {
+		return
+	}
+	select {
+	case jobUpdates <- j.record():
+	default:
+		slog.Warn("Job update dropped: publisher behind", "job", j.ID, "status", j.Status)
+	}
+}
+
+// publishJobUpdates saves and announces each change of the jobs this node
+// runs, so the node that queued one can answer for it.
+func publishJobUpdates() {
+	ctx := context.Background()
+	for rj := range jobUpdates {
+		if err := saveRedisJob(ctx, rj); err != nil {
+			slog.Error("Error saving job update", "job", rj.ID, "err", err)
+			continue
+		}
+		b, _ := json.Marshal(rj)
+		if err := redisQueue.Publish(ctx, redisUpdatesChannel, b).Err(); err != nil {
+			slog.Error("Error publishing job update", "job", rj.ID, "err", err)
+		}
+	}
+}
+
+// followJobUpdates applies the changes other nodes publish to this node's
+// copies of the jobs, waking their event streams. A job this node runs
+// takes only a cancel from them: one another node recorded while the job
+// was still queued there, as this node took it.
+func followJobUpdates() {
+	sub := redisQueue.Subscribe(context.Background(), redisUpdatesChannel)
+	for msg := range sub.Channel() {
+		var rj redisJob
+		if err := json.Unmarshal([]byte(msg.Payload), &rj); err != nil {
+			slog.Warn("Ignoring undecodable job update", "err", err)
+			continue
+		}
+		jobsMutex.Lock()
+		j, ok := jobs[rj.ID]
+		cancelled := ok && j.consumed && rj.Status == JobCancelled && !j.cancelled && (j.Status == JobQueued || j.Status == JobRunning)
+		if ok && !j.consumed {
+			j.apply(&rj)
+		}
+		jobsMutex.Unlock()
+		if cancelled {
+			cancelJob(context.Background(), rj.ID)
+		}
+	}
+}
+
+// apply brings this node's copy j of another node's job up to date with
+// rj, waking its event streams. The caller holds jobsMutex.
+func (j *job) apply(rj *redisJob) {
+	events, updated := j.events, j.updated
+	*j = *fromRecord(rj)
+	if len(rj.Events) < len(events) {
+		j.events = events
+	}
+	j.updated = updated
+	j.notify()
+}
+
+// followCancels stops the jobs this node runs that another node was asked
+// to cancel, including one it took but has not started, or to requeue.
+func followCancels() {
+	sub := redisQueue.Subscribe(context.Background(), redisCancelChannel, redisRequeueChannel)
+	for msg := range sub.Channel() {
+		jobsMutex.Lock()
+		j, ok := jobs[msg.Payload]
+		running := ok && j.consumed
+		jobsMutex.Unlock()
+		if !running {
+			continue
+		}
+		if msg.Channel == redisRequeueChannel {
+			requeueJob(context.Background(), msg.Payload)
+		} else {
+			cancelJob(context.Background(), msg.Payload)
+		}
+	}
+}
+
+// cancelRedisJob cancels a job this node is not running: a queued or held
+// one is marked cancelled in its record, which the node taking it skips,
+// and the node running a running one is asked to stop it.
+func cancelRedisJob(ctx context.Context, id string) (*job, error) {
+	var out *job
+	err := redisQueue.Watch(ctx, func(tx *redis.Tx) error {
+		rj, err := loadRedisJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		switch rj.Status {
+		case JobQueued, JobHeld:
+			now := time.Now()
+			rj.setStatus(ctx, JobCancelled)
+			rj.Error, rj.Finished = "cancelled", &now
+			b, err := json.Marshal(rj)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				p.Set(ctx, redisJobKey(id), b, jobRetention)
+				p.LRem(ctx, redisQueueKey, 1, id)
+				p.LRem(ctx, redisHeldKey, 1, id)
+				p.Publish(ctx, redisUpdatesChannel, b)
+				return nil
+			}); err != nil {
+				return err
+			}
+		case JobRunning:
+			if err := redisQueue.Publish(ctx, redisCancelChannel, id).Err(); err != nil {
+				return err
+			}
+		default:
+			return &statusError{http.StatusConflict, fmt.Errorf("job %s already %s", id, rj.Status)}
+		}
+		out = fromRecord(rj)
+		return nil
+	}, redisJobKey(id))
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Cancelling job", "job", id, "status", out.Status)
+	return out, nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+const (
+	JobQueued = "queued"
+	// JobHeld is a job waiting for room in its tenant's budget or the
+	// service's before it is queued again.
+	JobHeld      = "held"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+	// JobTimedOut is a job failed by a stage running past its deadline.
+	JobTimedOut = "timed_out"
+)
+
+var (
+	// jobWorkers is how many jobs run at once. Proving is serialized or
+	// farmed out to prover workers below this, so extra job workers mostly
+	// overlap input fetching and waiting for fulfillment.
+	jobWorkers = 1
+	// jobQueueSize bounds the jobs waiting to run; beyond it /submit-proof
+	// answers 503.
+	jobQueueSize = 100
+	// jobRetention is how long a finished job stays pollable.
+	jobRetention = 24 * time.Hour
+)
+
+// job is one queued /submit-proof request.
+type job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Spec     string     `json:"spec"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Options are the submission settings the job runs with.
+	Options submitOptions `json:"options"`
+	// ETA is the latest the job can finish given its options, set once it
+	// starts.
+	ETA *time.Time `json:"eta,omitempty"`
+	// Result is the response /submit-proof?wait=true would have returned.
+	Result      map[string]interface{} `json:"result,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	ErrorStatus int                    `json:"error_status,omitempty"`
+	// ErrorClass is ErrorRetryable when the job failed for a transient
+	// reason, retries spent, and may succeed if submitted again, or
+	// ErrorFatal when it would fail the same way.
+	ErrorClass string `json:"error_class,omitempty"`
+	// TimeoutStage is the stage that timed a JobTimedOut job out.
+	TimeoutStage string `json:"timeout_stage,omitempty"`
+	// CorrelationID traces the job's log lines back to the request that
+	// queued it.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// APIKey names the key the job was queued with.
+	APIKey string `json:"api_key,omitempty"`
+	// Stage is the latest progress stage the job reported.
+	Stage string `json:"stage,omitempty"`
+	// States are the statuses the job entered, with when, oldest first.
+	States []jobState `json:"states,omitempty"`
+
+	spec     CircuitSpec
+	queries  []sdk.StorageData
+	receipts []receiptQuery
+	pin      *snapshotPin
+
+	events  []jobEvent
+	updated chan struct{}
+	// cancel ends a running job's context; cancelled records that it was
+	// asked to.
+	cancel    context.CancelFunc
+	cancelled bool
+	// requeued marks a running job requeueJob stopped, to go back to the
+	// queue rather than finish.
+	requeued bool
+	// consumed marks a job this node took from the Redis queue to run, whose
+	// changes it publishes. Other nodes' jobs are copies it only follows.
+	consumed bool
+	// drained marks a running job a drain cancelled, to be exported with
+	// its checkpoint rather than finished.
+	drained bool
+}
+
+var (
+	jobs      = map[string]*job{}
+	jobsMutex sync.Mutex
+	jobQueue  chan *job
+	// jobsRunning counts jobs past JobQueued that have not finished.
+	jobsRunning sync.WaitGroup
+)
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startJobWorkers starts the goroutines that run queued jobs.
+func startJobWorkers() {
+	jobQueue = make(chan *job, jobQueueSize)
+	for i := 0; i < max(jobWorkers, 1); i++ {
+		go func() {
+			for j := range jobQueue {
+				runJob(j)
+			}
+		}()
+	}
+}
+
+// enqueueJob records a job and queues it to run, or holds it while its
+// tenant's budget or the service's is spent.
+func enqueueJob(ctx context.Context, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, opts submitOptions) (*job, error) {
+	now := time.Now()
+	j := &job{ID: newJobID(), Status: JobQueued, States: []jobState{{Status: JobQueued, Time: now}}, Spec: spec.String(), Options: opts, Created: now, CorrelationID: correlationID(ctx), APIKey: apiKeyName(ctx), spec: spec, queries: queries, receipts: receipts, pin: pin}
+	j.recordHistory(ctx, historyStatus, "", JobQueued)
+	overBudget := checkBudget(ctx, j.APIKey)
+	if overBudget != nil {
+		j.setStatus(ctx, JobHeld)
+	}
+
+	jobsMutex.Lock()
+	if draining {
+		jobsMutex.Unlock()
+		return nil, errDraining
+	}
+	pruneJobs()
+	jobs[j.ID] = j
+	jobsMutex.Unlock()
+
+	if redisQueue != nil {
+		// The prover node that takes it keeps its state.
+		push := pushRedisJob
+		if overBudget != nil {
+			push = holdRedisJob
+		}
+		if err := push(ctx, j); err != nil {
+			jobsMutex.Lock()
+			delete(jobs, j.ID)
+			jobsMutex.Unlock()
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Queued job", "job", j.ID, "spec", spec, "queue", "redis", "held", overBudget != nil)
+		return j, nil
+	}
+	saveJobState(j)
+	if overBudget != nil {
+		slog.WarnContext(ctx, "Holding job until the budget allows it", "job", j.ID, "spec", spec, "reason", overBudget)
+		return j, nil
+	}
+
+	select {
+	case jobQueue <- j:
+	default:
+		jobsMutex.Lock()
+		delete(jobs, j.ID)
+		jobsMutex.Unlock()
+		removeJobState(j.ID)
+		return nil, &statusError{http.StatusServiceUnavailable, fmt.Errorf("job queue is full (%d jobs); try again later", jobQueueSize)}
+	}
+	slog.InfoContext(ctx, "Queued job", "job", j.ID, "spec", spec)
+	return j, nil
+}
+
+func runJob(j *job) {
+	// The job outlives the request that queued it, so it runs under its own
+	// context, tagged the same, checkpointing its stages under its state and
+	// reporting its progress to it.
+	ctx, cancel := context.WithCancel(withJob(withJobState(withAPIKeyName(withCorrelationID(context.Background(), j.CorrelationID), j.APIKey), j.ID), j))
+	defer cancel()
+
+	// A drained job stays queued and is exported instead; a cancelled one is
+	// skipped.
+	startable := func() bool { return !draining && j.Status == JobQueued }
+	jobsMutex.Lock()
+	ok := startable()
+	jobsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	// Spend may have reached a cap since the job was queued. What the job
+	// reserves is used by its first attempt.
+	reservation, err := reserveBudget(ctx, j.APIKey, expectedFee(ctx, j.spec, j.Options.SrcChainID))
+	if err != nil {
+		holdJob(ctx, j, err)
+		return
+	}
+	defer reservation.release(ctx)
+	ctx = withBudgetReservation(ctx, reservation)
+
+	jobsMutex.Lock()
+	// Checked again, as it may have been cancelled while reserving.
+	if !startable() {
+		jobsMutex.Unlock()
+		return
+	}
+	if err := j.setStatus(ctx, JobRunning); err != nil {
+		jobsMutex.Unlock()
+		slog.ErrorContext(ctx, "Not starting job", "job", j.ID, "err", err)
+		return
+	}
+	now := time.Now()
+	eta := now.Add(j.Options.latestFinish())
+	j.Started, j.ETA, j.cancel = &now, &eta, cancel
+	j.publish()
+	jobsRunning.Add(1)
+	defer jobsRunning.Done()
+	jobsMutex.Unlock()
+
+	result, err := runSubmission(ctx, j.spec, j.queries, j.receipts, j.pin, j.Options)
+
+	if err != nil && stoppedByDrain(ctx) {
+		// The drain exports it, keeping its state to resume from.
+		slog.InfoContext(ctx, "Job stopped by drain", "job", j.ID, "err", err)
+		return
+	}
+	jobsMutex.Lock()
+	requeued := err != nil && j.requeued && !j.cancelled
+	jobsMutex.Unlock()
+	if requeued {
+		requeueStopped(ctx, j)
+		return
+	}
+	removeJobState(j.ID)
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	now = time.Now()
+	j.Finished = &now
+	defer j.notify()
+	finish := func(status string) {
+		if err := j.setStatus(ctx, status); err != nil {
+			slog.ErrorContext(ctx, "Job finished in an unexpected status", "job", j.ID, "err", err)
+		}
+	}
+	// A job that succeeded before its cancel took effect stays succeeded.
+	if j.cancelled && err != nil {
+		finish(JobCancelled)
+		j.Error = "cancelled"
+		slog.InfoContext(ctx, "Job cancelled", "job", j.ID)
+		return
+	}
+	if err != nil {
+		j.Error, j.ErrorStatus, j.ErrorClass = err.Error(), httpStatus(err), errorClass(err)
+		status := JobFailed
+		if j.TimeoutStage = timedOutStage(err); j.TimeoutStage != "" {
+			status = JobTimedOut
+		}
+		finish(status)
+		slog.ErrorContext(ctx, "Job failed", "job", j.ID, "status", j.Status, "class", j.ErrorClass, "err", err)
+		return
+	}
+	finish(JobSucceeded)
+	j.Result = result
+	slog.InfoContext(ctx, "Job succeeded", "job", j.ID, "duration_ms", now.Sub(*j.Started).Milliseconds())
+}
+
+// cancelJob stops job id: a queued or held job is marked cancelled and
+// never runs, a running one has its context cancelled and is marked
+// cancelled once its attempt returns, unless it has succeeded by then. With a Redis queue, a job this node
+// is not running is cancelled through the queue.
+func cancelJob(ctx context.Context, id string) (*job, error) {
+	if redisQueue != nil {
+		jobsMutex.Lock()
+		j, ok := jobs[id]
+		running := ok && j.consumed
+		jobsMutex.Unlock()
+		if !running {
+			return cancelRedisJob(ctx, id)
+		}
+	}
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	j, ok := jobs[id]
+	if !ok {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	if j.Status == JobRunning {
+		if !j.cancelled {
+			j.cancelled = true
+			j.cancel()
+		}
+	} else {
+		if err := j.setStatus(ctx, JobCancelled); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		j.Error, j.Finished = "cancelled", &now
+		j.notify()
+		removeJobState(j.ID)
+	}
+	slog.InfoContext(ctx, "Cancelling job", "job", id, "status", j.Status)
+	return j, nil
+}
+
+// cancelOwnJob cancels job id for the caller ctx carries, which must have
+// queued it or hold an admin key. Other callers' jobs are answered as not
+// found.
+func cancelOwnJob(ctx context.Context, id string) (*job, error) {
+	if _, err := lookupJob(ctx, id); err != nil {
+		return nil, err
+	}
+	return cancelJob(ctx, id)
+}
+
+// handleCancelJob cancels a job. A queued job is answered cancelled at once;
+// a running one answers 202 while its attempt stops, after which its
+// checkpointed witness and proof are removed and it reads cancelled on
+// /jobs/{id}.
+func handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	j, err := cancelOwnJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	view := j.view()
+	w.Header().Set("Content-Type", "application/json")
+	if view.Status != JobCancelled {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(view)
+}
+
+// pruneJobs drops finished jobs past jobRetention. The caller holds
+// jobsMutex.
+func pruneJobs() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, j := range jobs {
+		if j.Finished != nil && j.Finished.Before(cutoff) {
+			delete(jobs, id)
+		}
+	}
+}
+
+// view copies the job for encoding outside jobsMutex.
+func (j *job) view() job {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return *j
+}
+
+// lookupJob finds job id for the caller ctx carries, which must have queued
+// it or hold an admin key; other callers' jobs are answered as not found.
+// With a Redis queue, jobs other nodes queued are read from it.
+func lookupJob(ctx context.Context, id string) (*job, error) {
+	jobsMutex.Lock()
+	j, ok := jobs[id]
+	jobsMutex.Unlock()
+	if !ok && redisQueue != nil {
+		rj, err := loadRedisJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		j, ok = fromRecord(rj), true
+	}
+	if !ok || !mayActOn(ctx, j.APIKey) {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	return j, nil
+}
+
+// watchJob finds job id like lookupJob, and keeps the copy of a job read
+// from the Redis queue current from the updates other nodes publish, for
+// event streams to follow it.
+func watchJob(ctx context.Context, id string) (*job, error) {
+	jobsMutex.Lock()
+	j, ok := jobs[id]
+	jobsMutex.Unlock()
+	if ok && mayActOn(ctx, j.APIKey) {
+		return j, nil
+	}
+	if ok || redisQueue == nil {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	rj, err := loadRedisJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !mayActOn(ctx, rj.APIKey) {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No job %q", id)}
+	}
+	jobsMutex.Lock()
+	if j, ok = jobs[id]; !ok {
+		j = fromRecord(rj)
+		jobs[id] = j
+	}
+	jobsMutex.Unlock()
+	// An update published before the copy was in place was missed; the
+	// record has it.
+	if rj, err := loadRedisJob(ctx, id); err == nil {
+		jobsMutex.Lock()
+		if !j.consumed {
+			j.apply(rj)
+		}
+		jobsMutex.Unlock()
+	}
+	return j, nil
+}
+
+// handleJob reports a job's status, and its result once it has finished, to
+// the key that queued it or an admin key. It answers If-None-Match with 304
+// while the job is unchanged.
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	j, err := lookupJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
+	view := j.view()
+	writeCachedJSON(w, r, view, view.Finished != nil)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	// ledgerURL receives every finalized result. Empty disables delivery.
+	ledgerURL   = ""
+	ledgerToken = ""
+	// ledgerTemplate renders the POST body from a ledgerRecord; nil posts
+	// the record as JSON.
+	ledgerTemplate *template.Template
+	ledgerRetries  = 3
+	ledgerTimeout  = 30 * time.Second
+)
+
+// ledgerRecord is what a ledger template is executed with.
+type ledgerRecord struct {
+	RequestID    string                 `json:"request_id"`
+	Transaction  string                 `json:"transaction"`
+	Fee          *big.Int               `json:"fee"`
+	Spec         CircuitSpec            `json:"spec"`
+	OutputSchema int                    `json:"output_schema"`
+	Outputs      map[string]interface{} `json:"outputs"`
+	Finalized    time.Time              `json:"finalized"`
+}
+
+// ledgerDelivery is the outcome of delivering one record.
+type ledgerDelivery struct {
+	RequestID string    `json:"request_id"`
+	Attempts  int       `json:"attempts"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Delivered bool      `json:"delivered"`
+	Time      time.Time `json:"time"`
+}
+
+// maxLedgerDeliveries is how many recent deliveries /admin/ledger keeps.
+const maxLedgerDeliveries = 100
+
+var (
+	ledgerDeliveries []ledgerDelivery
+	ledgerMutex      sync.Mutex
+)
+
+// loadLedgerSettings reads BREVIS_LEDGER_URL, BREVIS_LEDGER_TOKEN, sent as a
+// bearer token, BREVIS_LEDGER_TEMPLATE, a text/template file, and
+// BREVIS_LEDGER_RETRIES.
+func loadLedgerSettings() error {
+	ledgerURL = os.Getenv("BREVIS_LEDGER_URL")
+	ledgerToken = os.Getenv("BREVIS_LEDGER_TOKEN")
+	var err error
+	if ledgerRetries, err = envInt("BREVIS_LEDGER_RETRIES", ledgerRetries); err != nil {
+		return err
+	}
+	if ledgerTimeout, err = envDuration("BREVIS_LEDGER_TIMEOUT", ledgerTimeout); err != nil {
+		return err
+	}
+	path := os.Getenv("BREVIS_LEDGER_TEMPLATE")
+	if path == "" {
+		return nil
+	}
+	if ledgerURL == "" {
+		return fmt.Errorf("BREVIS_LEDGER_TEMPLATE requires BREVIS_LEDGER_URL")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ledgerTemplate, err = template.New("ledger").Funcs(template.FuncMap{"json": toJSON}).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// toJSON lets templates quote values, e.g. {{json .RequestID}}.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// newLedgerRecord collects what the ledger is told about a finalized
+// submission.
+func newLedgerRecord(spec CircuitSpec, attempt *proofAttempt, outputs []decodedOutput) ledgerRecord {
+	rec := ledgerRecord{
+		RequestID:    attempt.RequestID,
+		Transaction:  attempt.Transaction,
+		Fee:          attempt.Fee,
+		Spec:         spec,
+		OutputSchema: outputSchemaVersion,
+		Outputs:      map[string]interface{}{},
+		Finalized:    time.Now().UTC(),
+	}
+	for _, o := range outputs {
+		rec.Outputs[o.Name] = o.Value
+	}
+	return rec
+}
+
+// renderLedgerBody renders rec, rejecting bodies that are not JSON so a
+// broken template never reaches the ledger.
+func renderLedgerBody(rec ledgerRecord) ([]byte, error) {
+	if ledgerTemplate == nil {
+		return json.Marshal(rec)
+	}
+	var buf bytes.Buffer
+	if err := ledgerTemplate.Execute(&buf, rec); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template rendered invalid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// deliverToLedger posts rec to the ledger, retrying network errors and 5xx
+// and 429 answers with exponential backoff, and records the outcome.
+func deliverToLedger(ctx context.Context, rec ledgerRecord) {
+	d := ledgerDelivery{RequestID: rec.RequestID}
+	defer func() {
+		d.Time = time.Now()
+		ledgerMutex.Lock()
+		ledgerDeliveries = append(ledgerDeliveries, d)
+		if len(ledgerDeliveries) > maxLedgerDeliveries {
+			ledgerDeliveries = ledgerDeliveries[len(ledgerDeliveries)-maxLedgerDeliveries:]
+		}
+		ledgerMutex.Unlock()
+	}()
+
+	body, err := renderLedgerBody(rec)
+	if err != nil {
+		d.Error = err.Error()
+		slog.ErrorContext(ctx, "Error rendering ledger record", "request", rec.RequestID, "err", err)
+		return
+	}
+	client := &http.Client{Timeout: ledgerTimeout}
+	for d.Attempts < ledgerRetries+1 {
+		if d.Attempts > 0 {
+			time.Sleep(time.Duration(1<<(d.Attempts-1)) * time.Second)
+		}
+		d.Attempts++
+		retry, err := postLedger(client, body, &d)
+		if err == nil {
+			d.Delivered, d.Error = true, ""
+			slog.InfoContext(ctx, "Delivered request to the ledger", "request", rec.RequestID, "attempt", d.Attempts)
+			return
+		}
+		d.Error = err.Error()
+		slog.ErrorContext(ctx, "Error delivering request to the ledger", "request", rec.RequestID, "attempt", d.Attempts, "err", err)
+		if !retry {
+			return
+		}
+	}
+}
+
+// postLedger makes one delivery try and reports whether a failure is worth
+// retrying.
+func postLedger(client *http.Client, body []byte, d *ledgerDelivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, ledgerURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ledgerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ledgerToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	d.Status = resp.StatusCode
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// handleAdminLedger lists the most recent ledger deliveries, newest last.
+func handleAdminLedger(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	ledgerMutex.Lock()
+	deliveries := append([]ledgerDelivery{}, ledgerDeliveries...)
+	ledgerMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        ledgerURL,
+		"deliveries": deliveries,
+	})
+}
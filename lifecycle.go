@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// The lifecycles of proof attempts, jobs and stored requests. Each moves
+// only along its transition table, and every move runs transitionHooks.
+
+// attemptTransitions lists the states each attempt state may move to.
+// Fulfilled and expired are terminal.
+var attemptTransitions = map[string][]string{
+	AttemptProving:   {AttemptSubmitted},
+	AttemptSubmitted: {AttemptFulfilled, AttemptExpired},
+}
+
+// jobTransitions lists the statuses each job status may move to. A running
+// job goes back to queued when interrupted to resume elsewhere. Succeeded,
+// failed, timed out and cancelled are terminal.
+var jobTransitions = map[string][]string{
+	JobQueued:  {JobRunning, JobHeld, JobCancelled},
+	JobHeld:    {JobQueued, JobCancelled},
+	JobRunning: {JobSucceeded, JobFailed, JobTimedOut, JobCancelled, JobQueued},
+}
+
+// requestTransitions lists the statuses each stored request status may move
+// to. Finalized, expired and failed are terminal.
+var requestTransitions = map[string][]string{
+	RequestCreated:   {RequestProven, RequestFailed},
+	RequestProven:    {RequestSubmitted, RequestFailed},
+	RequestSubmitted: {RequestFinalized, RequestExpired, RequestFailed},
+}
+
+// Kinds of transition.
+const (
+	transitionAttempt = "attempt"
+	transitionJob     = "job"
+	transitionRequest = "request"
+)
+
+// transition is one state change of an attempt, job or stored request. ID
+// is the Brevis request ID of an attempt, empty until it is submitted, and
+// the job's or stored request's own ID otherwise.
+type transition struct {
+	Kind     string
+	ID       string
+	From, To string
+}
+
+// transitionHooks run after every state change, in order.
+var transitionHooks = []func(ctx context.Context, t transition){
+	func(ctx context.Context, t transition) {
+		stateTransitionsTotal.WithLabelValues(t.Kind, t.From, t.To).Inc()
+	},
+	func(ctx context.Context, t transition) {
+		if t.ID != "" {
+			slog.InfoContext(ctx, "State changed", t.Kind, t.ID, "from", t.From, "to", t.To)
+		}
+	},
+}
+
+func runTransitionHooks(ctx context.Context, t transition) {
+	for _, hook := range transitionHooks {
+		hook(ctx, t)
+	}
+}
+
+func newProofAttempt() *proofAttempt {
+	return &proofAttempt{Status: AttemptProving, StateTimes: map[string]time.Time{AttemptProving: time.Now()}}
+}
+
+// transition moves the attempt to state to, recording when it entered it.
+func (a *proofAttempt) transition(ctx context.Context, to string) error {
+	from := a.Status
+	if !slices.Contains(attemptTransitions[from], to) {
+		return fmt.Errorf("invalid attempt transition %s -> %s", from, to)
+	}
+	a.Status = to
+	a.StateTimes[to] = time.Now()
+	runTransitionHooks(ctx, transition{transitionAttempt, a.RequestID, from, to})
+	return nil
+}
+
+// jobState is a status a job entered, and when.
+type jobState struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// setStatus moves j to status to, recording when it entered it. The caller
+// holds jobsMutex for a job in the jobs map.
+func (j *job) setStatus(ctx context.Context, to string) error {
+	from := j.Status
+	if !slices.Contains(jobTransitions[from], to) {
+		return &statusError{http.StatusConflict, fmt.Errorf("job %s cannot go from %s to %s", j.ID, from, to)}
+	}
+	j.Status = to
+	// Appended only, so copies taken under the lock stay as they were.
+	j.States = append(j.States, jobState{Status: to, Time: time.Now()})
+	j.recordHistory(ctx, historyStatus, from, to)
+	runTransitionHooks(ctx, transition{transitionJob, j.ID, from, to})
+	return nil
+}
+
+// checkRequestTransition checks that a stored request may move from
+// status from to status to.
+func checkRequestTransition(from, to string) error {
+	if !slices.Contains(requestTransitions[from], to) {
+		return fmt.Errorf("invalid request transition %s -> %s", from, to)
+	}
+	return nil
+}
+
+// requestPredecessors are the statuses a stored request may reach to
+// from.
+func requestPredecessors(to string) []string {
+	var from []string
+	for status, next := range requestTransitions {
+		if slices.Contains(next, to) {
+			from = append(from, status)
+		}
+	}
+	slices.Sort(from)
+	return from
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// correlationHeader carries a caller's correlation ID in and every
+// response's out.
+const correlationHeader = "X-Request-ID"
+
+type correlationKey struct{}
+
+// withCorrelationID tags ctx, and every line logged with it, with id.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// correlationID is the ID ctx is tagged with, or "".
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// correlationHandler adds the correlation ID and API key name of the logging
+// context to each record.
+type correlationHandler struct {
+	slog.Handler
+}
+
+func (h correlationHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := correlationID(ctx); id != "" {
+		r.AddAttrs(slog.String("correlation_id", id))
+	}
+	if name := apiKeyName(ctx); name != "" {
+		r.AddAttrs(slog.String("api_key", name))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h correlationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return correlationHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h correlationHandler) WithGroup(name string) slog.Handler {
+	return correlationHandler{h.Handler.WithGroup(name)}
+}
+
+// setupLogging reads BREVIS_LOG_FORMAT, json or text, and BREVIS_LOG_LEVEL.
+// Lines still written through the log package go to the same handler.
+func setupLogging() error {
+	var level slog.Level
+	if v := os.Getenv("BREVIS_LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid BREVIS_LOG_LEVEL %q: %v", v, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch v := os.Getenv("BREVIS_LOG_FORMAT"); v {
+	case "", "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid BREVIS_LOG_FORMAT %q: want json or text", v)
+	}
+	slog.SetDefault(slog.New(correlationHandler{h}))
+	return nil
+}
+
+// withCorrelation tags each request with the caller's X-Request-ID, or a new
+// ID, and echoes it on the response.
+func withCorrelation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationHeader)
+		if id == "" || len(id) > 128 {
+			id = newJobID()
+		}
+		w.Header().Set(correlationHeader, id)
+		next.ServeHTTP(w, r.WithContext(withCorrelationID(r.Context(), id)))
+	})
+}
+
+// LogValue logs a spec in its query string form.
+func (s CircuitSpec) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
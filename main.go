@@ -3,169 +3,416 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/big"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/brevis-network/brevis-sdk/sdk"
-	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type AppCircuit struct {
 	EmissionsData *big.Int
+	Spec          CircuitSpec
 }
 
 var (
-	circuitPrepared bool
-	circuitMutex    sync.Mutex
+	// preparedCircuits are the compiled specs requests can be proven with,
+	// keyed by spec string. Each keeps its own artifacts, so preparing one
+	// leaves the others prepared.
+	preparedCircuits = map[string]*preparedCircuit{}
+	circuitMutex     sync.Mutex
+	// compileMutex runs one compile at a time. circuitMutex is only taken
+	// to install the result, so proofs go on during a compile.
+	compileMutex sync.Mutex
 )
 
 var _ sdk.AppCircuit = &AppCircuit{}
 
 func (c *AppCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
-	return 0, 32, 0
+	return 0, c.Spec.slots(), 0
 }
 
 func (c *AppCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
 	slots := sdk.NewDataStream(api, in.StorageSlots)
-	expectedEmission := sdk.ConstUint248(c.EmissionsData.Uint64())
+	if c.Spec.ValueMode == ValueModeSplit {
+		return c.defineSplit(api, slots)
+	}
+	expectedEmission := sdk.ConstUint248(c.EmissionsData)
 
 	sdk.AssertEach(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
-		emissionValue := api.ToUint248(slot.Value)
-		return api.Uint248.IsEqual(emissionValue, expectedEmission)
+		return c.checkSlot(api, c.emissionValue(api, slot), expectedEmission)
 	})
 
 	emissions := sdk.Map(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
-		return api.ToUint248(slot.Value)
+		return c.weightedValue(api, slot)
 	})
 	totalEmissions := sdk.Sum(emissions)
+	c.assertTotalCap(api, totalEmissions)
 
-	api.OutputUint(248, totalEmissions)
+	c.outputTotal(api, totalEmissions)
+	c.outputPackedFields(api, in)
 
-	return nil
+	return c.defineAggregation(api, in, emissions)
 }
 
 func handlePrepareDownload(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
-	circuitMutex.Lock()
-	defer circuitMutex.Unlock()
 
-	if circuitPrepared {
-		log.Println("Circuit already prepared.")
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(spec.variants()) == 0 {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec), http.StatusBadRequest)
 		return
 	}
 
-	rpcURL := "https://sepolia.drpc.org"
-	outputDir := "./brevis-output"
-	app, err := sdk.NewBrevisApp(11155111, rpcURL, outputDir)
+	repaired, err := prepareCircuit(r.Context(), spec)
 	if err != nil {
-		log.Printf("Error initializing BrevisApp: %v", err)
+		slog.ErrorContext(r.Context(), "Circuit preparation failed", "spec", spec, "err", err)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
-	
-	estimatedEmissions := big.NewInt(10000)
-	circuit := &AppCircuit{EmissionsData: estimatedEmissions}
 
-	outDir := "./brevis-circuit"
-	srsDir := "./"
+	w.WriteHeader(http.StatusOK)
+	if len(repaired) > 0 {
+		fmt.Fprintf(w, "Artifacts repaired, recompiling: quarantined %s.\n", strings.Join(repaired, ", "))
+	}
+	w.Write([]byte("Circuit preparation started."))
+}
 
-	// Ensure the SRS directory exists
-	if _, err := os.Stat(srsDir); os.IsNotExist(err) {
-		if err := os.Mkdir(srsDir, os.ModePerm); err != nil {
-			log.Fatalf("Error creating directory: %v", err)
-		}
+// prepareCircuit compiles every variant of spec and adds it to the prepared
+// circuits. It returns the leftovers of earlier compiles it quarantined.
+// One replica compiles a spec at a time; the others wait for it and load
+// what it published instead.
+func prepareCircuit(ctx context.Context, spec CircuitSpec) (repaired []string, err error) {
+	compileMutex.Lock()
+	defer compileMutex.Unlock()
+
+	if lookupPrepared(spec) != nil {
+		slog.InfoContext(ctx, "Circuit already prepared", "spec", spec)
+		return nil, nil
 	}
+	unlock, err := lockCompile(ctx, spec)
+	if err != nil {
+		return nil, fmt.Errorf("Error locking circuit compile: %v", err)
+	}
+	defer unlock()
+	if variants, _ := sharedVariants(ctx, spec); variants != nil {
+		installPrepared(spec, variants)
+		slog.InfoContext(ctx, "Loaded circuit compiled by another replica", "spec", spec)
+		return nil, nil
+	}
+	startCompile(spec)
+	defer func() { finishCompile(err) }()
 
-	log.Println("Using SRS directory:", srsDir)
+	repaired, err = repairCircuitDir()
+	if err != nil {
+		return repaired, fmt.Errorf("Error repairing circuit artifacts: %v", err)
+	}
+	if len(repaired) > 0 {
+		slog.WarnContext(ctx, "Artifacts repaired, recompiling", "spec", spec, "quarantined", repaired)
+	}
 
-	_, _, _, _, err = sdk.Compile(circuit, outDir, srsDir, app)
+	app, err := activeProfile.newBrevisApp(pickRPC(), config.OutputDir)
 	if err != nil {
-		log.Printf("Error compiling circuit: %v", err)
-		return
+		return repaired, fmt.Errorf("Error initializing BrevisApp: %v", err)
 	}
 
-	circuitPrepared = true
-	log.Println("Circuit preparation complete.")
+	srsDir := config.SRSDir
+	if err := fetchSRS(ctx); err != nil {
+		return repaired, fmt.Errorf("Error fetching SRS: %v", err)
+	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Circuit preparation started."))
+	slog.InfoContext(ctx, "Using SRS directory", "dir", srsDir)
+	if err := unrecordPreparedSpec(spec); err != nil {
+		return repaired, fmt.Errorf("Error clearing prepared spec record: %v", err)
+	}
+
+	var variants []*circuitVariant
+	for _, v := range spec.variants() {
+		// Compile into a partial directory so an interrupted compile never
+		// leaves a half-written variant in place.
+		outDir := variantDir(v)
+		partial := outDir + partialSuffix
+		if err := os.RemoveAll(partial); err != nil {
+			return repaired, fmt.Errorf("Error clearing %s: %v", partial, err)
+		}
+		ccs, pk, _, _, err := sdk.Compile(v.newCircuit(), partial, srsDir, app)
+		if err != nil {
+			os.RemoveAll(partial)
+			return repaired, fmt.Errorf("Error compiling circuit: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(partial, circuitSpecFile), []byte(v.String()), 0644); err != nil {
+			return repaired, fmt.Errorf("Error recording circuit spec: %v", err)
+		}
+		hash := circuitHash(ccs)
+		if err := os.WriteFile(filepath.Join(partial, circuitHashFile), []byte(hash), 0644); err != nil {
+			return repaired, fmt.Errorf("Error recording circuit hash: %v", err)
+		}
+		if err := writeChecksums(partial); err != nil {
+			return repaired, fmt.Errorf("Error recording artifact checksums: %v", err)
+		}
+		if err := installVariant(partial, outDir); err != nil {
+			return repaired, fmt.Errorf("Error installing compiled circuit: %v", err)
+		}
+		if artifactBucket != "" {
+			if err := uploadArtifacts(ctx, outDir, v); err != nil {
+				return repaired, fmt.Errorf("Error publishing circuit artifacts: %v", err)
+			}
+		}
+		variants = append(variants, &circuitVariant{Spec: v, CCS: ccs, PK: pk, Hash: hash})
+	}
+
+	if err := recordPreparedSpec(spec); err != nil {
+		return repaired, fmt.Errorf("Error recording prepared spec: %v", err)
+	}
+	installPrepared(spec, variants)
+	slog.InfoContext(ctx, "Circuit preparation complete", "spec", spec)
+	return repaired, nil
 }
 
+// handleSubmitProof queues a proof job over the storage queries in the JSON
+// body and answers 202 with its ID, to be polled at /jobs/{id}. With
+// wait=true it proves inline and answers with the result.
 func handleSubmitProof(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 
-	circuitMutex.Lock()
-	prepared := circuitPrepared
-	circuitMutex.Unlock()
-
-	if !prepared {
-		http.Error(w, "Circuit not prepared yet. Please try again later.", http.StatusBadRequest)
+	if isDraining() {
+		http.Error(w, errDraining.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	rpcURL := "https://sepolia.drpc.org"
-	outputDir := "./brevis-output"
-	app, err := sdk.NewBrevisApp(11155111, rpcURL, outputDir)
+	sub, err := parseSubmission(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error initializing BrevisApp: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
 
-	estimatedEmissions := big.NewInt(10000)
-	circuit := &AppCircuit{EmissionsData: estimatedEmissions}
-
-	circuitInput, err := app.BuildCircuitInput(circuit)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error building circuit input: %v", err), http.StatusInternalServerError)
+	client := clientFor(r)
+	if r.URL.Query().Get("wait") == "true" {
+		if err := admitProof(); err != nil {
+			w.Header().Set("Retry-After", proofRetryAfter)
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		if err := useProofQuota(r.Context(), client); err != nil {
+			setQuotaRetryAfter(w, r)
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		response, err := runSubmission(r.Context(), sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
+		if err != nil {
+			if httpStatus(err) == http.StatusTooManyRequests {
+				setRetryAfter(w, r)
+			}
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	witness, _, err := sdk.NewFullWitness(circuit, circuitInput)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error generating witness: %v", err), http.StatusInternalServerError)
+	if err := useProofQuota(r.Context(), client); err != nil {
+		setQuotaRetryAfter(w, r)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
-
-	proof, err := sdk.Prove(nil, nil, witness)
+	j, err := enqueueJob(r.Context(), sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error generating proof: %v", err), http.StatusInternalServerError)
+		releaseProofQuota(r.Context(), client)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j.view())
+}
+
+// submission is a /submit-proof request, parsed and checked against the
+// prepared circuit. spec is the variant the queries route to.
+type submission struct {
+	spec     CircuitSpec
+	queries  []sdk.StorageData
+	receipts []receiptQuery
+	pin      *snapshotPin
+	opts     submitOptions
+}
 
-	err = app.SubmitProof(proof)
+// parseSubmission reads a /submit-proof request, refusing it with the status
+// it should be answered with.
+func parseSubmission(r *http.Request) (*submission, error) {
+	spec, err := requestSpec(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error submitting proof: %v", err), http.StatusInternalServerError)
-		return
+		return nil, &statusError{http.StatusBadRequest, fmt.Errorf("Invalid circuit spec: %v", err)}
+	}
+	pin, err := parseSnapshotPin(r)
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+	tenant, err := lookupTenantSettings(r.Context(), apiKeyName(r.Context()))
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseSubmitOptions(r, tenant)
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+	queries, receipts, err := parseQueries(r)
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+	if queries, err = rangeQueries(spec, r.URL.Query(), queries); err != nil {
+		return nil, &statusError{http.StatusBadRequest, err}
+	}
+	sub := &submission{spec: spec, queries: queries, receipts: receipts, pin: pin, opts: opts}
+	if err := sub.route(r.Context(), tenant, mainnetConfirmed(r)); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// mainnetConfirmed reports whether r confirms spending on mainnet.
+func mainnetConfirmed(r *http.Request) bool {
+	return r.URL.Query().Get("confirm_mainnet") == "true"
+}
+
+// route checks a parsed submission against the prepared circuit, the
+// caller's key and its tenant's limits, and sets its spec to the variant its
+// queries route to. confirmed is whether the caller confirmed spending on
+// mainnet.
+func (sub *submission) route(ctx context.Context, tenant tenantSettings, confirmed bool) error {
+	spec := sub.spec
+	// Nodes that did not compile this spec fetch it from the artifact
+	// bucket on first use, unless it was compiled from another circuit
+	// definition, which is compiled again instead.
+	if artifactBucket != "" && preparedVariantsOf(spec) == nil {
+		variants, stale := sharedVariants(ctx, spec)
+		if stale {
+			recompileInBackground(spec)
+			return &statusError{http.StatusServiceUnavailable, fmt.Errorf("Circuit for spec %s was compiled from an older circuit definition and is being recompiled. Please try again later.", spec)}
+		}
+		if variants != nil {
+			installPrepared(spec, variants)
+		}
+	}
+	variants := preparedVariantsOf(spec)
+	if variants == nil {
+		if preparedCount() == 0 {
+			return &statusError{http.StatusBadRequest, errors.New("Circuit not prepared yet. Please try again later.")}
+		}
+		return &statusError{http.StatusConflict, fmt.Errorf("No circuit prepared for spec %s. Call /prepare-download with the same parameters first.", spec)}
 	}
 
-	tokenAddress := common.HexToAddress("0xbd2F3813637Ed399D5ddBC2307D3bf4Ab1695B48")
-	refundAddress := common.HexToAddress("0x788997cD5b9feAc56d4928539Dc21C637C61E69a")
+	if err := checkKeyEnvironment(ctx, sub.opts); err != nil {
+		return err
+	}
+	for _, id := range []uint64{sub.opts.SrcChainID, sub.opts.DstChainID} {
+		if err := chains[id].confirmMainnet(confirmed); err != nil {
+			return &statusError{http.StatusForbidden, err}
+		}
+	}
+	if err := sub.opts.checkCallbackContract(); err != nil {
+		return &statusError{http.StatusBadRequest, err}
+	}
 
-	_, requestId, feeValue, _, err := app.PrepareRequest(
-		nil, witness, 11155111, 11155111, refundAddress, tokenAddress, 500000, nil, "",
-	)
+	if err := checkQueryKinds(spec, len(sub.queries), len(sub.receipts)); err != nil {
+		return &statusError{http.StatusBadRequest, err}
+	}
+	variant, err := routeVariant(variants, len(sub.queries))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error preparing request: %v", err), http.StatusInternalServerError)
-		return
+		return &statusError{http.StatusUnprocessableEntity, err}
+	}
+	if err := tenant.checkSlots(variant.Spec); err != nil {
+		return &statusError{http.StatusForbidden, err}
 	}
+	if event := spec.receiptEvent(); event != nil && len(sub.receipts) > event.MaxReceipts {
+		return &statusError{http.StatusUnprocessableEntity, fmt.Errorf("request has %d receipts; the circuit allocates %d", len(sub.receipts), event.MaxReceipts)}
+	}
+	sub.spec = variant.Spec
+	return checkSubmissionBlocks(ctx, sub)
+}
 
-	tx, err := app.WaitFinalProofSubmitted(context.Background())
+// runSubmission proves and submits one request until it is fulfilled,
+// returning the /submit-proof response.
+func runSubmission(ctx context.Context, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, opts submitOptions) (map[string]interface{}, error) {
+	proofsInFlight.Add(1)
+	defer proofsInFlight.Add(-1)
+	attempts, err := proveUntilFulfilled(ctx, spec, queries, receipts, pin, opts)
+	// A job a drain stopped reports its outcome where it is restored.
+	if opts.CallbackURL != "" && !stoppedByDrain(ctx) {
+		go deliverCallback(context.WithoutCancel(ctx), opts.CallbackURL, newCallbackPayload(ctx, attempts, err))
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error waiting for proof submission: %v", err), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	final := attempts[len(attempts)-1]
+	if final.Status == AttemptExpired {
+		return nil, &statusError{http.StatusGatewayTimeout, fmt.Errorf("Request %s expired unfulfilled after %d attempt(s)", final.RequestID, len(attempts))}
 	}
 
 	response := map[string]interface{}{
-		"request_id": requestId.Hex(),
-		"fee":        feeValue,
-		"transaction": tx.Hex(),
+		"request_id":  final.RequestID,
+		"fee":         final.Fee,
+		"transaction": final.Transaction,
+		"timings":     final.Timings,
+		"slots":       spec.slots(),
+		"cost":        totalCost(attempts),
+		"options":     opts,
+		// circuit_hash identifies the constraints the proof was made with.
+		"circuit_hash": final.CircuitHash,
+		// Outputs decode under output_schema; /decode-output keeps decoding
+		// them after later versions change the layout.
+		"output_schema": outputSchemaVersion,
+		"output":        final.Output,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	outputs, err := decodeOutput(outputSchemaVersion, spec, final.Output)
+	if err == nil {
+		response["outputs"] = outputs
+	} else {
+		slog.ErrorContext(ctx, "Error decoding output", "request", final.RequestID, "err", err)
+	}
+	if ledgerURL != "" {
+		go deliverToLedger(context.WithoutCancel(ctx), newLedgerRecord(spec, final, outputs))
+	}
+	if sampleCanary() {
+		go runCanary(context.WithoutCancel(ctx), canaryRequest{Spec: spec, Queries: queries, Receipts: receipts}, final)
+	}
+	if final.TransactionReceipt != nil {
+		response["transaction_receipt"] = final.TransactionReceipt
+	} else {
+		response["transaction_receipt_error"] = final.ReceiptError
+	}
+	if pin != nil {
+		response["snapshot"] = pin
+	}
+	if final.Merkle != nil {
+		response["merkle"] = final.Merkle
+	}
+	if final.Provenance != nil {
+		response["provenance"] = final.Provenance
+	}
+	if len(final.UnprovenInputs) > 0 {
+		response["unproven_inputs"] = final.UnprovenInputs
+		response["unproven_inputs_note"] = unprovenNote
+	}
+	if len(attempts) > 1 {
+		response["supersedes"] = final.Supersedes
+		response["attempts"] = attempts
+	}
+	return response, nil
 }
 
 func enableCors(w *http.ResponseWriter) {
@@ -173,16 +420,285 @@ func enableCors(w *http.ResponseWriter) {
 }
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if err := setupLogging(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if len(os.Args) == 3 && os.Args[1] == proverWorkerCommand {
+		log.Fatal(runProverWorker(os.Args[2]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == drainCommand {
+		var url string
+		if len(os.Args) == 3 {
+			url = os.Args[2]
+		}
+		if err := runDrain(url); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == statusCommand {
+		runCLI(runStatusCommand, os.Args[2:])
+		return
+	}
+	if err := loadContractOverrides(); err != nil {
+		log.Fatalf("Invalid contract registry: %v", err)
+	}
+	profile, err := loadProfile(config)
+	if err != nil {
+		log.Fatalf("Invalid profile: %v", err)
+	}
+	activeProfile = profile
+	slog.Info("Using profile", "profile", profile.Name, "chain_id", profile.ChainID)
+	loadRPCProviders(profile)
+	if err := loadChains(profile); err != nil {
+		log.Fatalf("Invalid chains: %v", err)
+	}
+	if err := loadDataProvider(profile.ChainID); err != nil {
+		log.Fatal(err)
 	}
 
+	contracts := contractRegistry[profile.ChainID]
+	contracts.Callback = profile.AppContract
+	if err := verifyContractCode(profile.ChainID, profile.RPCURL, contracts); err != nil {
+		log.Fatalf("Contract registry check failed: %v", err)
+	}
+	for _, id := range chainIDs() {
+		if id == profile.ChainID {
+			continue
+		}
+		contracts := contractRegistry[id]
+		contracts.Callback = chains[id].AppContract
+		if err := verifyContractCode(id, chains[id].RPCURL, contracts); err != nil {
+			log.Fatalf("Contract registry check failed: %v", err)
+		}
+	}
+
+	if err := applyProverProfile(); err != nil {
+		log.Fatal(err)
+	}
+	if fulfillmentWindow, err = envDuration("BREVIS_FULFILLMENT_WINDOW", fulfillmentWindow); err != nil {
+		log.Fatal(err)
+	}
+	if maxReproves, err = envInt("BREVIS_MAX_REPROVES", maxReproves); err != nil {
+		log.Fatal(err)
+	}
+	if fetchWorkers, err = envInt("BREVIS_FETCH_WORKERS", fetchWorkers); err != nil {
+		log.Fatal(err)
+	}
+	if provenanceAge, err = envDuration("BREVIS_PROVENANCE_AGE", provenanceAge); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadStageDeadlines(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadRetryPolicy(); err != nil {
+		log.Fatalf("Invalid retry policy: %v", err)
+	}
+	if err := loadSubmitPolicy(); err != nil {
+		log.Fatalf("Invalid submission policy: %v", err)
+	}
+	if err := loadRPCSettings(); err != nil {
+		log.Fatalf("Invalid RPC settings: %v", err)
+	}
+	go probeRPCProviders(context.Background())
+	if err := loadArtifactSettings(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadSRSSettings(); err != nil {
+		log.Fatalf("Invalid SRS settings: %v", err)
+	}
+	if srsPrefetch {
+		go func() {
+			if err := fetchSRS(context.Background()); err != nil {
+				slog.Error("Error prefetching SRS", "err", err)
+			}
+		}()
+	}
+	if v := os.Getenv("BREVIS_CIRCUIT_SIZES"); v != "" {
+		if circuitSizes, err = parseCircuitSizes(v); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if proverWorkers, err = envInt("BREVIS_PROVER_WORKERS", proverWorkers); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadWorkerLimits(); err != nil {
+		log.Fatal(err)
+	}
+	if (workerMemoryMax > 0 || workerCPUs > 0) && proverWorkers == 0 {
+		log.Fatal("BREVIS_PROVER_MEMORY_MAX and BREVIS_PROVER_CPUS require BREVIS_PROVER_WORKERS")
+	}
+	if jobWorkers, err = envInt("BREVIS_JOB_WORKERS", jobWorkers); err != nil {
+		log.Fatal(err)
+	}
+	if jobQueueSize, err = envInt("BREVIS_JOB_QUEUE", jobQueueSize); err != nil {
+		log.Fatal(err)
+	}
+	if finishedMaxAge, err = envDuration("BREVIS_RESULT_MAX_AGE", finishedMaxAge); err != nil {
+		log.Fatal(err)
+	}
+	if err := startProofPool(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadJobStateDir(); err != nil {
+		log.Fatalf("Invalid job state dir: %v", err)
+	}
+	// Before workers preload the compiled variants.
+	if _, err := repairCircuitDir(); err != nil {
+		log.Fatalf("Error repairing circuit artifacts: %v", err)
+	}
+	staleSpecs, err := restorePreparedCircuits()
+	if err != nil {
+		log.Fatalf("Error restoring prepared circuit: %v", err)
+	}
+	if proverWorkers > 0 {
+		if err := startProverWorkers(proverWorkers); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if reconcileInterval, err = envDuration("BREVIS_RECONCILE_INTERVAL", reconcileInterval); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadLedgerSettings(); err != nil {
+		log.Fatalf("Invalid ledger integration: %v", err)
+	}
+	if err := loadCallbackSettings(); err != nil {
+		log.Fatalf("Invalid callback settings: %v", err)
+	}
+	if err := loadShareSettings(); err != nil {
+		log.Fatalf("Invalid share settings: %v", err)
+	}
+	if err := loadCanarySettings(); err != nil {
+		log.Fatalf("Invalid canary settings: %v", err)
+	}
+	if err := loadRequestStore(); err != nil {
+		log.Fatalf("Invalid request store: %v", err)
+	}
+	// Once the request store is open, which compiles lock through.
+	if len(staleSpecs) > 0 {
+		go recompileStale(context.Background(), staleSpecs)
+	}
+	if err := loadAPIKeys(); err != nil {
+		log.Fatalf("Invalid API keys: %v", err)
+	}
+	if err := loadJobHistory(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadQuotas(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadSpendCaps(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadRegistry(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadProvers(); err != nil {
+		log.Fatal(err)
+	}
+	if negativeTests, err = envBool("BREVIS_NEGATIVE_TESTS", negativeTests); err != nil {
+		log.Fatal(err)
+	}
+	if negativeTests && profile.Mainnet {
+		log.Fatalf("BREVIS_NEGATIVE_TESTS is not allowed with mainnet profile %s", profile.Name)
+	}
+	if validateResponses, err = envBool("BREVIS_VALIDATE_RESPONSES", validateResponses); err != nil {
+		log.Fatal(err)
+	}
+	if err := buildOpenAPISpec(); err != nil {
+		log.Fatalf("Invalid API spec: %v", err)
+	}
+
+	if len(os.Args) >= 2 && cliCommands[os.Args[1]] != nil {
+		runCLI(cliCommands[os.Args[1]], os.Args[2:])
+		return
+	}
+
+	if err := loadJobQueue(); err != nil {
+		log.Fatalf("Invalid job queue: %v", err)
+	}
+	if redisQueue != nil {
+		// Jobs wait in Redis across restarts and drains, so there is nothing
+		// to restore or recover here.
+		if err := startRedisJobs(); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		startJobWorkers()
+		if err := restoreJobs(); err != nil {
+			log.Fatalf("Error restoring drained jobs: %v", err)
+		}
+		if err := recoverJobs(); err != nil {
+			log.Fatalf("Error recovering interrupted jobs: %v", err)
+		}
+	}
+	go reconcileJobs(context.Background())
+	go releaseHeldJobs(context.Background())
+	go replayCanaries(context.Background())
+
+	port := config.Port
+
 	http.HandleFunc("/prepare-download", handlePrepareDownload)
 	http.HandleFunc("/submit-proof", handleSubmitProof)
+	http.HandleFunc("/submit-proofs", handleSubmitProofs)
+	http.HandleFunc("GET /jobs/{id}", handleJob)
+	http.HandleFunc("DELETE /jobs/{id}", handleCancelJob)
+	http.HandleFunc("GET /jobs/{id}/events", handleJobEvents)
+	http.HandleFunc("GET /jobs/{id}/history", handleJobHistory)
+	http.HandleFunc("GET /jobs/{id}/explain", handleJobExplain)
+	http.HandleFunc("GET /ws", handleWS)
+	http.HandleFunc("GET /requests", handleRequests)
+	http.HandleFunc("GET /requests/{id}", handleRequest)
+	http.HandleFunc("POST /requests/{id}/visibility", handleRequestVisibility)
+	http.HandleFunc("POST /requests/{id}/share", handleShareRequest)
+	http.HandleFunc("GET /proofs/{request_id}", handleProof)
+	http.HandleFunc("GET /proofs/diff", handleProofDiff)
+	http.HandleFunc("/verify", handleVerify)
+	http.HandleFunc("/negative-test", handleNegativeTest)
+	http.HandleFunc("/admin/rpc", handleAdminRPC)
+	http.HandleFunc("/admin/api-keys", handleAdminAPIKeys)
+	http.HandleFunc("/block-by-timestamp", handleBlockByTimestamp)
+	http.HandleFunc("/validate", handleValidate)
+	http.HandleFunc("/plan", handlePlan)
+	http.HandleFunc("/estimate-fee", handleEstimateFee)
+	http.HandleFunc("GET /status", handleStatus)
+	http.HandleFunc("GET /healthz", handleHealthz)
+	http.HandleFunc("GET /readyz", handleReadyz)
+	http.HandleFunc("GET /openapi.json", handleOpenAPI)
+	http.HandleFunc("GET /quota", handleQuota)
+	http.HandleFunc("/decode-output", handleDecodeOutput)
+	http.HandleFunc("/admin/allocation", handleAdminAllocation)
+	http.HandleFunc("/admin/budget", handleAdminBudget)
+	http.HandleFunc("/admin/ledger", handleAdminLedger)
+	http.HandleFunc("/admin/reconciliation", handleAdminReconciliation)
+	http.HandleFunc("/admin/circuits", handleAdminCircuits)
+	http.HandleFunc("/admin/circuits/compile", handleAdminCircuitCompile)
+	http.HandleFunc("/admin/circuits/promote", handleAdminCircuitPromote)
+	http.HandleFunc("/admin/drain", handleAdminDrain)
+	http.HandleFunc("/admin/canary", handleAdminCanary)
+	http.HandleFunc("/admin/jobs/{action}", handleAdminJobs)
+	http.HandleFunc("/admin/tenants", handleAdminTenants)
+	http.HandleFunc("/admin/requests/import", handleImportRequests)
+	http.HandleFunc("/canary/prove", handleCanaryProve)
+	http.Handle("GET /metrics", promhttp.Handler())
+
+	if shutdownTimeout, err = envDuration("BREVIS_SHUTDOWN_TIMEOUT", shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+	handleSignals()
+	if err := startGRPCServer(); err != nil {
+		log.Fatal(err)
+	}
 
-	log.Printf("Server running on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	slog.Info("Server running", "port", port)
+	server.Addr = ":" + port
+	server.Handler = withCorrelation(withAPIKeys(withRateLimit(withValidation(http.DefaultServeMux))))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	<-drained
+	slog.Info("Drain complete, exiting")
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The merkle commitment uses BN254 MiMC, which costs a few hundred
+// constraints per hash where keccak costs tens of thousands. Leaves are
+// MiMC(slot lo, slot hi, value) over every allocated storage position, with
+// unused positions set to zero, and inner nodes are MiMC(left, right), so the
+// tree has a fixed depth of log2(maxStorage). Slot lo and hi are the low 248
+// and high 8 bits of the slot key; every input is a 32-byte big-endian field
+// element.
+
+// merkleRoot commits to the weighted value of every allocated slot.
+func (c *AppCircuit) merkleRoot(api *sdk.CircuitAPI, in sdk.DataInput) sdk.Bytes32 {
+	hash := func(inputs ...frontend.Variable) sdk.Uint248 {
+		h, err := api.NewMiMC()
+		if err != nil {
+			panic(err)
+		}
+		h.Write(inputs...)
+		return sdk.Uint248{Val: h.Sum()}
+	}
+
+	level := make([]sdk.Uint248, len(in.StorageSlots.Raw))
+	for i, slot := range in.StorageSlots.Raw {
+		leaf := hash(slot.Slot.Val[0], slot.Slot.Val[1], c.weightedValue(api, slot).Val)
+		level[i] = api.Uint248.Select(sdk.Uint248{Val: in.StorageSlots.Toggles[i]}, leaf, sdk.ConstUint248(0))
+	}
+	for len(level) > 1 {
+		next := make([]sdk.Uint248, len(level)/2)
+		for i := range next {
+			next[i] = hash(level[2*i].Val, level[2*i+1].Val)
+		}
+		level = next
+	}
+	return api.Bytes32.FromFV(level[0].Val)
+}
+
+// MerkleLeaf is one queried slot in a merkle commitment. Proof lists the
+// sibling hashes from the leaf up to the root.
+type MerkleLeaf struct {
+	Index int           `json:"index"`
+	Slot  common.Hash   `json:"slot"`
+	Value string        `json:"value"`
+	Leaf  common.Hash   `json:"leaf"`
+	Proof []common.Hash `json:"proof"`
+}
+
+type MerkleCommitment struct {
+	Hash   string       `json:"hash"`
+	Root   common.Hash  `json:"root"`
+	Leaves []MerkleLeaf `json:"leaves"`
+}
+
+// merkleCommitment rebuilds the tree proven by merkleRoot from the circuit
+// input, so the leaves and proofs can be handed out for later verification.
+func (c *AppCircuit) merkleCommitment(in sdk.CircuitInput) *MerkleCommitment {
+	slots := in.StorageSlots
+	level := make([]common.Hash, len(slots.Raw))
+	var leaves []MerkleLeaf
+	for i, slot := range slots.Raw {
+		if !toggleSet(slots.Toggles[i]) {
+			continue
+		}
+		key := bytes32Int(slot.Slot)
+		value := c.offCircuitWeighted(bytes32Int(slot.Value))
+		lo := new(big.Int).And(key, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 248), big.NewInt(1)))
+		hi := new(big.Int).Rsh(key, 248)
+		level[i] = mimcHash(common.BigToHash(lo), common.BigToHash(hi), common.BigToHash(value))
+		leaves = append(leaves, MerkleLeaf{Index: i, Slot: common.BigToHash(key), Value: value.String(), Leaf: level[i]})
+	}
+
+	for len(level) > 1 {
+		for j := range leaves {
+			pos := leaves[j].Index >> len(leaves[j].Proof)
+			leaves[j].Proof = append(leaves[j].Proof, level[pos^1])
+		}
+		next := make([]common.Hash, len(level)/2)
+		for i := range next {
+			next[i] = mimcHash(level[2*i], level[2*i+1])
+		}
+		level = next
+	}
+	return &MerkleCommitment{Hash: "mimc-bn254", Root: level[0], Leaves: leaves}
+}
+
+func mimcHash(inputs ...common.Hash) common.Hash {
+	h := mimc.NewMiMC()
+	for _, in := range inputs {
+		h.Write(in[:])
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// offCircuitWeighted mirrors weightedValue on a slot value read from the
+// circuit input.
+func (c *AppCircuit) offCircuitWeighted(value *big.Int) *big.Int {
+	for _, f := range c.Spec.Fields {
+		if f.Name == emissionsField {
+			mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(f.Bits)), big.NewInt(1))
+			value = mask.And(mask, new(big.Int).Rsh(value, uint(f.Offset)))
+		}
+	}
+	if c.Spec.ScaleFactor != "" {
+		f, _ := parseFixedPoint(c.Spec.ScaleFactor)
+		value = fixedMulInt(value, f)
+	}
+	return value
+}
+
+// bytes32Int joins the 248-bit low and 8-bit high limbs of an assigned
+// Bytes32.
+func bytes32Int(b sdk.Bytes32) *big.Int {
+	v := new(big.Int)
+	if hi, ok := b.Val[1].(*big.Int); ok {
+		v.Lsh(hi, 248)
+	}
+	if lo, ok := b.Val[0].(*big.Int); ok {
+		v.Add(v, lo)
+	}
+	return v
+}
+
+func toggleSet(t frontend.Variable) bool {
+	switch v := t.(type) {
+	case int:
+		return v != 0
+	case *big.Int:
+		return v.Sign() != 0
+	}
+	return false
+}
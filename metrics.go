@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics served on /metrics. Durations are in seconds and fees in the
+// smallest unit of the fee token.
+var (
+	compilationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "brevis_compilations_total",
+		Help: "Circuit compilations by result.",
+	}, []string{"result"})
+	compileDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "brevis_compile_duration_seconds",
+		Help:    "Time to compile and set up a circuit.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	proofAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "brevis_proof_attempts_total",
+		Help: "Proof attempts by circuit and outcome.",
+	}, []string{"circuit", "outcome"})
+	buildInputDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brevis_build_input_duration_seconds",
+		Help:    "Time to fetch and build the circuit input of a proof.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"circuit"})
+	witnessDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brevis_witness_duration_seconds",
+		Help:    "Time to build the witness of a proof.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"circuit"})
+	proveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brevis_prove_duration_seconds",
+		Help:    "Time to generate a proof from its witness.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"circuit"})
+	lastProofTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "brevis_last_proof_timestamp_seconds",
+		Help: "Unix time the last proof finished; a stalled prover stops advancing it.",
+	})
+	submissionFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "brevis_submission_failures_total",
+		Help: "Failed tries at submitting a proof to the gateway, including retried ones.",
+	})
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "brevis_rate_limited_total",
+		Help: "Requests refused for a client's rate limit or proof quota, by which.",
+	}, []string{"limit"})
+	stateTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "brevis_state_transitions_total",
+		Help: "State changes of proof attempts, jobs and stored requests, by kind and states.",
+	}, []string{"kind", "from", "to"})
+	feeAmount = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brevis_fee_amount",
+		Help:    "Fee of each proof request.",
+		Buckets: prometheus.ExponentialBuckets(1e9, 10, 10),
+	}, []string{"circuit"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "brevis_job_queue_depth",
+		Help: "Jobs waiting for a worker.",
+	}, func() float64 { return float64(len(jobQueue)) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "brevis_proofs_waiting",
+		Help: "Proofs waiting for a proving slot.",
+	}, func() float64 { return float64(proofsWaiting.Load()) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "brevis_proofs_proving",
+		Help: "Proofs holding a proving slot.",
+	}, func() float64 { return float64(len(proofSlots)) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "brevis_proofs_in_flight",
+		Help: "Submissions being proven, queued jobs and wait=true requests.",
+	}, func() float64 { return float64(proofsInFlight.Load()) })
+)
+
+// observeTimings records the stage durations of a finished proof.
+func observeTimings(spec CircuitSpec, t timings) {
+	buildInputDuration.WithLabelValues(spec.Circuit).Observe(msSeconds(t.BuildInputMs))
+	witnessDuration.WithLabelValues(spec.Circuit).Observe(msSeconds(t.WitnessMs))
+	proveDuration.WithLabelValues(spec.Circuit).Observe(msSeconds(t.ProveMs))
+	lastProofTime.SetToCurrentTime()
+}
+
+func msSeconds(ms int64) float64 {
+	return (time.Duration(ms) * time.Millisecond).Seconds()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// negativeTests enables /negative-test. It is refused at startup on mainnet
+// profiles.
+var negativeTests = false
+
+const ViolationExpectedValue = "expected_value"
+
+// handleNegativeTest builds a witness that violates the circuit's per-slot
+// emission check and reports how it was rejected. Nothing is proven or
+// submitted: an unsatisfied witness has no proof, so this shows contract
+// teams the failure their integration sees when inputs do not match.
+func handleNegativeTest(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if !negativeTests || activeProfile.Mainnet {
+		http.NotFound(w, r)
+		return
+	}
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	violation := r.URL.Query().Get("violation")
+	if violation == "" {
+		violation = ViolationExpectedValue
+	}
+	if violation != ViolationExpectedValue {
+		http.Error(w, fmt.Sprintf("Unknown violation %q", violation), http.StatusBadRequest)
+		return
+	}
+	circuit, ok := spec.newCircuit().(*AppCircuit)
+	if !ok || spec.ValueMode == ValueModeSplit {
+		http.Error(w, fmt.Sprintf("Violation %q needs circuit %q in value_mode %q", violation, CircuitEmissions, ValueModeUint248), http.StatusBadRequest)
+		return
+	}
+
+	app, err := activeProfile.newBrevisApp(pickRPC(), config.OutputDir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error initializing BrevisApp: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Build the honest input first so unrelated failures are not reported
+	// as the expected rejection.
+	buildInput := func() (sdk.CircuitInput, error) { return app.BuildCircuitInput(circuit) }
+	if _, err := runStage(r.Context(), StageBuildInput, buildInput); err != nil {
+		http.Error(w, fmt.Sprintf("Error building circuit input: %v", err), httpStatus(err))
+		return
+	}
+	// Every slot is checked against EmissionsData, so shifting it breaks the
+	// check for any non-empty input; a zero cap breaks any non-zero one.
+	if spec.Mode == ModeThreshold {
+		circuit.EmissionsData = new(big.Int)
+	} else {
+		circuit.EmissionsData = new(big.Int).Add(circuit.EmissionsData, big.NewInt(1))
+	}
+	_, err = runStage(r.Context(), StageBuildInput, buildInput)
+	if httpStatus(err) == http.StatusGatewayTimeout {
+		http.Error(w, fmt.Sprintf("Error building circuit input: %v", err), http.StatusGatewayTimeout)
+		return
+	}
+	if err == nil {
+		http.Error(w, "Witness unexpectedly satisfies the circuit; add at least one storage query", http.StatusUnprocessableEntity)
+		return
+	}
+	slog.InfoContext(r.Context(), "Negative test rejected as expected", "violation", violation, "err", err)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"violation": violation,
+		"rejected":  true,
+		"error":     err.Error(),
+	})
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// validateResponses checks the JSON responses of documented endpoints
+// against the spec too, logging mismatches. It costs a copy of each
+// response, so it is meant for development and staging.
+var validateResponses = false
+
+// schema is the part of an OpenAPI 3 schema object the spec uses, which is
+// also what requests are validated against.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+func ref(name string) *schema { return &schema{Ref: "#/components/schemas/" + name} }
+
+func minimum(n int64) *int64 { return &n }
+
+// components are the schemas the spec names. The value formats are the ones
+// the parsers accept, so a request passing them only fails the parsers on
+// rules between values.
+var components = map[string]*schema{
+	"Address":     {Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$", Description: "an address: 0x and 40 hex digits"},
+	"Slot":        {Type: "string", Pattern: "^0x[0-9a-fA-F]{1,64}$", Description: "a storage slot key: 0x and 1 to 64 hex digits"},
+	"Hash":        {Type: "string", Pattern: "^0x[0-9a-fA-F]{64}$", Description: "a 32-byte hash: 0x and 64 hex digits"},
+	"BlockNumber": {Type: "integer", Format: "uint64", Minimum: minimum(1), Description: "a block number above 0"},
+}
+
+// namedTypes are the Go types that encode as a component.
+var namedTypes = map[reflect.Type]string{
+	reflect.TypeOf(common.Address{}): "Address",
+	reflect.TypeOf(common.Hash{}):    "Hash",
+}
+
+// encodedAs are types whose MarshalJSON encodes them as another type.
+var encodedAs = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(submitOptions{}): reflect.TypeOf(submitOptionsJSON{}),
+}
+
+// schemaOf describes the JSON encoding of t. A field tagged openapi:"Name"
+// takes component Name, for its items if it is a slice; a field tagged
+// openapi:",required" must be present. Fields without a tag are optional.
+func schemaOf(t reflect.Type) *schema {
+	if e, ok := encodedAs[t]; ok {
+		t = e
+	}
+	if name, ok := namedTypes[t]; ok {
+		return ref(name)
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &schema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return &schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Minimum: minimum(0)}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &schema{Type: "object", Properties: map[string]*schema{}, AdditionalProperties: false}
+		addFields(s, t)
+		return s
+	}
+	return &schema{}
+}
+
+func addFields(s *schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" {
+			addFields(s, f.Type)
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		component, opt, _ := strings.Cut(f.Tag.Get("openapi"), ",")
+		fs := schemaOf(f.Type)
+		switch {
+		case component == "":
+		case fs.Type == "array":
+			fs.Items = ref(component)
+		default:
+			fs = ref(component)
+		}
+		s.Properties[name] = fs
+		if opt == "required" {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// parameter is an OpenAPI 3 query or path parameter.
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+// operation is one documented endpoint. An empty Method serves any method,
+// documented as GET and POST. Body and Response are component names;
+// Streams marks a response that is not one JSON document.
+type operation struct {
+	Method, Path string
+	Summary      string
+	Params       []parameter
+	Body         string
+	Response     string
+	Status       int
+	Streams      string
+}
+
+func query(name, description string, s *schema) parameter {
+	return parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+// circuitParams are the query parameters that select a circuit spec.
+var circuitParams = []parameter{
+	query("circuit", "Circuit to prove; emissions by default.", &schema{Type: "string"}),
+	query("aggregation", "How slot values are combined; sum by default.", &schema{Type: "string"}),
+	query("value_mode", "How slot values are read; uint248 by default.", &schema{Type: "string"}),
+	query("scale_factor", "Factor slot values are scaled by.", &schema{Type: "string"}),
+	query("bucket", "Bucket width of bucketed aggregations.", &schema{Type: "string"}),
+	query("expected_emission", "Emission the sum is compared against.", &schema{Type: "string"}),
+	query("mode", "Comparison against expected_emission.", &schema{Type: "string", Enum: []string{ModeEqual, ModeThreshold}}),
+	query("total_cap", "Cap on the total in threshold mode.", &schema{Type: "string"}),
+	query("k", "Values kept by top-k aggregations.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("window", "Window of windowed aggregations.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("alpha_bps", "Smoothing factor in basis points.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("slots", "Pins the spec to the variant with this many slots.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("fields", "Packed fields of each slot.", &schema{Type: "string"}),
+	query("registry", "Registry of the stock-flow circuit.", ref("Address")),
+	query("counter_slot", "Counter slot of the stock-flow circuit.", ref("Slot")),
+	query("event_id", "Event ID of the stock-flow and receipt circuits.", ref("Hash")),
+	query("amount_index", "Field of the event holding the amount.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("emitter", "Contract emitting the receipt circuit's events.", ref("Address")),
+	query("amount_is_topic", "Whether the amount is an indexed topic.", &schema{Type: "boolean"}),
+	query("max_receipts", "Receipts the receipt circuit compiles to.", &schema{Type: "integer", Minimum: minimum(1)}),
+	query("contract", "Contract of the block-range circuit.", ref("Address")),
+	query("slot", "Slot of the block-range circuit.", ref("Slot")),
+}
+
+// submitParams are the query parameters of a submission beside its spec.
+var submitParams = []parameter{
+	query("wait", "Prove inline and answer with the result.", &schema{Type: "boolean"}),
+	query("start_block", "First block of the block-range circuit.", ref("BlockNumber")),
+	query("end_block", "Last block of the block-range circuit.", ref("BlockNumber")),
+	query("samples", "Blocks the block-range circuit samples.", &schema{Type: "integer", Minimum: minimum(2)}),
+	query("snapshot_block", "Block of the pinned snapshot.", ref("BlockNumber")),
+	query("snapshot_hash", "Hash of the pinned snapshot block.", ref("Hash")),
+	query("snapshot_name", "Label of the pinned snapshot.", &schema{Type: "string"}),
+	query("submit_timeout", "Bound on each gateway submission, as 90s.", &schema{Type: "string"}),
+	query("submit_retries", "Retries of a failed gateway submission.", &schema{Type: "integer", Minimum: minimum(0)}),
+	query("fulfillment_window", "Bound on the wait for the callback, as 10m.", &schema{Type: "string"}),
+	query("callback_url", "URL posted the signed result.", &schema{Type: "string", Format: "uri"}),
+	query("chain_id", "Chain the queries read.", &schema{Type: "integer", Minimum: minimum(1)}),
+	query("dst_chain_id", "Chain whose app contract receives the result.", &schema{Type: "integer", Minimum: minimum(1)}),
+	query("callback_contract", "Contract receiving the result.", ref("Address")),
+	query("callback_gas_limit", "Gas the callback is given.", &schema{Type: "integer", Minimum: minimum(1)}),
+	query("query_option", "Mode the gateway proves in.", &schema{Type: "string", Enum: []string{"zk", "op"}}),
+}
+
+var jobIDParam = parameter{Name: "id", In: "path", Required: true, Schema: &schema{Type: "string"}}
+
+// operations are the endpoints the spec documents: the public proving API.
+// Admin endpoints are left out.
+var operations = []operation{
+	{Path: "/prepare-download", Summary: "Compile a circuit spec and fetch its proving key", Params: circuitParams},
+	{Path: "/submit-proof", Summary: "Queue a proof of storage slots and receipts", Params: append(append([]parameter{}, circuitParams...), submitParams...), Body: "QueryBody", Response: "Job", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/submit-proofs", Summary: "Queue a proof for each query set", Params: append(append([]parameter{}, circuitParams...), submitParams...), Body: "BatchBody"},
+	{Method: http.MethodGet, Path: "/jobs/{id}", Summary: "Read a job", Params: []parameter{jobIDParam}, Response: "Job", Status: http.StatusOK},
+	{Method: http.MethodDelete, Path: "/jobs/{id}", Summary: "Cancel a job", Params: []parameter{jobIDParam}, Response: "Job", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/jobs/{id}/events", Summary: "Follow a job's progress", Params: []parameter{jobIDParam}, Streams: "text/event-stream"},
+	{Method: http.MethodGet, Path: "/ws", Summary: "Submit and follow jobs over a WebSocket"},
+	{Method: http.MethodGet, Path: "/status", Summary: "Report prepared circuits, queue and SRS state"},
+	{Method: http.MethodGet, Path: "/healthz", Summary: "Liveness check"},
+	{Method: http.MethodGet, Path: "/readyz", Summary: "Readiness check"},
+	{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document"},
+}
+
+// bodySchemas are the request and response bodies operations name.
+var bodySchemas = map[string]reflect.Type{
+	"QueryBody":    reflect.TypeOf(queryBody{}),
+	"StorageQuery": reflect.TypeOf(storageQuery{}),
+	"ReceiptQuery": reflect.TypeOf(receiptQuery{}),
+	"BatchBody":    reflect.TypeOf(batchBody{}),
+	"Job":          reflect.TypeOf(job{}),
+}
+
+// openAPISpec and openAPISecuredSpec are the documents /openapi.json serves
+// while auth is disabled and once it is enabled, built once by
+// buildOpenAPISpec. Keys can be added at run time, so which one is served
+// is decided per request.
+var openAPISpec, openAPISecuredSpec []byte
+
+// buildOpenAPISpec generates the spec from operations and the Go types of
+// the bodies, and compiles the patterns requests are checked against.
+func buildOpenAPISpec() error {
+	for name, t := range bodySchemas {
+		components[name] = schemaOf(t)
+	}
+	for _, s := range components {
+		if err := compilePatterns(s); err != nil {
+			return err
+		}
+	}
+	for _, op := range operations {
+		for _, p := range op.Params {
+			if err := compilePatterns(p.Schema); err != nil {
+				return err
+			}
+		}
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, op := range operations {
+		o := map[string]interface{}{"summary": op.Summary, "responses": responsesOf(op)}
+		if len(op.Params) > 0 {
+			o["parameters"] = op.Params
+		}
+		if op.Body != "" {
+			o["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": ref(op.Body)}},
+			}
+		}
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		methods := []string{op.Method}
+		if op.Method == "" {
+			methods = []string{http.MethodGet, http.MethodPost}
+		}
+		for _, m := range methods {
+			paths[op.Path][strings.ToLower(m)] = o
+		}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "Brevis proving API", "version": "1.0.0"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+	var err error
+	if openAPISpec, err = json.MarshalIndent(doc, "", "  "); err != nil {
+		return err
+	}
+	doc["security"] = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	openAPISecuredSpec, err = json.MarshalIndent(doc, "", "  ")
+	return err
+}
+
+func compilePatterns(s *schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" && s.pattern == nil {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("schema pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = p
+	}
+	if err := compilePatterns(s.Items); err != nil {
+		return err
+	}
+	if a, ok := s.AdditionalProperties.(*schema); ok {
+		if err := compilePatterns(a); err != nil {
+			return err
+		}
+	}
+	for _, p := range s.Properties {
+		if err := compilePatterns(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func responsesOf(op operation) map[string]interface{} {
+	ok := map[string]interface{}{"description": "OK"}
+	switch {
+	case op.Response != "":
+		ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": ref(op.Response)}}
+	case op.Streams != "":
+		ok["content"] = map[string]interface{}{op.Streams: map[string]interface{}{}}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responses := map[string]interface{}{fmt.Sprint(status): ok}
+	if len(op.Params) > 0 || op.Body != "" {
+		responses["400"] = map[string]interface{}{"description": "The request does not match this spec; the body lists each mismatch."}
+	}
+	return responses
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	w.Header().Set("Content-Type", "application/json")
+	if authEnabled.Load() {
+		w.Write(openAPISecuredSpec)
+		return
+	}
+	w.Write(openAPISpec)
+}
+
+// findOperation is the documented operation serving r, if any.
+func findOperation(r *http.Request) (operation, bool) {
+	segments := strings.Split(r.URL.Path, "/")
+	for _, op := range operations {
+		if op.Method != "" && op.Method != r.Method {
+			continue
+		}
+		want := strings.Split(op.Path, "/")
+		if len(want) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range want {
+			if s != segments[i] && !strings.HasPrefix(s, "{") {
+				match = false
+				break
+			}
+		}
+		if match {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
+
+// checkRequest validates the query parameters and body of r against the
+// operation serving it, leaving the body to be read again. It reports every
+// mismatch at once, by parameter name or JSON path.
+func checkRequest(r *http.Request) error {
+	op, ok := findOperation(r)
+	if !ok {
+		return nil
+	}
+	var problems []string
+	q := r.URL.Query()
+	for _, p := range op.Params {
+		if p.In != "query" || !q.Has(p.Name) {
+			continue
+		}
+		v := q.Get(p.Name)
+		value, err := paramValue(resolve(p.Schema), v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not %s", p.Name, v, err))
+			continue
+		}
+		problems = validateValue(value, p.Schema, p.Name, problems)
+	}
+
+	if op.Body != "" && r.Body != nil {
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxBatchBody))
+		if err != nil {
+			return &statusError{http.StatusBadRequest, fmt.Errorf("reading request body: %v", err)}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		if len(bytes.TrimSpace(b)) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.UseNumber()
+			var body interface{}
+			if err := dec.Decode(&body); err != nil {
+				return &statusError{http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)}
+			}
+			problems = validateValue(body, ref(op.Body), "body", problems)
+		}
+	}
+	if len(problems) > 0 {
+		return &statusError{http.StatusBadRequest, fmt.Errorf("invalid request: %s", strings.Join(problems, "; "))}
+	}
+	return nil
+}
+
+// paramValue is query parameter v as the JSON value s describes.
+func paramValue(s *schema, v string) (interface{}, error) {
+	switch s.Type {
+	case "integer":
+		if _, ok := new(big.Int).SetString(v, 10); !ok {
+			return nil, errors.New("an integer")
+		}
+		return json.Number(v), nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("a boolean")
+		}
+		return b, nil
+	}
+	return v, nil
+}
+
+func resolve(s *schema) *schema {
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		return components[name]
+	}
+	return s
+}
+
+// validateValue appends to problems each way v, found at path, does not
+// match s.
+func validateValue(v interface{}, s *schema, path string, problems []string) []string {
+	s = resolve(s)
+	what := s.Description
+	if what == "" {
+		what = "of type " + s.Type
+	}
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be an object", path))
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				problems = validateValue(m[name], p, path+"."+name, problems)
+			} else if a, ok := s.AdditionalProperties.(*schema); ok {
+				problems = validateValue(m[name], a, path+"."+name, problems)
+			} else if s.AdditionalProperties == false {
+				problems = append(problems, fmt.Sprintf("%s.%s: is not a known field", path, name))
+			}
+		}
+	case "array":
+		if v == nil {
+			return problems
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be an array", path))
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				problems = validateValue(item, s.Items, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be %s", path, what))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not %s", path, str, what))
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %s", path, str, strings.Join(s.Enum, ", ")))
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		i, valid := new(big.Int).SetString(string(n), 10)
+		if !ok || !valid {
+			return append(problems, fmt.Sprintf("%s: %v is not %s", path, v, what))
+		}
+		if s.Minimum != nil && i.Cmp(big.NewInt(*s.Minimum)) < 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s is not %s", path, n, minimumText(s, what)))
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			problems = append(problems, fmt.Sprintf("%s: must be a number", path))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: must be a boolean", path))
+		}
+	}
+	return problems
+}
+
+func minimumText(s *schema, what string) string {
+	if s.Description != "" {
+		return what
+	}
+	return fmt.Sprintf("at least %d", *s.Minimum)
+}
+
+// withValidation answers requests to documented endpoints that do not match
+// the spec with 400 and every mismatch, before their handlers parse them.
+// With validateResponses it also checks their JSON responses.
+func withValidation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := checkRequest(r); err != nil {
+			slog.InfoContext(r.Context(), "Rejected request not matching the API spec", "path", r.URL.Path, "err", err)
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		op, ok := findOperation(r)
+		if !validateResponses || !ok || op.Response == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		// A response other than the documented one, such as the result
+		// /submit-proof?wait=true answers with, has no schema to check.
+		if rec.status != op.Status || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+			return
+		}
+		dec := json.NewDecoder(&rec.body)
+		dec.UseNumber()
+		var body interface{}
+		if err := dec.Decode(&body); err != nil {
+			slog.WarnContext(r.Context(), "Response is not JSON", "path", r.URL.Path, "err", err)
+			return
+		}
+		if problems := validateValue(body, ref(op.Response), "response", nil); len(problems) > 0 {
+			slog.WarnContext(r.Context(), "Response does not match the API spec", "path", r.URL.Path, "problems", problems)
+		}
+	})
+}
+
+// recordingWriter keeps a copy of the response it writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
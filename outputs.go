@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// outputSchemaVersion is the layout of the outputs circuits built from this
+// tree commit to. Any change that adds, removes, reorders or resizes an
+// output bumps it and adds the new layout to outputLayouts; earlier layouts
+// are never edited, so outputs of earlier proofs still decode.
+const outputSchemaVersion = 4
+
+// outputLayouts maps each output schema version to the layout it gives a
+// spec.
+var outputLayouts = map[int]func(CircuitSpec) []outputField{
+	1: outputLayoutV1,
+	2: outputLayoutV2,
+	3: outputLayoutV3,
+	4: outputLayoutV4,
+}
+
+// outputField is one abi.encodePacked circuit output.
+type outputField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	bytes int
+}
+
+// decodedOutput is an output field and its value: a decimal *big.Int for
+// uints, hex for bytes32 and address, and a bool.
+type decodedOutput struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+func uintField(name string, bits int) outputField {
+	return outputField{Name: name, Type: "uint" + strconv.Itoa(bits), bytes: bits / 8}
+}
+
+// outputLayoutV1 matches the outputs of AppCircuit and StockFlowCircuit as
+// first versioned.
+func outputLayoutV1(s CircuitSpec) []outputField {
+	if s.Circuit == CircuitStockFlow {
+		return []outputField{
+			{Name: "registry", Type: "address", bytes: 20},
+			uintField("start_block", 32),
+			uintField("end_block", 32),
+			uintField("counter_delta", 248),
+			uintField("event_sum", 248),
+			{Name: "balanced", Type: "bool", bytes: 1},
+		}
+	}
+	if s.ValueMode == ValueModeSplit {
+		return []outputField{uintField("total_hi", 248), uintField("total_lo", 248)}
+	}
+
+	var fields []outputField
+	if s.Bucket == "" {
+		fields = append(fields, uintField("total", 248))
+	} else {
+		fields = append(fields, uintField("total_lower", 248), uintField("total_upper", 248))
+	}
+	for i := 0; i < s.slots(); i++ {
+		for _, f := range s.Fields {
+			if f.Name != emissionsField {
+				fields = append(fields, uintField(fmt.Sprintf("%s_%d", f.Name, i), (f.Bits+7)/8*8))
+			}
+		}
+	}
+	switch s.Aggregation {
+	case AggregationTopK:
+		for i := 0; i < s.TopK; i++ {
+			fields = append(fields,
+				outputField{Name: fmt.Sprintf("top_%d_slot", i), Type: "bytes32", bytes: 32},
+				uintField(fmt.Sprintf("top_%d_value", i), 248))
+		}
+	case AggregationWindowAvg:
+		fields = append(fields, uintField("window_average", 248))
+	case AggregationEMA:
+		fields = append(fields, uintField("ema", 248))
+	case AggregationMerkle:
+		fields = append(fields, outputField{Name: "merkle_root", Type: "bytes32", bytes: 32})
+	}
+	return fields
+}
+
+// outputLayoutV2 adds the outputs of ReceiptEmissionsCircuit to
+// outputLayoutV1.
+func outputLayoutV2(s CircuitSpec) []outputField {
+	if s.Circuit == CircuitReceiptEmissions {
+		return []outputField{
+			{Name: "emitter", Type: "address", bytes: 20},
+			uintField("receipts", 32),
+			uintField("total", 248),
+		}
+	}
+	return outputLayoutV1(s)
+}
+
+// outputLayoutV3 adds the min, max, mean and count aggregations to
+// outputLayoutV2.
+func outputLayoutV3(s CircuitSpec) []outputField {
+	fields := outputLayoutV2(s)
+	if s.Circuit != CircuitEmissions {
+		return fields
+	}
+	switch s.Aggregation {
+	case AggregationMin:
+		fields = append(fields, uintField("min", 248))
+	case AggregationMax:
+		fields = append(fields, uintField("max", 248))
+	case AggregationMean:
+		fields = append(fields, uintField("mean", 248))
+	case AggregationCount:
+		fields = append(fields, uintField("nonzero_count", 32))
+	}
+	return fields
+}
+
+// outputLayoutV4 adds the outputs of BlockRangeCircuit to outputLayoutV3.
+func outputLayoutV4(s CircuitSpec) []outputField {
+	if s.Circuit == CircuitBlockRange {
+		return []outputField{
+			{Name: "contract", Type: "address", bytes: 20},
+			{Name: "slot", Type: "bytes32", bytes: 32},
+			uintField("start_block", 32),
+			uintField("end_block", 32),
+			uintField("start_value", 248),
+			uintField("end_value", 248),
+			uintField("emitted", 248),
+		}
+	}
+	return outputLayoutV3(s)
+}
+
+// decodeOutput decodes the packed outputs of a proof of spec made under the
+// given output schema version.
+func decodeOutput(version int, spec CircuitSpec, output []byte) ([]decodedOutput, error) {
+	layout, ok := outputLayouts[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown output schema version %d", version)
+	}
+	fields := layout(spec)
+	size := 0
+	for _, f := range fields {
+		size += f.bytes
+	}
+	if len(output) != size {
+		return nil, fmt.Errorf("output is %d bytes, schema version %d of spec %s has %d", len(output), version, spec, size)
+	}
+
+	decoded := make([]decodedOutput, len(fields))
+	for i, f := range fields {
+		b := output[:f.bytes]
+		output = output[f.bytes:]
+		d := decodedOutput{Name: f.Name, Type: f.Type}
+		switch f.Type {
+		case "address":
+			d.Value = common.BytesToAddress(b)
+		case "bytes32":
+			d.Value = common.BytesToHash(b)
+		case "bool":
+			d.Value = b[0] != 0
+		default:
+			d.Value = new(big.Int).SetBytes(b)
+		}
+		decoded[i] = d
+	}
+	return decoded, nil
+}
+
+// handleDecodeOutput decodes a proof's packed output, given as the output
+// parameter in hex, for the spec it was proven with. schema_version defaults
+// to the current one; proofs report theirs as output_schema. The spec
+// should include the proof's slots, which packed field outputs depend on.
+func handleDecodeOutput(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	version := outputSchemaVersion
+	if v := r.URL.Query().Get("schema_version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid schema_version %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	output, err := hexutil.Decode(r.URL.Query().Get("output"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid output: %v", err), http.StatusBadRequest)
+		return
+	}
+	decoded, err := decodeOutput(version, spec, output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"output_schema": version,
+		"outputs":       decoded,
+	})
+}
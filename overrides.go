@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/gwproto"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// submitOptions are the gateway and on-chain waiting settings of one
+// submission. Requests may override the server defaults within the server's
+// bounds.
+type submitOptions struct {
+	// SubmitTimeout bounds each gateway proof submission.
+	SubmitTimeout time.Duration
+	// SubmitRetries is how many times a failed submission is retried.
+	SubmitRetries int
+	// FulfillmentWindow bounds the wait for the on-chain callback.
+	FulfillmentWindow time.Duration
+	// CallbackURL is posted a signed callbackPayload once the submission
+	// is finalized, expires or fails.
+	CallbackURL string
+	// SrcChainID is the chain the queries read; DstChainID the chain whose
+	// app contract receives the result.
+	SrcChainID, DstChainID uint64
+	// CallbackContract receives the result in place of the destination
+	// chain's app contract when set, its callback given CallbackGasLimit.
+	CallbackContract common.Address
+	CallbackGasLimit uint64
+	// QueryOption is the mode the gateway proves the request in.
+	QueryOption gwproto.QueryOption
+}
+
+var (
+	// submitRetries is the default number of gateway submission retries.
+	submitRetries = 0
+	// callbackGasLimit is the default gas Brevis gives the callback when it
+	// delivers a result.
+	callbackGasLimit uint64 = 500000
+
+	// Requests may not override past these.
+	maxSubmitTimeout     = 10 * time.Minute
+	maxSubmitRetries     = 5
+	maxFulfillmentWindow = 2 * time.Hour
+	// A callback gets at least minCallbackGasLimit, enough to be called at
+	// all, and at most maxCallbackGasLimit.
+	minCallbackGasLimit uint64 = 21000
+	maxCallbackGasLimit uint64 = 5000000
+)
+
+// queryOptions name the gateway modes query_option takes.
+var queryOptions = map[string]gwproto.QueryOption{
+	"zk": gwproto.QueryOption_ZK_MODE,
+	"op": gwproto.QueryOption_OP_MODE,
+}
+
+// defaultSubmitOptions are the server's settings.
+func defaultSubmitOptions() submitOptions {
+	return submitOptions{
+		SubmitTimeout:     stageDeadlines[StageSubmitProof],
+		SubmitRetries:     submitRetries,
+		FulfillmentWindow: fulfillmentWindow,
+		SrcChainID:        activeProfile.ChainID,
+		DstChainID:        activeProfile.ChainID,
+		CallbackGasLimit:  callbackGasLimit,
+	}
+}
+
+// loadSubmitPolicy reads the default retries and the override bounds.
+func loadSubmitPolicy() error {
+	var err error
+	if submitRetries, err = envInt("BREVIS_SUBMIT_RETRIES", submitRetries); err != nil {
+		return err
+	}
+	if maxSubmitTimeout, err = envDuration("BREVIS_MAX_SUBMIT_TIMEOUT", maxSubmitTimeout); err != nil {
+		return err
+	}
+	if maxSubmitRetries, err = envInt("BREVIS_MAX_SUBMIT_RETRIES", maxSubmitRetries); err != nil {
+		return err
+	}
+	if maxFulfillmentWindow, err = envDuration("BREVIS_MAX_FULFILLMENT_WINDOW", maxFulfillmentWindow); err != nil {
+		return err
+	}
+	for name, v := range map[string]*uint64{
+		"BREVIS_CALLBACK_GAS_LIMIT":     &callbackGasLimit,
+		"BREVIS_MAX_CALLBACK_GAS_LIMIT": &maxCallbackGasLimit,
+	} {
+		n, err := envInt(name, int(*v))
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", name, n)
+		}
+		*v = uint64(n)
+	}
+	// The defaults must satisfy the bounds requests are held to.
+	return defaultSubmitOptions().check()
+}
+
+// parseSubmitOptions applies the submit_timeout, submit_retries,
+// fulfillment_window, callback_url, chain_id, dst_chain_id,
+// callback_contract, callback_gas_limit and query_option overrides of r to
+// the server defaults, as the caller's tenant settings t change them.
+func parseSubmitOptions(r *http.Request, t tenantSettings) (submitOptions, error) {
+	q := r.URL.Query()
+	opts := defaultSubmitOptions()
+	if err := t.apply(&opts); err != nil {
+		return opts, err
+	}
+	for name, d := range map[string]*time.Duration{
+		"submit_timeout":     &opts.SubmitTimeout,
+		"fulfillment_window": &opts.FulfillmentWindow,
+	} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %v", name, v, err)
+		}
+		*d = parsed
+	}
+	if q.Get("submit_retries") != "" {
+		var err error
+		if opts.SubmitRetries, err = intParam(q, "submit_retries"); err != nil {
+			return opts, err
+		}
+	}
+	if v := q.Get("callback_url"); v != "" {
+		opts.CallbackURL = v
+	}
+	for name, id := range map[string]*uint64{"chain_id": &opts.SrcChainID, "dst_chain_id": &opts.DstChainID} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %v", name, v, err)
+		}
+		*id = parsed
+	}
+	if v := q.Get("callback_contract"); v != "" {
+		addr, err := parseAddress("callback_contract", v)
+		if err != nil {
+			return opts, err
+		}
+		opts.CallbackContract = addr
+	}
+	if v := q.Get("callback_gas_limit"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid callback_gas_limit %q: %v", v, err)
+		}
+		opts.CallbackGasLimit = parsed
+	}
+	if v := q.Get("query_option"); v != "" {
+		option, ok := queryOptions[v]
+		if !ok {
+			return opts, fmt.Errorf("invalid query_option %q: want zk or op", v)
+		}
+		opts.QueryOption = option
+	}
+	return opts, opts.check()
+}
+
+// submitOptionsJSON spells the durations of submitOptions like "90s".
+type submitOptionsJSON struct {
+	SubmitTimeout     string `json:"submit_timeout"`
+	SubmitRetries     int    `json:"submit_retries"`
+	FulfillmentWindow string `json:"fulfillment_window"`
+	CallbackURL       string `json:"callback_url,omitempty"`
+	SrcChainID        uint64 `json:"chain_id,omitempty"`
+	DstChainID        uint64 `json:"dst_chain_id,omitempty"`
+	CallbackContract  string `json:"callback_contract,omitempty"`
+	CallbackGasLimit  uint64 `json:"callback_gas_limit,omitempty"`
+	QueryOption       string `json:"query_option,omitempty"`
+}
+
+func (o submitOptions) MarshalJSON() ([]byte, error) {
+	j := submitOptionsJSON{o.SubmitTimeout.String(), o.SubmitRetries, o.FulfillmentWindow.String(), o.CallbackURL, o.SrcChainID, o.DstChainID, "", o.CallbackGasLimit, ""}
+	if o.CallbackContract != (common.Address{}) {
+		j.CallbackContract = o.CallbackContract.Hex()
+	}
+	for name, option := range queryOptions {
+		if option == o.QueryOption {
+			j.QueryOption = name
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON leaves settings missing from b, as in jobs exported before
+// they existed, at the server defaults.
+func (o *submitOptions) UnmarshalJSON(b []byte) error {
+	var j submitOptionsJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*o = defaultSubmitOptions()
+	o.SubmitRetries, o.CallbackURL = j.SubmitRetries, j.CallbackURL
+	if j.SrcChainID != 0 {
+		o.SrcChainID, o.DstChainID = j.SrcChainID, j.DstChainID
+	}
+	if j.CallbackContract != "" {
+		o.CallbackContract = common.HexToAddress(j.CallbackContract)
+	}
+	if j.CallbackGasLimit != 0 {
+		o.CallbackGasLimit = j.CallbackGasLimit
+	}
+	o.QueryOption = queryOptions[j.QueryOption]
+	for _, d := range []struct {
+		s string
+		d *time.Duration
+	}{{j.SubmitTimeout, &o.SubmitTimeout}, {j.FulfillmentWindow, &o.FulfillmentWindow}} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil {
+			return err
+		}
+		*d.d = v
+	}
+	return nil
+}
+
+func (o submitOptions) check() error {
+	if o.SubmitTimeout <= 0 || o.SubmitTimeout > maxSubmitTimeout {
+		return fmt.Errorf("submit_timeout %s must be positive and at most %s", o.SubmitTimeout, maxSubmitTimeout)
+	}
+	if o.SubmitRetries < 0 || o.SubmitRetries > maxSubmitRetries {
+		return fmt.Errorf("submit_retries %d must be between 0 and %d", o.SubmitRetries, maxSubmitRetries)
+	}
+	if o.FulfillmentWindow <= 0 || o.FulfillmentWindow > maxFulfillmentWindow {
+		return fmt.Errorf("fulfillment_window %s must be positive and at most %s", o.FulfillmentWindow, maxFulfillmentWindow)
+	}
+	if o.CallbackURL != "" {
+		u, err := url.Parse(o.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid callback_url %q: want an http or https URL", o.CallbackURL)
+		}
+		if callbackSecret == "" {
+			return fmt.Errorf("callback_url requires BREVIS_CALLBACK_SECRET to sign callbacks")
+		}
+	}
+	if _, err := chainFor(o.SrcChainID); err != nil {
+		return err
+	}
+	if _, err := destinationFor(o.DstChainID); err != nil {
+		return err
+	}
+	if o.CallbackGasLimit < minCallbackGasLimit || o.CallbackGasLimit > maxCallbackGasLimit {
+		return fmt.Errorf("callback_gas_limit %d must be between %d and %d", o.CallbackGasLimit, minCallbackGasLimit, maxCallbackGasLimit)
+	}
+	return nil
+}
+
+// callbackContract is the contract the result is delivered to on dst.
+func (o submitOptions) callbackContract(dst Profile) common.Address {
+	if o.CallbackContract != (common.Address{}) {
+		return o.CallbackContract
+	}
+	return dst.AppContract
+}
+
+// checkCallbackContract refuses a callback_contract with no code on the
+// destination chain, where Brevis could not deliver the result.
+func (o submitOptions) checkCallbackContract() error {
+	if o.CallbackContract == (common.Address{}) {
+		return nil
+	}
+	return verifyContractCode(o.DstChainID, pickChainRPC(o.DstChainID), ChainContracts{Callback: o.CallbackContract})
+}
+
+// latestFinish is how long a submission started now can take at most: every
+// stage deadline, each submission try and request preparation try, the
+// fulfillment window and the receipt wait, for the first attempt and every
+// re-prove.
+func (o submitOptions) latestFinish() time.Duration {
+	var attempt time.Duration
+	for stage, d := range stageDeadlines {
+		switch stage {
+		case StageSubmitProof:
+		case StagePrepareRequest:
+			attempt += time.Duration(retries.Attempts) * d
+		default:
+			attempt += d
+		}
+	}
+	attempt += time.Duration(o.SubmitRetries+1)*o.SubmitTimeout + o.FulfillmentWindow + receiptTimeout
+	return time.Duration(maxReproves+1) * attempt
+}
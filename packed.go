@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// emissionsField is the packed field name that replaces the full slot value
+// as the emissions value checked and aggregated by the circuit.
+const emissionsField = "emissions"
+
+// PackedField is a bit range of a storage slot value, counted from the least
+// significant bit, matching how Solidity packs struct members into a slot.
+type PackedField struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+	Bits   int    `json:"bits"`
+}
+
+// parsePackedFields parses "name:offset:bits" entries separated by commas,
+// e.g. "emissions:0:128,timestamp:128:64,flags:192:8".
+func parsePackedFields(s string) ([]PackedField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var fields []PackedField
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid field %q, expected name:offset:bits", entry)
+		}
+		offset, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in field %q: %v", entry, err)
+		}
+		bits, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bits in field %q: %v", entry, err)
+		}
+		fields = append(fields, PackedField{Name: parts[0], Offset: offset, Bits: bits})
+	}
+	return fields, nil
+}
+
+func validatePackedFields(fields []PackedField) error {
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("packed field name must not be empty")
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate packed field %q", f.Name)
+		}
+		seen[f.Name] = true
+		if f.Bits < 1 || f.Bits > 248 {
+			return fmt.Errorf("packed field %q must be between 1 and 248 bits, got %d", f.Name, f.Bits)
+		}
+		if f.Offset < 0 || f.Offset+f.Bits > 256 {
+			return fmt.Errorf("packed field %q exceeds the 256-bit slot", f.Name)
+		}
+	}
+	return nil
+}
+
+func decodePackedField(api *sdk.CircuitAPI, value sdk.Bytes32, f PackedField) sdk.Uint248 {
+	bits := api.Bytes32.ToBinary(value)
+	return api.Uint248.FromBinary(bits[f.Offset : f.Offset+f.Bits]...)
+}
+
+// emissionValue returns the value the circuit treats as a slot's emissions:
+// the packed emissions field if the spec declares one, else the whole slot.
+func (c *AppCircuit) emissionValue(api *sdk.CircuitAPI, slot sdk.StorageSlot) sdk.Uint248 {
+	for _, f := range c.Spec.Fields {
+		if f.Name == emissionsField {
+			return decodePackedField(api, slot.Value, f)
+		}
+	}
+	return api.ToUint248(slot.Value)
+}
+
+// outputPackedFields outputs every non-emissions field of every allocated slot,
+// in slot order then field order. Unused slots decode to zero.
+func (c *AppCircuit) outputPackedFields(api *sdk.CircuitAPI, in sdk.DataInput) {
+	for _, slot := range in.StorageSlots.Raw {
+		for _, f := range c.Spec.Fields {
+			if f.Name == emissionsField {
+				continue
+			}
+			api.OutputUint((f.Bits+7)/8*8, decodePackedField(api, slot.Value, f))
+		}
+	}
+}
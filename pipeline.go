@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	AttemptProving   = "proving"
+	AttemptSubmitted = "submitted"
+	AttemptFulfilled = "fulfilled"
+	AttemptExpired   = "expired"
+)
+
+var (
+	// fulfillmentWindow bounds how long a Brevis request may stay unfulfilled
+	// before it is considered expired.
+	fulfillmentWindow = 30 * time.Minute
+	// maxReproves is how many times an expired request is re-proven at the
+	// current block before giving up.
+	maxReproves = 0
+)
+
+// proofAttempt is one pass through input building, proving, submission and
+// waiting for fulfillment.
+type proofAttempt struct {
+	RequestID          string               `json:"request_id"`
+	Fee                *big.Int             `json:"fee"`
+	Status             string               `json:"status"`
+	StateTimes         map[string]time.Time `json:"state_times"`
+	Transaction        string               `json:"transaction,omitempty"`
+	TransactionReceipt *TxReceipt           `json:"transaction_receipt,omitempty"`
+	ReceiptError       string               `json:"transaction_receipt_error,omitempty"`
+	Supersedes         string               `json:"supersedes,omitempty"`
+	Merkle             *MerkleCommitment    `json:"merkle,omitempty"`
+	Provenance         []provenance         `json:"provenance,omitempty"`
+	Output             hexutil.Bytes        `json:"output,omitempty"`
+	Cost               cost                 `json:"cost"`
+	Timings            timings              `json:"timings"`
+	// CircuitHash is the circuitHash of the variant the attempt was proven
+	// with.
+	CircuitHash string `json:"circuit_hash,omitempty"`
+	// UnprovenInputs are the storage values the attempt fetched and proved
+	// over; they are not themselves proven.
+	UnprovenInputs []rawStorageValue `json:"unproven_inputs,omitempty"`
+}
+
+type timings struct {
+	FetchMs       int64   `json:"fetch_ms"`
+	FetchSerialMs int64   `json:"fetch_serial_ms"`
+	FetchSpeedup  float64 `json:"fetch_speedup,omitempty"`
+	BuildInputMs  int64   `json:"build_input_ms"`
+	WitnessMs     int64   `json:"witness_ms"`
+	ProveMs       int64   `json:"prove_ms"`
+}
+
+// statusError carries the HTTP status a pipeline failure should map to.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func httpStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	return http.StatusInternalServerError
+}
+
+// proveUntilFulfilled runs proof attempts until one is fulfilled or the
+// re-prove budget is spent. It returns every attempt, oldest first; each
+// re-proven attempt links to the expired one it supersedes.
+func proveUntilFulfilled(ctx context.Context, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, opts submitOptions) ([]*proofAttempt, error) {
+	var attempts []*proofAttempt
+	for i := 0; i <= maxReproves; i++ {
+		// A job's first attempt runs on what the job reserved to start.
+		reservation, _ := ctx.Value(budgetReservationKey{}).(*budgetReservation)
+		if i > 0 || reservation == nil {
+			var err error
+			if reservation, err = reserveBudget(ctx, apiKeyName(ctx), expectedFee(ctx, spec, opts.SrcChainID)); err != nil {
+				return attempts, err
+			}
+		}
+		attempt, err := runProofAttempt(ctx, spec, queries, receipts, pin, opts, reservation)
+		if err != nil {
+			proofAttemptsTotal.WithLabelValues(spec.Circuit, "error").Inc()
+			return attempts, err
+		}
+		proofAttemptsTotal.WithLabelValues(spec.Circuit, attempt.Status).Inc()
+		if len(attempts) > 0 {
+			attempt.Supersedes = attempts[len(attempts)-1].RequestID
+		}
+		attempts = append(attempts, attempt)
+		clearCheckpoint(ctx)
+		if attempt.Status == AttemptFulfilled {
+			return attempts, nil
+		}
+		slog.WarnContext(ctx, "Request expired unfulfilled", "request", attempt.RequestID, "window", opts.FulfillmentWindow.String())
+	}
+	return attempts, nil
+}
+
+// runProofAttempt runs one proof attempt, counting its fee against the
+// budget in place of reservation.
+func runProofAttempt(ctx context.Context, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, opts submitOptions, reservation *budgetReservation) (_ *proofAttempt, err error) {
+	defer reservation.release(ctx)
+	rec := newStoredRequest(ctx, spec, opts.SrcChainID, queries, receipts)
+	defer func() {
+		if err != nil {
+			rec.Error = err.Error()
+			rec.advance(ctx, RequestFailed)
+		}
+	}()
+
+	src, err := chainFor(opts.SrcChainID)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := destinationFor(opts.DstChainID)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := loadCheckpoint(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Ignoring unreadable attempt checkpoint", "err", err)
+		saved = nil
+	}
+	if saved.reached(CheckpointSubmitted) {
+		clearCheckpoint(ctx)
+		return nil, &statusError{http.StatusConflict, fmt.Errorf("attempt was interrupted after submitting request %s; not submitting it again", saved.Attempt.RequestID)}
+	}
+	// A fetch that fails on one provider moves to another of the chain, with
+	// a fresh app since the failed one holds partial data.
+	var (
+		app     *sdk.BrevisApp
+		attempt *proofAttempt
+		witness witness.Witness
+		proof   plonk.Proof
+		tried   []string
+	)
+	rpcURL := pickChainRPC(src.ChainID)
+	for {
+		if app, err = src.newBrevisApp(rpcURL, config.OutputDir); err != nil {
+			return nil, fmt.Errorf("Error initializing BrevisApp: %v", err)
+		}
+		attempt = newProofAttempt()
+		witness, proof, err = proveAttempt(ctx, app, rpcURL, spec, queries, receipts, pin, attempt, saved)
+		var re *rpcError
+		if err == nil || !errors.As(err, &re) || len(tried) >= rpcFailovers {
+			break
+		}
+		tried = append(tried, rpcURL)
+		next := failoverRPC(src.ChainID, tried)
+		if next == "" {
+			break
+		}
+		slog.WarnContext(ctx, "Failing over to another RPC provider", "rpc", rpcURL, "next", next, "err", err)
+		rpcURL = next
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.proven(ctx, proof, witness, attempt.Output)
+
+	if err := submitWithRetries(ctx, app, proof, opts); err != nil {
+		return nil, fmt.Errorf("Error submitting proof: %w", err)
+	}
+	reportProgress(ctx, ProgressSubmitted)
+
+	if err := prepareAttempt(ctx, app, witness, src.ChainID, dst, opts, attempt); err != nil {
+		return nil, err
+	}
+	recordAttemptSample(spec, attempt.Timings, attempt.Fee)
+	recordSpend(ctx, attempt.Fee, reservation)
+	feeAmount.WithLabelValues(spec.Circuit).Observe(feeFloat(attempt.Fee))
+	if err := attempt.transition(ctx, AttemptSubmitted); err != nil {
+		return nil, err
+	}
+	saveCheckpoint(ctx, &stageCheckpoint{Stage: CheckpointSubmitted, Attempt: *attempt})
+	rec.RequestID, rec.Fee = attempt.RequestID, attempt.Fee
+	rec.advance(ctx, RequestSubmitted)
+	reportProgress(ctx, ProgressAwaitingFinality)
+
+	// The SDK polls the gateway without a deadline of its own, so a poll
+	// that hangs is cut off past the window.
+	waitCtx, cancel := context.WithTimeout(ctx, opts.FulfillmentWindow)
+	defer cancel()
+	tx, err := runStageWithin(ctx, StageFinality, opts.FulfillmentWindow+stageDeadlines[StageFinality], func() (common.Hash, error) {
+		return app.WaitFinalProofSubmitted(waitCtx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error waiting for proof submission: %w", err)
+	}
+	// The SDK returns a zero hash without an error once the context ends.
+	if tx == (common.Hash{}) {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Error waiting for proof submission: %v", ctx.Err())
+		}
+		if err := attempt.transition(ctx, AttemptExpired); err != nil {
+			return nil, err
+		}
+		rec.advance(ctx, RequestExpired)
+		return attempt, nil
+	}
+	attempt.Transaction = tx.Hex()
+	if err := attempt.transition(ctx, AttemptFulfilled); err != nil {
+		return nil, err
+	}
+	rec.Transaction = tx.Hex()
+	rec.advance(ctx, RequestFinalized)
+	reportProgress(ctx, ProgressFinalized)
+
+	// The fulfillment lands on the destination chain.
+	receipt, err := waitForReceipt(ctx, pickChainRPC(dst.ChainID), tx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error fetching fulfillment receipt", "tx", tx.Hex(), "err", err)
+		attempt.ReceiptError = err.Error()
+	} else {
+		attempt.TransactionReceipt = receipt
+		attempt.Cost.FulfillmentGasUsed = receipt.GasUsed
+	}
+	return attempt, nil
+}
+
+// prepareRequest is the SDK call that prepares a Brevis request; tests
+// stub it.
+var prepareRequest = (*sdk.BrevisApp).PrepareRequest
+
+// prepareAttempt prepares the Brevis request of a proven attempt and records
+// its ID, fee and cost on the attempt. The fee is the request's fee value,
+// not its nonce.
+func prepareAttempt(ctx context.Context, app *sdk.BrevisApp, witness witness.Witness, srcChainID uint64, dst Profile, opts submitOptions, attempt *proofAttempt) error {
+	var requestId common.Hash
+	fee, err := withRetry(ctx, StagePrepareRequest, func() (*big.Int, error) {
+		return runStage(ctx, StagePrepareRequest, func() (*big.Int, error) {
+			_, id, _, feeValue, err := prepareRequest(
+				app, nil, witness, srcChainID, dst.ChainID, dst.RefundAddress, opts.callbackContract(dst), opts.CallbackGasLimit, &opts.QueryOption, "",
+			)
+			requestId = id
+			return feeValue, err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("Error preparing request: %w", err)
+	}
+	if fee == nil {
+		fee = new(big.Int)
+	}
+	attempt.RequestID, attempt.Fee = requestId.Hex(), fee
+	attempt.Cost = attemptCost(fee, attempt.Timings)
+	return nil
+}
+
+// proveAttempt fetches the queried data into app, builds the circuit input
+// and proves it, recording the inputs, output, Merkle commitment and
+// timings on attempt. It submits nothing. Stages saved reached before a
+// restart are taken from it instead of run again.
+func proveAttempt(ctx context.Context, app *sdk.BrevisApp, rpcURL string, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, attempt *proofAttempt, saved *stageCheckpoint) (witness.Witness, plonk.Proof, error) {
+	var t timings
+	var fetched []sdk.StorageData
+	var receiptData []sdk.ReceiptData
+	if saved.reached(CheckpointFetched) {
+		slog.InfoContext(ctx, "Resuming attempt from checkpoint", "stage", saved.Stage)
+		fetched, receiptData, t = saved.Storage, saved.Receipts, saved.Attempt.Timings
+		attempt.Provenance, attempt.UnprovenInputs = saved.Attempt.Provenance, saved.Attempt.UnprovenInputs
+	} else {
+		var err error
+		if fetched, receiptData, t, err = fetchAttempt(ctx, rpcURL, spec, queries, receipts, pin, attempt); err != nil {
+			return nil, nil, err
+		}
+		saveCheckpoint(ctx, &stageCheckpoint{Stage: CheckpointFetched, Attempt: attempt.with(t), Storage: fetched, Receipts: receiptData})
+	}
+	for _, q := range fetched {
+		app.AddStorage(q)
+	}
+	for _, d := range receiptData {
+		app.AddReceipt(d)
+	}
+
+	// Building the input onwards is what takes the memory.
+	release, err := acquireProofSlot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	circuit := spec.newCircuit()
+	if v := findVariant(spec); v != nil {
+		attempt.CircuitHash = v.Hash
+	}
+
+	start := time.Now()
+	circuitInput, err := runStage(ctx, StageBuildInput, func() (sdk.CircuitInput, error) {
+		return app.BuildCircuitInput(circuit)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error building circuit input: %w", err)
+	}
+	t.BuildInputMs = time.Since(start).Milliseconds()
+	reportProgress(ctx, ProgressInputBuilt)
+	recordSlotUsage(spec, circuitInput)
+	attempt.Output = circuitInput.GetAbiPackedOutput()
+	var merkle *MerkleCommitment
+	if c, ok := circuit.(*AppCircuit); ok {
+		if err := c.checkValueWidths(circuitInput); err != nil {
+			return nil, nil, &statusError{http.StatusUnprocessableEntity, err}
+		}
+		if err := c.checkScaledRange(circuitInput); err != nil {
+			return nil, nil, &statusError{http.StatusUnprocessableEntity, err}
+		}
+		if spec.Aggregation == AggregationMerkle {
+			merkle = c.merkleCommitment(circuitInput)
+		}
+	}
+	attempt.Merkle = merkle
+
+	fullWitness, proof := saved.witnessAndProof()
+	if fullWitness == nil {
+		start = time.Now()
+		fullWitness, err = runStage(ctx, StageWitness, func() (witness.Witness, error) {
+			w, _, err := sdk.NewFullWitness(circuit, circuitInput)
+			return w, err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error generating witness: %w", err)
+		}
+		t.WitnessMs = time.Since(start).Milliseconds()
+		saveCheckpoint(ctx, &stageCheckpoint{Stage: CheckpointWitness, Attempt: attempt.with(t), Storage: fetched, Receipts: receiptData, witness: fullWitness})
+	}
+	reportProgress(ctx, ProgressWitnessGenerated)
+
+	if proof == nil {
+		reportProgress(ctx, ProgressProving)
+		start = time.Now()
+		proof, err = runStage(ctx, StageProve, func() (plonk.Proof, error) {
+			return prove(ctx, spec, fullWitness)
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error generating proof: %w", err)
+		}
+		t.ProveMs = time.Since(start).Milliseconds()
+		observeTimings(spec, t)
+		saveCheckpoint(ctx, &stageCheckpoint{Stage: CheckpointProven, Attempt: attempt.with(t), Storage: fetched, Receipts: receiptData, proof: proof})
+	}
+	attempt.Timings = t
+	return fullWitness, proof, nil
+}
+
+// fetchAttempt reads the queried storage and receipts for an attempt,
+// checking the snapshot pin and provenance, and records the inputs on
+// attempt.
+func fetchAttempt(ctx context.Context, rpcURL string, spec CircuitSpec, queries []sdk.StorageData, receipts []receiptQuery, pin *snapshotPin, attempt *proofAttempt) ([]sdk.StorageData, []sdk.ReceiptData, timings, error) {
+	var t timings
+
+	// Checked on every attempt, since a re-prove may run after a reorg.
+	if pin != nil {
+		pinCtx, cancel := stageContext(ctx, StageSnapshot)
+		err := pin.verify(pinCtx, rpcURL)
+		cancel()
+		if err != nil {
+			if pinCtx.Err() != nil {
+				return nil, nil, t, stageError(pinCtx, StageSnapshot)
+			}
+			return nil, nil, t, err
+		}
+	}
+
+	fetchCtx, cancel := stageContext(ctx, StageFetch)
+	fetched, serial, wall, err := prefetchStorage(fetchCtx, rpcURL, queries)
+	cancel()
+	if err != nil {
+		if fetchCtx.Err() != nil {
+			return nil, nil, t, stageError(fetchCtx, StageFetch)
+		}
+		return nil, nil, t, &rpcError{rpcURL, fmt.Errorf("Error fetching storage queries: %w", err)}
+	}
+	t.FetchMs, t.FetchSerialMs = wall.Milliseconds(), serial.Milliseconds()
+	if wall > 0 {
+		t.FetchSpeedup = float64(serial) / float64(wall)
+	}
+	provCtx, cancel := stageContext(ctx, StageProvenance)
+	attempt.Provenance, err = verifyProvenance(provCtx, rpcURL, fetched)
+	cancel()
+	if err != nil {
+		if provCtx.Err() != nil {
+			return nil, nil, t, stageError(provCtx, StageProvenance)
+		}
+		return nil, nil, t, err
+	}
+	attempt.UnprovenInputs = rawStorageValues(fetched)
+	var data []sdk.ReceiptData
+	if len(receipts) > 0 {
+		receiptCtx, cancel := stageContext(ctx, StageFetch)
+		data, err = fetchReceipts(receiptCtx, rpcURL, spec.receiptEvent(), receipts)
+		cancel()
+		if err != nil {
+			if receiptCtx.Err() != nil {
+				return nil, nil, t, stageError(receiptCtx, StageFetch)
+			}
+			var se *statusError
+			if errors.As(err, &se) {
+				return nil, nil, t, fmt.Errorf("Error fetching receipt queries: %w", err)
+			}
+			return nil, nil, t, &rpcError{rpcURL, fmt.Errorf("Error fetching receipt queries: %w", err)}
+		}
+	}
+	return fetched, data, t, nil
+}
+
+// submitWithRetries submits the proof to the gateway, retrying tries that
+// fail transiently or time out up to opts.SubmitRetries times, backing off
+// as the retry policy does.
+func submitWithRetries(ctx context.Context, app *sdk.BrevisApp, proof plonk.Proof, opts submitOptions) error {
+	var err error
+	for i := 0; i <= opts.SubmitRetries; i++ {
+		if i > 0 {
+			slog.WarnContext(ctx, "Retrying proof submission", "retry", i, "retries", opts.SubmitRetries, "err", err)
+			if err := retries.sleep(ctx, i); err != nil {
+				return err
+			}
+		}
+		_, err = runStageWithin(ctx, StageSubmitProof, opts.SubmitTimeout, func() (struct{}, error) {
+			return struct{}{}, app.SubmitProof(proof)
+		})
+		if err == nil {
+			return nil
+		}
+		submissionFailuresTotal.Inc()
+		if ctx.Err() != nil || !retryable(err) && httpStatus(err) != http.StatusGatewayTimeout {
+			return err
+		}
+	}
+	return err
+}
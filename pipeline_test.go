@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/gwproto"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPrepareAttemptReportsFeeValue(t *testing.T) {
+	const nonce = 7
+	feeValue, _ := new(big.Int).SetString("123456789012345678901", 10)
+	requestID := common.HexToHash("0x01")
+
+	defer func(orig func(*sdk.BrevisApp, plonk.VerifyingKey, witness.Witness, uint64, uint64, common.Address, common.Address, uint64, *gwproto.QueryOption, string) ([]byte, common.Hash, uint64, *big.Int, error)) {
+		prepareRequest = orig
+	}(prepareRequest)
+	prepareRequest = func(*sdk.BrevisApp, plonk.VerifyingKey, witness.Witness, uint64, uint64, common.Address, common.Address, uint64, *gwproto.QueryOption, string) ([]byte, common.Hash, uint64, *big.Int, error) {
+		return nil, requestID, nonce, new(big.Int).Set(feeValue), nil
+	}
+
+	attempt := newProofAttempt()
+	if err := prepareAttempt(context.Background(), nil, nil, 1, Profile{ChainID: 1}, defaultSubmitOptions(), attempt); err != nil {
+		t.Fatalf("prepareAttempt: %v", err)
+	}
+	if attempt.RequestID != requestID.Hex() {
+		t.Errorf("request ID = %s, want %s", attempt.RequestID, requestID.Hex())
+	}
+	if attempt.Fee.Cmp(feeValue) != 0 {
+		t.Errorf("fee = %s, want the fee value %s, not the nonce %d", attempt.Fee, feeValue, nonce)
+	}
+	if attempt.Cost.FeeAmount != feeValue.String() {
+		t.Errorf("cost fee amount = %s, want %s", attempt.Cost.FeeAmount, feeValue)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// planSamples is how many recent attempts per variant /plan estimates from.
+const planSamples = 100
+
+// prunedStateDepth is how many recent blocks of state a non-archive node
+// keeps.
+const prunedStateDepth = 128
+
+// attemptSample is the proving time and fee of one proof attempt.
+type attemptSample struct {
+	ProveMs int64
+	Fee     *big.Int
+}
+
+var (
+	// attemptSamples holds recent attempts keyed by variant spec.
+	attemptSamples      = map[string][]attemptSample{}
+	attemptSamplesMutex sync.Mutex
+)
+
+// recordAttemptSample notes the witness and proving time and the fee of an
+// attempt of the spec's variant.
+func recordAttemptSample(spec CircuitSpec, t timings, fee *big.Int) {
+	attemptSamplesMutex.Lock()
+	defer attemptSamplesMutex.Unlock()
+	key := spec.String()
+	samples := append(attemptSamples[key], attemptSample{t.WitnessMs + t.ProveMs, fee})
+	if len(samples) > planSamples {
+		samples = samples[len(samples)-planSamples:]
+	}
+	attemptSamples[key] = samples
+}
+
+// queryPlan is how a draft query set maps onto circuit capacity and what
+// submitting it is expected to take.
+type queryPlan struct {
+	Spec           string `json:"spec"`
+	StorageQueries int    `json:"storage_queries"`
+	ReceiptQueries int    `json:"receipt_queries"`
+	// Capacity is the allocation of the variant each submission is routed
+	// to: storage slots, or receipts for circuits reading receipts.
+	Capacity int `json:"capacity"`
+	// Chunks is how many submissions the queries must be split into to fit.
+	Chunks int `json:"chunks"`
+	// Samples is how many past attempts of the variant the estimates come
+	// from; without any they are left out.
+	Samples          int    `json:"samples"`
+	EstimatedProveMs int64  `json:"estimated_prove_ms,omitempty"`
+	EstimatedFee     string `json:"estimated_fee,omitempty"`
+	FeeToken         string `json:"fee_token"`
+	// Warnings are problems to fix before submitting.
+	Warnings []string `json:"warnings"`
+}
+
+// handlePlan reports how the queries of a draft /submit-proof body fit the
+// spec given in the query string, without fetching or proving anything.
+// Estimates are medians over recent attempts of the same variant, times the
+// chunks needed.
+func handlePlan(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	queries, receipts, err := parseQueries(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if queries, err = rangeQueries(spec, r.URL.Query(), queries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkQueryKinds(spec, len(queries), len(receipts)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	variants := spec.variants()
+	if len(variants) == 0 {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec), http.StatusBadRequest)
+		return
+	}
+
+	plan := queryPlan{Spec: spec.String(), StorageQueries: len(queries), ReceiptQueries: len(receipts), FeeToken: activeProfile.FeeToken, Warnings: []string{}}
+	variant, needed, capacity, chunks := fitVariant(spec, variants, len(queries), len(receipts))
+	plan.Capacity, plan.Chunks = capacity, chunks
+	if plan.Chunks > 1 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%d queries exceed the largest allocation of %d; split them into %d submissions", needed, plan.Capacity, plan.Chunks))
+	}
+	if spec.Circuit == CircuitStockFlow && len(queries) != 2 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("circuit %q needs exactly 2 storage queries, the counter at the start and end block, got %d", CircuitStockFlow, len(queries)))
+	}
+
+	samples, proveMs, fee := sampleMedians(variant)
+	plan.Samples = samples
+	if samples > 0 {
+		plan.EstimatedProveMs = proveMs * int64(plan.Chunks)
+		plan.EstimatedFee = fee.Mul(fee, big.NewInt(int64(plan.Chunks))).String()
+	}
+
+	if lookupPrepared(spec) == nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("No circuit is prepared for spec %s; call /prepare-download with the same parameters first", spec))
+	}
+	plan.Warnings = append(plan.Warnings, archiveWarnings(r.Context(), queries)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// fitVariant picks the variant a query set is routed to: the smallest whose
+// storage allocation holds the queries, else the largest, or for circuits
+// reading receipts the one receipt allocation. It returns how many queries
+// count against the variant's capacity, the capacity, and how many
+// submissions the queries need to fit.
+func fitVariant(spec CircuitSpec, variants []CircuitSpec, storage, receipts int) (variant CircuitSpec, needed, capacity, chunks int) {
+	needed, variant = storage, variants[len(variants)-1]
+	if event := spec.receiptEvent(); event != nil {
+		needed, capacity = receipts, event.MaxReceipts
+	} else {
+		for _, v := range variants {
+			if v.slots() >= needed {
+				variant = v
+				break
+			}
+		}
+		capacity = variant.slots()
+	}
+	return variant, needed, capacity, max(1, (needed+capacity-1)/capacity)
+}
+
+// sampleMedians returns how many recent attempts of variant there are and
+// their median proving time and fee.
+func sampleMedians(variant CircuitSpec) (n int, proveMs int64, fee *big.Int) {
+	attemptSamplesMutex.Lock()
+	samples := append([]attemptSample(nil), attemptSamples[variant.String()]...)
+	attemptSamplesMutex.Unlock()
+	if len(samples) == 0 {
+		return 0, 0, new(big.Int)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].ProveMs < samples[j].ProveMs })
+	proveMs = samples[len(samples)/2].ProveMs
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Fee.Cmp(samples[j].Fee) < 0 })
+	return len(samples), proveMs, new(big.Int).Set(samples[len(samples)/2].Fee)
+}
+
+// archiveWarnings flags queries of blocks past the head or, when no provider
+// passed the archive probe, older than a pruned node keeps.
+func archiveWarnings(ctx context.Context, queries []sdk.StorageData) []string {
+	if len(queries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ec, err := ethclient.DialContext(ctx, pickRPC())
+	if err != nil {
+		return []string{fmt.Sprintf("Could not check query blocks against the chain head: %v", err)}
+	}
+	defer ec.Close()
+	head, err := ec.BlockNumber(ctx)
+	if err != nil {
+		return []string{fmt.Sprintf("Could not check query blocks against the chain head: %v", err)}
+	}
+
+	archive := chainHasArchive(activeProfile.ChainID)
+
+	var future, historical int
+	for _, q := range queries {
+		switch block := q.BlockNum.Uint64(); {
+		case block > head:
+			future++
+		case head-block > prunedStateDepth:
+			historical++
+		}
+	}
+	var warnings []string
+	if future > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d queries read blocks past the chain head %d", future, head))
+	}
+	if historical > 0 && !archive {
+		warnings = append(warnings, fmt.Sprintf("%d queries read state older than %d blocks, which needs an archive node, and no configured RPC provider passed the archive probe", historical, prunedStateDepth))
+	}
+	return warnings
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// fetchWorkers caps the goroutines fetching storage query data. Only the
+// fetch runs in parallel: the SDK assigns the circuit witness itself, in
+// one goroutine.
+var fetchWorkers = 8
+
+// prefetchStorage resolves the block info and value of every storage query in
+// parallel from the configured DataProvider. BuildCircuitInput fetches each
+// query one after another, but skips the RPC round trips for queries whose
+// base fee, timestamp and value are already filled in. Queries read from an
+// indexer are spot-checked against RPC. It returns the completed queries in
+// input order, the sum of the individual fetch times and the wall time
+// spent.
+func prefetchStorage(ctx context.Context, rpcURL string, queries []sdk.StorageData) ([]sdk.StorageData, time.Duration, time.Duration, error) {
+	if len(queries) == 0 {
+		return queries, 0, 0, nil
+	}
+	start := time.Now()
+
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+	provider := newDataProvider(ec, rpcChain(rpcURL))
+
+	out := make([]sdk.StorageData, len(queries))
+	errs := make([]error, len(queries))
+	took := make([]time.Duration, len(queries))
+	sem := make(chan struct{}, max(fetchWorkers, 1))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			t := time.Now()
+			out[i], errs[i] = withRetry(ctx, "storage query", func() (sdk.StorageData, error) {
+				return provider.FetchStorage(ctx, q)
+			})
+			took[i] = time.Since(t)
+		}()
+	}
+	wg.Wait()
+
+	if provider.Name() == "rpc" {
+		for i := range errs {
+			observeRPC(rpcURL, took[i], errs[i])
+		}
+	}
+
+	var serial time.Duration
+	for i, err := range errs {
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("storage query %d: %w", i, err)
+		}
+		serial += took[i]
+	}
+	if provider.Name() != "rpc" {
+		if err := crossCheckStorage(ctx, ec, out); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return out, serial, time.Since(start), nil
+}
+
+func fetchStorage(ctx context.Context, ec *ethclient.Client, q sdk.StorageData) (sdk.StorageData, error) {
+	header, err := ec.HeaderByNumber(ctx, q.BlockNum)
+	if err != nil {
+		return q, fmt.Errorf("fetching block %d: %w", q.BlockNum, err)
+	}
+	value, err := ec.StorageAt(ctx, q.Address, q.Slot, q.BlockNum)
+	if err != nil {
+		return q, fmt.Errorf("fetching slot %s of %s at block %d: %w", q.Slot.Hex(), q.Address.Hex(), q.BlockNum, err)
+	}
+	q.BlockBaseFee = header.BaseFee
+	q.BlockTimestamp = header.Time
+	q.Value = common.BytesToHash(value)
+	return q, nil
+}
+
+// unprovenNote labels the raw inputs in results.
+const unprovenNote = "Unproven auxiliary data: storage values as fetched from the data provider, for sanity checks only. Only the outputs are covered by the proof."
+
+// rawStorageValue is a storage query as fetched, before proving.
+type rawStorageValue struct {
+	Contract       common.Address `json:"contract"`
+	Slot           common.Hash    `json:"slot"`
+	BlockNumber    *big.Int       `json:"block_number"`
+	BlockTimestamp uint64         `json:"block_timestamp"`
+	Value          common.Hash    `json:"value"`
+	// Decimal is Value read as an unsigned integer.
+	Decimal *big.Int `json:"decimal"`
+}
+
+func rawStorageValues(fetched []sdk.StorageData) []rawStorageValue {
+	raw := make([]rawStorageValue, len(fetched))
+	for i, q := range fetched {
+		raw[i] = rawStorageValue{
+			Contract:       q.Address,
+			Slot:           q.Slot,
+			BlockNumber:    q.BlockNum,
+			BlockTimestamp: q.BlockTimestamp,
+			Value:          q.Value,
+			Decimal:        q.Value.Big(),
+		}
+	}
+	return raw
+}
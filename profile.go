@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Profile selects the chain and Brevis deployment the service talks to.
+type Profile struct {
+	Name       string
+	ChainID    uint64
+	RPCURL     string
+	GatewayURL string // empty uses the SDK's default gateway
+	Mainnet    bool
+	FeeToken   string // native token Brevis fees are paid in
+	// ExplorerURL is the block explorer transactions are linked to, as
+	// ExplorerURL/tx/HASH; empty links none.
+	ExplorerURL string
+
+	AppContract   common.Address
+	RefundAddress common.Address
+}
+
+var profiles = map[string]Profile{
+	"staging": {
+		Name:          "staging",
+		ChainID:       11155111,
+		RPCURL:        "https://sepolia.drpc.org",
+		FeeToken:      "ETH",
+		ExplorerURL:   "https://sepolia.etherscan.io",
+		RefundAddress: common.HexToAddress("0x788997cD5b9feAc56d4928539Dc21C637C61E69a"),
+	},
+	"production": {
+		Name:        "production",
+		ChainID:     1,
+		RPCURL:      "https://eth.drpc.org",
+		Mainnet:     true,
+		FeeToken:    "ETH",
+		ExplorerURL: "https://etherscan.io",
+	},
+}
+
+var activeProfile Profile
+
+// loadProfile picks the profile named by cfg.Env and applies the chain,
+// RPC, gateway, fee token, explorer and address settings of cfg over it. The app
+// contract defaults to the registered callback contract of the chain. A
+// chain other than the profile's needs its own RPC URL.
+func loadProfile(cfg Config) (Profile, error) {
+	p, ok := profiles[cfg.Env]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown BREVIS_ENV %q", cfg.Env)
+	}
+	if cfg.ChainID != 0 && cfg.ChainID != p.ChainID {
+		if cfg.RPCURL == "" {
+			return Profile{}, fmt.Errorf("chain %d differs from profile %q's chain %d and requires rpc_url", cfg.ChainID, p.Name, p.ChainID)
+		}
+		p.ChainID, p.RefundAddress, p.ExplorerURL = cfg.ChainID, common.Address{}, ""
+	}
+	if cfg.RPCURL != "" {
+		p.RPCURL = cfg.RPCURL
+	}
+	if cfg.GatewayURL != "" {
+		p.GatewayURL = cfg.GatewayURL
+	}
+	if cfg.FeeToken != "" {
+		p.FeeToken = cfg.FeeToken
+	}
+	if cfg.ExplorerURL != "" {
+		p.ExplorerURL = strings.TrimSuffix(cfg.ExplorerURL, "/")
+	}
+	p.AppContract = contractRegistry[p.ChainID].Callback
+	for name, setting := range map[string]struct {
+		value string
+		addr  *common.Address
+	}{
+		"app_contract":   {cfg.AppContract, &p.AppContract},
+		"refund_address": {cfg.RefundAddress, &p.RefundAddress},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		if !common.IsHexAddress(setting.value) {
+			return Profile{}, fmt.Errorf("invalid %s %q", name, setting.value)
+		}
+		*setting.addr = common.HexToAddress(setting.value)
+	}
+	if p.AppContract == (common.Address{}) || p.RefundAddress == (common.Address{}) {
+		return Profile{}, fmt.Errorf("profile %q requires app_contract and refund_address (BREVIS_APP_CONTRACT and BREVIS_REFUND_ADDRESS)", p.Name)
+	}
+	return p, nil
+}
+
+func (p Profile) newBrevisApp(rpcURL, outputDir string) (*sdk.BrevisApp, error) {
+	if p.GatewayURL != "" {
+		return sdk.NewBrevisApp(p.ChainID, rpcURL, outputDir, p.GatewayURL)
+	}
+	return sdk.NewBrevisApp(p.ChainID, rpcURL, outputDir)
+}
+
+// confirmMainnet guards against spending mainnet fees by accident: on a
+// mainnet profile the request must be confirmed, as confirm_mainnet=true.
+func (p Profile) confirmMainnet(confirmed bool) error {
+	if !p.Mainnet || confirmed {
+		return nil
+	}
+	return fmt.Errorf("profile %q submits to mainnet; repeat the request with confirm_mainnet=true", p.Name)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Progress stages a job reports as its attempts run. A re-proven attempt
+// reports them again.
+const (
+	ProgressInputBuilt       = "input-built"
+	ProgressWitnessGenerated = "witness-generated"
+	ProgressProving          = "proving"
+	ProgressSubmitted        = "submitted"
+	ProgressAwaitingFinality = "awaiting-finality"
+	ProgressFinalized        = "finalized"
+)
+
+// progressKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not close it during a long proof.
+var progressKeepAlive = 15 * time.Second
+
+// jobEvent is one stage transition of a job.
+type jobEvent struct {
+	Stage string    `json:"stage"`
+	Time  time.Time `json:"time"`
+}
+
+type jobKey struct{}
+
+// withJob has the attempts run under ctx report their progress to j.
+func withJob(ctx context.Context, j *job) context.Context {
+	return context.WithValue(ctx, jobKey{}, j)
+}
+
+// reportProgress records that the job under ctx reached stage and wakes its
+// event streams. Proofs not run by a job report nothing.
+func reportProgress(ctx context.Context, stage string) {
+	j, _ := ctx.Value(jobKey{}).(*job)
+	if j == nil {
+		return
+	}
+	jobsMutex.Lock()
+	j.Stage = stage
+	j.events = append(j.events, jobEvent{Stage: stage, Time: time.Now()})
+	j.recordHistory(ctx, historyStage, "", stage)
+	j.notify()
+	jobsMutex.Unlock()
+	slog.DebugContext(ctx, "Job progress", "job", j.ID, "stage", stage)
+}
+
+// changed is closed at the job's next event or when it finishes. The caller
+// holds jobsMutex.
+func (j *job) changed() <-chan struct{} {
+	if j.updated == nil {
+		j.updated = make(chan struct{})
+	}
+	return j.updated
+}
+
+// notify wakes everything waiting on changed, and publishes the change of
+// a job taken from the Redis queue. The caller holds jobsMutex.
+func (j *job) notify() {
+	if j.updated != nil {
+		close(j.updated)
+		j.updated = nil
+	}
+	j.publish()
+}
+
+// handleJobEvents streams a job's stage transitions as server-sent events,
+// replaying those already reached, or those after Last-Event-ID, then ends
+// with a done event carrying the job's status once it finishes.
+func handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	j, err := watchJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	sent := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid Last-Event-ID %q", v), http.StatusBadRequest)
+			return
+		}
+		sent = n
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	final, ok := followJob(r.Context(), j, sent, keepAlive.C, func(e jobEvent) {
+		sent++
+		b, _ := json.Marshal(e)
+		fmt.Fprintf(w, "id: %d\nevent: stage\ndata: %s\n\n", sent, b)
+		flusher.Flush()
+	}, func() {
+		fmt.Fprint(w, ": keepalive\n\n")
+		flusher.Flush()
+	})
+	if !ok {
+		return
+	}
+	done := map[string]interface{}{"status": final.Status}
+	if final.Error != "" {
+		done["error"] = final.Error
+	}
+	b, _ := json.Marshal(done)
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", b)
+	flusher.Flush()
+}
+
+// followJob passes emit each stage j reports after the first sent, and
+// calls idle at each tick without one. It returns a copy of j once it
+// finishes, or false once ctx ends first.
+func followJob(ctx context.Context, j *job, sent int, tick <-chan time.Time, emit func(jobEvent), idle func()) (job, bool) {
+	for {
+		jobsMutex.Lock()
+		var events []jobEvent
+		if sent < len(j.events) {
+			events = append(events, j.events[sent:]...)
+		}
+		sent += len(events)
+		finished := j.Finished != nil
+		final := *j
+		changed := j.changed()
+		jobsMutex.Unlock()
+
+		for _, e := range events {
+			emit(e)
+		}
+		if finished {
+			return final, true
+		}
+
+		select {
+		case <-changed:
+		case <-tick:
+			idle()
+		case <-ctx.Done():
+			return job{}, false
+		}
+	}
+}
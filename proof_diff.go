@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// diffSide identifies one of the proofs GET /proofs/diff compares.
+type diffSide struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id,omitempty"`
+	Spec      string    `json:"spec"`
+	ChainID   uint64    `json:"chain_id"`
+	Created   time.Time `json:"created"`
+}
+
+// slotRead is a slot as one proof read it.
+type slotRead struct {
+	Block uint64      `json:"block"`
+	Value common.Hash `json:"value"`
+}
+
+// slotDiff is a contract slot read differently by the two proofs, or by
+// only one of them.
+type slotDiff struct {
+	Contract common.Address `json:"contract"`
+	Slot     common.Hash    `json:"slot"`
+	A        []slotRead     `json:"a"`
+	B        []slotRead     `json:"b"`
+}
+
+// outputDiff is an output field of either proof. Delta is B - A for uints
+// both proofs have.
+type outputDiff struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	A       interface{} `json:"a"`
+	B       interface{} `json:"b"`
+	Changed bool        `json:"changed"`
+	Delta   *big.Int    `json:"delta,omitempty"`
+}
+
+type slotKey struct {
+	contract common.Address
+	slot     common.Hash
+}
+
+// diffSlots pairs the storage reads of a and b by contract and slot,
+// returning those that differ in block or value, in a's order then b's.
+func diffSlots(a, b []sdk.StorageData) []slotDiff {
+	reads := func(queries []sdk.StorageData) (map[slotKey][]slotRead, []slotKey) {
+		m := map[slotKey][]slotRead{}
+		var order []slotKey
+		for _, q := range queries {
+			k := slotKey{q.Address, q.Slot}
+			if _, ok := m[k]; !ok {
+				order = append(order, k)
+			}
+			var block uint64
+			if q.BlockNum != nil {
+				block = q.BlockNum.Uint64()
+			}
+			m[k] = append(m[k], slotRead{Block: block, Value: q.Value})
+		}
+		return m, order
+	}
+	ra, orderA := reads(a)
+	rb, orderB := reads(b)
+	diffs := []slotDiff{}
+	seen := map[slotKey]bool{}
+	for _, k := range append(orderA, orderB...) {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if sameReads(ra[k], rb[k]) {
+			continue
+		}
+		diffs = append(diffs, slotDiff{Contract: k.contract, Slot: k.slot, A: ra[k], B: rb[k]})
+	}
+	return diffs
+}
+
+func sameReads(a, b []slotRead) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffReceipts lists the receipts only a, and only b, read.
+func diffReceipts(a, b []receiptQuery) (onlyA, onlyB []receiptQuery) {
+	key := func(q receiptQuery) string { return fmt.Sprintf("%s/%d", q.TxHash.Hex(), q.LogIndex) }
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, q := range a {
+		inA[key(q)] = true
+	}
+	for _, q := range b {
+		inB[key(q)] = true
+	}
+	onlyA, onlyB = []receiptQuery{}, []receiptQuery{}
+	for _, q := range a {
+		if !inB[key(q)] {
+			onlyA = append(onlyA, q)
+		}
+	}
+	for _, q := range b {
+		if !inA[key(q)] {
+			onlyB = append(onlyB, q)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// storedOutputs decodes rec's outputs under the layout it was proven with.
+func storedOutputs(rec *storedRequest) ([]decodedOutput, error) {
+	if len(rec.Output) == 0 {
+		return nil, fmt.Errorf("request %s has no output; it is %s", rec.ID, rec.Status)
+	}
+	var spec CircuitSpec
+	if err := json.Unmarshal([]byte(rec.Spec), &spec); err != nil {
+		return nil, fmt.Errorf("decoding spec of request %s: %v", rec.ID, err)
+	}
+	version := rec.OutputSchema
+	if version == 0 {
+		version = outputSchemaVersion
+	}
+	return decodeOutput(version, spec, rec.Output)
+}
+
+// diffOutputs pairs the outputs of a and b by name, in a's order then b's.
+func diffOutputs(a, b []decodedOutput) []outputDiff {
+	inB := map[string]decodedOutput{}
+	for _, o := range b {
+		inB[o.Name] = o
+	}
+	diffs := []outputDiff{}
+	seen := map[string]bool{}
+	for _, o := range a {
+		seen[o.Name] = true
+		d := outputDiff{Name: o.Name, Type: o.Type, A: o.Value}
+		if ob, ok := inB[o.Name]; ok {
+			d.B = ob.Value
+			va, aInt := o.Value.(*big.Int)
+			vb, bInt := ob.Value.(*big.Int)
+			if aInt && bInt {
+				d.Changed = va.Cmp(vb) != 0
+				d.Delta = new(big.Int).Sub(vb, va)
+			} else {
+				d.Changed = fmt.Sprint(o.Value) != fmt.Sprint(ob.Value)
+			}
+		} else {
+			d.Changed = true
+		}
+		diffs = append(diffs, d)
+	}
+	for _, o := range b {
+		if !seen[o.Name] {
+			diffs = append(diffs, outputDiff{Name: o.Name, Type: o.Type, B: o.Value, Changed: true})
+		}
+	}
+	return diffs
+}
+
+// readableRequest reads stored request id for the caller of r, answering
+// requests mayRead refuses as not found.
+func readableRequest(r *http.Request, id string) (*storedRequest, error) {
+	rec, err := getStoredRequest(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !mayRead(r, rec) {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No request %q", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading request store: %v", err)
+	}
+	return rec, nil
+}
+
+// handleProofDiff compares two stored proofs, a and b, each by Brevis
+// request ID or stored ID: the slots they read at different blocks or to
+// different values, the receipts only one read, and their outputs side by
+// side, with the change of each numeric one. It is meant for tracing a jump
+// in reported emissions between two periods proven over the same
+// contracts.
+func handleProofDiff(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("a") == "" || q.Get("b") == "" {
+		http.Error(w, "a and b are required: the request IDs of the proofs to compare", http.StatusBadRequest)
+		return
+	}
+	var recs [2]*storedRequest
+	var outputs [2][]decodedOutput
+	for i, id := range []string{q.Get("a"), q.Get("b")} {
+		rec, err := readableRequest(r, id)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		if outputs[i], err = storedOutputs(rec); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		recs[i] = rec
+	}
+	a, b := recs[0], recs[1]
+
+	result := map[string]interface{}{
+		"a":            diffSide{a.ID, a.RequestID, a.Spec, a.ChainID, a.Created},
+		"b":            diffSide{b.ID, b.RequestID, b.Spec, b.ChainID, b.Created},
+		"spec_changed": a.Spec != b.Spec,
+		"outputs":      diffOutputs(outputs[0], outputs[1]),
+	}
+	// Requests stored before queries were kept can only be compared by
+	// output.
+	if a.Queries != nil && b.Queries != nil {
+		onlyA, onlyB := diffReceipts(a.Queries.Receipts, b.Queries.Receipts)
+		result["slots"] = diffSlots(a.Queries.Storage, b.Queries.Storage)
+		result["receipts_only_in_a"] = onlyA
+		result["receipts_only_in_b"] = onlyB
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxImportBody bounds one POST /admin/requests/import body.
+const maxImportBody = 64 << 20
+
+// importedRequest is one historical proof to import, in the form GET
+// /proofs returns it, with what is known of its submission.
+type importedRequest struct {
+	RequestID     string        `json:"request_id"`
+	Spec          string        `json:"spec"`
+	ChainID       uint64        `json:"chain_id"`
+	Proof         hexutil.Bytes `json:"proof"`
+	PublicWitness hexutil.Bytes `json:"public_witness"`
+	Output        hexutil.Bytes `json:"output"`
+	// Transaction is the fulfillment; an import with one is finalized,
+	// without one proven.
+	Transaction string `json:"transaction"`
+	// APIKey names the key the request belongs to, the importing key's
+	// name when empty.
+	APIKey  string     `json:"api_key"`
+	Created *time.Time `json:"created"`
+	// Queries are what was proven, when known. OutputSchema is the layout
+	// of Output, the current one when zero.
+	Queries      *storedQueries `json:"queries"`
+	OutputSchema int            `json:"output_schema"`
+}
+
+// importRequest checks in's proof against the verifying key of its spec's
+// circuit and stores it, returning its stored ID. One whose request ID is
+// already stored is refused, so that an import can be run again.
+func importRequest(r *http.Request, in importedRequest) (string, error) {
+	if in.Spec == "" || len(in.Proof) == 0 || len(in.PublicWitness) == 0 {
+		return "", errors.New("spec, proof and public_witness are required")
+	}
+	if in.RequestID != "" {
+		_, err := getStoredRequest(r.Context(), in.RequestID)
+		if err == nil {
+			return "", fmt.Errorf("request %s is already stored", in.RequestID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("reading request store: %v", err)
+		}
+	}
+	vkBytes, err := verifyingKey(in.Spec)
+	if err != nil {
+		return "", fmt.Errorf("no verifying key for spec %s: %v", in.Spec, err)
+	}
+	proof, public, vk, err := decodeVerification(in.Proof, in.PublicWitness, vkBytes)
+	if err != nil {
+		return "", err
+	}
+	if err := sdk.Verify(vk, public, proof); err != nil {
+		return "", fmt.Errorf("proof does not verify: %v", err)
+	}
+
+	now := time.Now().UTC()
+	created := now
+	if in.Created != nil {
+		created = in.Created.UTC()
+	}
+	rec := &storedRequest{
+		ID:            newJobID(),
+		CorrelationID: correlationID(r.Context()),
+		APIKey:        in.APIKey,
+		ChainID:       in.ChainID,
+		Spec:          in.Spec,
+		Status:        RequestProven,
+		RequestID:     in.RequestID,
+		Transaction:   in.Transaction,
+		Proof:         in.Proof,
+		PublicWitness: in.PublicWitness,
+		Output:        in.Output,
+		Created:       created,
+		Proven:        &created,
+		Queries:       in.Queries,
+		OutputSchema:  in.OutputSchema,
+	}
+	if rec.OutputSchema == 0 {
+		rec.OutputSchema = outputSchemaVersion
+	}
+	if rec.APIKey == "" {
+		rec.APIKey = apiKeyName(r.Context())
+	}
+	if rec.ChainID == 0 {
+		rec.ChainID = activeProfile.ChainID
+	}
+	if in.Transaction != "" {
+		rec.Status, rec.Finished = RequestFinalized, &now
+	}
+	// A new ID, so never an update.
+	if _, err := rec.write(r.Context(), []string{"'" + rec.Status + "'"}); err != nil {
+		return "", fmt.Errorf("storing request: %v", err)
+	}
+	return rec.ID, nil
+}
+
+// handleImportRequests stores the proofs in the JSON body's requests,
+// from an older deployment or manual runs, so that history is kept in one
+// place. Each proof must verify against its spec's circuit. Those that do
+// not, or are already stored, are listed as skipped with the reason;
+// imported ones map their request ID, or position, to the stored ID.
+func handleImportRequests(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if requestDB == nil {
+		http.Error(w, "No request store to import into; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	var body struct {
+		Requests []importedRequest `json:"requests"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxImportBody)).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	imported := map[string]string{}
+	skipped := map[string]string{}
+	for i, in := range body.Requests {
+		name := in.RequestID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		id, err := importRequest(r, in)
+		if err != nil {
+			skipped[name] = err.Error()
+			continue
+		}
+		imported[name] = id
+	}
+	slog.InfoContext(r.Context(), "Imported proofs", "imported", len(imported), "skipped", len(skipped))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	// proofConcurrency is how many proofs build their input, witness and
+	// proof at once. The rest of a submission, fetching and waiting on
+	// chain, is not limited.
+	proofConcurrency = 1
+	// proofQueueSize is how many proofs may wait for a slot before
+	// /submit-proof?wait=true answers 429. Queued jobs always wait, as
+	// BREVIS_JOB_WORKERS already bounds them.
+	proofQueueSize = 16
+
+	proofSlots    chan struct{}
+	proofsWaiting atomic.Int64
+)
+
+// proofRetryAfter is the Retry-After, in seconds, of a request turned away
+// by a full proof queue.
+const proofRetryAfter = "30"
+
+// startProofPool reads BREVIS_PROOF_CONCURRENCY and BREVIS_PROOF_QUEUE.
+func startProofPool() error {
+	var err error
+	if proofConcurrency, err = envInt("BREVIS_PROOF_CONCURRENCY", proofConcurrency); err != nil {
+		return err
+	}
+	if proofQueueSize, err = envInt("BREVIS_PROOF_QUEUE", proofQueueSize); err != nil {
+		return err
+	}
+	if proofConcurrency < 1 || proofQueueSize < 0 {
+		return fmt.Errorf("BREVIS_PROOF_CONCURRENCY must be positive and BREVIS_PROOF_QUEUE not negative")
+	}
+	proofSlots = make(chan struct{}, proofConcurrency)
+	return nil
+}
+
+// admitProof turns a request away with 429 when the proof queue is full.
+func admitProof() error {
+	if waiting := proofsWaiting.Load(); waiting >= int64(proofQueueSize) {
+		return &statusError{http.StatusTooManyRequests, fmt.Errorf("%d proofs are waiting for %d proving slots; try again later", waiting, proofConcurrency)}
+	}
+	return nil
+}
+
+// acquireProofSlot waits for a proving slot, returning the function that
+// gives it back.
+func acquireProofSlot(ctx context.Context) (func(), error) {
+	proofsWaiting.Add(1)
+	defer proofsWaiting.Add(-1)
+	select {
+	case proofSlots <- struct{}{}:
+		return func() { <-proofSlots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a proving slot: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// proofArtifacts is everything needed to verify a proof off-band: the PLONK
+// proof, public witness and verifying key over BN254, each in gnark's binary
+// form.
+type proofArtifacts struct {
+	ID            string        `json:"id"`
+	RequestID     string        `json:"request_id,omitempty"`
+	Spec          string        `json:"spec"`
+	Backend       string        `json:"backend"`
+	Curve         string        `json:"curve"`
+	Proof         hexutil.Bytes `json:"proof"`
+	PublicWitness hexutil.Bytes `json:"public_witness,omitempty"`
+	VerifyingKey  hexutil.Bytes `json:"verifying_key,omitempty"`
+	Output        hexutil.Bytes `json:"output,omitempty"`
+	// VerifyingKeyError says why the key is missing: this node no longer
+	// holds the circuit the proof was made with.
+	VerifyingKeyError string `json:"verifying_key_error,omitempty"`
+}
+
+// verifyingKey reads the verifying key compiled for spec, from the artifact
+// cache with an artifact bucket, otherwise from its variant directory.
+func verifyingKey(spec string) ([]byte, error) {
+	var dir string
+	if artifactBucket != "" {
+		var err error
+		if dir, err = cachedArtifacts(spec); err != nil {
+			return nil, err
+		}
+	} else {
+		var parsed CircuitSpec
+		if err := json.Unmarshal([]byte(spec), &parsed); err != nil {
+			return nil, fmt.Errorf("decoding spec: %v", err)
+		}
+		dir = variantDir(parsed)
+		onDisk, err := os.ReadFile(filepath.Join(dir, circuitSpecFile))
+		if err != nil {
+			return nil, fmt.Errorf("no circuit on disk: %v", err)
+		}
+		if string(onDisk) != spec {
+			return nil, fmt.Errorf("circuit on disk is for spec %s, not %s", onDisk, spec)
+		}
+	}
+	return os.ReadFile(filepath.Join(dir, "vk"))
+}
+
+// handleProof returns the proof artifacts of a stored request, looked up by
+// Brevis request ID or stored ID, so integrators can verify it or submit it
+// to their own contracts, to those mayRead lets read it. It answers
+// If-None-Match with 304 while they are unchanged.
+func handleProof(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	rec, err := getStoredRequest(r.Context(), r.PathValue("request_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("No request %q", r.PathValue("request_id")), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading request store: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !mayRead(r, rec) {
+		http.Error(w, fmt.Sprintf("No request %q", r.PathValue("request_id")), http.StatusNotFound)
+		return
+	}
+	if len(rec.Proof) == 0 {
+		http.Error(w, fmt.Sprintf("Request %q has no proof; it is %s", r.PathValue("request_id"), rec.Status), http.StatusConflict)
+		return
+	}
+
+	artifacts := proofArtifacts{
+		ID:            rec.ID,
+		RequestID:     rec.RequestID,
+		Spec:          rec.Spec,
+		Backend:       "plonk",
+		Curve:         "bn254",
+		Proof:         rec.Proof,
+		PublicWitness: rec.PublicWitness,
+		Output:        rec.Output,
+	}
+	if artifacts.VerifyingKey, err = verifyingKey(rec.Spec); err != nil {
+		artifacts.VerifyingKeyError = err.Error()
+	}
+
+	// Without its verifying key the response may still change, once the
+	// circuit is available again.
+	writeCachedJSON(w, r, artifacts, rec.Finished != nil && artifacts.VerifyingKeyError == "")
+}
@@ -0,0 +1,1964 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: brevis.proto
+
+// The prover API over gRPC. It runs the same pipeline as the HTTP endpoints
+// it mirrors and takes the same API keys, sent as "authorization: Bearer
+// <key>" or "x-api-key" metadata.
+
+package brevispb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PrepareCircuitRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Spec *CircuitSpec `protobuf:"bytes,2,opt,name=spec,proto3" json:"spec,omitempty"`
+}
+
+func (x *PrepareCircuitRequest) Reset() {
+	*x = PrepareCircuitRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PrepareCircuitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrepareCircuitRequest) ProtoMessage() {}
+
+func (x *PrepareCircuitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrepareCircuitRequest.ProtoReflect.Descriptor instead.
+func (*PrepareCircuitRequest) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PrepareCircuitRequest) GetSpec() *CircuitSpec {
+	if x != nil {
+		return x.Spec
+	}
+	return nil
+}
+
+type PrepareCircuitResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Spec string `protobuf:"bytes,1,opt,name=spec,proto3" json:"spec,omitempty"`
+	// quarantined are the leftovers of earlier compiles moved aside first.
+	Quarantined []string `protobuf:"bytes,2,rep,name=quarantined,proto3" json:"quarantined,omitempty"`
+}
+
+func (x *PrepareCircuitResponse) Reset() {
+	*x = PrepareCircuitResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PrepareCircuitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrepareCircuitResponse) ProtoMessage() {}
+
+func (x *PrepareCircuitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrepareCircuitResponse.ProtoReflect.Descriptor instead.
+func (*PrepareCircuitResponse) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PrepareCircuitResponse) GetSpec() string {
+	if x != nil {
+		return x.Spec
+	}
+	return ""
+}
+
+func (x *PrepareCircuitResponse) GetQuarantined() []string {
+	if x != nil {
+		return x.Quarantined
+	}
+	return nil
+}
+
+type SubmitProofRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The circuit is given by its spec, or by the name of a registered
+	// circuit, whose active version is used.
+	//
+	// Types that are assignable to Circuit:
+	//	*SubmitProofRequest_Spec
+	//	*SubmitProofRequest_CircuitName
+	Circuit  isSubmitProofRequest_Circuit `protobuf_oneof:"circuit"`
+	Queries  []*StorageQuery              `protobuf:"bytes,5,rep,name=queries,proto3" json:"queries,omitempty"`
+	Receipts []*ReceiptQuery              `protobuf:"bytes,6,rep,name=receipts,proto3" json:"receipts,omitempty"`
+	// range is required by block_range circuits, which query their counter
+	// themselves and take no storage queries.
+	Range    *BlockRange    `protobuf:"bytes,7,opt,name=range,proto3" json:"range,omitempty"`
+	Snapshot *SnapshotPin   `protobuf:"bytes,8,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Options  *SubmitOptions `protobuf:"bytes,9,opt,name=options,proto3" json:"options,omitempty"`
+}
+
+func (x *SubmitProofRequest) Reset() {
+	*x = SubmitProofRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitProofRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitProofRequest) ProtoMessage() {}
+
+func (x *SubmitProofRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitProofRequest.ProtoReflect.Descriptor instead.
+func (*SubmitProofRequest) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{2}
+}
+
+func (m *SubmitProofRequest) GetCircuit() isSubmitProofRequest_Circuit {
+	if m != nil {
+		return m.Circuit
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetSpec() *CircuitSpec {
+	if x, ok := x.GetCircuit().(*SubmitProofRequest_Spec); ok {
+		return x.Spec
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetCircuitName() string {
+	if x, ok := x.GetCircuit().(*SubmitProofRequest_CircuitName); ok {
+		return x.CircuitName
+	}
+	return ""
+}
+
+func (x *SubmitProofRequest) GetQueries() []*StorageQuery {
+	if x != nil {
+		return x.Queries
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetReceipts() []*ReceiptQuery {
+	if x != nil {
+		return x.Receipts
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetRange() *BlockRange {
+	if x != nil {
+		return x.Range
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetSnapshot() *SnapshotPin {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *SubmitProofRequest) GetOptions() *SubmitOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type isSubmitProofRequest_Circuit interface {
+	isSubmitProofRequest_Circuit()
+}
+
+type SubmitProofRequest_Spec struct {
+	Spec *CircuitSpec `protobuf:"bytes,3,opt,name=spec,proto3,oneof"`
+}
+
+type SubmitProofRequest_CircuitName struct {
+	CircuitName string `protobuf:"bytes,4,opt,name=circuit_name,json=circuitName,proto3,oneof"`
+}
+
+func (*SubmitProofRequest_Spec) isSubmitProofRequest_Circuit() {}
+
+func (*SubmitProofRequest_CircuitName) isSubmitProofRequest_Circuit() {}
+
+// CircuitSpec selects a circuit as the /prepare-download query parameters
+// do. Fields left unset take the same defaults.
+type CircuitSpec struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// circuit is emissions, stock_flow, receipt_emissions or block_range.
+	Circuit string `protobuf:"bytes,1,opt,name=circuit,proto3" json:"circuit,omitempty"`
+	// aggregation is sum, top_k, sorted, window_avg, ema, merkle, min, max,
+	// mean or count.
+	Aggregation string         `protobuf:"bytes,2,opt,name=aggregation,proto3" json:"aggregation,omitempty"`
+	K           int32          `protobuf:"varint,3,opt,name=k,proto3" json:"k,omitempty"`
+	Window      int32          `protobuf:"varint,4,opt,name=window,proto3" json:"window,omitempty"`
+	AlphaBps    int32          `protobuf:"varint,5,opt,name=alpha_bps,json=alphaBps,proto3" json:"alpha_bps,omitempty"`
+	Fields      []*PackedField `protobuf:"bytes,6,rep,name=fields,proto3" json:"fields,omitempty"`
+	ValueMode   string         `protobuf:"bytes,7,opt,name=value_mode,json=valueMode,proto3" json:"value_mode,omitempty"`
+	// scale_factor is a decimal; bucket, expected_emission and total_cap are
+	// decimal integers, as they may exceed 64 bits.
+	ScaleFactor      string `protobuf:"bytes,8,opt,name=scale_factor,json=scaleFactor,proto3" json:"scale_factor,omitempty"`
+	Bucket           string `protobuf:"bytes,9,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	ExpectedEmission string `protobuf:"bytes,10,opt,name=expected_emission,json=expectedEmission,proto3" json:"expected_emission,omitempty"`
+	// mode is equal or threshold.
+	Mode     string `protobuf:"bytes,11,opt,name=mode,proto3" json:"mode,omitempty"`
+	TotalCap string `protobuf:"bytes,12,opt,name=total_cap,json=totalCap,proto3" json:"total_cap,omitempty"`
+	// slots pins the spec to one storage allocation.
+	Slots int32 `protobuf:"varint,13,opt,name=slots,proto3" json:"slots,omitempty"`
+	// The parameters of the circuit named by circuit; each is required by its
+	// circuit and refused by the others.
+	StockFlow        *StockFlowParams        `protobuf:"bytes,14,opt,name=stock_flow,json=stockFlow,proto3" json:"stock_flow,omitempty"`
+	ReceiptEmissions *ReceiptEmissionsParams `protobuf:"bytes,15,opt,name=receipt_emissions,json=receiptEmissions,proto3" json:"receipt_emissions,omitempty"`
+	BlockRange       *BlockRangeParams       `protobuf:"bytes,16,opt,name=block_range,json=blockRange,proto3" json:"block_range,omitempty"`
+}
+
+func (x *CircuitSpec) Reset() {
+	*x = CircuitSpec{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CircuitSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CircuitSpec) ProtoMessage() {}
+
+func (x *CircuitSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CircuitSpec.ProtoReflect.Descriptor instead.
+func (*CircuitSpec) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CircuitSpec) GetCircuit() string {
+	if x != nil {
+		return x.Circuit
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetAggregation() string {
+	if x != nil {
+		return x.Aggregation
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetK() int32 {
+	if x != nil {
+		return x.K
+	}
+	return 0
+}
+
+func (x *CircuitSpec) GetWindow() int32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *CircuitSpec) GetAlphaBps() int32 {
+	if x != nil {
+		return x.AlphaBps
+	}
+	return 0
+}
+
+func (x *CircuitSpec) GetFields() []*PackedField {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *CircuitSpec) GetValueMode() string {
+	if x != nil {
+		return x.ValueMode
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetScaleFactor() string {
+	if x != nil {
+		return x.ScaleFactor
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetExpectedEmission() string {
+	if x != nil {
+		return x.ExpectedEmission
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetTotalCap() string {
+	if x != nil {
+		return x.TotalCap
+	}
+	return ""
+}
+
+func (x *CircuitSpec) GetSlots() int32 {
+	if x != nil {
+		return x.Slots
+	}
+	return 0
+}
+
+func (x *CircuitSpec) GetStockFlow() *StockFlowParams {
+	if x != nil {
+		return x.StockFlow
+	}
+	return nil
+}
+
+func (x *CircuitSpec) GetReceiptEmissions() *ReceiptEmissionsParams {
+	if x != nil {
+		return x.ReceiptEmissions
+	}
+	return nil
+}
+
+func (x *CircuitSpec) GetBlockRange() *BlockRangeParams {
+	if x != nil {
+		return x.BlockRange
+	}
+	return nil
+}
+
+// PackedField is a field packed into each storage slot read.
+type PackedField struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Offset int32  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Bits   int32  `protobuf:"varint,3,opt,name=bits,proto3" json:"bits,omitempty"`
+}
+
+func (x *PackedField) Reset() {
+	*x = PackedField{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PackedField) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PackedField) ProtoMessage() {}
+
+func (x *PackedField) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PackedField.ProtoReflect.Descriptor instead.
+func (*PackedField) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PackedField) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PackedField) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *PackedField) GetBits() int32 {
+	if x != nil {
+		return x.Bits
+	}
+	return 0
+}
+
+// Addresses and hashes are 0x-prefixed hex, as in the HTTP API.
+type StockFlowParams struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Registry    string `protobuf:"bytes,1,opt,name=registry,proto3" json:"registry,omitempty"`
+	CounterSlot string `protobuf:"bytes,2,opt,name=counter_slot,json=counterSlot,proto3" json:"counter_slot,omitempty"`
+	EventId     string `protobuf:"bytes,3,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	AmountIndex int32  `protobuf:"varint,4,opt,name=amount_index,json=amountIndex,proto3" json:"amount_index,omitempty"`
+}
+
+func (x *StockFlowParams) Reset() {
+	*x = StockFlowParams{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StockFlowParams) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StockFlowParams) ProtoMessage() {}
+
+func (x *StockFlowParams) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StockFlowParams.ProtoReflect.Descriptor instead.
+func (*StockFlowParams) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StockFlowParams) GetRegistry() string {
+	if x != nil {
+		return x.Registry
+	}
+	return ""
+}
+
+func (x *StockFlowParams) GetCounterSlot() string {
+	if x != nil {
+		return x.CounterSlot
+	}
+	return ""
+}
+
+func (x *StockFlowParams) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *StockFlowParams) GetAmountIndex() int32 {
+	if x != nil {
+		return x.AmountIndex
+	}
+	return 0
+}
+
+type ReceiptEmissionsParams struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Emitter       string `protobuf:"bytes,1,opt,name=emitter,proto3" json:"emitter,omitempty"`
+	EventId       string `protobuf:"bytes,2,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	AmountIndex   int32  `protobuf:"varint,3,opt,name=amount_index,json=amountIndex,proto3" json:"amount_index,omitempty"`
+	AmountIsTopic bool   `protobuf:"varint,4,opt,name=amount_is_topic,json=amountIsTopic,proto3" json:"amount_is_topic,omitempty"`
+	// max_receipts is the receipt allocation, 32 when unset.
+	MaxReceipts int32 `protobuf:"varint,5,opt,name=max_receipts,json=maxReceipts,proto3" json:"max_receipts,omitempty"`
+}
+
+func (x *ReceiptEmissionsParams) Reset() {
+	*x = ReceiptEmissionsParams{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReceiptEmissionsParams) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReceiptEmissionsParams) ProtoMessage() {}
+
+func (x *ReceiptEmissionsParams) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReceiptEmissionsParams.ProtoReflect.Descriptor instead.
+func (*ReceiptEmissionsParams) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReceiptEmissionsParams) GetEmitter() string {
+	if x != nil {
+		return x.Emitter
+	}
+	return ""
+}
+
+func (x *ReceiptEmissionsParams) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *ReceiptEmissionsParams) GetAmountIndex() int32 {
+	if x != nil {
+		return x.AmountIndex
+	}
+	return 0
+}
+
+func (x *ReceiptEmissionsParams) GetAmountIsTopic() bool {
+	if x != nil {
+		return x.AmountIsTopic
+	}
+	return false
+}
+
+func (x *ReceiptEmissionsParams) GetMaxReceipts() int32 {
+	if x != nil {
+		return x.MaxReceipts
+	}
+	return 0
+}
+
+type BlockRangeParams struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Contract string `protobuf:"bytes,1,opt,name=contract,proto3" json:"contract,omitempty"`
+	Slot     string `protobuf:"bytes,2,opt,name=slot,proto3" json:"slot,omitempty"`
+}
+
+func (x *BlockRangeParams) Reset() {
+	*x = BlockRangeParams{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlockRangeParams) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockRangeParams) ProtoMessage() {}
+
+func (x *BlockRangeParams) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockRangeParams.ProtoReflect.Descriptor instead.
+func (*BlockRangeParams) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BlockRangeParams) GetContract() string {
+	if x != nil {
+		return x.Contract
+	}
+	return ""
+}
+
+func (x *BlockRangeParams) GetSlot() string {
+	if x != nil {
+		return x.Slot
+	}
+	return ""
+}
+
+// StorageQuery is a storage slot of a contract to read at a block.
+type StorageQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Contract    string `protobuf:"bytes,1,opt,name=contract,proto3" json:"contract,omitempty"`
+	Slot        string `protobuf:"bytes,2,opt,name=slot,proto3" json:"slot,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,3,opt,name=block_number,json=blockNumber,proto3" json:"block_number,omitempty"`
+}
+
+func (x *StorageQuery) Reset() {
+	*x = StorageQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StorageQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StorageQuery) ProtoMessage() {}
+
+func (x *StorageQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StorageQuery.ProtoReflect.Descriptor instead.
+func (*StorageQuery) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StorageQuery) GetContract() string {
+	if x != nil {
+		return x.Contract
+	}
+	return ""
+}
+
+func (x *StorageQuery) GetSlot() string {
+	if x != nil {
+		return x.Slot
+	}
+	return ""
+}
+
+func (x *StorageQuery) GetBlockNumber() uint64 {
+	if x != nil {
+		return x.BlockNumber
+	}
+	return 0
+}
+
+// ReceiptQuery is an event log of a transaction receipt to read.
+type ReceiptQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TxHash   string   `protobuf:"bytes,1,opt,name=tx_hash,json=txHash,proto3" json:"tx_hash,omitempty"`
+	LogIndex uint32   `protobuf:"varint,2,opt,name=log_index,json=logIndex,proto3" json:"log_index,omitempty"`
+	Topics   []string `protobuf:"bytes,3,rep,name=topics,proto3" json:"topics,omitempty"`
+}
+
+func (x *ReceiptQuery) Reset() {
+	*x = ReceiptQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReceiptQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReceiptQuery) ProtoMessage() {}
+
+func (x *ReceiptQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReceiptQuery.ProtoReflect.Descriptor instead.
+func (*ReceiptQuery) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ReceiptQuery) GetTxHash() string {
+	if x != nil {
+		return x.TxHash
+	}
+	return ""
+}
+
+func (x *ReceiptQuery) GetLogIndex() uint32 {
+	if x != nil {
+		return x.LogIndex
+	}
+	return 0
+}
+
+func (x *ReceiptQuery) GetTopics() []string {
+	if x != nil {
+		return x.Topics
+	}
+	return nil
+}
+
+// BlockRange is the range a block_range circuit samples its counter over:
+// at start_block, end_block and, when samples is above 2, evenly between.
+type BlockRange struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StartBlock uint64 `protobuf:"varint,1,opt,name=start_block,json=startBlock,proto3" json:"start_block,omitempty"`
+	EndBlock   uint64 `protobuf:"varint,2,opt,name=end_block,json=endBlock,proto3" json:"end_block,omitempty"`
+	// samples is 2 when unset.
+	Samples int32 `protobuf:"varint,3,opt,name=samples,proto3" json:"samples,omitempty"`
+}
+
+func (x *BlockRange) Reset() {
+	*x = BlockRange{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlockRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockRange) ProtoMessage() {}
+
+func (x *BlockRange) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockRange.ProtoReflect.Descriptor instead.
+func (*BlockRange) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *BlockRange) GetStartBlock() uint64 {
+	if x != nil {
+		return x.StartBlock
+	}
+	return 0
+}
+
+func (x *BlockRange) GetEndBlock() uint64 {
+	if x != nil {
+		return x.EndBlock
+	}
+	return 0
+}
+
+func (x *BlockRange) GetSamples() int32 {
+	if x != nil {
+		return x.Samples
+	}
+	return 0
+}
+
+// SnapshotPin pins the request to a block whose hash must still be
+// canonical when it is proven.
+type SnapshotPin struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name        string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,2,opt,name=block_number,json=blockNumber,proto3" json:"block_number,omitempty"`
+	BlockHash   string `protobuf:"bytes,3,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+}
+
+func (x *SnapshotPin) Reset() {
+	*x = SnapshotPin{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SnapshotPin) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotPin) ProtoMessage() {}
+
+func (x *SnapshotPin) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotPin.ProtoReflect.Descriptor instead.
+func (*SnapshotPin) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SnapshotPin) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SnapshotPin) GetBlockNumber() uint64 {
+	if x != nil {
+		return x.BlockNumber
+	}
+	return 0
+}
+
+func (x *SnapshotPin) GetBlockHash() string {
+	if x != nil {
+		return x.BlockHash
+	}
+	return ""
+}
+
+// SubmitOptions are the submission settings of /submit-proof. Those left
+// unset take the API key's tenant defaults, then the server's.
+type SubmitOptions struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SubmitTimeout     *durationpb.Duration `protobuf:"bytes,1,opt,name=submit_timeout,json=submitTimeout,proto3" json:"submit_timeout,omitempty"`
+	SubmitRetries     *int32               `protobuf:"varint,2,opt,name=submit_retries,json=submitRetries,proto3,oneof" json:"submit_retries,omitempty"`
+	FulfillmentWindow *durationpb.Duration `protobuf:"bytes,3,opt,name=fulfillment_window,json=fulfillmentWindow,proto3" json:"fulfillment_window,omitempty"`
+	CallbackUrl       string               `protobuf:"bytes,4,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
+	// chain_id is the chain the queries read; dst_chain_id the chain the
+	// result is delivered to.
+	ChainId          uint64 `protobuf:"varint,5,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	DstChainId       uint64 `protobuf:"varint,6,opt,name=dst_chain_id,json=dstChainId,proto3" json:"dst_chain_id,omitempty"`
+	CallbackContract string `protobuf:"bytes,7,opt,name=callback_contract,json=callbackContract,proto3" json:"callback_contract,omitempty"`
+	CallbackGasLimit uint64 `protobuf:"varint,8,opt,name=callback_gas_limit,json=callbackGasLimit,proto3" json:"callback_gas_limit,omitempty"`
+	// query_option is zk or op.
+	QueryOption string `protobuf:"bytes,9,opt,name=query_option,json=queryOption,proto3" json:"query_option,omitempty"`
+	// confirm_mainnet must be set to submit on a mainnet chain.
+	ConfirmMainnet bool `protobuf:"varint,10,opt,name=confirm_mainnet,json=confirmMainnet,proto3" json:"confirm_mainnet,omitempty"`
+}
+
+func (x *SubmitOptions) Reset() {
+	*x = SubmitOptions{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitOptions) ProtoMessage() {}
+
+func (x *SubmitOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitOptions.ProtoReflect.Descriptor instead.
+func (*SubmitOptions) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SubmitOptions) GetSubmitTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.SubmitTimeout
+	}
+	return nil
+}
+
+func (x *SubmitOptions) GetSubmitRetries() int32 {
+	if x != nil && x.SubmitRetries != nil {
+		return *x.SubmitRetries
+	}
+	return 0
+}
+
+func (x *SubmitOptions) GetFulfillmentWindow() *durationpb.Duration {
+	if x != nil {
+		return x.FulfillmentWindow
+	}
+	return nil
+}
+
+func (x *SubmitOptions) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+func (x *SubmitOptions) GetChainId() uint64 {
+	if x != nil {
+		return x.ChainId
+	}
+	return 0
+}
+
+func (x *SubmitOptions) GetDstChainId() uint64 {
+	if x != nil {
+		return x.DstChainId
+	}
+	return 0
+}
+
+func (x *SubmitOptions) GetCallbackContract() string {
+	if x != nil {
+		return x.CallbackContract
+	}
+	return ""
+}
+
+func (x *SubmitOptions) GetCallbackGasLimit() uint64 {
+	if x != nil {
+		return x.CallbackGasLimit
+	}
+	return 0
+}
+
+func (x *SubmitOptions) GetQueryOption() string {
+	if x != nil {
+		return x.QueryOption
+	}
+	return ""
+}
+
+func (x *SubmitOptions) GetConfirmMainnet() bool {
+	if x != nil {
+		return x.ConfirmMainnet
+	}
+	return false
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StreamJobEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// after skips the first events, as Last-Event-ID does.
+	After int32 `protobuf:"varint,2,opt,name=after,proto3" json:"after,omitempty"`
+}
+
+func (x *StreamJobEventsRequest) Reset() {
+	*x = StreamJobEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamJobEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamJobEventsRequest) ProtoMessage() {}
+
+func (x *StreamJobEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamJobEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamJobEventsRequest) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *StreamJobEventsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *StreamJobEventsRequest) GetAfter() int32 {
+	if x != nil {
+		return x.After
+	}
+	return 0
+}
+
+type Job struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status   string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Spec     string                 `protobuf:"bytes,3,opt,name=spec,proto3" json:"spec,omitempty"`
+	Created  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created,proto3" json:"created,omitempty"`
+	Started  *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=started,proto3" json:"started,omitempty"`
+	Finished *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=finished,proto3" json:"finished,omitempty"`
+	Eta      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=eta,proto3" json:"eta,omitempty"`
+	// stage is the latest progress stage the job reported.
+	Stage string `protobuf:"bytes,8,opt,name=stage,proto3" json:"stage,omitempty"`
+	// result is the response /submit-proof?wait=true would have returned.
+	Result        *structpb.Struct `protobuf:"bytes,9,opt,name=result,proto3" json:"result,omitempty"`
+	Error         string           `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	ErrorStatus   int32            `protobuf:"varint,11,opt,name=error_status,json=errorStatus,proto3" json:"error_status,omitempty"`
+	ErrorClass    string           `protobuf:"bytes,12,opt,name=error_class,json=errorClass,proto3" json:"error_class,omitempty"`
+	TimeoutStage  string           `protobuf:"bytes,13,opt,name=timeout_stage,json=timeoutStage,proto3" json:"timeout_stage,omitempty"`
+	CorrelationId string           `protobuf:"bytes,14,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Job) GetSpec() string {
+	if x != nil {
+		return x.Spec
+	}
+	return ""
+}
+
+func (x *Job) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *Job) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *Job) GetFinished() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Finished
+	}
+	return nil
+}
+
+func (x *Job) GetEta() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Eta
+	}
+	return nil
+}
+
+func (x *Job) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *Job) GetResult() *structpb.Struct {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetErrorStatus() int32 {
+	if x != nil {
+		return x.ErrorStatus
+	}
+	return 0
+}
+
+func (x *Job) GetErrorClass() string {
+	if x != nil {
+		return x.ErrorClass
+	}
+	return ""
+}
+
+func (x *Job) GetTimeoutStage() string {
+	if x != nil {
+		return x.TimeoutStage
+	}
+	return ""
+}
+
+func (x *Job) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+type JobEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// sequence numbers the job's events from 1.
+	Sequence int32                  `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Stage    string                 `protobuf:"bytes,2,opt,name=stage,proto3" json:"stage,omitempty"`
+	Time     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	// done is set on the last event, once the job has finished, which has no
+	// sequence or stage.
+	Done *Job `protobuf:"bytes,4,opt,name=done,proto3" json:"done,omitempty"`
+}
+
+func (x *JobEvent) Reset() {
+	*x = JobEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_brevis_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JobEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobEvent) ProtoMessage() {}
+
+func (x *JobEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_brevis_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobEvent.ProtoReflect.Descriptor instead.
+func (*JobEvent) Descriptor() ([]byte, []int) {
+	return file_brevis_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *JobEvent) GetSequence() int32 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *JobEvent) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *JobEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *JobEvent) GetDone() *Job {
+	if x != nil {
+		return x.Done
+	}
+	return nil
+}
+
+var File_brevis_proto protoreflect.FileDescriptor
+
+var file_brevis_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09,
+	0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x73, 0x74, 0x72, 0x75, 0x63,
+	0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x51, 0x0a, 0x15, 0x50, 0x72, 0x65, 0x70,
+	0x61, 0x72, 0x65, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x2a, 0x0a, 0x04, 0x73, 0x70, 0x65, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x69, 0x72, 0x63,
+	0x75, 0x69, 0x74, 0x53, 0x70, 0x65, 0x63, 0x52, 0x04, 0x73, 0x70, 0x65, 0x63, 0x4a, 0x04, 0x08,
+	0x01, 0x10, 0x02, 0x52, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x22, 0x4e, 0x0a, 0x16, 0x50,
+	0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x65, 0x63, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x70, 0x65, 0x63, 0x12, 0x20, 0x0a, 0x0b, 0x71, 0x75, 0x61,
+	0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x64, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b,
+	0x71, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x64, 0x22, 0x89, 0x03, 0x0a, 0x12,
+	0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x2c, 0x0a, 0x04, 0x73, 0x70, 0x65, 0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x16, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x69, 0x72,
+	0x63, 0x75, 0x69, 0x74, 0x53, 0x70, 0x65, 0x63, 0x48, 0x00, 0x52, 0x04, 0x73, 0x70, 0x65, 0x63,
+	0x12, 0x23, 0x0a, 0x0c, 0x63, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0b, 0x63, 0x69, 0x72, 0x63, 0x75, 0x69,
+	0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x31, 0x0a, 0x07, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73,
+	0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e,
+	0x76, 0x31, 0x2e, 0x53, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52,
+	0x07, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x12, 0x33, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65,
+	0x69, 0x70, 0x74, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x62, 0x72, 0x65,
+	0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x51, 0x75,
+	0x65, 0x72, 0x79, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x73, 0x12, 0x2b, 0x0a,
+	0x05, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x62,
+	0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x61,
+	0x6e, 0x67, 0x65, 0x52, 0x05, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x73, 0x6e,
+	0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x62,
+	0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f,
+	0x74, 0x50, 0x69, 0x6e, 0x52, 0x08, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x32,
+	0x0a, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x18, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d,
+	0x69, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x42, 0x09, 0x0a, 0x07, 0x63, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x4a, 0x04, 0x08,
+	0x01, 0x10, 0x02, 0x4a, 0x04, 0x08, 0x02, 0x10, 0x03, 0x52, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d,
+	0x73, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22, 0xd3, 0x04, 0x0a, 0x0b, 0x43, 0x69, 0x72, 0x63,
+	0x75, 0x69, 0x74, 0x53, 0x70, 0x65, 0x63, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x69, 0x72, 0x63, 0x75,
+	0x69, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x69, 0x72, 0x63, 0x75, 0x69,
+	0x74, 0x12, 0x20, 0x0a, 0x0b, 0x61, 0x67, 0x67, 0x72, 0x65, 0x67, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x61, 0x67, 0x67, 0x72, 0x65, 0x67, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x0c, 0x0a, 0x01, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x01,
+	0x6b, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12, 0x1b, 0x0a, 0x09, 0x61, 0x6c, 0x70,
+	0x68, 0x61, 0x5f, 0x62, 0x70, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x61, 0x6c,
+	0x70, 0x68, 0x61, 0x42, 0x70, 0x73, 0x12, 0x2e, 0x0a, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73,
+	0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e,
+	0x76, 0x31, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x06,
+	0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x5f,
+	0x6d, 0x6f, 0x64, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x63, 0x61, 0x6c, 0x65, 0x5f, 0x66,
+	0x61, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x63, 0x61,
+	0x6c, 0x65, 0x46, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x75, 0x63, 0x6b,
+	0x65, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74,
+	0x12, 0x2b, 0x0a, 0x11, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x65, 0x6d, 0x69,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x65, 0x78, 0x70,
+	0x65, 0x63, 0x74, 0x65, 0x64, 0x45, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a,
+	0x04, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6d, 0x6f, 0x64,
+	0x65, 0x12, 0x1b, 0x0a, 0x09, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x63, 0x61, 0x70, 0x18, 0x0c,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x43, 0x61, 0x70, 0x12, 0x14,
+	0x0a, 0x05, 0x73, 0x6c, 0x6f, 0x74, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x73,
+	0x6c, 0x6f, 0x74, 0x73, 0x12, 0x39, 0x0a, 0x0a, 0x73, 0x74, 0x6f, 0x63, 0x6b, 0x5f, 0x66, 0x6c,
+	0x6f, 0x77, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x6f, 0x63, 0x6b, 0x46, 0x6c, 0x6f, 0x77, 0x50, 0x61,
+	0x72, 0x61, 0x6d, 0x73, 0x52, 0x09, 0x73, 0x74, 0x6f, 0x63, 0x6b, 0x46, 0x6c, 0x6f, 0x77, 0x12,
+	0x4e, 0x0a, 0x11, 0x72, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x5f, 0x65, 0x6d, 0x69, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x73, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x62, 0x72, 0x65,
+	0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x45, 0x6d,
+	0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x52, 0x10, 0x72,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x45, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12,
+	0x3c, 0x0a, 0x0b, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x10,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31,
+	0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x50, 0x61, 0x72, 0x61, 0x6d,
+	0x73, 0x52, 0x0a, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x22, 0x4d, 0x0a,
+	0x0b, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x69, 0x74, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x62, 0x69, 0x74, 0x73, 0x22, 0x8e, 0x01, 0x0a,
+	0x0f, 0x53, 0x74, 0x6f, 0x63, 0x6b, 0x46, 0x6c, 0x6f, 0x77, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x12, 0x21, 0x0a, 0x0c,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x5f, 0x73, 0x6c, 0x6f, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x53, 0x6c, 0x6f, 0x74, 0x12,
+	0x19, 0x0a, 0x08, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x61, 0x6d,
+	0x6f, 0x75, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x0b, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x22, 0xbb, 0x01,
+	0x0a, 0x16, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x45, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f,
+	0x6e, 0x73, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x6d, 0x69, 0x74,
+	0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x65, 0x6d, 0x69, 0x74, 0x74,
+	0x65, 0x72, 0x12, 0x19, 0x0a, 0x08, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x12, 0x21, 0x0a,
+	0x0c, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x0b, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x49, 0x6e, 0x64, 0x65, 0x78,
+	0x12, 0x26, 0x0a, 0x0f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x5f, 0x69, 0x73, 0x5f, 0x74, 0x6f,
+	0x70, 0x69, 0x63, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x61, 0x6d, 0x6f, 0x75, 0x6e,
+	0x74, 0x49, 0x73, 0x54, 0x6f, 0x70, 0x69, 0x63, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x61, 0x78, 0x5f,
+	0x72, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b,
+	0x6d, 0x61, 0x78, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x73, 0x22, 0x42, 0x0a, 0x10, 0x42,
+	0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x12,
+	0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73,
+	0x6c, 0x6f, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x6c, 0x6f, 0x74, 0x22,
+	0x61, 0x0a, 0x0c, 0x53, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12,
+	0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73,
+	0x6c, 0x6f, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x6c, 0x6f, 0x74, 0x12,
+	0x21, 0x0a, 0x0c, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x4e, 0x75, 0x6d, 0x62,
+	0x65, 0x72, 0x22, 0x5c, 0x0a, 0x0c, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x51, 0x75, 0x65,
+	0x72, 0x79, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x78, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x78, 0x48, 0x61, 0x73, 0x68, 0x12, 0x1b, 0x0a, 0x09, 0x6c,
+	0x6f, 0x67, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08,
+	0x6c, 0x6f, 0x67, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x6f, 0x70, 0x69,
+	0x63, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x73,
+	0x22, 0x64, 0x0a, 0x0a, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x1f,
+	0x0a, 0x0b, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12,
+	0x1b, 0x0a, 0x09, 0x65, 0x6e, 0x64, 0x5f, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x08, 0x65, 0x6e, 0x64, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x18, 0x0a, 0x07,
+	0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x73,
+	0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x22, 0x63, 0x0a, 0x0b, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x50, 0x69, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x62, 0x6c, 0x6f,
+	0x63, 0x6b, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x0b, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a,
+	0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x61, 0x73, 0x68, 0x22, 0xe1, 0x03, 0x0a, 0x0d,
+	0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x40, 0x0a,
+	0x0e, 0x73, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x52, 0x0d, 0x73, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x12,
+	0x2a, 0x0a, 0x0e, 0x73, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x5f, 0x72, 0x65, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x0d, 0x73, 0x75, 0x62, 0x6d, 0x69,
+	0x74, 0x52, 0x65, 0x74, 0x72, 0x69, 0x65, 0x73, 0x88, 0x01, 0x01, 0x12, 0x48, 0x0a, 0x12, 0x66,
+	0x75, 0x6c, 0x66, 0x69, 0x6c, 0x6c, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x77, 0x69, 0x6e, 0x64, 0x6f,
+	0x77, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x11, 0x66, 0x75, 0x6c, 0x66, 0x69, 0x6c, 0x6c, 0x6d, 0x65, 0x6e, 0x74, 0x57,
+	0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63,
+	0x6b, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x61, 0x6c,
+	0x6c, 0x62, 0x61, 0x63, 0x6b, 0x55, 0x72, 0x6c, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x69,
+	0x6e, 0x5f, 0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x63, 0x68, 0x61, 0x69,
+	0x6e, 0x49, 0x64, 0x12, 0x20, 0x0a, 0x0c, 0x64, 0x73, 0x74, 0x5f, 0x63, 0x68, 0x61, 0x69, 0x6e,
+	0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x64, 0x73, 0x74, 0x43, 0x68,
+	0x61, 0x69, 0x6e, 0x49, 0x64, 0x12, 0x2b, 0x0a, 0x11, 0x63, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63,
+	0x6b, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x10, 0x63, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x61,
+	0x63, 0x74, 0x12, 0x2c, 0x0a, 0x12, 0x63, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x5f, 0x67,
+	0x61, 0x73, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x10,
+	0x63, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x47, 0x61, 0x73, 0x4c, 0x69, 0x6d, 0x69, 0x74,
+	0x12, 0x21, 0x0a, 0x0c, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x71, 0x75, 0x65, 0x72, 0x79, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x0f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x72, 0x6d, 0x5f, 0x6d,
+	0x61, 0x69, 0x6e, 0x6e, 0x65, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x63, 0x6f,
+	0x6e, 0x66, 0x69, 0x72, 0x6d, 0x4d, 0x61, 0x69, 0x6e, 0x6e, 0x65, 0x74, 0x42, 0x11, 0x0a, 0x0f,
+	0x5f, 0x73, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x5f, 0x72, 0x65, 0x74, 0x72, 0x69, 0x65, 0x73, 0x22,
+	0x1f, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64,
+	0x22, 0x3e, 0x0a, 0x16, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x66,
+	0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x61, 0x66, 0x74, 0x65, 0x72,
+	0x22, 0x80, 0x04, 0x0a, 0x03, 0x4a, 0x6f, 0x62, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x65, 0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x73, 0x70, 0x65, 0x63, 0x12, 0x34, 0x0a, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x52, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x12, 0x34, 0x0a, 0x07, 0x73, 0x74,
+	0x61, 0x72, 0x74, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x07, 0x73, 0x74, 0x61, 0x72, 0x74, 0x65, 0x64,
+	0x12, 0x36, 0x0a, 0x08, 0x66, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x08,
+	0x66, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64, 0x12, 0x2c, 0x0a, 0x03, 0x65, 0x74, 0x61, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x52, 0x03, 0x65, 0x74, 0x61, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x67, 0x65, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x74, 0x61, 0x67, 0x65, 0x12, 0x2f, 0x0a, 0x06,
+	0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53,
+	0x74, 0x72, 0x75, 0x63, 0x74, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x14, 0x0a,
+	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72,
+	0x72, 0x6f, 0x72, 0x12, 0x21, 0x0a, 0x0c, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x65, 0x72, 0x72, 0x6f, 0x72,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f,
+	0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x74, 0x69, 0x6d, 0x65, 0x6f,
+	0x75, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x67, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c,
+	0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x53, 0x74, 0x61, 0x67, 0x65, 0x12, 0x25, 0x0a, 0x0e,
+	0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x0e,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x49, 0x64, 0x22, 0x90, 0x01, 0x0a, 0x08, 0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x73, 0x74, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x74, 0x61,
+	0x67, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x74, 0x69,
+	0x6d, 0x65, 0x12, 0x22, 0x0a, 0x04, 0x64, 0x6f, 0x6e, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0e, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62,
+	0x52, 0x04, 0x64, 0x6f, 0x6e, 0x65, 0x32, 0x9e, 0x02, 0x0a, 0x06, 0x50, 0x72, 0x6f, 0x76, 0x65,
+	0x72, 0x12, 0x55, 0x0a, 0x0e, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x43, 0x69, 0x72, 0x63,
+	0x75, 0x69, 0x74, 0x12, 0x20, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e,
+	0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3c, 0x0a, 0x0b, 0x53, 0x75, 0x62, 0x6d,
+	0x69, 0x74, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x12, 0x1d, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73,
+	0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0e, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e,
+	0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62, 0x12, 0x32, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62,
+	0x12, 0x18, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74,
+	0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0e, 0x2e, 0x62, 0x72, 0x65,
+	0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62, 0x12, 0x4b, 0x0a, 0x0f, 0x53, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x21, 0x2e,
+	0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x13, 0x2e, 0x62, 0x72, 0x65, 0x76, 0x69, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62,
+	0x45, 0x76, 0x65, 0x6e, 0x74, 0x30, 0x01, 0x42, 0x1b, 0x5a, 0x19, 0x62, 0x72, 0x65, 0x76, 0x69,
+	0x73, 0x5f, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x3b, 0x62, 0x72, 0x65, 0x76,
+	0x69, 0x73, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_brevis_proto_rawDescOnce sync.Once
+	file_brevis_proto_rawDescData = file_brevis_proto_rawDesc
+)
+
+func file_brevis_proto_rawDescGZIP() []byte {
+	file_brevis_proto_rawDescOnce.Do(func() {
+		file_brevis_proto_rawDescData = protoimpl.X.CompressGZIP(file_brevis_proto_rawDescData)
+	})
+	return file_brevis_proto_rawDescData
+}
+
+var file_brevis_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_brevis_proto_goTypes = []any{
+	(*PrepareCircuitRequest)(nil),  // 0: brevis.v1.PrepareCircuitRequest
+	(*PrepareCircuitResponse)(nil), // 1: brevis.v1.PrepareCircuitResponse
+	(*SubmitProofRequest)(nil),     // 2: brevis.v1.SubmitProofRequest
+	(*CircuitSpec)(nil),            // 3: brevis.v1.CircuitSpec
+	(*PackedField)(nil),            // 4: brevis.v1.PackedField
+	(*StockFlowParams)(nil),        // 5: brevis.v1.StockFlowParams
+	(*ReceiptEmissionsParams)(nil), // 6: brevis.v1.ReceiptEmissionsParams
+	(*BlockRangeParams)(nil),       // 7: brevis.v1.BlockRangeParams
+	(*StorageQuery)(nil),           // 8: brevis.v1.StorageQuery
+	(*ReceiptQuery)(nil),           // 9: brevis.v1.ReceiptQuery
+	(*BlockRange)(nil),             // 10: brevis.v1.BlockRange
+	(*SnapshotPin)(nil),            // 11: brevis.v1.SnapshotPin
+	(*SubmitOptions)(nil),          // 12: brevis.v1.SubmitOptions
+	(*GetJobRequest)(nil),          // 13: brevis.v1.GetJobRequest
+	(*StreamJobEventsRequest)(nil), // 14: brevis.v1.StreamJobEventsRequest
+	(*Job)(nil),                    // 15: brevis.v1.Job
+	(*JobEvent)(nil),               // 16: brevis.v1.JobEvent
+	(*durationpb.Duration)(nil),    // 17: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil),  // 18: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),        // 19: google.protobuf.Struct
+}
+var file_brevis_proto_depIdxs = []int32{
+	3,  // 0: brevis.v1.PrepareCircuitRequest.spec:type_name -> brevis.v1.CircuitSpec
+	3,  // 1: brevis.v1.SubmitProofRequest.spec:type_name -> brevis.v1.CircuitSpec
+	8,  // 2: brevis.v1.SubmitProofRequest.queries:type_name -> brevis.v1.StorageQuery
+	9,  // 3: brevis.v1.SubmitProofRequest.receipts:type_name -> brevis.v1.ReceiptQuery
+	10, // 4: brevis.v1.SubmitProofRequest.range:type_name -> brevis.v1.BlockRange
+	11, // 5: brevis.v1.SubmitProofRequest.snapshot:type_name -> brevis.v1.SnapshotPin
+	12, // 6: brevis.v1.SubmitProofRequest.options:type_name -> brevis.v1.SubmitOptions
+	4,  // 7: brevis.v1.CircuitSpec.fields:type_name -> brevis.v1.PackedField
+	5,  // 8: brevis.v1.CircuitSpec.stock_flow:type_name -> brevis.v1.StockFlowParams
+	6,  // 9: brevis.v1.CircuitSpec.receipt_emissions:type_name -> brevis.v1.ReceiptEmissionsParams
+	7,  // 10: brevis.v1.CircuitSpec.block_range:type_name -> brevis.v1.BlockRangeParams
+	17, // 11: brevis.v1.SubmitOptions.submit_timeout:type_name -> google.protobuf.Duration
+	17, // 12: brevis.v1.SubmitOptions.fulfillment_window:type_name -> google.protobuf.Duration
+	18, // 13: brevis.v1.Job.created:type_name -> google.protobuf.Timestamp
+	18, // 14: brevis.v1.Job.started:type_name -> google.protobuf.Timestamp
+	18, // 15: brevis.v1.Job.finished:type_name -> google.protobuf.Timestamp
+	18, // 16: brevis.v1.Job.eta:type_name -> google.protobuf.Timestamp
+	19, // 17: brevis.v1.Job.result:type_name -> google.protobuf.Struct
+	18, // 18: brevis.v1.JobEvent.time:type_name -> google.protobuf.Timestamp
+	15, // 19: brevis.v1.JobEvent.done:type_name -> brevis.v1.Job
+	0,  // 20: brevis.v1.Prover.PrepareCircuit:input_type -> brevis.v1.PrepareCircuitRequest
+	2,  // 21: brevis.v1.Prover.SubmitProof:input_type -> brevis.v1.SubmitProofRequest
+	13, // 22: brevis.v1.Prover.GetJob:input_type -> brevis.v1.GetJobRequest
+	14, // 23: brevis.v1.Prover.StreamJobEvents:input_type -> brevis.v1.StreamJobEventsRequest
+	1,  // 24: brevis.v1.Prover.PrepareCircuit:output_type -> brevis.v1.PrepareCircuitResponse
+	15, // 25: brevis.v1.Prover.SubmitProof:output_type -> brevis.v1.Job
+	15, // 26: brevis.v1.Prover.GetJob:output_type -> brevis.v1.Job
+	16, // 27: brevis.v1.Prover.StreamJobEvents:output_type -> brevis.v1.JobEvent
+	24, // [24:28] is the sub-list for method output_type
+	20, // [20:24] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
+}
+
+func init() { file_brevis_proto_init() }
+func file_brevis_proto_init() {
+	if File_brevis_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_brevis_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*PrepareCircuitRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*PrepareCircuitResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*SubmitProofRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*CircuitSpec); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*PackedField); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*StockFlowParams); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*ReceiptEmissionsParams); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[7].Exporter = func(v any, i int) any {
+			switch v := v.(*BlockRangeParams); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[8].Exporter = func(v any, i int) any {
+			switch v := v.(*StorageQuery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[9].Exporter = func(v any, i int) any {
+			switch v := v.(*ReceiptQuery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[10].Exporter = func(v any, i int) any {
+			switch v := v.(*BlockRange); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[11].Exporter = func(v any, i int) any {
+			switch v := v.(*SnapshotPin); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[12].Exporter = func(v any, i int) any {
+			switch v := v.(*SubmitOptions); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[13].Exporter = func(v any, i int) any {
+			switch v := v.(*GetJobRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[14].Exporter = func(v any, i int) any {
+			switch v := v.(*StreamJobEventsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[15].Exporter = func(v any, i int) any {
+			switch v := v.(*Job); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_brevis_proto_msgTypes[16].Exporter = func(v any, i int) any {
+			switch v := v.(*JobEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_brevis_proto_msgTypes[2].OneofWrappers = []any{
+		(*SubmitProofRequest_Spec)(nil),
+		(*SubmitProofRequest_CircuitName)(nil),
+	}
+	file_brevis_proto_msgTypes[12].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_brevis_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_brevis_proto_goTypes,
+		DependencyIndexes: file_brevis_proto_depIdxs,
+		MessageInfos:      file_brevis_proto_msgTypes,
+	}.Build()
+	File_brevis_proto = out.File
+	file_brevis_proto_rawDesc = nil
+	file_brevis_proto_goTypes = nil
+	file_brevis_proto_depIdxs = nil
+}
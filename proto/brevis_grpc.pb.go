@@ -0,0 +1,264 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: brevis.proto
+
+// The prover API over gRPC. It runs the same pipeline as the HTTP endpoints
+// it mirrors and takes the same API keys, sent as "authorization: Bearer
+// <key>" or "x-api-key" metadata.
+
+package brevispb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Prover_PrepareCircuit_FullMethodName  = "/brevis.v1.Prover/PrepareCircuit"
+	Prover_SubmitProof_FullMethodName     = "/brevis.v1.Prover/SubmitProof"
+	Prover_GetJob_FullMethodName          = "/brevis.v1.Prover/GetJob"
+	Prover_StreamJobEvents_FullMethodName = "/brevis.v1.Prover/StreamJobEvents"
+)
+
+// ProverClient is the client API for Prover service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ProverClient interface {
+	// PrepareCircuit compiles a circuit spec, as /prepare-download does, and
+	// returns once it is prepared.
+	PrepareCircuit(ctx context.Context, in *PrepareCircuitRequest, opts ...grpc.CallOption) (*PrepareCircuitResponse, error)
+	// SubmitProof queues a proof job, as /submit-proof does without wait.
+	SubmitProof(ctx context.Context, in *SubmitProofRequest, opts ...grpc.CallOption) (*Job, error)
+	// GetJob reports a job, as /jobs/{id} does.
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// StreamJobEvents streams a job's stage transitions, as
+	// /jobs/{id}/events does, ending with the finished job.
+	StreamJobEvents(ctx context.Context, in *StreamJobEventsRequest, opts ...grpc.CallOption) (Prover_StreamJobEventsClient, error)
+}
+
+type proverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProverClient(cc grpc.ClientConnInterface) ProverClient {
+	return &proverClient{cc}
+}
+
+func (c *proverClient) PrepareCircuit(ctx context.Context, in *PrepareCircuitRequest, opts ...grpc.CallOption) (*PrepareCircuitResponse, error) {
+	out := new(PrepareCircuitResponse)
+	err := c.cc.Invoke(ctx, Prover_PrepareCircuit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proverClient) SubmitProof(ctx context.Context, in *SubmitProofRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Prover_SubmitProof_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proverClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Prover_GetJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proverClient) StreamJobEvents(ctx context.Context, in *StreamJobEventsRequest, opts ...grpc.CallOption) (Prover_StreamJobEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Prover_ServiceDesc.Streams[0], Prover_StreamJobEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &proverStreamJobEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Prover_StreamJobEventsClient interface {
+	Recv() (*JobEvent, error)
+	grpc.ClientStream
+}
+
+type proverStreamJobEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *proverStreamJobEventsClient) Recv() (*JobEvent, error) {
+	m := new(JobEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ProverServer is the server API for Prover service.
+// All implementations must embed UnimplementedProverServer
+// for forward compatibility
+type ProverServer interface {
+	// PrepareCircuit compiles a circuit spec, as /prepare-download does, and
+	// returns once it is prepared.
+	PrepareCircuit(context.Context, *PrepareCircuitRequest) (*PrepareCircuitResponse, error)
+	// SubmitProof queues a proof job, as /submit-proof does without wait.
+	SubmitProof(context.Context, *SubmitProofRequest) (*Job, error)
+	// GetJob reports a job, as /jobs/{id} does.
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// StreamJobEvents streams a job's stage transitions, as
+	// /jobs/{id}/events does, ending with the finished job.
+	StreamJobEvents(*StreamJobEventsRequest, Prover_StreamJobEventsServer) error
+	mustEmbedUnimplementedProverServer()
+}
+
+// UnimplementedProverServer must be embedded to have forward compatible implementations.
+type UnimplementedProverServer struct {
+}
+
+func (UnimplementedProverServer) PrepareCircuit(context.Context, *PrepareCircuitRequest) (*PrepareCircuitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PrepareCircuit not implemented")
+}
+func (UnimplementedProverServer) SubmitProof(context.Context, *SubmitProofRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitProof not implemented")
+}
+func (UnimplementedProverServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedProverServer) StreamJobEvents(*StreamJobEventsRequest, Prover_StreamJobEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamJobEvents not implemented")
+}
+func (UnimplementedProverServer) mustEmbedUnimplementedProverServer() {}
+
+// UnsafeProverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProverServer will
+// result in compilation errors.
+type UnsafeProverServer interface {
+	mustEmbedUnimplementedProverServer()
+}
+
+func RegisterProverServer(s grpc.ServiceRegistrar, srv ProverServer) {
+	s.RegisterService(&Prover_ServiceDesc, srv)
+}
+
+func _Prover_PrepareCircuit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrepareCircuitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProverServer).PrepareCircuit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prover_PrepareCircuit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProverServer).PrepareCircuit(ctx, req.(*PrepareCircuitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prover_SubmitProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProverServer).SubmitProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prover_SubmitProof_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProverServer).SubmitProof(ctx, req.(*SubmitProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prover_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProverServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prover_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProverServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prover_StreamJobEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamJobEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProverServer).StreamJobEvents(m, &proverStreamJobEventsServer{stream})
+}
+
+type Prover_StreamJobEventsServer interface {
+	Send(*JobEvent) error
+	grpc.ServerStream
+}
+
+type proverStreamJobEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *proverStreamJobEventsServer) Send(m *JobEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Prover_ServiceDesc is the grpc.ServiceDesc for Prover service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Prover_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "brevis.v1.Prover",
+	HandlerType: (*ProverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PrepareCircuit",
+			Handler:    _Prover_PrepareCircuit_Handler,
+		},
+		{
+			MethodName: "SubmitProof",
+			Handler:    _Prover_SubmitProof_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Prover_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamJobEvents",
+			Handler:       _Prover_StreamJobEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "brevis.proto",
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// provenanceAge is how old a storage query's block must be before its value
+// is checked against a state proof. Zero disables the check.
+var provenanceAge = 24 * time.Hour
+
+// provenance is the evidence that a historical storage value is what the
+// chain held: Merkle proofs from the block's state root to the value, and
+// whether a second provider agreed on the block hash that commits to it.
+type provenance struct {
+	Address      common.Address `json:"address"`
+	Slot         common.Hash    `json:"slot"`
+	BlockNumber  uint64         `json:"block_number"`
+	BlockHash    common.Hash    `json:"block_hash"`
+	StateRoot    common.Hash    `json:"state_root"`
+	StorageHash  common.Hash    `json:"storage_hash"`
+	Value        common.Hash    `json:"value"`
+	AccountProof []string       `json:"account_proof"`
+	StorageProof []string       `json:"storage_proof"`
+	// CrossChecked is false when only one RPC provider is configured.
+	CrossChecked bool `json:"cross_checked"`
+}
+
+// verifyProvenance proves every query older than provenanceAge against its
+// block's state root on rpcURL, and checks the block hash on a second
+// provider. A value or hash that does not match fails the attempt.
+func verifyProvenance(ctx context.Context, rpcURL string, queries []sdk.StorageData) ([]provenance, error) {
+	if provenanceAge == 0 {
+		return nil, nil
+	}
+	cutoff := uint64(time.Now().Add(-provenanceAge).Unix())
+	var old []sdk.StorageData
+	for _, q := range queries {
+		if q.BlockTimestamp <= cutoff {
+			old = append(old, q)
+		}
+	}
+	if len(old) == 0 {
+		return nil, nil
+	}
+
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+	var second *ethclient.Client
+	if url := otherRPC(rpcURL); url != "" {
+		if second, err = ethclient.DialContext(ctx, url); err != nil {
+			return nil, fmt.Errorf("dialing %s: %v", url, err)
+		}
+		defer second.Close()
+	}
+
+	var records []provenance
+	for _, q := range old {
+		p, err := proveStorage(ctx, ec, q)
+		if err != nil {
+			return nil, &statusError{http.StatusBadGateway, fmt.Errorf("provenance of slot %s of %s at block %d: %v", q.Slot.Hex(), q.Address.Hex(), q.BlockNum, err)}
+		}
+		if second != nil {
+			header, err := second.HeaderByNumber(ctx, q.BlockNum)
+			if err != nil {
+				return nil, fmt.Errorf("cross-checking block %d: %v", q.BlockNum, err)
+			}
+			if header.Hash() != p.BlockHash {
+				return nil, &statusError{http.StatusBadGateway, fmt.Errorf("providers disagree on block %d: %s vs %s", q.BlockNum, p.BlockHash.Hex(), header.Hash().Hex())}
+			}
+			p.CrossChecked = true
+		}
+		records = append(records, p)
+	}
+	return records, nil
+}
+
+// proofResult is the part of an eth_getProof response that is verified.
+type proofResult struct {
+	AccountProof []string    `json:"accountProof"`
+	StorageHash  common.Hash `json:"storageHash"`
+	StorageProof []struct {
+		Proof []string `json:"proof"`
+	} `json:"storageProof"`
+}
+
+// proveStorage fetches eth_getProof for q and verifies it against the state
+// root of the block header, which the block hash commits to.
+func proveStorage(ctx context.Context, ec *ethclient.Client, q sdk.StorageData) (provenance, error) {
+	header, err := ec.HeaderByNumber(ctx, q.BlockNum)
+	if err != nil {
+		return provenance{}, fmt.Errorf("fetching block: %v", err)
+	}
+	var result proofResult
+	err = ec.Client().CallContext(ctx, &result, "eth_getProof", q.Address, []string{q.Slot.Hex()}, hexutil.EncodeBig(q.BlockNum))
+	if err != nil {
+		return provenance{}, fmt.Errorf("fetching proof: %v", err)
+	}
+	if len(result.StorageProof) != 1 {
+		return provenance{}, fmt.Errorf("got %d storage proofs, want 1", len(result.StorageProof))
+	}
+	p := provenance{
+		Address:      q.Address,
+		Slot:         q.Slot,
+		BlockNumber:  header.Number.Uint64(),
+		BlockHash:    header.Hash(),
+		StateRoot:    header.Root,
+		StorageHash:  result.StorageHash,
+		Value:        q.Value,
+		AccountProof: result.AccountProof,
+		StorageProof: result.StorageProof[0].Proof,
+	}
+
+	raw, err := verifyTrieProof(header.Root, crypto.Keccak256(q.Address.Bytes()), p.AccountProof)
+	if err != nil {
+		return p, fmt.Errorf("account proof: %v", err)
+	}
+	if raw == nil {
+		return p, fmt.Errorf("account does not exist at this block")
+	}
+	account, err := types.FullAccount(raw)
+	if err != nil {
+		return p, fmt.Errorf("decoding account: %v", err)
+	}
+	if account.Root != result.StorageHash {
+		return p, fmt.Errorf("account storage root %s does not match reported %s", account.Root.Hex(), result.StorageHash.Hex())
+	}
+
+	raw, err = verifyTrieProof(account.Root, crypto.Keccak256(q.Slot.Bytes()), p.StorageProof)
+	if err != nil {
+		return p, fmt.Errorf("storage proof: %v", err)
+	}
+	value := new(big.Int)
+	if raw != nil {
+		var b []byte
+		if err := rlp.DecodeBytes(raw, &b); err != nil {
+			return p, fmt.Errorf("decoding storage value: %v", err)
+		}
+		value.SetBytes(b)
+	}
+	if common.BigToHash(value) != q.Value {
+		return p, fmt.Errorf("proven value %s does not match fetched %s", common.BigToHash(value).Hex(), q.Value.Hex())
+	}
+	return p, nil
+}
+
+// verifyTrieProof returns the value stored under key in the trie with the
+// given root, or nil if the proof shows the key is absent.
+func verifyTrieProof(root common.Hash, key []byte, proof []string) ([]byte, error) {
+	db := memorydb.New()
+	for _, node := range proof {
+		b, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, err
+		}
+		db.Put(crypto.Keccak256(b), b)
+	}
+	return trie.VerifyProof(root, key, db)
+}
+
+// otherRPC returns the best-scored provider of url's chain other than url,
+// or "" if there is none.
+func otherRPC(url string) string {
+	chainID := rpcChain(url)
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	others := make([]*rpcProvider, 0, len(rpcProviders))
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID && p.URL != url {
+			others = append(others, p)
+		}
+	}
+	if len(others) == 0 {
+		return ""
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Score > others[j].Score })
+	return others[0].URL
+}
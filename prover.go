@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// Prover turns a full witness into a proof for a prepared circuit. Once ctx
+// ends it abandons the proof, stopping the work where the backend allows.
+type Prover interface {
+	Name() string
+	Prove(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error)
+}
+
+// provers are the backends tried in order for each circuit, keyed by
+// circuit name. Circuits without an entry use the in-process prover.
+var provers = map[string][]Prover{}
+
+// loadProvers reads BREVIS_PROVER, the backends every circuit tries in
+// order, and BREVIS_PROVER_<CIRCUIT> overrides such as
+// BREVIS_PROVER_STOCK_FLOW. Each is a comma-separated list of "local",
+// "command:<path>" or "remote:<url>".
+func loadProvers() error {
+	for _, circuit := range []string{CircuitEmissions, CircuitStockFlow, CircuitReceiptEmissions, CircuitBlockRange} {
+		v := os.Getenv("BREVIS_PROVER_" + strings.ToUpper(circuit))
+		if v == "" {
+			v = os.Getenv("BREVIS_PROVER")
+		}
+		if v == "" {
+			continue
+		}
+		chain, err := parseProvers(v)
+		if err != nil {
+			return err
+		}
+		provers[circuit] = chain
+		names := make([]string, len(chain))
+		for i, p := range chain {
+			names[i] = p.Name()
+		}
+		slog.Info("Configured provers", "circuit", circuit, "provers", names)
+	}
+	return nil
+}
+
+func parseProvers(s string) ([]Prover, error) {
+	var chain []Prover
+	for _, v := range strings.Split(s, ",") {
+		kind, arg, _ := strings.Cut(strings.TrimSpace(v), ":")
+		switch {
+		case kind == "local" && arg == "":
+			chain = append(chain, localProver{})
+		case kind == "command" && arg != "":
+			chain = append(chain, commandProver{Path: arg})
+		case kind == "remote" && arg != "":
+			chain = append(chain, remoteProver{URL: arg})
+		default:
+			return nil, fmt.Errorf("invalid prover %q: want local, command:<path> or remote:<url>", v)
+		}
+	}
+	return chain, nil
+}
+
+// proveWithFallback tries each backend configured for the spec's circuit
+// until one returns a proof.
+func proveWithFallback(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	chain := provers[spec.Circuit]
+	if len(chain) == 0 {
+		chain = []Prover{localProver{}}
+	}
+	var errs []string
+	for _, p := range chain {
+		start := time.Now()
+		proof, err := p.Prove(ctx, spec, w)
+		if err == nil {
+			slog.InfoContext(ctx, "Proved", "prover", p.Name(), "duration_ms", time.Since(start).Milliseconds())
+			return proof, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("proof abandoned: %w", ctx.Err())
+		}
+		slog.ErrorContext(ctx, "Prover failed", "prover", p.Name(), "err", err)
+		errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+	}
+	return nil, fmt.Errorf("every prover failed: %s", strings.Join(errs, "; "))
+}
+
+// localProver is the gnark prover, run in this process or on a prover
+// worker if any are running.
+// An in-process proof cannot be stopped; cancelling ctx only drops its
+// result.
+type localProver struct{}
+
+func (localProver) Name() string { return "local" }
+
+func (localProver) Prove(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	if workerPool != nil {
+		return proveOnWorker(ctx, spec, w)
+	}
+	if v := findVariant(spec); v != nil {
+		return proveWith(v.CCS, v.PK, w)
+	}
+	return nil, fmt.Errorf("circuit for spec %s is no longer prepared", spec)
+}
+
+// commandProver runs an external prover binary, such as a GPU build of
+// gnark, once per proof as
+//
+//	<path> <artifact dir> <witness file> <proof file>
+//
+// The artifact dir holds compiledCircuit and pk as written by sdk.Compile,
+// the witness file is a binary full witness, and the binary writes the
+// binary plonk proof to the proof file. The binary is killed once ctx ends.
+type commandProver struct {
+	Path string
+}
+
+func (p commandProver) Name() string { return "command:" + p.Path }
+
+func (p commandProver) Prove(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	dir := variantDir(spec)
+	if artifactBucket != "" {
+		var err error
+		if dir, err = cachedArtifacts(spec.String()); err != nil {
+			return nil, err
+		}
+	}
+	tmp, err := os.MkdirTemp("", "brevis-prove-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	raw, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	witnessFile := filepath.Join(tmp, "witness")
+	proofFile := filepath.Join(tmp, "proof")
+	if err := os.WriteFile(witnessFile, raw, 0600); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, p.Path, dir, witnessFile, proofFile)
+	cmd.Stdout = os.Stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	out, err := os.ReadFile(proofFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading proof: %v", err)
+	}
+	return decodeProof(out)
+}
+
+// remoteProver posts the witness to a proving service, which answers with
+// the binary plonk proof. The service must hold the circuit for the spec.
+type remoteProver struct {
+	URL string
+}
+
+// remoteProveTimeout bounds a single remote proof, generously above the
+// time a 32-slot proof takes on a CPU.
+var remoteProveTimeout = 10 * time.Minute
+
+func (p remoteProver) Name() string { return "remote:" + p.URL }
+
+func (p remoteProver) Prove(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	raw, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(proveRequest{Spec: spec.String(), Witness: raw})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteProveTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(out)))
+	}
+	return decodeProof(out)
+}
+
+func decodeProof(b []byte) (plonk.Proof, error) {
+	proof := plonk.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("decoding proof: %v", err)
+	}
+	return proof, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	// workerMemoryMax is the hard memory limit of each prover worker in
+	// bytes; zero leaves it unlimited.
+	workerMemoryMax = 0
+	// workerCPUs caps the cores each prover worker may use; zero leaves it
+	// unlimited.
+	workerCPUs = 0
+)
+
+// loadWorkerLimits reads BREVIS_PROVER_MEMORY_MAX and BREVIS_PROVER_CPUS.
+// Workers read them too, to keep their own heap and threads inside the
+// limits.
+func loadWorkerLimits() error {
+	var err error
+	if workerMemoryMax, err = envInt("BREVIS_PROVER_MEMORY_MAX", workerMemoryMax); err != nil {
+		return err
+	}
+	workerCPUs, err = envInt("BREVIS_PROVER_CPUS", workerCPUs)
+	return err
+}
+
+// limitWorker moves worker i's process into a cgroup of its own enforcing
+// the worker limits. Only cgroup v2 is supported; on other hosts the workers
+// run with the soft limits from applyWorkerMemoryLimit alone.
+func limitWorker(i, pid int) error {
+	if workerMemoryMax == 0 && workerCPUs == 0 {
+		return nil
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		return fmt.Errorf("cgroup v2 not available")
+	}
+	self, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return err
+	}
+	parent := filepath.Join("/sys/fs/cgroup", strings.TrimPrefix(strings.TrimSpace(string(self)), "0::"))
+	// Fails harmlessly when the controllers are already delegated.
+	os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644)
+
+	dir := filepath.Join(parent, fmt.Sprintf("brevis-prover-%d", i))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	limits := map[string]string{}
+	if workerMemoryMax > 0 {
+		limits["memory.max"] = fmt.Sprint(workerMemoryMax)
+		limits["memory.swap.max"] = "0"
+	}
+	if workerCPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", workerCPUs*100000)
+	}
+	for file, v := range limits {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(v), 0644); err != nil {
+			return fmt.Errorf("setting %s: %v", file, err)
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(fmt.Sprint(pid)), 0644)
+}
+
+// applyWorkerMemoryLimit keeps a worker's heap and threads inside its hard
+// limits: the GC works harder as the heap nears 90% of the memory limit,
+// and GOMAXPROCS matches the CPU quota so the runtime isn't throttled.
+func applyWorkerMemoryLimit() {
+	if workerMemoryMax > 0 {
+		soft := int64(workerMemoryMax) * 9 / 10
+		if limit := activeProverProfile.MemoryLimit; limit == 0 || soft < limit {
+			debug.SetMemoryLimit(soft)
+		}
+	}
+	if workerCPUs > 0 && workerCPUs < runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(workerCPUs)
+	}
+}
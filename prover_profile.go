@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+)
+
+// proverProfile trades proving speed for peak memory.
+type proverProfile struct {
+	Name string
+	// MaxProcs caps GOMAXPROCS; zero keeps the runtime default.
+	MaxProcs int
+	// MemoryLimit is the soft heap limit in bytes; zero leaves it unset.
+	MemoryLimit int64
+	// GCPercent is the GOGC value; zero leaves it unchanged.
+	GCPercent int
+	// Serialize runs one proof at a time so concurrent requests can't stack
+	// their proving memory.
+	Serialize bool
+}
+
+var proverProfiles = map[string]proverProfile{
+	"default": {Name: "default"},
+	// low-memory keeps a 32-slot proof within a 16 GB node.
+	"low-memory": {
+		Name:        "low-memory",
+		MaxProcs:    2,
+		MemoryLimit: 12 << 30,
+		GCPercent:   25,
+		Serialize:   true,
+	},
+}
+
+var (
+	activeProverProfile = proverProfiles["default"]
+	proveMutex          sync.Mutex
+)
+
+// applyProverProfile activates the profile named by BREVIS_PROVER_PROFILE.
+func applyProverProfile() error {
+	name := os.Getenv("BREVIS_PROVER_PROFILE")
+	if name == "" {
+		name = "default"
+	}
+	p, ok := proverProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown BREVIS_PROVER_PROFILE %q", name)
+	}
+	if p.MaxProcs > 0 && p.MaxProcs < runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(p.MaxProcs)
+	}
+	if p.MemoryLimit > 0 {
+		debug.SetMemoryLimit(p.MemoryLimit)
+	}
+	if p.GCPercent > 0 {
+		debug.SetGCPercent(p.GCPercent)
+	}
+	activeProverProfile = p
+	slog.Info("Using prover profile", "profile", p.Name, "gomaxprocs", runtime.GOMAXPROCS(0))
+	return nil
+}
+
+// prove proves w for the circuit prepared for spec under the active prover
+// profile, using the backends configured for the spec's circuit.
+func prove(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	if activeProverProfile.Serialize {
+		proveMutex.Lock()
+		defer proveMutex.Unlock()
+		// Hand the proving buffers back to the OS before the next proof starts.
+		defer debug.FreeOSMemory()
+	}
+	return proveWithFallback(ctx, spec, w)
+}
+
+func proveWith(ccs constraint.ConstraintSystem, pk plonk.ProvingKey, w witness.Witness) (plonk.Proof, error) {
+	return sdk.Prove(ccs, pk, w)
+}
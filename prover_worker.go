@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+)
+
+// proverWorkerCommand is the argument that starts the binary as a prover
+// worker instead of the HTTP server.
+const proverWorkerCommand = "prover-worker"
+
+// circuitDir holds the compiled variants; set from config.CircuitDir.
+var circuitDir = "./brevis-circuit"
+
+const (
+	// circuitSpecFile records which spec the artifacts in circuitDir were
+	// compiled for, so workers can load them before the first job.
+	circuitSpecFile = "spec.json"
+)
+
+// proverWorkers is how many worker processes to start. Zero proves in the
+// API process.
+var proverWorkers = 0
+
+var (
+	// workerPool holds every idle worker.
+	workerPool chan *proverWorker
+	workerExe  string
+)
+
+// proverWorker is one supervised worker process.
+type proverWorker struct {
+	index  int
+	socket string
+	cmd    *exec.Cmd
+	// stdin is the write end of the worker's stdin, held open for the life
+	// of the API process.
+	stdin io.WriteCloser
+	// exited closes once the process is gone, after which exitErr is set.
+	exited  chan struct{}
+	exitErr error
+}
+
+type proveRequest struct {
+	Spec    string
+	Witness []byte
+}
+
+type proveResponse struct {
+	Proof []byte
+	Err   string
+}
+
+// startProverWorkers forks n workers and waits until each accepts
+// connections. Workers exit when the API process does, since their stdin
+// closes with it.
+func startProverWorkers(n int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	workerExe = exe
+	workerPool = make(chan *proverWorker, n)
+	for i := 0; i < n; i++ {
+		pw, err := startProverWorker(i)
+		if err != nil {
+			return err
+		}
+		workerPool <- pw
+	}
+	return nil
+}
+
+func startProverWorker(i int) (*proverWorker, error) {
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("brevis-prover-%d-%d.sock", os.Getpid(), i))
+	os.Remove(socket)
+	cmd := exec.Command(workerExe, proverWorkerCommand, socket)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting prover worker %d: %v", i, err)
+	}
+	pw := &proverWorker{index: i, socket: socket, cmd: cmd, stdin: stdin, exited: make(chan struct{})}
+	go func() {
+		pw.exitErr = cmd.Wait()
+		close(pw.exited)
+	}()
+	if err := limitWorker(i, cmd.Process.Pid); err != nil {
+		slog.Warn("Prover worker running without hard limits", "worker", i, "err", err)
+	}
+	if err := waitForSocket(socket, time.Minute); err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("prover worker %d: %v", i, err)
+	}
+	slog.Info("Prover worker running", "worker", i, "pid", cmd.Process.Pid)
+	return pw, nil
+}
+
+// replace starts a fresh worker in the crashed one's place and returns it to
+// the pool, retrying until it comes up.
+func (pw *proverWorker) replace() {
+	for delay := time.Second; ; delay = min(2*delay, time.Minute) {
+		next, err := startProverWorker(pw.index)
+		if err == nil {
+			workerPool <- next
+			return
+		}
+		slog.Error("Error restarting prover worker", "worker", pw.index, "err", err)
+		time.Sleep(delay)
+	}
+}
+
+// crashed reports how the worker died, if it did. A worker whose proof
+// fails mid-stream may still be exiting, so it waits briefly.
+func (pw *proverWorker) crashed() (string, bool) {
+	select {
+	case <-pw.exited:
+	case <-time.After(5 * time.Second):
+		return "", false
+	}
+	if ee, ok := pw.exitErr.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			if ws.Signal() == syscall.SIGKILL {
+				return "killed, most likely out of memory", true
+			}
+			return fmt.Sprintf("killed by %s", ws.Signal()), true
+		}
+	}
+	return fmt.Sprintf("exited: %v", pw.exitErr), true
+}
+
+func waitForSocket(socket string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not listening on %s after %s: %v", socket, timeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// proveOnWorker sends the witness to an idle worker and waits for its proof.
+// A worker that crashes fails only this proof and is replaced. Once ctx ends
+// the worker is killed to stop the proof, and replaced the same way.
+func proveOnWorker(ctx context.Context, spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	var pw *proverWorker
+	select {
+	case pw = <-workerPool:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	stop := context.AfterFunc(ctx, func() { pw.cmd.Process.Kill() })
+	proof, err := pw.prove(spec, w)
+	stop()
+	if err != nil {
+		if how, ok := pw.crashed(); ok {
+			if ctx.Err() != nil {
+				slog.InfoContext(ctx, "Killed prover worker for an abandoned proof; restarting it", "worker", pw.index)
+				go pw.replace()
+				return nil, ctx.Err()
+			}
+			slog.Error("Prover worker died; restarting it", "worker", pw.index, "pid", pw.cmd.Process.Pid, "how", how)
+			go pw.replace()
+			return nil, fmt.Errorf("prover worker %s during the proof", how)
+		}
+	}
+	workerPool <- pw
+	return proof, err
+}
+
+func (pw *proverWorker) prove(spec CircuitSpec, w witness.Witness) (plonk.Proof, error) {
+	raw, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", pw.socket)
+	if err != nil {
+		return nil, fmt.Errorf("prover worker unavailable: %v", err)
+	}
+	defer conn.Close()
+	if err := gob.NewEncoder(conn).Encode(proveRequest{Spec: spec.String(), Witness: raw}); err != nil {
+		return nil, fmt.Errorf("sending witness to prover worker: %v", err)
+	}
+	var resp proveResponse
+	if err := gob.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("prover worker died mid-proof: %v", err)
+	}
+	if resp.Err != "" {
+		return nil, fmt.Errorf("%s", resp.Err)
+	}
+	return decodeProof(resp.Proof)
+}
+
+// loadedCircuit is one compiled circuit a worker keeps in memory.
+type loadedCircuit struct {
+	spec string
+	ccs  constraint.ConstraintSystem
+	pk   plonk.ProvingKey
+}
+
+// loadedCircuits holds a worker's circuits keyed by spec, so every variant
+// of every prepared spec stays warm.
+type loadedCircuits map[string]*loadedCircuit
+
+// load reads the artifacts for spec from its variant directory under
+// circuitDir, which must have been compiled for it. With an artifact bucket,
+// the spec is fetched through the artifact cache instead.
+func (l loadedCircuits) load(spec string) (*loadedCircuit, error) {
+	var parsed CircuitSpec
+	if err := json.Unmarshal([]byte(spec), &parsed); err != nil {
+		return nil, fmt.Errorf("decoding spec: %v", err)
+	}
+	start := time.Now()
+	var circuit *loadedCircuit
+	if artifactBucket != "" {
+		ccs, pk, err := loadArtifacts(spec)
+		if err != nil {
+			return nil, err
+		}
+		circuit = &loadedCircuit{spec, ccs, pk}
+		if err := circuit.checkCurrent(parsed); err != nil {
+			dropCachedArtifacts(spec)
+			return nil, err
+		}
+	} else {
+		var err error
+		if circuit, err = loadCircuitDir(variantDir(parsed)); err != nil {
+			return nil, err
+		}
+		if circuit.spec != spec {
+			return nil, fmt.Errorf("circuit on disk is for spec %s, not %s", circuit.spec, spec)
+		}
+		if err := circuit.checkCurrent(parsed); err != nil {
+			return nil, err
+		}
+	}
+	l[spec] = circuit
+	slog.Info("Prover worker loaded circuit", "spec", spec, "duration_ms", time.Since(start).Milliseconds())
+	return circuit, nil
+}
+
+// checkCurrent refuses a circuit compiled from a different definition of
+// spec than this build's, whose proofs would not verify against it.
+func (c *loadedCircuit) checkCurrent(spec CircuitSpec) error {
+	current, err := definitionHash(spec)
+	if err != nil {
+		return fmt.Errorf("checking circuit definition of %s: %v", c.spec, err)
+	}
+	if compiled := circuitHash(c.ccs); compiled != current {
+		return fmt.Errorf("circuit for spec %s is stale: compiled %s, this build defines %s", c.spec, compiled, current)
+	}
+	return nil
+}
+
+// loadCircuitDir reads whatever circuit was compiled into dir.
+func loadCircuitDir(dir string) (*loadedCircuit, error) {
+	onDisk, err := os.ReadFile(filepath.Join(dir, circuitSpecFile))
+	if err != nil {
+		return nil, fmt.Errorf("no prepared circuit: %v", err)
+	}
+	ccs, err := sdk.ReadCircuitFrom(filepath.Join(dir, "compiledCircuit"))
+	if err != nil {
+		return nil, err
+	}
+	pk, err := sdk.ReadPkFrom(filepath.Join(dir, "pk"))
+	if err != nil {
+		return nil, err
+	}
+	return &loadedCircuit{string(onDisk), ccs, pk}, nil
+}
+
+// runProverWorker serves proofs on socket, one at a time, until stdin closes.
+func runProverWorker(socket string) error {
+	if err := applyProverProfile(); err != nil {
+		return err
+	}
+	if err := loadArtifactSettings(); err != nil {
+		return err
+	}
+	if err := loadWorkerLimits(); err != nil {
+		return err
+	}
+	applyWorkerMemoryLimit()
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		os.Remove(socket)
+		os.Exit(0)
+	}()
+
+	circuits := loadedCircuits{}
+	dirs := preparedVariantDirs()
+	if len(dirs) == 0 {
+		slog.Warn("Prover worker starting cold: no prepared circuit")
+	}
+	for _, dir := range dirs {
+		circuit, err := loadCircuitDir(dir)
+		if err == nil {
+			var parsed CircuitSpec
+			if err = json.Unmarshal([]byte(circuit.spec), &parsed); err == nil {
+				err = circuit.checkCurrent(parsed)
+			}
+		}
+		if err != nil {
+			slog.Warn("Prover worker skipping circuit", "dir", dir, "err", err)
+			continue
+		}
+		circuits[circuit.spec] = circuit
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		serveProve(conn, circuits)
+	}
+}
+
+func serveProve(conn net.Conn, circuits loadedCircuits) {
+	defer conn.Close()
+	var req proveRequest
+	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
+		// Readiness probes connect and close without sending anything.
+		return
+	}
+	proof, err := circuits.prove(req)
+	resp := proveResponse{}
+	if err != nil {
+		resp.Err = err.Error()
+	} else {
+		var buf bytes.Buffer
+		if _, err := proof.WriteTo(&buf); err != nil {
+			resp.Err = err.Error()
+		}
+		resp.Proof = buf.Bytes()
+	}
+	if err := gob.NewEncoder(conn).Encode(resp); err != nil {
+		slog.Error("Error returning proof", "err", err)
+	}
+}
+
+func (l loadedCircuits) prove(req proveRequest) (plonk.Proof, error) {
+	circuit := l[req.Spec]
+	if circuit == nil {
+		var err error
+		if circuit, err = l.load(req.Spec); err != nil {
+			return nil, err
+		}
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(req.Witness); err != nil {
+		return nil, fmt.Errorf("decoding witness: %v", err)
+	}
+	return proveWith(circuit.ccs, circuit.pk, w)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxQueryBody bounds the /submit-proof request body.
+const maxQueryBody = 1 << 20
+
+// storageQuery is one slot to prove: the slot of contract at block_number.
+type storageQuery struct {
+	Contract    string `json:"contract" openapi:"Address,required"`
+	Slot        string `json:"slot" openapi:"Slot,required"`
+	BlockNumber uint64 `json:"block_number" openapi:"BlockNumber,required"`
+}
+
+// receiptQuery is one event log to prove: the log at position LogIndex in
+// the receipt of TxHash. LogIndex counts logs within the transaction, not
+// the block. Topics, if given, are the log's expected leading topics,
+// starting with the event ID, and are checked before proving.
+type receiptQuery struct {
+	TxHash   common.Hash   `json:"tx_hash" openapi:",required"`
+	LogIndex uint          `json:"log_index"`
+	Topics   []common.Hash `json:"topics,omitempty"`
+}
+
+// queryBody is the /submit-proof request body. Slots of one contract at one
+// block are given as contract, slots and block_number; queries lists slots
+// of any contract and block. Both may be used together. Receipts lists the
+// event logs of circuits that read receipts.
+type queryBody struct {
+	Contract    string         `json:"contract" openapi:"Address"`
+	Slots       []string       `json:"slots" openapi:"Slot"`
+	BlockNumber uint64         `json:"block_number" openapi:"BlockNumber"`
+	Queries     []storageQuery `json:"queries" openapi:"StorageQuery"`
+	Receipts    []receiptQuery `json:"receipts" openapi:"ReceiptQuery"`
+}
+
+// parseQueries reads the storage and receipt queries of a /submit-proof
+// body. An empty body has none.
+func parseQueries(r *http.Request) ([]sdk.StorageData, []receiptQuery, error) {
+	if r.Body == nil {
+		return nil, nil, nil
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxQueryBody))
+	dec.DisallowUnknownFields()
+	var body queryBody
+	if err := dec.Decode(&body); errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	if err := checkReceipts(body.Receipts); err != nil {
+		return nil, nil, err
+	}
+
+	all := body.Queries
+	if len(body.Slots) > 0 || body.Contract != "" {
+		if body.Contract == "" || len(body.Slots) == 0 {
+			return nil, nil, fmt.Errorf("contract and slots must be given together")
+		}
+		for _, slot := range body.Slots {
+			all = append(all, storageQuery{body.Contract, slot, body.BlockNumber})
+		}
+	}
+	queries, err := storageData(all)
+	if err != nil {
+		return nil, nil, err
+	}
+	return queries, body.Receipts, nil
+}
+
+// checkReceipts refuses receipt queries without a transaction, with more
+// topics than a log has, or given twice.
+func checkReceipts(receipts []receiptQuery) error {
+	seen := map[receiptKey]bool{}
+	for i, q := range receipts {
+		if q.TxHash == (common.Hash{}) {
+			return fmt.Errorf("receipt %d: tx_hash is required", i)
+		}
+		if len(q.Topics) > 4 {
+			return fmt.Errorf("receipt %d: a log has at most 4 topics, got %d", i, len(q.Topics))
+		}
+		// A receipt given twice would be summed twice.
+		if seen[q.key()] {
+			return fmt.Errorf("receipt %d: log %d of %s is already queried", i, q.LogIndex, q.TxHash.Hex())
+		}
+		seen[q.key()] = true
+	}
+	return nil
+}
+
+// storageData reads storage queries as the SDK takes them.
+func storageData(all []storageQuery) ([]sdk.StorageData, error) {
+	queries := make([]sdk.StorageData, len(all))
+	for i, q := range all {
+		addr, err := parseAddress("contract", q.Contract)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %v", i, err)
+		}
+		slot, err := parseSlotKey(q.Slot)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %v", i, err)
+		}
+		if q.BlockNumber == 0 {
+			return nil, fmt.Errorf("query %d: block_number is required", i)
+		}
+		queries[i] = sdk.StorageData{
+			BlockNum: new(big.Int).SetUint64(q.BlockNumber),
+			Address:  addr,
+			Slot:     slot,
+		}
+	}
+	return queries, nil
+}
+
+type receiptKey struct {
+	tx  common.Hash
+	log uint
+}
+
+func (q receiptQuery) key() receiptKey { return receiptKey{q.TxHash, q.LogIndex} }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clientLimits bound one client's request rate and proofs. Zero leaves the
+// limit off.
+type clientLimits struct {
+	// RateLimit is the requests a minute the client's bucket refills with;
+	// RateBurst is the bucket's size.
+	RateLimit int `json:"rate_limit,omitempty"`
+	RateBurst int `json:"rate_burst,omitempty"`
+	// DailyProofs and MonthlyProofs cap the proofs submitted per UTC day
+	// and month.
+	DailyProofs   int `json:"daily_proof_quota,omitempty"`
+	MonthlyProofs int `json:"monthly_proof_quota,omitempty"`
+	// DailySpend and MonthlySpend cap the Brevis fees of the key's proofs
+	// per UTC day and month, in the fee token's smallest unit, within the
+	// service's own caps. Jobs past them are held. They are only set on
+	// API keys.
+	DailySpend   *big.Int `json:"daily_spend_cap,omitempty"`
+	MonthlySpend *big.Int `json:"monthly_spend_cap,omitempty"`
+}
+
+var (
+	// defaultLimits apply to every client whose API key sets none of its
+	// own, and to callers without a key, each address its own client.
+	defaultLimits = clientLimits{RateBurst: 10}
+	// keyLimits are the limits config API keys override the defaults with,
+	// by key name, set by loadAPIKeys.
+	keyLimits = map[string]clientLimits{}
+)
+
+// loadQuotas reads BREVIS_RATE_LIMIT, BREVIS_RATE_BURST,
+// BREVIS_DAILY_PROOF_QUOTA and BREVIS_MONTHLY_PROOF_QUOTA, and checks the
+// limits of config API keys against them. It runs after loadAPIKeys.
+func loadQuotas() error {
+	var err error
+	for name, v := range map[string]*int{
+		"BREVIS_RATE_LIMIT":          &defaultLimits.RateLimit,
+		"BREVIS_RATE_BURST":          &defaultLimits.RateBurst,
+		"BREVIS_DAILY_PROOF_QUOTA":   &defaultLimits.DailyProofs,
+		"BREVIS_MONTHLY_PROOF_QUOTA": &defaultLimits.MonthlyProofs,
+	} {
+		if *v, err = envInt(name, *v); err != nil {
+			return err
+		}
+		if *v < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", name, *v)
+		}
+	}
+	// A rate with an empty bucket would refuse every request.
+	if defaultLimits.RateLimit > 0 && defaultLimits.RateBurst < 1 {
+		return fmt.Errorf("BREVIS_RATE_BURST must be at least 1 with BREVIS_RATE_LIMIT set, got %d", defaultLimits.RateBurst)
+	}
+	for name := range keyLimits {
+		if l := limitsFor(name); l.RateLimit > 0 && l.RateBurst < 1 {
+			return fmt.Errorf("API key %s: rate_burst must be at least 1 with a rate limit, got %d", name, l.RateBurst)
+		}
+	}
+	return nil
+}
+
+// limitsFor returns a client's limits: its key's where set, else the
+// defaults.
+func limitsFor(client string) clientLimits {
+	l := defaultLimits
+	k := keyLimits[client]
+	if k.RateLimit != 0 {
+		l.RateLimit = k.RateLimit
+	}
+	if k.RateBurst != 0 {
+		l.RateBurst = k.RateBurst
+	}
+	if k.DailyProofs != 0 {
+		l.DailyProofs = k.DailyProofs
+	}
+	if k.MonthlyProofs != 0 {
+		l.MonthlyProofs = k.MonthlyProofs
+	}
+	l.DailySpend, l.MonthlySpend = k.DailySpend, k.MonthlySpend
+	return l
+}
+
+// clientFor names who a request counts against: its API key, or without
+// one its remote address.
+func clientFor(r *http.Request) string {
+	if name := apiKeyName(r.Context()); name != "" {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// tokenBucket holds a client's unspent requests.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets bounds the clients tracked at once; past it, full buckets,
+// which are no different from new ones, are dropped.
+const maxBuckets = 10000
+
+var (
+	buckets     = map[string]*tokenBucket{}
+	bucketMutex sync.Mutex
+)
+
+// refill tops b up for the time since it was last used, returning its
+// tokens.
+func (b *tokenBucket) refill(l clientLimits, now time.Time) float64 {
+	b.tokens = math.Min(float64(l.RateBurst), b.tokens+now.Sub(b.last).Minutes()*float64(l.RateLimit))
+	b.last = now
+	return b.tokens
+}
+
+// takeToken spends one of client's requests, or returns how long until one
+// is available.
+func takeToken(client string) (time.Duration, bool) {
+	l := limitsFor(client)
+	if l.RateLimit == 0 {
+		return 0, true
+	}
+	bucketMutex.Lock()
+	defer bucketMutex.Unlock()
+	now := time.Now()
+	b, ok := buckets[client]
+	if !ok {
+		if len(buckets) >= maxBuckets {
+			for c, old := range buckets {
+				if old.refill(limitsFor(c), now) >= float64(limitsFor(c).RateBurst) {
+					delete(buckets, c)
+				}
+			}
+		}
+		b = &tokenBucket{tokens: float64(l.RateBurst), last: now}
+		buckets[client] = b
+	}
+	if b.refill(l, now) < 1 {
+		return time.Duration((1 - b.tokens) / float64(l.RateLimit) * float64(time.Minute)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// withRateLimit refuses a client's requests past its rate limit with 429.
+// Health checks and metrics are not limited.
+func withRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeScope(r) == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := clientFor(r)
+		if wait, ok := takeToken(client); !ok {
+			rateLimitedTotal.WithLabelValues("rate").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, fmt.Sprintf("Rate limit of %d requests a minute exceeded; try again later", limitsFor(client).RateLimit), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// quotaCap is client's proof quota in period under l, or 0 when it has
+// none.
+func quotaCap(l clientLimits, period string) int {
+	if period == "daily" {
+		return l.DailyProofs
+	}
+	return l.MonthlyProofs
+}
+
+var oneProof = big.NewInt(1)
+
+// useProofQuota counts a submitted proof against client's quotas, or
+// refuses it with 429 once one is used up. Proofs are counted with spend,
+// in the request store when there is one, so every replica counts against
+// the same quota.
+func useProofQuota(ctx context.Context, client string) error {
+	l := proofLimitsFor(ctx, client)
+	if l.DailyProofs == 0 && l.MonthlyProofs == 0 {
+		return nil
+	}
+	now := time.Now()
+	var counted []usageKey
+	for _, period := range usagePeriods {
+		k := newUsageKey(usageProofs, client, period, now)
+		var limit *big.Int
+		c := quotaCap(l, period)
+		if c > 0 {
+			limit = big.NewInt(int64(c))
+		}
+		_, ok, err := addUsage(ctx, k, oneProof, limit)
+		if err == nil && !ok {
+			rateLimitedTotal.WithLabelValues("quota").Inc()
+			err = &statusError{http.StatusTooManyRequests, fmt.Errorf("%s proof quota of %d is used up until %s", period, c, periodEnd(period, k.start).Format(time.RFC3339))}
+		}
+		if err != nil {
+			for _, k := range counted {
+				subtractUsage(ctx, k, oneProof)
+			}
+			return err
+		}
+		counted = append(counted, k)
+	}
+	return nil
+}
+
+// releaseProofQuota gives back a proof useProofQuota counted that was never
+// started.
+func releaseProofQuota(ctx context.Context, client string) {
+	l := proofLimitsFor(ctx, client)
+	if l.DailyProofs == 0 && l.MonthlyProofs == 0 {
+		return
+	}
+	now := time.Now()
+	for _, period := range usagePeriods {
+		if err := subtractUsage(ctx, newUsageKey(usageProofs, client, period, now), oneProof); err != nil {
+			slog.ErrorContext(ctx, "Error releasing proof quota", "client", client, "period", period, "err", err)
+		}
+	}
+}
+
+// setQuotaRetryAfter tells the client of r, refused for quota, when its
+// used up periods have all reset.
+func setQuotaRetryAfter(w http.ResponseWriter, r *http.Request) {
+	client := clientFor(r)
+	l := proofLimitsFor(r.Context(), client)
+	now := time.Now()
+	var wait time.Duration
+	for _, period := range usagePeriods {
+		k := newUsageKey(usageProofs, client, period, now)
+		c := quotaCap(l, period)
+		if c == 0 {
+			continue
+		}
+		if used, err := readUsage(r.Context(), k); err == nil && used.Cmp(big.NewInt(int64(c))) >= 0 {
+			wait = max(wait, time.Until(periodEnd(period, k.start)))
+		}
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	}
+}
+
+// quotaView is one period of GET /quota. Quota and Remaining are omitted
+// when the period is unlimited.
+type quotaView struct {
+	Period    string    `json:"period"`
+	Quota     int       `json:"quota,omitempty"`
+	Used      int       `json:"used"`
+	Remaining *int      `json:"remaining,omitempty"`
+	Resets    time.Time `json:"resets"`
+}
+
+// handleQuota reports the caller's rate limit and remaining proofs.
+func handleQuota(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	client := clientFor(r)
+	l := proofLimitsFor(r.Context(), client)
+	now := time.Now()
+
+	rate := map[string]interface{}{"limit_per_minute": l.RateLimit}
+	if l.RateLimit > 0 {
+		tokens := float64(l.RateBurst)
+		bucketMutex.Lock()
+		if b, ok := buckets[client]; ok {
+			tokens = b.refill(l, now)
+		}
+		bucketMutex.Unlock()
+		rate["burst"], rate["available"] = l.RateBurst, int(tokens)
+	}
+
+	var proofs []quotaView
+	for _, period := range usagePeriods {
+		k := newUsageKey(usageProofs, client, period, now)
+		used, err := readUsage(r.Context(), k)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		v := quotaView{Period: period, Quota: quotaCap(l, period), Used: int(used.Int64()), Resets: periodEnd(period, k.start)}
+		if v.Quota > 0 {
+			remaining := max(v.Quota-v.Used, 0)
+			v.Remaining = &remaining
+		}
+		proofs = append(proofs, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"client": client,
+		"rate":   rate,
+		"proofs": proofs,
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// defaultMaxReceipts is the receipt allocation of a receipt emissions circuit
+// that does not set max_receipts.
+const defaultMaxReceipts = 32
+
+// ReceiptEmissionsParams identify the event reporting each emission and
+// which of its fields holds the amount.
+type ReceiptEmissionsParams struct {
+	Emitter common.Address `json:"emitter"`
+	EventID common.Hash    `json:"event_id"`
+	// AmountIndex is the position of the amount among the event's topics if
+	// AmountIsTopic, otherwise among its data fields.
+	AmountIndex   int  `json:"amount_index"`
+	AmountIsTopic bool `json:"amount_is_topic,omitempty"`
+	// MaxReceipts is the receipt allocation the circuit compiles to.
+	MaxReceipts int `json:"max_receipts"`
+}
+
+func parseReceiptEmissionsParams(q url.Values) (*ReceiptEmissionsParams, error) {
+	for _, name := range []string{"emitter", "event_id"} {
+		if q.Get(name) == "" {
+			return nil, fmt.Errorf("circuit %q requires %s", CircuitReceiptEmissions, name)
+		}
+	}
+	emitter, err := parseAddress("emitter", q.Get("emitter"))
+	if err != nil {
+		return nil, err
+	}
+	eventID, err := parseHash("event_id", q.Get("event_id"))
+	if err != nil {
+		return nil, err
+	}
+	p := &ReceiptEmissionsParams{
+		Emitter:     emitter,
+		EventID:     eventID,
+		MaxReceipts: defaultMaxReceipts,
+	}
+	if p.AmountIndex, err = intParam(q, "amount_index"); err != nil {
+		return nil, err
+	}
+	if v := q.Get("amount_is_topic"); v != "" {
+		if p.AmountIsTopic, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid amount_is_topic %q: %v", v, err)
+		}
+	}
+	if q.Get("max_receipts") != "" {
+		if p.MaxReceipts, err = intParam(q, "max_receipts"); err != nil {
+			return nil, err
+		}
+	}
+	return p, p.validate()
+}
+
+func (p *ReceiptEmissionsParams) validate() error {
+	if p.AmountIndex < 0 {
+		return fmt.Errorf("amount_index must not be negative, got %d", p.AmountIndex)
+	}
+	// Topic 0 is the event ID.
+	if p.AmountIsTopic && (p.AmountIndex < 1 || p.AmountIndex > 3) {
+		return fmt.Errorf("amount_index of a topic must be between 1 and 3, got %d", p.AmountIndex)
+	}
+	if !validSlots(p.MaxReceipts) {
+		return fmt.Errorf("max_receipts must be a power of two from %d to %d, got %d", minSlots, maxSlots, p.MaxReceipts)
+	}
+	return nil
+}
+
+// ReceiptEmissionsCircuit sums the amounts of emissions events read from
+// transaction receipts. Each receipt carries one event amount as its first
+// field.
+//
+// As with StockFlowCircuit, the circuit proves the supplied events were
+// emitted and sum to the output, not that no event was left out. Duplicate
+// receipt queries are rejected before proving.
+type ReceiptEmissionsCircuit struct {
+	ReceiptEmissionsParams
+}
+
+var _ sdk.AppCircuit = &ReceiptEmissionsCircuit{}
+
+func (c *ReceiptEmissionsCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return c.MaxReceipts, 0, 0
+}
+
+func (c *ReceiptEmissionsCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u248 := api.Uint248
+	emitter := sdk.ConstUint248(c.Emitter)
+	eventID := sdk.ParseEventID(c.EventID[:])
+	isTopic := sdk.ConstUint248(0)
+	if c.AmountIsTopic {
+		isTopic = sdk.ConstUint248(1)
+	}
+
+	receipts := sdk.NewDataStream(api, in.Receipts)
+	sdk.AssertEach(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		f := r.Fields[0]
+		return u248.And(
+			u248.IsEqual(f.Contract, emitter),
+			u248.IsEqual(f.EventID, eventID),
+			u248.IsEqual(f.IsTopic, isTopic),
+			u248.IsEqual(f.Index, sdk.ConstUint248(c.AmountIndex)),
+		)
+	})
+	total := sdk.Sum(sdk.Map(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		return api.ToUint248(r.Fields[0].Value)
+	}))
+
+	api.OutputAddress(emitter)
+	api.OutputUint(32, sdk.Count(receipts))
+	api.OutputUint(248, total)
+	return nil
+}
+
+// receiptEvent is the event the spec's circuit reads from receipts, or nil
+// for circuits that only read storage.
+func (s CircuitSpec) receiptEvent() *ReceiptEmissionsParams {
+	switch s.Circuit {
+	case CircuitReceiptEmissions:
+		return s.ReceiptEmissions
+	case CircuitStockFlow:
+		// StockFlowCircuit allocates 32 receipts.
+		return &ReceiptEmissionsParams{Emitter: s.StockFlow.Registry, EventID: s.StockFlow.EventID, AmountIndex: s.StockFlow.AmountIndex, MaxReceipts: 32}
+	}
+	return nil
+}
+
+// checkQueryKinds rejects queries of a kind the spec's circuit does not read.
+func checkQueryKinds(spec CircuitSpec, storage, receipts int) error {
+	switch {
+	case spec.receiptEvent() == nil && receipts > 0:
+		return fmt.Errorf("circuit %q does not read receipts", spec.Circuit)
+	case spec.Circuit == CircuitReceiptEmissions && storage > 0:
+		return fmt.Errorf("circuit %q does not read storage", spec.Circuit)
+	}
+	return nil
+}
+
+// fetchReceipts checks that each queried log is the event the circuit reads,
+// with the expected topics, and returns the receipt queries to add to the
+// app. The SDK fetches the rest of each receipt as it builds the input.
+func fetchReceipts(ctx context.Context, rpcURL string, event *ReceiptEmissionsParams, qs []receiptQuery) ([]sdk.ReceiptData, error) {
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+
+	data := make([]sdk.ReceiptData, len(qs))
+	for i, q := range qs {
+		receipt, err := withRetry(ctx, "receipt query", func() (*types.Receipt, error) {
+			return ec.TransactionReceipt(ctx, q.TxHash)
+		})
+		if errors.Is(err, ethereum.NotFound) {
+			return nil, &statusError{http.StatusUnprocessableEntity, fmt.Errorf("receipt %d: transaction %s not found", i, q.TxHash.Hex())}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching receipt of %s: %w", q.TxHash.Hex(), err)
+		}
+		if q.LogIndex >= uint(len(receipt.Logs)) {
+			return nil, &statusError{http.StatusUnprocessableEntity, fmt.Errorf("receipt %d: transaction %s has %d logs, no log %d", i, q.TxHash.Hex(), len(receipt.Logs), q.LogIndex)}
+		}
+		l := receipt.Logs[q.LogIndex]
+		if problem := checkEventLog(event, q, l.Address, l.Topics, len(l.Data)); problem != "" {
+			return nil, &statusError{http.StatusUnprocessableEntity, fmt.Errorf("receipt %d: log %d of %s %s", i, q.LogIndex, q.TxHash.Hex(), problem)}
+		}
+		data[i] = sdk.ReceiptData{
+			TxHash:   q.TxHash,
+			BlockNum: receipt.BlockNumber,
+			Fields: []sdk.LogFieldData{{
+				Contract:   event.Emitter,
+				EventID:    event.EventID,
+				LogPos:     q.LogIndex,
+				IsTopic:    event.AmountIsTopic,
+				FieldIndex: uint(event.AmountIndex),
+			}},
+		}
+	}
+	return data, nil
+}
+
+// checkEventLog returns why a log is not the queried emissions event, or "".
+func checkEventLog(event *ReceiptEmissionsParams, q receiptQuery, emitter common.Address, topics []common.Hash, dataLen int) string {
+	if emitter != event.Emitter {
+		return fmt.Sprintf("was emitted by %s, not %s", emitter.Hex(), event.Emitter.Hex())
+	}
+	if len(topics) == 0 || topics[0] != event.EventID {
+		return fmt.Sprintf("is not event %s", event.EventID.Hex())
+	}
+	for j, want := range q.Topics {
+		if j >= len(topics) || topics[j] != want {
+			return fmt.Sprintf("does not have topic %d %s", j, want.Hex())
+		}
+	}
+	if event.AmountIsTopic && event.AmountIndex >= len(topics) {
+		return fmt.Sprintf("has %d topics, no amount topic %d", len(topics), event.AmountIndex)
+	}
+	if !event.AmountIsTopic && (event.AmountIndex+1)*32 > dataLen {
+		return fmt.Sprintf("has %d data bytes, no amount field %d", dataLen, event.AmountIndex)
+	}
+	return ""
+}
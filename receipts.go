@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	receiptPollInterval = 3 * time.Second
+	receiptTimeout      = 2 * time.Minute
+)
+
+// TxReceipt is the part of a transaction receipt reported in results.
+type TxReceipt struct {
+	Hash              string `json:"hash"`
+	Status            string `json:"status"`
+	GasUsed           uint64 `json:"gas_used"`
+	EffectiveGasPrice string `json:"effective_gas_price"`
+	BlockNumber       uint64 `json:"block_number"`
+}
+
+// waitForReceipt polls rpcURL until the transaction is mined or
+// receiptTimeout passes.
+func waitForReceipt(ctx context.Context, rpcURL string, hash common.Hash) (*TxReceipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, receiptTimeout)
+	defer cancel()
+
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+
+	t := time.NewTicker(receiptPollInterval)
+	defer t.Stop()
+	for {
+		receipt, err := withRetry(ctx, "fulfillment receipt", func() (*types.Receipt, error) {
+			return ec.TransactionReceipt(ctx, hash)
+		})
+		if err == nil {
+			return newTxReceipt(receipt), nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, fmt.Errorf("fetching receipt of %s: %w", hash.Hex(), err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for receipt of %s: %v", hash.Hex(), ctx.Err())
+		}
+	}
+}
+
+func newTxReceipt(r *types.Receipt) *TxReceipt {
+	status := "failed"
+	if r.Status == types.ReceiptStatusSuccessful {
+		status = "success"
+	}
+	gasPrice := "0"
+	if r.EffectiveGasPrice != nil {
+		gasPrice = r.EffectiveGasPrice.String()
+	}
+	var block uint64
+	if r.BlockNumber != nil {
+		block = r.BlockNumber.Uint64()
+	}
+	return &TxReceipt{
+		Hash:              r.TxHash.Hex(),
+		Status:            status,
+		GasUsed:           r.GasUsed,
+		EffectiveGasPrice: gasPrice,
+		BlockNumber:       block,
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk/eth"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// reconcileInterval is how often finalized jobs are cross-checked against
+// the chain. Zero disables the schedule; POST /admin/reconciliation still
+// runs it on demand.
+var reconcileInterval = 24 * time.Hour
+
+// maxReconcileReports is how many reports /admin/reconciliation keeps.
+const maxReconcileReports = 30
+
+// reconcileMismatch is a finalized job the chain disagrees with.
+type reconcileMismatch struct {
+	JobID       string `json:"job_id"`
+	RequestID   string `json:"request_id,omitempty"`
+	Transaction string `json:"transaction,omitempty"`
+	Problem     string `json:"problem"`
+}
+
+// reconcileReport is the outcome of one reconciliation run. Jobs that could
+// not be checked, such as on an RPC error, are listed under Errors rather
+// than counted as mismatches.
+type reconcileReport struct {
+	Started    time.Time           `json:"started"`
+	Finished   time.Time           `json:"finished"`
+	Checked    int                 `json:"checked"`
+	Matched    int                 `json:"matched"`
+	Mismatches []reconcileMismatch `json:"mismatches"`
+	Errors     []reconcileMismatch `json:"errors,omitempty"`
+}
+
+var (
+	reconcileReports []reconcileReport
+	reconcileMutex   sync.Mutex
+	// reconcileRun serializes scheduled and on-demand runs.
+	reconcileRun sync.Mutex
+)
+
+// recordedFulfillment is what a finalized job's result says happened on chain.
+type recordedFulfillment struct {
+	RequestID          string     `json:"request_id"`
+	Transaction        string     `json:"transaction"`
+	TransactionReceipt *TxReceipt `json:"transaction_receipt"`
+}
+
+// reconcileJobs runs reconciliation every reconcileInterval.
+func reconcileJobs(ctx context.Context) {
+	if reconcileInterval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconcileInterval):
+		}
+		reconcile(ctx)
+	}
+}
+
+// reconcile checks every succeeded job against its fulfillment transaction:
+// that it is still on chain in the recorded block, did not revert, emitted
+// RequestFulfilled for the job's request, and the callback did not fail.
+func reconcile(ctx context.Context) reconcileReport {
+	reconcileRun.Lock()
+	defer reconcileRun.Unlock()
+
+	report := reconcileReport{Started: time.Now().UTC(), Mismatches: []reconcileMismatch{}}
+	jobsMutex.Lock()
+	var finalized []*job
+	for _, j := range jobs {
+		if j.Status == JobSucceeded {
+			finalized = append(finalized, j)
+		}
+	}
+	jobsMutex.Unlock()
+
+	// Fulfillments land on each job's destination chain.
+	clients := map[uint64]*ethclient.Client{}
+	dialErrs := map[uint64]error{}
+	for _, j := range finalized {
+		chainID := j.Options.DstChainID
+		ec, ok := clients[chainID]
+		if !ok && dialErrs[chainID] == nil {
+			var err error
+			if ec, err = ethclient.DialContext(ctx, pickChainRPC(chainID)); err != nil {
+				dialErrs[chainID] = err
+			} else {
+				clients[chainID] = ec
+				defer ec.Close()
+			}
+		}
+		if err := dialErrs[chainID]; err != nil {
+			report.Errors = append(report.Errors, reconcileMismatch{JobID: j.ID, Problem: fmt.Sprintf("dialing RPC of chain %d: %v", chainID, err)})
+			continue
+		}
+		report.Checked++
+		m, err := reconcileJob(ctx, ec, j)
+		switch {
+		case err != nil:
+			m.Problem = err.Error()
+			report.Errors = append(report.Errors, m)
+		case m.Problem != "":
+			slog.WarnContext(withCorrelationID(ctx, j.CorrelationID), "Reconciliation mismatch", "job", m.JobID, "request", m.RequestID, "problem", m.Problem)
+			report.Mismatches = append(report.Mismatches, m)
+		default:
+			report.Matched++
+		}
+	}
+	report.Finished = time.Now().UTC()
+	slog.InfoContext(ctx, "Reconciled finalized jobs", "jobs", len(finalized), "matched", report.Matched, "mismatched", len(report.Mismatches), "unchecked", len(report.Errors))
+
+	reconcileMutex.Lock()
+	reconcileReports = append(reconcileReports, report)
+	if len(reconcileReports) > maxReconcileReports {
+		reconcileReports = reconcileReports[len(reconcileReports)-maxReconcileReports:]
+	}
+	reconcileMutex.Unlock()
+	return report
+}
+
+// reconcileJob returns j with Problem set if the chain disagrees with it, or
+// an error if it could not be checked.
+func reconcileJob(ctx context.Context, ec *ethclient.Client, j *job) (reconcileMismatch, error) {
+	m := reconcileMismatch{JobID: j.ID}
+	jobsMutex.Lock()
+	b, err := json.Marshal(j.Result)
+	jobsMutex.Unlock()
+	if err != nil {
+		return m, err
+	}
+	// Results restored from a checkpoint hold decoded JSON rather than the
+	// original types, so both are read back through JSON.
+	var rec recordedFulfillment
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return m, fmt.Errorf("reading job result: %v", err)
+	}
+	m.RequestID, m.Transaction = rec.RequestID, rec.Transaction
+	if rec.Transaction == "" {
+		m.Problem = "finalized without a fulfillment transaction"
+		return m, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	receipt, err := ec.TransactionReceipt(ctx, common.HexToHash(rec.Transaction))
+	if errors.Is(err, ethereum.NotFound) {
+		m.Problem = "fulfillment transaction not found on chain"
+		return m, nil
+	}
+	if err != nil {
+		return m, fmt.Errorf("fetching receipt of %s: %v", rec.Transaction, err)
+	}
+	m.Problem = checkFulfillment(rec, receipt, j.Options.DstChainID)
+	return m, nil
+}
+
+var (
+	brevisRequestABI     *abi.ABI
+	brevisRequestABIOnce sync.Once
+)
+
+// checkFulfillment compares a fulfillment receipt with what was recorded,
+// returning the first disagreement or "". chainID is the chain it landed on.
+func checkFulfillment(rec recordedFulfillment, receipt *types.Receipt, chainID uint64) string {
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return "fulfillment transaction reverted"
+	}
+	if rec.TransactionReceipt != nil && receipt.BlockNumber != nil && receipt.BlockNumber.Uint64() != rec.TransactionReceipt.BlockNumber {
+		return fmt.Sprintf("fulfillment transaction mined in block %d, recorded in block %d", receipt.BlockNumber, rec.TransactionReceipt.BlockNumber)
+	}
+
+	brevisRequestABIOnce.Do(func() {
+		var err error
+		if brevisRequestABI, err = eth.BrevisRequestMetaData.GetAbi(); err != nil {
+			slog.Error("Error parsing BrevisRequest ABI", "err", err)
+		}
+	})
+	if brevisRequestABI == nil {
+		return ""
+	}
+	fulfilled := brevisRequestABI.Events["RequestFulfilled"]
+	callbackFailed := brevisRequestABI.Events["RequestCallbackFailed"]
+	brevisRequest := contractRegistry[chainID].BrevisRequest
+
+	var sawFulfilled, sawCallbackFailed bool
+	for _, l := range receipt.Logs {
+		if len(l.Topics) == 0 || brevisRequest != (common.Address{}) && l.Address != brevisRequest {
+			continue
+		}
+		var event abi.Event
+		switch l.Topics[0] {
+		case fulfilled.ID:
+			event = fulfilled
+		case callbackFailed.ID:
+			event = callbackFailed
+		default:
+			continue
+		}
+		values, err := event.Inputs.Unpack(l.Data)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		proofID, ok := values[0].([32]byte)
+		if !ok || common.Hash(proofID) != common.HexToHash(rec.RequestID) {
+			continue
+		}
+		if event.ID == fulfilled.ID {
+			sawFulfilled = true
+		} else {
+			sawCallbackFailed = true
+		}
+	}
+	switch {
+	case !sawFulfilled:
+		return fmt.Sprintf("no RequestFulfilled event for request %s", rec.RequestID)
+	case sawCallbackFailed:
+		return "callback failed"
+	}
+	return ""
+}
+
+// handleAdminReconciliation lists the most recent reconciliation reports,
+// newest last. POST runs a reconciliation now and returns its report.
+func handleAdminReconciliation(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		json.NewEncoder(w).Encode(reconcile(r.Context()))
+		return
+	}
+
+	reconcileMutex.Lock()
+	reports := append([]reconcileReport{}, reconcileReports...)
+	reconcileMutex.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval": reconcileInterval.String(),
+		"reports":  reports,
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// circuitRegistryFile persists the registry across restarts.
+var circuitRegistryFile = "./brevis-registry.json"
+
+// registeredCircuit is a named circuit and every version registered under
+// the name. Versions are never changed or removed once registered.
+type registeredCircuit struct {
+	Name     string           `json:"name"`
+	Versions []circuitVersion `json:"versions"`
+	// Active is the version requests naming the circuit are proven with;
+	// zero until one is promoted.
+	Active int `json:"active,omitempty"`
+}
+
+type circuitVersion struct {
+	Version    int         `json:"version"`
+	Spec       CircuitSpec `json:"spec"`
+	Registered time.Time   `json:"registered"`
+	Compiled   *time.Time  `json:"compiled,omitempty"`
+	Promoted   *time.Time  `json:"promoted,omitempty"`
+	// OutputSchema is the output schema version the version was compiled
+	// under; its proofs decode with that version's layout.
+	OutputSchema int `json:"output_schema,omitempty"`
+}
+
+var (
+	circuitRegistry = map[string]*registeredCircuit{}
+	registryMutex   sync.Mutex
+)
+
+var circuitNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// loadRegistry reads the registry saved by a previous run, if any.
+func loadRegistry() error {
+	b, err := os.ReadFile(circuitRegistryFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &circuitRegistry); err != nil {
+		return fmt.Errorf("reading %s: %v", circuitRegistryFile, err)
+	}
+	slog.Info("Loaded registered circuits", "circuits", len(circuitRegistry), "path", circuitRegistryFile)
+	return nil
+}
+
+// saveRegistry writes the registry, replacing the old file only once the
+// new one is complete. The caller holds registryMutex.
+func saveRegistry() error {
+	b, err := json.MarshalIndent(circuitRegistry, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := circuitRegistryFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, circuitRegistryFile)
+}
+
+// activeCircuitSpec returns the spec of the named circuit's active version.
+func activeCircuitSpec(name string) (CircuitSpec, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	c, ok := circuitRegistry[name]
+	if !ok {
+		return CircuitSpec{}, fmt.Errorf("no registered circuit %q", name)
+	}
+	if c.Active == 0 {
+		return CircuitSpec{}, fmt.Errorf("circuit %q has no promoted version", name)
+	}
+	return c.Versions[c.Active-1].Spec, nil
+}
+
+// requestSpec is the spec a proving request names: the active version of a
+// registered circuit_name, or the spec given inline.
+func requestSpec(r *http.Request) (CircuitSpec, error) {
+	if name := r.URL.Query().Get("circuit_name"); name != "" {
+		return activeCircuitSpec(name)
+	}
+	return parseCircuitSpec(r)
+}
+
+// lookupVersion finds the circuit and version named by the name and
+// version query parameters. The caller holds registryMutex.
+func lookupVersion(r *http.Request) (*registeredCircuit, *circuitVersion, error) {
+	q := r.URL.Query()
+	c, ok := circuitRegistry[q.Get("name")]
+	if !ok {
+		return nil, nil, fmt.Errorf("no registered circuit %q", q.Get("name"))
+	}
+	n, err := strconv.Atoi(q.Get("version"))
+	if err != nil || n < 1 || n > len(c.Versions) {
+		return nil, nil, fmt.Errorf("circuit %q has no version %q", c.Name, q.Get("version"))
+	}
+	return c, &c.Versions[n-1], nil
+}
+
+// handleAdminCircuits lists the registry on GET and registers a new version
+// of the named circuit on POST. The version's spec takes the same
+// parameters as /prepare-download, including slots for a fixed allocation.
+func handleAdminCircuits(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	switch r.Method {
+	case http.MethodGet:
+		registryMutex.Lock()
+		circuits := make([]registeredCircuit, 0, len(circuitRegistry))
+		for _, c := range circuitRegistry {
+			circuits = append(circuits, *c)
+		}
+		registryMutex.Unlock()
+		sort.Slice(circuits, func(i, j int) bool { return circuits[i].Name < circuits[j].Name })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(circuits)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if !circuitNamePattern.MatchString(name) {
+		http.Error(w, fmt.Sprintf("Invalid circuit name %q: want lowercase letters, digits, '-' and '_'", name), http.StatusBadRequest)
+		return
+	}
+	spec, err := parseCircuitSpec(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(spec.variants()) == 0 {
+		http.Error(w, fmt.Sprintf("Invalid circuit spec: no configured circuit size %v fits spec %s", circuitSizes, spec), http.StatusBadRequest)
+		return
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	c, ok := circuitRegistry[name]
+	if !ok {
+		c = &registeredCircuit{Name: name}
+		circuitRegistry[name] = c
+	}
+	v := circuitVersion{Version: len(c.Versions) + 1, Spec: spec, Registered: time.Now()}
+	c.Versions = append(c.Versions, v)
+	if err := saveRegistry(); err != nil {
+		c.Versions = c.Versions[:len(c.Versions)-1]
+		http.Error(w, fmt.Sprintf("Error saving circuit registry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Registered circuit", "circuit", name, "version", v.Version, "spec", spec)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleAdminCircuitCompile compiles a registered version and adds it to the
+// prepared circuits.
+func handleAdminCircuitCompile(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	registryMutex.Lock()
+	_, v, err := lookupVersion(r)
+	var spec CircuitSpec
+	if err == nil {
+		spec = v.Spec
+	}
+	registryMutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// Compiling takes minutes, so the registry is not held meanwhile. A
+	// version registered meanwhile can move the versions slice, so the
+	// version is looked up again afterwards.
+	if _, err := prepareCircuit(r.Context(), spec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	c, v, _ := lookupVersion(r)
+	now := time.Now()
+	v.Compiled, v.OutputSchema = &now, outputSchemaVersion
+	if err := saveRegistry(); err != nil {
+		http.Error(w, fmt.Sprintf("Error saving circuit registry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Compiled circuit", "circuit", c.Name, "version", v.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleAdminCircuitPromote makes a compiled version the one requests
+// naming the circuit are proven with.
+func handleAdminCircuitPromote(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	c, v, err := lookupVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if v.Compiled == nil {
+		http.Error(w, fmt.Sprintf("Circuit %s version %d is not compiled; call /admin/circuits/compile first", c.Name, v.Version), http.StatusConflict)
+		return
+	}
+	previous := c.Active
+	now := time.Now()
+	c.Active, v.Promoted = v.Version, &now
+	if err := saveRegistry(); err != nil {
+		c.Active, v.Promoted = previous, nil
+		http.Error(w, fmt.Sprintf("Error saving circuit registry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Promoted circuit", "circuit", c.Name, "version", v.Version, "previous", previous)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
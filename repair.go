@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quarantineDir keeps artifacts found incomplete or corrupt, for inspection,
+// outside circuitDir so they are never loaded.
+var quarantineDir = circuitDir + "-quarantine"
+
+// partialSuffix marks a variant directory still being compiled. It is
+// renamed into place only once every artifact is written.
+const partialSuffix = ".partial"
+
+// repairCircuitDir quarantines everything in circuitDir a failed or
+// interrupted compile could have left behind: partial directories, variant
+// directories missing an artifact or holding an empty one, and files from
+// before variants had directories of their own. It returns what it moved.
+//
+// The SRS in srsDir needs no repair: fetchSRS checks its checksum before
+// the first compile and downloads it again when the check fails.
+func repairCircuitDir() ([]string, error) {
+	entries, err := os.ReadDir(circuitDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, e := range entries {
+		path := filepath.Join(circuitDir, e.Name())
+		reason := ""
+		switch {
+		case e.Name() == preparedSpecFile:
+			continue
+		case !e.IsDir():
+			reason = "not a variant directory"
+		case strings.HasSuffix(e.Name(), partialSuffix):
+			reason = "compile did not finish"
+		default:
+			if reason = checkVariantDir(path); reason == "" {
+				reason = checkVariantPath(path)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		if err := quarantine(path); err != nil {
+			return moved, err
+		}
+		slog.Warn("Quarantined circuit artifacts", "path", path, "reason", reason)
+		moved = append(moved, e.Name())
+	}
+	return moved, nil
+}
+
+// checkVariantDir returns why dir does not hold a complete variant, or "".
+func checkVariantDir(dir string) string {
+	for _, name := range artifactFiles {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Sprintf("missing %s", name)
+		}
+		if info.Size() == 0 {
+			return fmt.Sprintf("empty %s", name)
+		}
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, circuitSpecFile))
+	var spec CircuitSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return fmt.Sprintf("unreadable %s: %v", circuitSpecFile, err)
+	}
+	return ""
+}
+
+// checkVariantPath returns why the complete variant in dir is not where its
+// spec compiles to, as variants compiled before each spec had a directory
+// of its own are not, or "".
+func checkVariantPath(dir string) string {
+	b, _ := os.ReadFile(filepath.Join(dir, circuitSpecFile))
+	var spec CircuitSpec
+	json.Unmarshal(b, &spec)
+	if want := variantDir(spec); filepath.Clean(dir) != filepath.Clean(want) {
+		return fmt.Sprintf("belongs in %s", filepath.Base(want))
+	}
+	return ""
+}
+
+func quarantine(path string) error {
+	if err := os.MkdirAll(quarantineDir, os.ModePerm); err != nil {
+		return err
+	}
+	dest := filepath.Join(quarantineDir, fmt.Sprintf("%s-%d", filepath.Base(path), time.Now().UnixNano()))
+	return os.Rename(path, dest)
+}
+
+// installVariant replaces dir with the fully written partial directory.
+func installVariant(partial, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(partial, dir)
+}
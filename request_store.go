@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Lifecycle statuses of a stored request. Expired and failed end it like
+// finalized does.
+const (
+	RequestCreated   = "created"
+	RequestProven    = "proven"
+	RequestSubmitted = "submitted"
+	RequestFinalized = "finalized"
+	RequestExpired   = "expired"
+	RequestFailed    = "failed"
+)
+
+// requestStoreURL is where request history is kept: sqlite:<path> or a
+// postgres:// URL. "off" keeps none.
+var requestStoreURL = "sqlite:./brevis-requests.db"
+
+var requestDB *sql.DB
+
+// storeTimeLayout is fixed width so stored times sort as text.
+const storeTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+const requestSchema = `CREATE TABLE IF NOT EXISTS proof_requests (
+	id TEXT PRIMARY KEY,
+	correlation_id TEXT NOT NULL DEFAULT '',
+	api_key TEXT NOT NULL DEFAULT '',
+	chain_id BIGINT NOT NULL,
+	spec TEXT NOT NULL,
+	status TEXT NOT NULL,
+	request_id TEXT NOT NULL DEFAULT '',
+	fee TEXT NOT NULL DEFAULT '0',
+	tx_hash TEXT NOT NULL DEFAULT '',
+	proof TEXT NOT NULL DEFAULT '',
+	output TEXT NOT NULL DEFAULT '',
+	public_witness TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	proven_at TEXT NOT NULL DEFAULT '',
+	submitted_at TEXT NOT NULL DEFAULT '',
+	finished_at TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS proof_requests_request_id ON proof_requests (request_id);
+CREATE INDEX IF NOT EXISTS proof_requests_created_at ON proof_requests (created_at)`
+
+// addedRequestColumns are text columns added after proof_requests was first
+// created, which older stores gain on startup.
+var addedRequestColumns = []string{"public_witness", "api_key", "visibility", "queries", "output_schema"}
+
+// storedRequest is one proof attempt through its lifecycle, as the request
+// store keeps it.
+type storedRequest struct {
+	ID            string `json:"id"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// APIKey names the key the request was made with.
+	APIKey  string `json:"api_key,omitempty"`
+	ChainID uint64 `json:"chain_id"`
+	Spec    string `json:"spec"`
+	Status  string `json:"status"`
+	// RequestID, Fee and Transaction are the Brevis request, known once
+	// submitted, and its fulfillment, known once finalized.
+	RequestID   string        `json:"request_id,omitempty"`
+	Fee         *big.Int      `json:"fee"`
+	Transaction string        `json:"transaction,omitempty"`
+	Proof       hexutil.Bytes `json:"proof,omitempty"`
+	Output      hexutil.Bytes `json:"output,omitempty"`
+	// PublicWitness is the proof's public witness in gnark's binary form.
+	PublicWitness hexutil.Bytes `json:"public_witness,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	Created       time.Time     `json:"created"`
+	Proven        *time.Time    `json:"proven,omitempty"`
+	Submitted     *time.Time    `json:"submitted,omitempty"`
+	Finished      *time.Time    `json:"finished,omitempty"`
+	// Visibility is who may read the request besides its key; "" is
+	// private. It is set through /requests/{id}/visibility and /share, not
+	// by save.
+	Visibility string `json:"visibility,omitempty"`
+	// Queries are what the attempt proved, and OutputSchema the layout of
+	// its Output. Requests stored before they were kept have neither.
+	Queries      *storedQueries `json:"queries,omitempty"`
+	OutputSchema int            `json:"output_schema,omitempty"`
+}
+
+// storedQueries are the storage slots and receipts of a stored request.
+type storedQueries struct {
+	Storage  []sdk.StorageData `json:"storage,omitempty"`
+	Receipts []receiptQuery    `json:"receipts,omitempty"`
+}
+
+// loadRequestStore reads BREVIS_REQUEST_STORE and opens the store, creating
+// its table on first use.
+func loadRequestStore() error {
+	if v := os.Getenv("BREVIS_REQUEST_STORE"); v != "" {
+		requestStoreURL = v
+	}
+	if requestStoreURL == "off" {
+		return nil
+	}
+	kind, path, _ := strings.Cut(requestStoreURL, ":")
+	var driver, dsn string
+	switch kind {
+	case "sqlite":
+		driver, dsn = "sqlite3", path
+	case "postgres", "postgresql":
+		driver, dsn = "postgres", requestStoreURL
+	default:
+		return fmt.Errorf("invalid BREVIS_REQUEST_STORE %q: want sqlite:<path>, a postgres:// URL or off", requestStoreURL)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	if driver == "sqlite3" {
+		// SQLite takes one writer at a time.
+		db.SetMaxOpenConns(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, stmt := range strings.Split(requestSchema, ";") {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return fmt.Errorf("creating request store schema: %v", err)
+		}
+	}
+	for _, col := range addedRequestColumns {
+		if _, err := db.ExecContext(ctx, "SELECT "+col+" FROM proof_requests LIMIT 0"); err == nil {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE proof_requests ADD COLUMN "+col+" TEXT NOT NULL DEFAULT ''"); err != nil {
+			db.Close()
+			return fmt.Errorf("adding request store column %s: %v", col, err)
+		}
+	}
+	requestDB = db
+	slog.Info("Recording request history", "store", kind)
+	return nil
+}
+
+// newStoredRequest starts the stored lifecycle of an attempt at spec reading
+// queries and receipts on chainID.
+func newStoredRequest(ctx context.Context, spec CircuitSpec, chainID uint64, queries []sdk.StorageData, receipts []receiptQuery) *storedRequest {
+	rec := &storedRequest{
+		ID:            newJobID(),
+		CorrelationID: correlationID(ctx),
+		APIKey:        apiKeyName(ctx),
+		ChainID:       chainID,
+		Spec:          spec.String(),
+		Status:        RequestCreated,
+		Created:       time.Now().UTC(),
+		Queries:       &storedQueries{Storage: queries, Receipts: receipts},
+		OutputSchema:  outputSchemaVersion,
+	}
+	rec.save(ctx)
+	return rec
+}
+
+// proven records the attempt's proof, public witness and output.
+func (rec *storedRequest) proven(ctx context.Context, proof plonk.Proof, w witness.Witness, output []byte) {
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err == nil {
+		rec.Proof = buf.Bytes()
+	}
+	if public, err := w.Public(); err == nil {
+		rec.PublicWitness, _ = public.MarshalBinary()
+	}
+	rec.Output = output
+	rec.advance(ctx, RequestProven)
+}
+
+// advance moves the request to status, stamping when it got there. A move
+// requestTransitions does not allow is logged and not made.
+func (rec *storedRequest) advance(ctx context.Context, status string) {
+	from := rec.Status
+	if err := checkRequestTransition(from, status); err != nil {
+		slog.ErrorContext(ctx, "Request not advanced", "id", rec.ID, "err", err)
+		return
+	}
+	now := time.Now().UTC()
+	rec.Status = status
+	switch status {
+	case RequestProven:
+		rec.Proven = &now
+	case RequestSubmitted:
+		rec.Submitted = &now
+	case RequestFinalized, RequestExpired, RequestFailed:
+		rec.Finished = &now
+	}
+	rec.save(ctx)
+	runTransitionHooks(ctx, transition{transitionRequest, rec.ID, from, status})
+}
+
+// save writes the request to the store. A store failure is logged rather
+// than failing a proof that may already have paid its fee. The stored row
+// is only updated from a status requestTransitions lets it leave for
+// rec's, so a stale writer cannot move a request back.
+func (rec *storedRequest) save(ctx context.Context) {
+	if requestDB == nil {
+		return
+	}
+	from := []string{"'" + rec.Status + "'"}
+	for _, s := range requestPredecessors(rec.Status) {
+		from = append(from, "'"+s+"'")
+	}
+	// A request ending because its caller left is still recorded.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	written, err := rec.write(ctx, from)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording request", "id", rec.ID, "status", rec.Status, "err", err)
+		return
+	}
+	if !written {
+		slog.WarnContext(ctx, "Request not recorded: the store has it past this status", "id", rec.ID, "status", rec.Status)
+	}
+}
+
+// write inserts rec, or updates it when the stored row's status is one of
+// from, quoted for SQL, reporting whether a row was written.
+func (rec *storedRequest) write(ctx context.Context, from []string) (bool, error) {
+	var queries, schema string
+	if rec.Queries != nil {
+		b, err := json.Marshal(rec.Queries)
+		if err != nil {
+			return false, err
+		}
+		queries = string(b)
+	}
+	if rec.OutputSchema != 0 {
+		schema = strconv.Itoa(rec.OutputSchema)
+	}
+	res, err := requestDB.ExecContext(ctx, `INSERT INTO proof_requests
+		(id, correlation_id, api_key, chain_id, spec, status, request_id, fee, tx_hash, proof, output, public_witness, error, created_at, proven_at, submitted_at, finished_at, queries, output_schema)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, request_id = excluded.request_id, fee = excluded.fee,
+		tx_hash = excluded.tx_hash, proof = excluded.proof, output = excluded.output, public_witness = excluded.public_witness, error = excluded.error,
+		proven_at = excluded.proven_at, submitted_at = excluded.submitted_at, finished_at = excluded.finished_at
+		WHERE proof_requests.status IN (`+strings.Join(from, ", ")+`)`,
+		rec.ID, rec.CorrelationID, rec.APIKey, int64(rec.ChainID), rec.Spec, rec.Status, rec.RequestID, feeString(rec.Fee),
+		rec.Transaction, hexOrEmpty(rec.Proof), hexOrEmpty(rec.Output), hexOrEmpty(rec.PublicWitness), rec.Error, rec.Created.Format(storeTimeLayout),
+		storeTime(rec.Proven), storeTime(rec.Submitted), storeTime(rec.Finished), queries, schema)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return err != nil || n > 0, nil
+}
+
+func storeTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(storeTimeLayout)
+}
+
+// feeString stores a fee as a decimal string, "0" before it is known.
+func feeString(fee *big.Int) string {
+	if fee == nil {
+		return "0"
+	}
+	return fee.String()
+}
+
+func hexOrEmpty(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return hexutil.Encode(b)
+}
+
+func parseStoreTime(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(storeTimeLayout, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// requestColumns are the stored columns in scanStoredRequest's order.
+const requestColumns = `id, correlation_id, api_key, chain_id, spec, status, request_id, fee, tx_hash, proof, output, public_witness, error, created_at, proven_at, submitted_at, finished_at, visibility, queries, output_schema`
+
+func scanStoredRequest(row interface{ Scan(...any) error }) (*storedRequest, error) {
+	var rec storedRequest
+	var chainID int64
+	var fee, proof, output, public, created, proven, submitted, finished, queries, schema string
+	if err := row.Scan(&rec.ID, &rec.CorrelationID, &rec.APIKey, &chainID, &rec.Spec, &rec.Status, &rec.RequestID, &fee, &rec.Transaction,
+		&proof, &output, &public, &rec.Error, &created, &proven, &submitted, &finished, &rec.Visibility, &queries, &schema); err != nil {
+		return nil, err
+	}
+	if queries != "" {
+		rec.Queries = new(storedQueries)
+		if err := json.Unmarshal([]byte(queries), rec.Queries); err != nil {
+			return nil, fmt.Errorf("decoding queries of request %s: %v", rec.ID, err)
+		}
+	}
+	rec.OutputSchema, _ = strconv.Atoi(schema)
+	rec.ChainID = uint64(chainID)
+	rec.Fee, _ = new(big.Int).SetString(fee, 10)
+	if proof != "" {
+		rec.Proof, _ = hexutil.Decode(proof)
+	}
+	if output != "" {
+		rec.Output, _ = hexutil.Decode(output)
+	}
+	if public != "" {
+		rec.PublicWitness, _ = hexutil.Decode(public)
+	}
+	if t := parseStoreTime(created); t != nil {
+		rec.Created = *t
+	}
+	rec.Proven, rec.Submitted, rec.Finished = parseStoreTime(proven), parseStoreTime(submitted), parseStoreTime(finished)
+	return &rec, nil
+}
+
+// maxListedRequests bounds one page of GET /requests.
+const maxListedRequests = 1000
+
+// requestFilter selects stored requests. Zero fields match everything.
+type requestFilter struct {
+	Status  string
+	ChainID uint64
+	APIKey  string
+	// Since and Until bound when requests were created, Until exclusive.
+	Since, Until time.Time
+	Limit        int
+}
+
+func parseRequestFilter(q url.Values) (requestFilter, error) {
+	f := requestFilter{Status: q.Get("status"), APIKey: q.Get("api_key"), Limit: 100}
+	switch f.Status {
+	case "", RequestCreated, RequestProven, RequestSubmitted, RequestFinalized, RequestExpired, RequestFailed:
+	default:
+		return f, fmt.Errorf("invalid status %q", f.Status)
+	}
+	if v := q.Get("chain_id"); v != "" {
+		var err error
+		if f.ChainID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid chain_id %q: %v", v, err)
+		}
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if parsed, err = time.Parse(time.DateOnly, v); err != nil {
+				return f, fmt.Errorf("invalid %s %q: want an RFC 3339 time or a date", name, v)
+			}
+		}
+		*t = parsed
+	}
+	if q.Get("limit") != "" {
+		var err error
+		if f.Limit, err = intParam(q, "limit"); err != nil {
+			return f, err
+		}
+		if f.Limit < 1 || f.Limit > maxListedRequests {
+			return f, fmt.Errorf("limit must be from 1 to %d, got %d", maxListedRequests, f.Limit)
+		}
+	}
+	return f, nil
+}
+
+// listStoredRequests returns the requests matching f, newest first.
+func listStoredRequests(ctx context.Context, f requestFilter) ([]*storedRequest, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.ChainID != 0 {
+		add("chain_id = $%d", int64(f.ChainID))
+	}
+	if f.APIKey != "" {
+		add("api_key = $%d", f.APIKey)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= $%d", f.Since.UTC().Format(storeTimeLayout))
+	}
+	if !f.Until.IsZero() {
+		add("created_at < $%d", f.Until.UTC().Format(storeTimeLayout))
+	}
+	query := "SELECT " + requestColumns + " FROM proof_requests"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT %d", f.Limit)
+
+	rows, err := requestDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	recs := []*storedRequest{}
+	for rows.Next() {
+		rec, err := scanStoredRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// getStoredRequest looks a request up by its stored ID or Brevis request ID.
+func getStoredRequest(ctx context.Context, id string) (*storedRequest, error) {
+	row := requestDB.QueryRowContext(ctx, "SELECT "+requestColumns+" FROM proof_requests WHERE id = $1 OR request_id = $1 ORDER BY created_at DESC LIMIT 1", id)
+	return scanStoredRequest(row)
+}
+
+// handleRequests lists stored requests, newest first, without their proofs,
+// public witnesses and queries.
+// status, chain_id, api_key, since, until and limit narrow the list.
+func handleRequests(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	f, err := parseRequestFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Keys other than admin keys list only their own requests.
+	if authEnabled.Load() && !isAdmin(r.Context()) {
+		f.APIKey = apiKeyName(r.Context())
+	}
+	recs, err := listStoredRequests(r.Context(), f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading request store: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, rec := range recs {
+		rec.Proof, rec.PublicWitness, rec.Queries = nil, nil, nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"requests": recs,
+	})
+}
+
+// handleRequest returns a stored request in full, proof included, to those
+// mayRead lets read it, answering If-None-Match with 304 while it is
+// unchanged.
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	rec, err := getStoredRequest(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("No request %q", r.PathValue("id")), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading request store: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !mayRead(r, rec) {
+		http.Error(w, fmt.Sprintf("No request %q", r.PathValue("id")), http.StatusNotFound)
+		return
+	}
+
+	writeCachedJSON(w, r, rec, rec.Finished != nil)
+}
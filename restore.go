@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+)
+
+const (
+	// preparedSpecFile in circuitDir records the specs prepared, so a
+	// restart can restore them without recompiling. A spec is dropped from
+	// it while it compiles, since its variants are then mixed.
+	preparedSpecFile = "prepared.json"
+	// checksumFile in a variant directory holds the SHA-256 of each
+	// artifact, written as the variant is compiled.
+	checksumFile = "checksums.json"
+)
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksums records the checksum of every artifact in dir.
+func writeChecksums(dir string) error {
+	sums := map[string]string{}
+	for _, name := range artifactFiles {
+		sum, err := fileChecksum(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		sums[name] = sum
+	}
+	b, err := json.MarshalIndent(sums, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, checksumFile), b, 0644)
+}
+
+// verifyChecksums returns why the artifacts in dir do not match the
+// checksums recorded when it was compiled, or "".
+func verifyChecksums(dir string) string {
+	b, err := os.ReadFile(filepath.Join(dir, checksumFile))
+	if err != nil {
+		return fmt.Sprintf("no %s", checksumFile)
+	}
+	var sums map[string]string
+	if err := json.Unmarshal(b, &sums); err != nil {
+		return fmt.Sprintf("unreadable %s: %v", checksumFile, err)
+	}
+	for _, name := range artifactFiles {
+		sum, err := fileChecksum(filepath.Join(dir, name))
+		if err != nil {
+			return err.Error()
+		}
+		if sums[name] != sum {
+			return fmt.Sprintf("%s checksum %s does not match recorded %s", name, sum, sums[name])
+		}
+	}
+	return ""
+}
+
+// readPreparedSpecs reads the specs recorded in preparedSpecFile. A file
+// from before several circuits could be prepared holds a single spec.
+func readPreparedSpecs() ([]CircuitSpec, error) {
+	b, err := os.ReadFile(filepath.Join(circuitDir, preparedSpecFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var specs []CircuitSpec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		var spec CircuitSpec
+		if json.Unmarshal(b, &spec) != nil {
+			return nil, fmt.Errorf("reading %s: %v", preparedSpecFile, err)
+		}
+		specs = []CircuitSpec{spec}
+	}
+	return specs, nil
+}
+
+func writePreparedSpecs(specs []CircuitSpec) error {
+	b, err := json.Marshal(specs)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(circuitDir, preparedSpecFile)
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// recordPreparedSpec adds spec to the specs a restart restores.
+func recordPreparedSpec(spec CircuitSpec) error {
+	specs, err := readPreparedSpecs()
+	if err != nil {
+		return err
+	}
+	for _, s := range specs {
+		if s.equal(spec) {
+			return nil
+		}
+	}
+	return writePreparedSpecs(append(specs, spec))
+}
+
+// unrecordPreparedSpec drops spec from the specs a restart restores.
+func unrecordPreparedSpec(spec CircuitSpec) error {
+	specs, err := readPreparedSpecs()
+	if err != nil {
+		return err
+	}
+	kept := []CircuitSpec{}
+	for _, s := range specs {
+		if !s.equal(spec) {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(specs) {
+		return nil
+	}
+	return writePreparedSpecs(kept)
+}
+
+// restorePreparedCircuits prepares each spec recorded in circuitDir again
+// once every one of its variants is complete and passes checksum
+// validation. A variant whose checksums fail is quarantined, and otherwise
+// the spec is left for /prepare-download to recompile, unless only its
+// circuit definition changed, in which case it is returned to be
+// recompiled. The SRS is only used to compile, so it is not needed here.
+func restorePreparedCircuits() ([]CircuitSpec, error) {
+	specs, err := readPreparedSpecs()
+	if err != nil {
+		return nil, err
+	}
+	var stale []CircuitSpec
+	for _, spec := range specs {
+		ok, changed, err := restorePreparedCircuit(spec)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			stale = append(stale, spec)
+		}
+		if !ok {
+			if err := unrecordPreparedSpec(spec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stale, nil
+}
+
+// restorePreparedCircuit loads the variants of one recorded spec, reporting
+// whether it could, and whether it could not only because this build
+// defines the circuit differently.
+func restorePreparedCircuit(spec CircuitSpec) (ok, changed bool, err error) {
+	if len(spec.variants()) == 0 {
+		slog.Warn("Not restoring prepared circuit: no configured circuit size fits it", "spec", spec, "sizes", circuitSizes)
+		return false, false, nil
+	}
+
+	start := time.Now()
+	var variants []*circuitVariant
+	for _, v := range spec.variants() {
+		dir := variantDir(v)
+		reason := checkVariantDir(dir)
+		if reason == "" {
+			if onDisk, _ := os.ReadFile(filepath.Join(dir, circuitSpecFile)); string(onDisk) != v.String() {
+				reason = fmt.Sprintf("compiled for spec %s", onDisk)
+			}
+		}
+		if reason != "" {
+			slog.Warn("Not restoring prepared circuit", "spec", spec, "dir", dir, "reason", reason)
+			return false, false, nil
+		}
+		if reason = verifyChecksums(dir); reason != "" {
+			slog.Warn("Not restoring prepared circuit", "spec", spec, "dir", dir, "reason", reason)
+			if err := quarantine(dir); err != nil {
+				return false, false, err
+			}
+			slog.Warn("Quarantined circuit artifacts", "path", dir, "reason", reason)
+			return false, false, nil
+		}
+		reason, err := staleVariant(dir, v)
+		if err != nil {
+			return false, false, fmt.Errorf("checking circuit definition of %s: %v", v, err)
+		}
+		if reason != "" {
+			slog.Warn("Not restoring prepared circuit", "spec", spec, "dir", dir, "reason", reason)
+			return false, true, nil
+		}
+		// Artifacts written by another SDK version can pass their checksums
+		// and still not load.
+		ccs, err := sdk.ReadCircuitFrom(filepath.Join(dir, "compiledCircuit"))
+		if err == nil {
+			var pk plonk.ProvingKey
+			if pk, err = sdk.ReadPkFrom(filepath.Join(dir, "pk")); err == nil {
+				variants = append(variants, &circuitVariant{Spec: v, CCS: ccs, PK: pk, Hash: circuitHash(ccs)})
+				continue
+			}
+		}
+		slog.Warn("Not restoring prepared circuit: artifacts unreadable", "spec", spec, "dir", dir, "err", err)
+		if err := quarantine(dir); err != nil {
+			return false, false, err
+		}
+		slog.Warn("Quarantined circuit artifacts", "path", dir, "reason", "unreadable artifacts")
+		return false, false, nil
+	}
+
+	installPrepared(spec, variants)
+	slog.Info("Restored prepared circuit", "spec", spec, "variants", len(variants), "duration_ms", time.Since(start).Milliseconds())
+	return true, false, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Error classes a failed job reports: whether trying it again later may
+// succeed.
+const (
+	ErrorRetryable = "retryable"
+	ErrorFatal     = "fatal"
+)
+
+// retryPolicy bounds the retries of one gateway call or chain read.
+type retryPolicy struct {
+	// Attempts counts the first try.
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// retries is the policy of gateway calls and chain reads besides proof
+// submission, whose retries requests set themselves.
+var retries = retryPolicy{Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// loadRetryPolicy reads BREVIS_RETRY_ATTEMPTS, BREVIS_RETRY_BASE_DELAY and
+// BREVIS_RETRY_MAX_DELAY.
+func loadRetryPolicy() error {
+	var err error
+	if retries.Attempts, err = envInt("BREVIS_RETRY_ATTEMPTS", retries.Attempts); err != nil {
+		return err
+	}
+	if retries.BaseDelay, err = envDuration("BREVIS_RETRY_BASE_DELAY", retries.BaseDelay); err != nil {
+		return err
+	}
+	if retries.MaxDelay, err = envDuration("BREVIS_RETRY_MAX_DELAY", retries.MaxDelay); err != nil {
+		return err
+	}
+	if retries.Attempts < 1 {
+		return fmt.Errorf("BREVIS_RETRY_ATTEMPTS must be at least 1, got %d", retries.Attempts)
+	}
+	if retries.BaseDelay <= 0 || retries.MaxDelay < retries.BaseDelay {
+		return fmt.Errorf("BREVIS_RETRY_BASE_DELAY %s must be positive and at most BREVIS_RETRY_MAX_DELAY %s", retries.BaseDelay, retries.MaxDelay)
+	}
+	return nil
+}
+
+// backoff is the pause before retry n, from 1: the base delay doubled each
+// retry up to the maximum, jittered down by up to half so clients failing
+// together don't retry together.
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.MaxDelay
+	if n < 32 {
+		d = min(p.BaseDelay<<(n-1), p.MaxDelay)
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep pauses before retry n, returning early with ctx's error.
+func (p retryPolicy) sleep(ctx context.Context, n int) error {
+	t := time.NewTimer(p.backoff(n))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withRetry calls fn until it succeeds, fails with an error retrying can't
+// fix, or has been tried retries.Attempts times. The last error is returned,
+// noting the attempts when there were several.
+func withRetry[T any](ctx context.Context, op string, fn func() (T, error)) (T, error) {
+	var v T
+	var err error
+	for n := 1; ; n++ {
+		if v, err = fn(); err == nil || !retryable(err) {
+			return v, err
+		}
+		if n == retries.Attempts {
+			return v, fmt.Errorf("%w (after %d attempts)", err, n)
+		}
+		slog.WarnContext(ctx, "Retrying", "op", op, "attempt", n, "attempts", retries.Attempts, "err", err)
+		if ctx.Err() != nil || retries.sleep(ctx, n) != nil {
+			return v, err
+		}
+	}
+}
+
+// retryable tells transient failures, such as dropped connections,
+// throttling and overloaded providers, from those that would fail again:
+// invalid requests, reverts, rejections by the gateway and an ended
+// context. Failures it does not recognize are taken as transient.
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		// A stage deadline is the stage's whole budget.
+		return se.code == http.StatusTooManyRequests || se.code == http.StatusBadGateway || se.code == http.StatusServiceUnavailable
+	}
+	var he rpc.HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode == http.StatusTooManyRequests || he.StatusCode >= 500
+	}
+	var re rpc.Error
+	if errors.As(err, &re) {
+		// Limit exceeded and internal errors; the rest are invalid requests
+		// and reverts.
+		return re.ErrorCode() == -32005 || re.ErrorCode() == -32603
+	}
+	// The SDK flattens gateway errors to text; an answer with an error code
+	// (spelled "cdoe" by the SDK) is the gateway refusing the request.
+	return !strings.Contains(err.Error(), "brevis gateway") || !strings.Contains(err.Error(), "cdoe ")
+}
+
+// errorClass is the class a job failing with err reports.
+func errorClass(err error) string {
+	if retryable(err) || httpStatus(err) == http.StatusGatewayTimeout {
+		return ErrorRetryable
+	}
+	return ErrorFatal
+}
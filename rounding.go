@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// parseBucket reads a bucket width: a positive integer below 2^248.
+func parseBucket(s string) (*big.Int, error) {
+	w, ok := new(big.Int).SetString(s, 10)
+	if !ok || w.Sign() <= 0 || w.Cmp(sdk.MaxUint248) > 0 {
+		return nil, fmt.Errorf("invalid bucket %q: want a positive integer below 2^248", s)
+	}
+	return w, nil
+}
+
+// validateBucket allows rounding only where the total is the sole value
+// output, since any other output would reveal the exact figures anyway.
+func (s CircuitSpec) validateBucket() error {
+	if s.Bucket == "" {
+		return nil
+	}
+	if _, err := parseBucket(s.Bucket); err != nil {
+		return err
+	}
+	if s.Aggregation != AggregationSum && s.Aggregation != AggregationSorted {
+		return fmt.Errorf("bucket is only valid with aggregation %q or %q", AggregationSum, AggregationSorted)
+	}
+	for _, f := range s.Fields {
+		if f.Name != emissionsField {
+			return fmt.Errorf("bucket outputs only the total's bounds, so field %q cannot be output", f.Name)
+		}
+	}
+	return nil
+}
+
+// outputTotal outputs the total emissions, or with a bucket width the
+// bounds [lower, lower+width) of the bucket the total falls in. The upper
+// bound must fit 248 bits, so a total in a bucket reaching past 2^248 - 1
+// cannot be proven.
+func (c *AppCircuit) outputTotal(api *sdk.CircuitAPI, total sdk.Uint248) {
+	if c.Spec.Bucket == "" {
+		api.OutputUint(248, total)
+		return
+	}
+	u248 := api.Uint248
+	w, _ := parseBucket(c.Spec.Bucket)
+	width := sdk.ConstUint248(w)
+	q, _ := u248.Div(total, width)
+	lower := u248.Mul(q, width)
+	u248.AssertIsLessOrEqual(lower, sdk.ConstUint248(new(big.Int).Sub(sdk.MaxUint248, w)))
+	api.OutputUint(248, lower)
+	api.OutputUint(248, u248.Add(lower, width))
+}
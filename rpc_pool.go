@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	// rpcProbeInterval is how often every provider is probed.
+	rpcProbeInterval = 30 * time.Second
+	// archiveProbeDepth is how many blocks behind head the archive probe
+	// reads state, well past the 128 blocks a pruned node keeps.
+	archiveProbeDepth = uint64(10000)
+	// rpcSelection spreads calls over a chain's providers: weighted picks at
+	// random by score, round-robin takes the healthy ones in turn.
+	rpcSelection = "weighted"
+	// rpcFailovers caps how many other providers a failed fetch moves to.
+	rpcFailovers = 2
+)
+
+const (
+	// rpcAlpha weights each new observation in the moving averages.
+	rpcAlpha = 0.2
+	// rpcHealthyErrorRate is the error rate at which round-robin skips a
+	// provider, while its chain has one below it.
+	rpcHealthyErrorRate = 0.5
+)
+
+// rpcProvider is the running health record of one RPC endpoint.
+type rpcProvider struct {
+	ChainID   uint64  `json:"chain_id"`
+	URL       string  `json:"url"`
+	LatencyMs float64 `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+	Archive   bool    `json:"archive"`
+	// Head is the latest block the provider reported.
+	Head       uint64    `json:"head"`
+	Score      float64   `json:"score"`
+	Requests   int       `json:"requests"`
+	Errors     int       `json:"errors"`
+	LastError  string    `json:"last_error,omitempty"`
+	LastProbed time.Time `json:"last_probed"`
+}
+
+var (
+	rpcProviders []*rpcProvider
+	// rpcCursor is the next round-robin turn of each chain.
+	rpcCursor = map[uint64]int{}
+	rpcMutex  sync.Mutex
+)
+
+// rpcError is a failure of the provider at URL, which the chain's other
+// providers may not share.
+type rpcError struct {
+	URL string
+	err error
+}
+
+func (e *rpcError) Error() string { return e.err.Error() }
+func (e *rpcError) Unwrap() error { return e.err }
+
+// loadRPCSettings reads BREVIS_RPC_PROBE_INTERVAL, BREVIS_RPC_SELECTION and
+// BREVIS_RPC_FAILOVERS.
+func loadRPCSettings() error {
+	var err error
+	if rpcProbeInterval, err = envDuration("BREVIS_RPC_PROBE_INTERVAL", rpcProbeInterval); err != nil {
+		return err
+	}
+	if rpcFailovers, err = envInt("BREVIS_RPC_FAILOVERS", rpcFailovers); err != nil {
+		return err
+	}
+	if rpcFailovers < 0 {
+		return fmt.Errorf("BREVIS_RPC_FAILOVERS must not be negative, got %d", rpcFailovers)
+	}
+	switch v := os.Getenv("BREVIS_RPC_SELECTION"); v {
+	case "":
+	case "weighted", "round-robin":
+		rpcSelection = v
+	default:
+		return fmt.Errorf("invalid BREVIS_RPC_SELECTION %q: want weighted or round-robin", v)
+	}
+	return nil
+}
+
+// loadRPCProviders registers the profile's RPC URL followed by any extra
+// comma-separated URLs in BREVIS_RPC_URLS.
+func loadRPCProviders(p Profile) {
+	urls := []string{p.RPCURL}
+	for _, u := range strings.Split(os.Getenv("BREVIS_RPC_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" && u != p.RPCURL {
+			urls = append(urls, u)
+		}
+	}
+	rpcProviders = nil
+	addRPCProviders(p.ChainID, urls)
+}
+
+// addRPCProviders registers urls as providers of a chain. A chain's first
+// providers start optimistic, so traffic flows before the first probe
+// lands. Providers joining a chain that has some already start at their
+// median score, so an unprobed one takes no more than its share, and are
+// not taken for archive nodes until probed.
+func addRPCProviders(chainID uint64, urls []string) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	var scores []float64
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID {
+			scores = append(scores, p.Score)
+		}
+	}
+	for _, u := range urls {
+		p := &rpcProvider{ChainID: chainID, URL: u, Archive: true, Score: 1}
+		if len(scores) > 0 {
+			p.Archive, p.Score = false, medianScore(scores)
+		}
+		rpcProviders = append(rpcProviders, p)
+	}
+}
+
+func medianScore(scores []float64) float64 {
+	s := slices.Clone(scores)
+	slices.Sort(s)
+	if n := len(s); n%2 == 0 {
+		return (s[n/2-1] + s[n/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+// pickRPC returns a provider URL of the profile's chain.
+func pickRPC() string {
+	return pickChainRPC(activeProfile.ChainID)
+}
+
+// pickChainRPC returns a provider URL of the chain by rpcSelection, or "" if
+// the chain has none.
+func pickChainRPC(chainID uint64) string {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	var candidates, healthy []*rpcProvider
+	var total float64
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID {
+			candidates = append(candidates, p)
+			total += p.Score
+			if p.ErrorRate < rpcHealthyErrorRate {
+				healthy = append(healthy, p)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	if rpcSelection == "round-robin" {
+		if len(healthy) == 0 {
+			healthy = candidates
+		}
+		p := healthy[rpcCursor[chainID]%len(healthy)]
+		rpcCursor[chainID]++
+		return p.URL
+	}
+	if total == 0 {
+		return candidates[0].URL
+	}
+	r := rand.Float64() * total
+	for _, p := range candidates {
+		if r < p.Score {
+			return p.URL
+		}
+		r -= p.Score
+	}
+	return candidates[len(candidates)-1].URL
+}
+
+// failoverRPC returns the best-scored provider of the chain not in tried, or
+// "" if every one has been.
+func failoverRPC(chainID uint64, tried []string) string {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	var best *rpcProvider
+	for _, p := range rpcProviders {
+		if p.ChainID != chainID || slices.Contains(tried, p.URL) {
+			continue
+		}
+		if best == nil || p.Score > best.Score {
+			best = p
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.URL
+}
+
+// rpcChain is the chain the provider at url serves, or 0 if it is unknown.
+func rpcChain(url string) uint64 {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	for _, p := range rpcProviders {
+		if p.URL == url {
+			return p.ChainID
+		}
+	}
+	return 0
+}
+
+// observeRPC folds the outcome of one call to url into its health record.
+func observeRPC(url string, took time.Duration, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+	for _, p := range rpcProviders {
+		if p.URL != url {
+			continue
+		}
+		p.Requests++
+		failed := 0.0
+		if err != nil {
+			p.Errors++
+			p.LastError = err.Error()
+			failed = 1
+		} else {
+			p.LatencyMs = (1-rpcAlpha)*p.LatencyMs + rpcAlpha*float64(took.Milliseconds())
+		}
+		p.ErrorRate = (1-rpcAlpha)*p.ErrorRate + rpcAlpha*failed
+		p.rescore()
+	}
+}
+
+// rescore weights healthy, fast providers up. Nodes without historical state
+// keep a small share since they still serve recent blocks and receipts.
+func (p *rpcProvider) rescore() {
+	p.Score = (1 - p.ErrorRate) / (1 + p.LatencyMs/100)
+	if !p.Archive {
+		p.Score *= 0.25
+	}
+}
+
+// probeRPCProviders probes every provider each rpcProbeInterval until ctx
+// ends.
+func probeRPCProviders(ctx context.Context) {
+	for {
+		for _, p := range rpcProviders {
+			probeRPC(ctx, p.ChainID, p.URL)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rpcProbeInterval):
+		}
+	}
+}
+
+func probeRPC(ctx context.Context, chainID uint64, url string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	ec, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		observeRPC(url, 0, err)
+		return
+	}
+	defer ec.Close()
+	head, err := ec.BlockNumber(ctx)
+	observeRPC(url, time.Since(start), err)
+	if err != nil {
+		return
+	}
+	recordHead(url, head)
+
+	archive := true
+	if head > archiveProbeDepth {
+		old := new(big.Int).SetUint64(head - archiveProbeDepth)
+		_, err := ec.CodeAt(ctx, chains[chainID].AppContract, old)
+		archive = err == nil
+	}
+	rpcMutex.Lock()
+	for _, p := range rpcProviders {
+		if p.ChainID == chainID && p.URL == url {
+			if p.Archive != archive {
+				slog.Info("RPC historical state availability changed", "rpc", url, "archive", archive)
+			}
+			p.Archive = archive
+			p.LastProbed = time.Now()
+			p.rescore()
+		}
+	}
+	rpcMutex.Unlock()
+}
+
+// handleAdminRPC lists every provider's health by chain, best first.
+func handleAdminRPC(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	rpcMutex.Lock()
+	providers := make([]rpcProvider, len(rpcProviders))
+	for i, p := range rpcProviders {
+		providers[i] = *p
+	}
+	rpcMutex.Unlock()
+	sort.Slice(providers, func(i, j int) bool {
+		if providers[i].ChainID != providers[j].ChainID {
+			return providers[i].ChainID < providers[j].ChainID
+		}
+		return providers[i].Score > providers[j].Score
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(providers)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Visibilities of a stored request's proof and result. A private request
+// is read only by the key that made it and admin keys; a link request also
+// by whoever holds an unexpired share link; a public one by anyone.
+const (
+	VisibilityPrivate = "private"
+	VisibilityLink    = "link"
+	VisibilityPublic  = "public"
+)
+
+var (
+	// shareSecret signs share links. Without it none are issued.
+	shareSecret = ""
+	// defaultShareTTL is how long a share link lasts unless asked
+	// otherwise; maxShareTTL the longest one may.
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 90 * 24 * time.Hour
+)
+
+// loadShareSettings reads BREVIS_SHARE_SECRET and BREVIS_MAX_SHARE_TTL.
+func loadShareSettings() error {
+	shareSecret = os.Getenv("BREVIS_SHARE_SECRET")
+	var err error
+	if maxShareTTL, err = envDuration("BREVIS_MAX_SHARE_TTL", maxShareTTL); err != nil {
+		return err
+	}
+	defaultShareTTL = min(defaultShareTTL, maxShareTTL)
+	return nil
+}
+
+// shareSignature signs stored request id's link expiring at expires, in
+// Unix seconds.
+func shareSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(shareSecret))
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// shareToken is the share query parameter of a link to id until expires.
+func shareToken(id string, expires time.Time) string {
+	return strconv.FormatInt(expires.Unix(), 10) + "." + shareSignature(id, expires.Unix())
+}
+
+// validShareToken reports whether token is an unexpired link to id.
+func validShareToken(id, token string) bool {
+	if shareSecret == "" || token == "" {
+		return false
+	}
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(shareSignature(id, expires)))
+}
+
+// visibility is rec's visibility, private when never set.
+func (rec *storedRequest) visibility() string {
+	if rec.Visibility == "" {
+		return VisibilityPrivate
+	}
+	return rec.Visibility
+}
+
+// mayRead reports whether the caller of r may read rec: its owner or an
+// admin, anyone once it is public, and anyone with a valid share link while
+// it is shared by link. Callers without a key reach the request and proof
+// routes only for this, so they may read nothing else.
+func mayRead(r *http.Request, rec *storedRequest) bool {
+	switch {
+	case rec.visibility() == VisibilityPublic:
+		return true
+	case rec.visibility() == VisibilityLink && validShareToken(rec.ID, r.URL.Query().Get("share")):
+		return true
+	case authEnabled.Load() && apiKeyName(r.Context()) == "":
+		return false
+	}
+	return mayActOn(r.Context(), rec.APIKey)
+}
+
+// sharedRoute reports whether r reads a stored request or its proof, which
+// callers without a key may attempt with a share link or on a public one.
+func sharedRoute(r *http.Request) bool {
+	p := r.URL.Path
+	return r.Method == http.MethodGet && (strings.HasPrefix(p, "/requests/") || strings.HasPrefix(p, "/proofs/")) && strings.Count(p, "/") == 2
+}
+
+// ownStoredRequest reads stored request id for r's caller, which must own
+// it or hold an admin key; other callers' requests are answered as not
+// found.
+func ownStoredRequest(r *http.Request, id string) (*storedRequest, error) {
+	if requestDB == nil {
+		return nil, &statusError{http.StatusNotFound, errors.New("No request store; set BREVIS_REQUEST_STORE")}
+	}
+	rec, err := getStoredRequest(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !mayActOn(r.Context(), rec.APIKey) {
+		return nil, &statusError{http.StatusNotFound, fmt.Errorf("No request %q", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading request store: %v", err)
+	}
+	return rec, nil
+}
+
+// setVisibility records rec's visibility.
+func setVisibility(r *http.Request, rec *storedRequest, visibility string) error {
+	if _, err := requestDB.ExecContext(r.Context(), "UPDATE proof_requests SET visibility = $1 WHERE id = $2", visibility, rec.ID); err != nil {
+		return fmt.Errorf("Error saving visibility: %v", err)
+	}
+	rec.Visibility = visibility
+	slog.InfoContext(r.Context(), "Request visibility changed", "id", rec.ID, "visibility", visibility)
+	return nil
+}
+
+// handleRequestVisibility sets a stored request's visibility to the
+// visibility parameter: private, link or public. Making it private again
+// voids the share links already issued.
+func handleRequestVisibility(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	visibility := r.URL.Query().Get("visibility")
+	switch visibility {
+	case VisibilityPrivate, VisibilityLink, VisibilityPublic:
+	default:
+		http.Error(w, fmt.Sprintf("invalid visibility %q: want private, link or public", visibility), http.StatusBadRequest)
+		return
+	}
+	rec, err := ownStoredRequest(r, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if err := setVisibility(r, rec, visibility); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":         rec.ID,
+		"visibility": visibility,
+	})
+}
+
+// handleShareRequest issues a signed link to a stored request's proof that
+// lasts ttl, defaultShareTTL unless given, for auditors without an API key.
+// A private request becomes shared by link.
+func handleShareRequest(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if shareSecret == "" {
+		http.Error(w, "Share links are disabled; set BREVIS_SHARE_SECRET", http.StatusNotFound)
+		return
+	}
+	ttl := defaultShareTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxShareTTL {
+			http.Error(w, fmt.Sprintf("invalid ttl %q: want a positive duration up to %s", v, maxShareTTL), http.StatusBadRequest)
+			return
+		}
+	}
+	rec, err := ownStoredRequest(r, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if rec.visibility() == VisibilityPrivate {
+		if err := setVisibility(r, rec, VisibilityLink); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	token := shareToken(rec.ID, expires)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      rec.ID,
+		"share":   token,
+		"proof":   "/proofs/" + rec.ID + "?share=" + token,
+		"request": "/requests/" + rec.ID + "?share=" + token,
+		"expires": expires.UTC(),
+	})
+}
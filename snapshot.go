@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// snapshotPin is an agreed chain state a proof must reference: the block
+// hash at a block number, optionally with a name for the agreement.
+type snapshotPin struct {
+	Name        string      `json:"name,omitempty"`
+	BlockNumber uint64      `json:"block_number"`
+	BlockHash   common.Hash `json:"block_hash"`
+}
+
+// parseSnapshotPin reads snapshot_block, snapshot_hash and snapshot_name.
+// It returns nil when the request pins no snapshot.
+func parseSnapshotPin(r *http.Request) (*snapshotPin, error) {
+	q := r.URL.Query()
+	block, hash := q.Get("snapshot_block"), q.Get("snapshot_hash")
+	if block == "" && hash == "" {
+		return nil, nil
+	}
+	if block == "" || hash == "" {
+		return nil, fmt.Errorf("snapshot_block and snapshot_hash must be given together")
+	}
+	n, ok := new(big.Int).SetString(block, 10)
+	if !ok || !n.IsUint64() {
+		return nil, fmt.Errorf("invalid snapshot_block %q", block)
+	}
+	b, err := hexutil.Decode(hash)
+	if err != nil || len(b) != common.HashLength {
+		return nil, fmt.Errorf("invalid snapshot_hash %q", hash)
+	}
+	return &snapshotPin{Name: q.Get("snapshot_name"), BlockNumber: n.Uint64(), BlockHash: common.BytesToHash(b)}, nil
+}
+
+// verify checks the pinned hash against the canonical chain on rpcURL.
+func (s *snapshotPin) verify(ctx context.Context, rpcURL string) error {
+	ec, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %v", rpcURL, err)
+	}
+	defer ec.Close()
+	header, err := ec.HeaderByNumber(ctx, new(big.Int).SetUint64(s.BlockNumber))
+	if err != nil {
+		return fmt.Errorf("fetching snapshot block %d: %v", s.BlockNumber, err)
+	}
+	if header.Hash() != s.BlockHash {
+		return &statusError{http.StatusConflict, fmt.Errorf("snapshot %s diverged: block %d is %s on chain, pinned %s", s.label(), s.BlockNumber, header.Hash().Hex(), s.BlockHash.Hex())}
+	}
+	return nil
+}
+
+func (s *snapshotPin) label() string {
+	if s.Name != "" {
+		return fmt.Sprintf("%q", s.Name)
+	}
+	return fmt.Sprintf("at block %d", s.BlockNumber)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+const (
+	CircuitEmissions = "emissions"
+	CircuitStockFlow = "stock_flow"
+	// CircuitReceiptEmissions sums emissions events from receipts instead
+	// of reading storage.
+	CircuitReceiptEmissions = "receipt_emissions"
+	// CircuitBlockRange proves the change of an emissions counter over a
+	// block range.
+	CircuitBlockRange = "block_range"
+)
+
+const (
+	AggregationSum       = "sum"
+	AggregationTopK      = "top_k"
+	AggregationSorted    = "sorted"
+	AggregationWindowAvg = "window_avg"
+	AggregationEMA       = "ema"
+	AggregationMerkle    = "merkle"
+	AggregationMin       = "min"
+	AggregationMax       = "max"
+	AggregationMean      = "mean"
+	// AggregationCount outputs the number of slots with a nonzero value.
+	AggregationCount = "count"
+)
+
+// emaScale is the denominator of CircuitSpec.AlphaBps.
+const emaScale = 10000
+
+// CircuitSpec selects the optional checks and outputs compiled into
+// AppCircuit. The circuit must be prepared and proven with the same spec.
+type CircuitSpec struct {
+	Circuit     string `json:"circuit,omitempty"`
+	Aggregation string `json:"aggregation,omitempty"`
+	TopK        int    `json:"top_k,omitempty"`
+	Window      int    `json:"window,omitempty"`
+	AlphaBps    int    `json:"alpha_bps,omitempty"`
+
+	Fields      []PackedField `json:"fields,omitempty"`
+	ValueMode   string        `json:"value_mode,omitempty"`
+	ScaleFactor string        `json:"scale_factor,omitempty"`
+	// Bucket rounds the public total down to a multiple of this width,
+	// outputting the bucket's bounds instead of the exact total.
+	Bucket string `json:"bucket,omitempty"`
+	// ExpectedEmission is the value every queried slot must hold, in
+	// decimal; empty means defaultExpectedEmission.
+	ExpectedEmission string `json:"expected_emission,omitempty"`
+	// Mode is how slots are checked against ExpectedEmission; empty means
+	// ModeEqual. TotalCap bounds the total in ModeThreshold.
+	Mode     string `json:"mode,omitempty"`
+	TotalCap string `json:"total_cap,omitempty"`
+
+	StockFlow        *StockFlowParams        `json:"stock_flow,omitempty"`
+	ReceiptEmissions *ReceiptEmissionsParams `json:"receipt_emissions,omitempty"`
+	BlockRange       *BlockRangeParams       `json:"block_range,omitempty"`
+
+	// Slots is the storage slot allocation of a compiled variant. Requests
+	// usually leave it unset and are routed to a variant; setting it pins
+	// the spec to that one allocation.
+	Slots int `json:"slots,omitempty"`
+}
+
+// setDefaults fills in the settings a spec leaves empty and empties those
+// given as their default, so that specs meaning the same compare equal.
+func (s *CircuitSpec) setDefaults() {
+	if s.Circuit == "" {
+		s.Circuit = CircuitEmissions
+	}
+	if s.Aggregation == "" {
+		s.Aggregation = AggregationSum
+	}
+	if s.ValueMode == "" {
+		s.ValueMode = ValueModeUint248
+	}
+	s.ExpectedEmission = canonicalExpectedEmission(s.ExpectedEmission)
+	if s.Mode == ModeEqual {
+		s.Mode = ""
+	}
+}
+
+func parseCircuitSpec(r *http.Request) (CircuitSpec, error) {
+	spec, errs := parseCircuitSpecAll(r)
+	if len(errs) > 0 {
+		return spec, errs[0]
+	}
+	return spec, nil
+}
+
+// parseCircuitSpecAll is parseCircuitSpec reporting every problem with the
+// request rather than only the first.
+func parseCircuitSpecAll(r *http.Request) (CircuitSpec, []error) {
+	q := r.URL.Query()
+	spec := CircuitSpec{Circuit: q.Get("circuit"), Aggregation: q.Get("aggregation"), ValueMode: q.Get("value_mode"), ScaleFactor: q.Get("scale_factor"), Bucket: q.Get("bucket"), ExpectedEmission: q.Get("expected_emission"), Mode: q.Get("mode"), TotalCap: q.Get("total_cap")}
+	spec.setDefaults()
+	var errs []error
+	var err error
+	if spec.TopK, err = intParam(q, "k"); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.Window, err = intParam(q, "window"); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.AlphaBps, err = intParam(q, "alpha_bps"); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.Slots, err = intParam(q, "slots"); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.Fields, err = parsePackedFields(q.Get("fields")); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.Circuit == CircuitStockFlow {
+		if spec.StockFlow, err = parseStockFlowParams(q); err != nil {
+			return spec, append(errs, err)
+		}
+	}
+	if spec.Circuit == CircuitReceiptEmissions {
+		if spec.ReceiptEmissions, err = parseReceiptEmissionsParams(q); err != nil {
+			return spec, append(errs, err)
+		}
+	}
+	if spec.Circuit == CircuitBlockRange {
+		if spec.BlockRange, err = parseBlockRangeParams(q); err != nil {
+			return spec, append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return spec, errs
+	}
+	return spec, spec.violations()
+}
+
+func intParam(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", name, v, err)
+	}
+	return n, nil
+}
+
+func (s CircuitSpec) validate() error {
+	if v := s.violations(); len(v) > 0 {
+		return v[0]
+	}
+	return nil
+}
+
+// violations checks each independent part of the spec, returning one error
+// per part that is invalid.
+func (s CircuitSpec) violations() []error {
+	var errs []error
+	for _, check := range []func() error{s.validateCircuit, s.validateAggregation, s.validateValueMode, s.validateScaleFactor, s.validateSlots, s.validateBucket, s.validateExpectedEmission, s.validateMode} {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validatePackedFields(s.Fields); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (s CircuitSpec) validateCircuit() error {
+	if s.StockFlow != nil && s.Circuit != CircuitStockFlow {
+		return fmt.Errorf("stock flow parameters are only valid with circuit %q", CircuitStockFlow)
+	}
+	if s.ReceiptEmissions != nil && s.Circuit != CircuitReceiptEmissions {
+		return fmt.Errorf("receipt emissions parameters are only valid with circuit %q", CircuitReceiptEmissions)
+	}
+	if s.BlockRange != nil && s.Circuit != CircuitBlockRange {
+		return fmt.Errorf("block range parameters are only valid with circuit %q", CircuitBlockRange)
+	}
+	switch s.Circuit {
+	case CircuitEmissions:
+		return nil
+	case CircuitStockFlow:
+		if s.StockFlow == nil {
+			return fmt.Errorf("circuit %q requires stock flow parameters", CircuitStockFlow)
+		}
+	case CircuitReceiptEmissions:
+		if s.ReceiptEmissions == nil {
+			return fmt.Errorf("circuit %q requires receipt emissions parameters", CircuitReceiptEmissions)
+		}
+		if err := s.ReceiptEmissions.validate(); err != nil {
+			return err
+		}
+	case CircuitBlockRange:
+		if s.BlockRange == nil {
+			return fmt.Errorf("circuit %q requires block range parameters", CircuitBlockRange)
+		}
+	default:
+		return fmt.Errorf("unknown circuit %q", s.Circuit)
+	}
+	if s.Aggregation != AggregationSum || len(s.Fields) > 0 || s.ValueMode != ValueModeUint248 || s.ScaleFactor != "" || s.Bucket != "" || s.ExpectedEmission != "" || s.Mode != "" {
+		return fmt.Errorf("circuit %q does not take aggregation, fields, value_mode, scale_factor, bucket, expected_emission or mode options", s.Circuit)
+	}
+	return nil
+}
+
+func (s CircuitSpec) validateAggregation() error {
+	maxStorage := s.slots()
+	switch s.Aggregation {
+	case AggregationSum, AggregationSorted, AggregationMin, AggregationMax, AggregationMean, AggregationCount:
+	case AggregationMerkle:
+		for _, f := range s.Fields {
+			if f.Name != emissionsField {
+				return fmt.Errorf("aggregation %q outputs only the root and total, so field %q cannot be output", AggregationMerkle, f.Name)
+			}
+		}
+	case AggregationTopK:
+		if s.TopK < 1 || s.TopK > maxStorage {
+			return fmt.Errorf("k must be between 1 and %d, got %d", maxStorage, s.TopK)
+		}
+	case AggregationWindowAvg:
+		if s.Window < 1 || s.Window > maxStorage {
+			return fmt.Errorf("window must be between 1 and %d, got %d", maxStorage, s.Window)
+		}
+	case AggregationEMA:
+		if s.AlphaBps < 1 || s.AlphaBps > emaScale {
+			return fmt.Errorf("alpha_bps must be between 1 and %d, got %d", emaScale, s.AlphaBps)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q", s.Aggregation)
+	}
+	if s.TopK != 0 && s.Aggregation != AggregationTopK {
+		return fmt.Errorf("k is only valid with aggregation %q", AggregationTopK)
+	}
+	if s.Window != 0 && s.Aggregation != AggregationWindowAvg {
+		return fmt.Errorf("window is only valid with aggregation %q", AggregationWindowAvg)
+	}
+	if s.AlphaBps != 0 && s.Aggregation != AggregationEMA {
+		return fmt.Errorf("alpha_bps is only valid with aggregation %q", AggregationEMA)
+	}
+	return nil
+}
+
+func (s CircuitSpec) validateValueMode() error {
+	switch s.ValueMode {
+	case ValueModeUint248:
+	case ValueModeSplit:
+		if s.Aggregation != AggregationSum || len(s.Fields) > 0 || s.ScaleFactor != "" || s.Bucket != "" {
+			return fmt.Errorf("value_mode %q only supports aggregation %q without packed fields, scale_factor or bucket", ValueModeSplit, AggregationSum)
+		}
+	default:
+		return fmt.Errorf("unknown value_mode %q", s.ValueMode)
+	}
+	return nil
+}
+
+func (s CircuitSpec) validateScaleFactor() error {
+	if s.ScaleFactor == "" {
+		return nil
+	}
+	_, err := parseFixedPoint(s.ScaleFactor)
+	return err
+}
+
+func (s CircuitSpec) validateSlots() error {
+	if s.Slots == 0 {
+		return nil
+	}
+	if s.Circuit != CircuitEmissions {
+		return fmt.Errorf("slots is only valid with circuit %q", CircuitEmissions)
+	}
+	if !validSlots(s.Slots) {
+		return fmt.Errorf("slots must be a power of two from %d to %d, got %d", minSlots, maxSlots, s.Slots)
+	}
+	return nil
+}
+
+// newCircuit builds the app circuit the spec describes.
+func (s CircuitSpec) newCircuit() sdk.AppCircuit {
+	switch s.Circuit {
+	case CircuitStockFlow:
+		return &StockFlowCircuit{StockFlowParams: *s.StockFlow}
+	case CircuitReceiptEmissions:
+		return &ReceiptEmissionsCircuit{ReceiptEmissionsParams: *s.ReceiptEmissions}
+	case CircuitBlockRange:
+		return &BlockRangeCircuit{BlockRangeParams: *s.BlockRange}
+	}
+	return &AppCircuit{EmissionsData: s.expectedEmission(), Spec: s}
+}
+
+func (s CircuitSpec) packedEmissions() bool {
+	for _, f := range s.Fields {
+		if f.Name == emissionsField {
+			return true
+		}
+	}
+	return false
+}
+
+func (s CircuitSpec) equal(o CircuitSpec) bool {
+	return s.String() == o.String()
+}
+
+func (s CircuitSpec) String() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
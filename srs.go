@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// srsFile is the SRS the SDK reads from srsDir. fetchSRS puts it there
+	// before a compile so the SDK never downloads it itself.
+	srsFile = "kzg_srs_100800000_bn254_MAIN_IGNITION"
+	// srsMD5 is the checksum the SDK accepts srsFile with.
+	srsMD5 = "2abd249241a7fe883379db93530365f8"
+)
+
+var (
+	// srsMirror is the base URL srsFile is downloaded from. Air-gapped
+	// deployments point it at an internal copy.
+	srsMirror = "https://kzg-srs.s3.us-west-2.amazonaws.com"
+	// srsPrefetch downloads the SRS at startup rather than on the first
+	// compile.
+	srsPrefetch = true
+)
+
+func loadSRSSettings() error {
+	if v := os.Getenv("BREVIS_SRS_MIRROR"); v != "" {
+		srsMirror = strings.TrimRight(v, "/")
+	}
+	var err error
+	srsPrefetch, err = envBool("BREVIS_SRS_PREFETCH", srsPrefetch)
+	return err
+}
+
+// srsState is the progress of getting the SRS onto disk, reported by
+// /status.
+type srsState struct {
+	State      string     `json:"state"` // missing, downloading, verifying, ready or failed
+	URL        string     `json:"url,omitempty"`
+	BytesDone  int64      `json:"bytes_done,omitempty"`
+	BytesTotal int64      `json:"bytes_total,omitempty"`
+	Started    *time.Time `json:"started,omitempty"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	srsStatus      = srsState{State: "missing"}
+	srsStatusMutex sync.Mutex
+	// srsFetchMutex lets one caller fetch at a time; the rest wait and find
+	// the SRS ready.
+	srsFetchMutex sync.Mutex
+)
+
+func srsSnapshot() srsState {
+	srsStatusMutex.Lock()
+	defer srsStatusMutex.Unlock()
+	return srsStatus
+}
+
+func setSRSStatus(f func(*srsState)) {
+	srsStatusMutex.Lock()
+	defer srsStatusMutex.Unlock()
+	f(&srsStatus)
+}
+
+// fetchSRS makes sure a verified srsFile is in config.SRSDir, taking it
+// from artifactStore or else downloading it from srsMirror if it is missing
+// or fails its checksum. A download is shared through artifactStore for the
+// other replicas. A file already on disk is verified once per process.
+func fetchSRS(ctx context.Context) error {
+	srsFetchMutex.Lock()
+	defer srsFetchMutex.Unlock()
+	if srsSnapshot().State == "ready" {
+		return nil
+	}
+	if err := os.MkdirAll(config.SRSDir, 0755); err != nil {
+		return fmt.Errorf("creating SRS directory: %v", err)
+	}
+	path := filepath.Join(config.SRSDir, srsFile)
+
+	if _, err := os.Stat(path); err == nil {
+		setSRSStatus(func(s *srsState) { *s = srsState{State: "verifying"} })
+		sum, err := md5File(path)
+		if err == nil && sum == srsMD5 {
+			now := time.Now()
+			setSRSStatus(func(s *srsState) { s.State, s.Finished = "ready", &now })
+			return nil
+		}
+		slog.WarnContext(ctx, "SRS on disk fails its checksum; downloading it again", "path", path, "md5", sum, "err", err)
+	}
+
+	err := errBlobNotFound
+	if artifactStore != nil {
+		if err = sharedSRS(ctx, path); err != nil && !errors.Is(err, errBlobNotFound) {
+			slog.WarnContext(ctx, "Error fetching shared SRS; downloading it from the mirror", "err", err)
+		}
+	}
+	if err != nil {
+		if err = downloadSRS(ctx, path); err == nil && artifactStore != nil {
+			if err := putBlobFile(ctx, srsObject(), path); err != nil {
+				slog.WarnContext(ctx, "Error sharing SRS", "object", artifactStore.URL(srsObject()), "err", err)
+			}
+		}
+	}
+	now := time.Now()
+	setSRSStatus(func(s *srsState) {
+		s.Finished = &now
+		if err != nil {
+			s.State, s.Error = "failed", err.Error()
+			return
+		}
+		s.State = "ready"
+	})
+	return err
+}
+
+// downloadSRS streams srsFile from srsMirror into a partial file, checking
+// its MD5 on the way, and moves it to path only once it matches.
+func downloadSRS(ctx context.Context, path string) error {
+	url := srsMirror + "/" + srsFile
+	now := time.Now()
+	setSRSStatus(func(s *srsState) { *s = srsState{State: "downloading", URL: url, Started: &now} })
+	slog.InfoContext(ctx, "Downloading SRS", "url", url, "path", path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading SRS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading SRS from %s: %s", url, resp.Status)
+	}
+	setSRSStatus(func(s *srsState) { s.BytesTotal = resp.ContentLength })
+
+	partial := path + ".partial"
+	f, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partial)
+	h := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, h, srsProgress{}), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading SRS: %v", err)
+	}
+
+	setSRSStatus(func(s *srsState) { s.State = "verifying" })
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != srsMD5 {
+		return fmt.Errorf("SRS from %s has MD5 %s, want %s", url, sum, srsMD5)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Downloaded SRS", "path", path, "duration_ms", time.Since(now).Milliseconds())
+	return nil
+}
+
+// srsObject is where replicas share the SRS in artifactStore.
+func srsObject() string {
+	return blobKey("srs", srsFile)
+}
+
+// sharedSRS copies the SRS another replica shared to path, once it passes
+// its checksum.
+func sharedSRS(ctx context.Context, path string) error {
+	url := artifactStore.URL(srsObject())
+	now := time.Now()
+	setSRSStatus(func(s *srsState) { *s = srsState{State: "downloading", URL: url, Started: &now} })
+	partial := path + ".partial"
+	if err := getBlobFile(ctx, srsObject(), partial); err != nil {
+		return err
+	}
+	defer os.Remove(partial)
+	setSRSStatus(func(s *srsState) { s.State = "verifying" })
+	sum, err := md5File(partial)
+	if err != nil {
+		return err
+	}
+	if sum != srsMD5 {
+		return fmt.Errorf("SRS at %s has MD5 %s, want %s", url, sum, srsMD5)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Fetched shared SRS", "object", url, "duration_ms", time.Since(now).Milliseconds())
+	return nil
+}
+
+// srsProgress counts downloaded bytes into srsStatus.
+type srsProgress struct{}
+
+func (srsProgress) Write(p []byte) (int, error) {
+	setSRSStatus(func(s *srsState) { s.BytesDone += int64(len(p)) })
+	return len(p), nil
+}
+
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
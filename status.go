@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// compileStatus is the progress of the latest circuit preparation.
+type compileStatus struct {
+	Spec       string     `json:"spec"`
+	InProgress bool       `json:"in_progress"`
+	Started    time.Time  `json:"started"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	serverStarted = time.Now()
+
+	lastCompile *compileStatus
+	// lastCompileError outlives later successful compiles.
+	lastCompileError   string
+	lastCompileErrorAt *time.Time
+	compileStatusMutex sync.Mutex
+
+	// proofsInFlight counts submissions being proven, queued jobs and
+	// wait=true requests alike.
+	proofsInFlight atomic.Int64
+)
+
+func startCompile(spec CircuitSpec) {
+	compileStatusMutex.Lock()
+	defer compileStatusMutex.Unlock()
+	lastCompile = &compileStatus{Spec: spec.String(), InProgress: true, Started: time.Now()}
+}
+
+func finishCompile(err error) {
+	compileStatusMutex.Lock()
+	defer compileStatusMutex.Unlock()
+	now := time.Now()
+	lastCompile.InProgress, lastCompile.Finished = false, &now
+	lastCompile.DurationMs = now.Sub(lastCompile.Started).Milliseconds()
+	compileDuration.Observe(now.Sub(lastCompile.Started).Seconds())
+	if err != nil {
+		lastCompile.Error = err.Error()
+		lastCompileError, lastCompileErrorAt = err.Error(), &now
+		compilationsTotal.WithLabelValues("failure").Inc()
+		return
+	}
+	compilationsTotal.WithLabelValues("success").Inc()
+}
+
+// handleStatus reports whether a circuit is prepared, the latest and failed
+// compiles, the SRS download, and how many proofs are in flight.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	circuit := map[string]interface{}{}
+	prepared := []map[string]interface{}{}
+	for _, p := range preparedList() {
+		var slots []int
+		for _, v := range p.Variants {
+			slots = append(slots, v.Spec.slots())
+		}
+		prepared = append(prepared, map[string]interface{}{"spec": p.Spec, "slots": slots})
+	}
+	circuit["prepared"] = len(prepared) > 0
+	circuit["circuits"] = prepared
+	compileStatusMutex.Lock()
+	if lastCompile != nil {
+		c := *lastCompile
+		if c.InProgress {
+			c.DurationMs = time.Since(c.Started).Milliseconds()
+		}
+		circuit["compile"] = c
+	}
+	if lastCompileError != "" {
+		circuit["last_error"] = lastCompileError
+		circuit["last_error_at"] = lastCompileErrorAt
+	}
+	compileStatusMutex.Unlock()
+
+	counts := map[string]int{}
+	jobsMutex.Lock()
+	for _, j := range jobs {
+		counts[j.Status]++
+	}
+	isDrain := draining
+	jobsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile":  activeProfile.Name,
+		"chain_id": activeProfile.ChainID,
+		"chains":   chainIDs(),
+		"uptime_s": int64(time.Since(serverStarted).Seconds()),
+		"draining": isDrain,
+		"circuit":  circuit,
+		"srs":      srsSnapshot(),
+		"proofs": map[string]interface{}{
+			"in_flight": proofsInFlight.Load(),
+			"proving":   len(proofSlots),
+			"waiting":   proofsWaiting.Load(),
+			"slots":     proofConcurrency,
+			"jobs":      counts,
+		},
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StockFlowParams identify the cumulative emissions counter and the event
+// reporting each emission.
+type StockFlowParams struct {
+	Registry    common.Address `json:"registry"`
+	CounterSlot common.Hash    `json:"counter_slot"`
+	EventID     common.Hash    `json:"event_id"`
+	// AmountIndex is the position of the amount among the event's data fields.
+	AmountIndex int `json:"amount_index"`
+}
+
+func parseStockFlowParams(q url.Values) (*StockFlowParams, error) {
+	for _, name := range []string{"registry", "counter_slot", "event_id"} {
+		if q.Get(name) == "" {
+			return nil, fmt.Errorf("circuit %q requires %s", CircuitStockFlow, name)
+		}
+	}
+	registry, err := parseAddress("registry", q.Get("registry"))
+	if err != nil {
+		return nil, err
+	}
+	counterSlot, err := parseSlotKey(q.Get("counter_slot"))
+	if err != nil {
+		return nil, fmt.Errorf("counter_slot: %v", err)
+	}
+	eventID, err := parseHash("event_id", q.Get("event_id"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := intParam(q, "amount_index")
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("amount_index must not be negative, got %d", index)
+	}
+	return &StockFlowParams{
+		Registry:    registry,
+		CounterSlot: counterSlot,
+		EventID:     eventID,
+		AmountIndex: index,
+	}, nil
+}
+
+// StockFlowCircuit checks that the change of a registry's stored cumulative
+// emissions counter between two blocks matches the sum of the emissions events
+// it reported in that range. Storage slot 0 and 1 hold the counter at the start
+// and end block; each receipt carries one event amount as its first field.
+//
+// The circuit can only account for the receipts it is given: it proves the
+// supplied events are in range and sum as output, not that no event was left
+// out.
+type StockFlowCircuit struct {
+	StockFlowParams
+}
+
+var _ sdk.AppCircuit = &StockFlowCircuit{}
+
+func (c *StockFlowCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return 32, 32, 0
+}
+
+func (c *StockFlowCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u248 := api.Uint248
+	u32 := api.Uint32
+	registry := sdk.ConstUint248(c.Registry)
+	counterSlot := sdk.ConstFromBigEndianBytes(c.CounterSlot[:])
+	eventID := sdk.ParseEventID(c.EventID[:])
+
+	slots := sdk.NewDataStream(api, in.StorageSlots)
+	u248.AssertIsEqual(sdk.Count(slots), sdk.ConstUint248(2))
+	sdk.AssertEach(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		return u248.And(
+			u248.IsEqual(slot.Contract, registry),
+			api.Bytes32.IsEqual(slot.Slot, counterSlot),
+		)
+	})
+	start := sdk.GetUnderlying(slots, 0)
+	end := sdk.GetUnderlying(slots, 1)
+	u32.AssertIsEqual(u32.IsLessThan(start.BlockNum, end.BlockNum), sdk.ConstUint32(1))
+
+	receipts := sdk.NewDataStream(api, in.Receipts)
+	sdk.AssertEach(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		f := r.Fields[0]
+		return u248.And(
+			u248.IsEqual(f.Contract, registry),
+			u248.IsEqual(f.EventID, eventID),
+			u248.IsZero(f.IsTopic),
+			u248.IsEqual(f.Index, sdk.ConstUint248(c.AmountIndex)),
+			api.ToUint248(u32.IsGreaterThan(r.BlockNum, start.BlockNum)),
+			api.ToUint248(u32.Not(u32.IsGreaterThan(r.BlockNum, end.BlockNum))),
+		)
+	})
+	flow := sdk.Sum(sdk.Map(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		return api.ToUint248(r.Fields[0].Value)
+	}))
+
+	startValue := api.ToUint248(start.Value)
+	endValue := api.ToUint248(end.Value)
+	u248.AssertIsLessOrEqual(startValue, endValue)
+	delta := u248.Sub(endValue, startValue)
+
+	api.OutputAddress(registry)
+	api.OutputUint32(32, start.BlockNum)
+	api.OutputUint32(32, end.BlockNum)
+	api.OutputUint(248, delta)
+	api.OutputUint(248, flow)
+	api.OutputBool(u248.IsEqual(delta, flow))
+	return nil
+}
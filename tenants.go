@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// tenantSettingsSchema keeps what each API key's tenant configured, by key
+// name, as the JSON of tenantSettings.
+const tenantSettingsSchema = `CREATE TABLE IF NOT EXISTS tenant_settings (
+	name TEXT PRIMARY KEY,
+	settings TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+)`
+
+// tenantSettings are the defaults a tenant's requests fall back on in place
+// of the server's, and its policy limits. A request's own parameters still
+// override the defaults, within the server's bounds; the limits only
+// tighten the server's.
+type tenantSettings struct {
+	ChainID           uint64 `json:"chain_id,omitempty"`
+	DstChainID        uint64 `json:"dst_chain_id,omitempty"`
+	CallbackURL       string `json:"callback_url,omitempty"`
+	CallbackGasLimit  uint64 `json:"callback_gas_limit,omitempty"`
+	QueryOption       string `json:"query_option,omitempty"`
+	FulfillmentWindow string `json:"fulfillment_window,omitempty"`
+
+	// MaxSlots bounds the slots of the circuit variant a proof runs on.
+	MaxSlots      int `json:"max_slots,omitempty"`
+	DailyProofs   int `json:"daily_proof_quota,omitempty"`
+	MonthlyProofs int `json:"monthly_proof_quota,omitempty"`
+}
+
+// lookupTenantSettings reads the settings of the tenant of key name, none
+// without a request store or a key.
+func lookupTenantSettings(ctx context.Context, name string) (tenantSettings, error) {
+	var t tenantSettings
+	if requestDB == nil || name == "" {
+		return t, nil
+	}
+	var b string
+	err := requestDB.QueryRowContext(ctx, "SELECT settings FROM tenant_settings WHERE name = $1", name).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, nil
+	}
+	if err != nil {
+		return t, &statusError{http.StatusInternalServerError, fmt.Errorf("reading settings of %s: %v", name, err)}
+	}
+	if err := json.Unmarshal([]byte(b), &t); err != nil {
+		return t, &statusError{http.StatusInternalServerError, fmt.Errorf("decoding settings of %s: %v", name, err)}
+	}
+	return t, nil
+}
+
+// apply sets the defaults t configures on o.
+func (t tenantSettings) apply(o *submitOptions) error {
+	if t.ChainID != 0 {
+		o.SrcChainID = t.ChainID
+	}
+	if t.DstChainID != 0 {
+		o.DstChainID = t.DstChainID
+	}
+	if t.CallbackURL != "" {
+		o.CallbackURL = t.CallbackURL
+	}
+	if t.CallbackGasLimit != 0 {
+		o.CallbackGasLimit = t.CallbackGasLimit
+	}
+	if t.QueryOption != "" {
+		option, ok := queryOptions[t.QueryOption]
+		if !ok {
+			return fmt.Errorf("invalid query_option %q: want zk or op", t.QueryOption)
+		}
+		o.QueryOption = option
+	}
+	if t.FulfillmentWindow != "" {
+		d, err := time.ParseDuration(t.FulfillmentWindow)
+		if err != nil {
+			return fmt.Errorf("invalid fulfillment_window %q: %v", t.FulfillmentWindow, err)
+		}
+		o.FulfillmentWindow = d
+	}
+	return nil
+}
+
+// check refuses settings whose defaults the server's bounds would refuse,
+// or whose limits are negative.
+func (t tenantSettings) check() error {
+	o := defaultSubmitOptions()
+	if err := t.apply(&o); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	if t.MaxSlots < 0 || t.DailyProofs < 0 || t.MonthlyProofs < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// checkSlots refuses a proof on a variant of more slots than the tenant's
+// max_slots.
+func (t tenantSettings) checkSlots(spec CircuitSpec) error {
+	if t.MaxSlots > 0 && spec.Slots > t.MaxSlots {
+		return fmt.Errorf("the request needs a %d-slot circuit; this API key is limited to %d slots", spec.Slots, t.MaxSlots)
+	}
+	return nil
+}
+
+// proofLimitsFor is limitsFor with the proof quotas tightened to those the
+// client's tenant settings set. Settings that cannot be read leave the
+// limits as they are.
+func proofLimitsFor(ctx context.Context, client string) clientLimits {
+	l := limitsFor(client)
+	t, err := lookupTenantSettings(ctx, client)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading tenant settings; applying the key's quotas", "client", client, "err", err)
+		return l
+	}
+	tighten := func(limit, tenant int) int {
+		if tenant > 0 && (limit == 0 || tenant < limit) {
+			return tenant
+		}
+		return limit
+	}
+	l.DailyProofs = tighten(l.DailyProofs, t.DailyProofs)
+	l.MonthlyProofs = tighten(l.MonthlyProofs, t.MonthlyProofs)
+	return l
+}
+
+// handleAdminTenants lists the stored tenant settings on GET, or those of
+// name. PUT replaces name's settings with the JSON body, which must pass
+// the checks a request's parameters do; DELETE clears them.
+func handleAdminTenants(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if requestDB == nil {
+		http.Error(w, "No request store to keep tenant settings in; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	switch r.Method {
+	case http.MethodPut:
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		var t tenantSettings
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&t); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid settings: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := t.check(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid settings: %v", err), http.StatusBadRequest)
+			return
+		}
+		b, _ := json.Marshal(t)
+		_, err := requestDB.ExecContext(r.Context(), `INSERT INTO tenant_settings (name, settings, updated_at) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET settings = excluded.settings, updated_at = excluded.updated_at`,
+			name, string(b), time.Now().UTC().Format(storeTimeLayout))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving settings: %v", err), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Updated tenant settings", "name", name, "settings", string(b))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+
+	case http.MethodDelete:
+		res, err := requestDB.ExecContext(r.Context(), "DELETE FROM tenant_settings WHERE name = $1", name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error clearing settings: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, fmt.Sprintf("No settings for %q", name), http.StatusNotFound)
+			return
+		}
+		slog.InfoContext(r.Context(), "Cleared tenant settings", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		query, args := "SELECT name, settings FROM tenant_settings ORDER BY name", []interface{}{}
+		if name != "" {
+			query, args = "SELECT name, settings FROM tenant_settings WHERE name = $1", []interface{}{name}
+		}
+		rows, err := requestDB.QueryContext(r.Context(), query, args...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading settings: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		tenants := map[string]tenantSettings{}
+		for rows.Next() {
+			var n, b string
+			var t tenantSettings
+			err := rows.Scan(&n, &b)
+			if err == nil {
+				err = json.Unmarshal([]byte(b), &t)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error reading settings: %v", err), http.StatusInternalServerError)
+				return
+			}
+			tenants[n] = t
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tenants": tenants,
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+const (
+	// ModeEqual checks every slot holds exactly the expected emission. It is
+	// the default, left out of specs as "".
+	ModeEqual = "equal"
+	// ModeThreshold checks every slot is at most the expected emission, used
+	// as a cap, and the total at most total_cap when set.
+	ModeThreshold = "threshold"
+)
+
+// parseTotalCap reads a total cap: a positive integer below 2^248.
+func parseTotalCap(s string) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() <= 0 || v.Cmp(sdk.MaxUint248) > 0 {
+		return nil, fmt.Errorf("invalid total_cap %q: want a positive integer below 2^248", s)
+	}
+	return v, nil
+}
+
+func (s CircuitSpec) validateMode() error {
+	switch s.Mode {
+	case "":
+		if s.TotalCap != "" {
+			return fmt.Errorf("total_cap is only valid with mode %q", ModeThreshold)
+		}
+		return nil
+	case ModeThreshold:
+	default:
+		return fmt.Errorf("unknown mode %q", s.Mode)
+	}
+	if s.ValueMode == ValueModeSplit {
+		return fmt.Errorf("mode %q is not supported with value_mode %q", ModeThreshold, ValueModeSplit)
+	}
+	if s.TotalCap != "" {
+		if _, err := parseTotalCap(s.TotalCap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSlot is 1 if the emission value v of a slot passes the spec's mode
+// against expected.
+func (c *AppCircuit) checkSlot(api *sdk.CircuitAPI, v, expected sdk.Uint248) sdk.Uint248 {
+	if c.Spec.Mode == ModeThreshold {
+		return api.Uint248.Not(api.Uint248.IsGreaterThan(v, expected))
+	}
+	return api.Uint248.IsEqual(v, expected)
+}
+
+// assertTotalCap holds the aggregated total to the spec's total cap, if any.
+func (c *AppCircuit) assertTotalCap(api *sdk.CircuitAPI, total sdk.Uint248) {
+	if c.Spec.TotalCap == "" {
+		return
+	}
+	limit, _ := parseTotalCap(c.Spec.TotalCap)
+	api.Uint248.AssertIsLessOrEqual(total, sdk.ConstUint248(limit))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// usageSchema keeps the spend and proof counts of each budget and quota
+// period, so that every replica counts against the same totals and a
+// restart keeps them. client is "" for the service-wide budget.
+const usageSchema = `CREATE TABLE IF NOT EXISTS usage_counters (
+	kind TEXT NOT NULL,
+	client TEXT NOT NULL,
+	period TEXT NOT NULL,
+	period_start TEXT NOT NULL,
+	amount NUMERIC NOT NULL,
+	PRIMARY KEY (kind, client, period, period_start)
+)`
+
+// Usage kinds: fees in the fee token's smallest unit, and proofs
+// submitted.
+const (
+	usageSpend  = "spend"
+	usageProofs = "proofs"
+)
+
+// usagePeriods are the periods usage is counted over, each starting at
+// periodStart.
+var usagePeriods = []string{"daily", "monthly"}
+
+// usageKey names one counter: what a client used in the period beginning
+// at start.
+type usageKey struct {
+	kind, client, period string
+	start                time.Time
+}
+
+func newUsageKey(kind, client, period string, now time.Time) usageKey {
+	return usageKey{kind: kind, client: client, period: period, start: periodStart(period, now)}
+}
+
+var (
+	// localUsage counts usage when there is no request store, in memory
+	// and per process.
+	localUsage = map[usageKey]*big.Int{}
+	usageMutex sync.Mutex
+)
+
+// createUsageTable creates the counters' table in the request store. It
+// runs after loadRequestStore.
+func createUsageTable() error {
+	if requestDB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := requestDB.ExecContext(ctx, usageSchema); err != nil {
+		return fmt.Errorf("creating usage table: %v", err)
+	}
+	return nil
+}
+
+// readUsage is what was counted under k, zero before anything was.
+func readUsage(ctx context.Context, k usageKey) (*big.Int, error) {
+	if requestDB == nil {
+		usageMutex.Lock()
+		defer usageMutex.Unlock()
+		if n, ok := localUsage[k]; ok {
+			return new(big.Int).Set(n), nil
+		}
+		return new(big.Int), nil
+	}
+	var amount string
+	err := requestDB.QueryRowContext(ctx, "SELECT amount FROM usage_counters WHERE kind = $1 AND client = $2 AND period = $3 AND period_start = $4",
+		k.kind, k.client, k.period, k.start.Format(storeTimeLayout)).Scan(&amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseUsage(amount)
+}
+
+// addUsage adds n to what was counted under k and returns the new total.
+// With limit set, n is only added while the total stays within it; past it
+// nothing is added and ok is false.
+func addUsage(ctx context.Context, k usageKey, n, limit *big.Int) (total *big.Int, ok bool, err error) {
+	if limit != nil && n.Cmp(limit) > 0 {
+		return nil, false, nil
+	}
+	if requestDB == nil {
+		usageMutex.Lock()
+		defer usageMutex.Unlock()
+		total = new(big.Int).Set(n)
+		if cur, ok := localUsage[k]; ok {
+			total.Add(total, cur)
+		}
+		if limit != nil && total.Cmp(limit) > 0 {
+			return nil, false, nil
+		}
+		localUsage[k] = total
+		pruneLocalUsage(k.start)
+		return new(big.Int).Set(total), true, nil
+	}
+
+	// The upsert is atomic, so replicas adding at once cannot both pass
+	// the limit.
+	query := `INSERT INTO usage_counters (kind, client, period, period_start, amount) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (kind, client, period, period_start) DO UPDATE SET amount = usage_counters.amount + excluded.amount`
+	args := []interface{}{k.kind, k.client, k.period, k.start.Format(storeTimeLayout), n.String()}
+	if limit != nil {
+		query += " WHERE usage_counters.amount + excluded.amount <= CAST($6 AS NUMERIC)"
+		args = append(args, limit.String())
+	}
+	var amount string
+	err = requestDB.QueryRowContext(ctx, query+" RETURNING amount", args...).Scan(&amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	total, err = parseUsage(amount)
+	return total, err == nil, err
+}
+
+// subtractUsage gives back n of what was counted under k, leaving it as
+// it was if less than n was.
+func subtractUsage(ctx context.Context, k usageKey, n *big.Int) error {
+	if requestDB == nil {
+		usageMutex.Lock()
+		defer usageMutex.Unlock()
+		if cur, ok := localUsage[k]; ok && cur.Cmp(n) >= 0 {
+			localUsage[k] = new(big.Int).Sub(cur, n)
+		}
+		return nil
+	}
+	_, err := requestDB.ExecContext(ctx, "UPDATE usage_counters SET amount = amount - CAST($1 AS NUMERIC) WHERE amount >= CAST($1 AS NUMERIC) AND kind = $2 AND client = $3 AND period = $4 AND period_start = $5",
+		n.String(), k.kind, k.client, k.period, k.start.Format(storeTimeLayout))
+	return err
+}
+
+// pruneLocalUsage drops in-memory counters of periods that ended before
+// the one starting at start. The caller holds usageMutex.
+func pruneLocalUsage(start time.Time) {
+	for k := range localUsage {
+		if periodEnd(k.period, k.start).Before(start) {
+			delete(localUsage, k)
+		}
+	}
+}
+
+// parseUsage reads a stored amount. SQLite hands amounts past int64 back as
+// floats, which are read to the nearest integer.
+func parseUsage(s string) (*big.Int, error) {
+	if n, ok := new(big.Int).SetString(s, 10); ok {
+		return n, nil
+	}
+	f, _, err := big.ParseFloat(s, 10, 256, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored usage amount %q", s)
+	}
+	n, _ := f.Int(nil)
+	return n, nil
+}
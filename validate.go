@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handleValidate runs the checks /submit-proof would apply to the same
+// parameters and reports every violation, without proving anything. Problems
+// that a later /prepare-download call would fix are reported as warnings.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	violations := []string{}
+	warnings := []string{}
+	spec, errs := parseCircuitSpecAll(r)
+	for _, err := range errs {
+		violations = append(violations, err.Error())
+	}
+	if _, err := parseSnapshotPin(r); err != nil {
+		violations = append(violations, err.Error())
+	}
+	tenant, err := lookupTenantSettings(r.Context(), apiKeyName(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if opts, err := parseSubmitOptions(r, tenant); err != nil {
+		violations = append(violations, err.Error())
+	} else {
+		if err := checkKeyEnvironment(r.Context(), opts); err != nil {
+			violations = append(violations, err.Error())
+		}
+		for _, id := range []uint64{opts.SrcChainID, opts.DstChainID} {
+			if err := chains[id].confirmMainnet(mainnetConfirmed(r)); err != nil {
+				violations = append(violations, err.Error())
+			}
+		}
+		if err := opts.checkCallbackContract(); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	if len(errs) == 0 {
+		if lookupPrepared(spec) == nil {
+			warnings = append(warnings, fmt.Sprintf("No circuit is prepared for spec %s; call /prepare-download with the same parameters first", spec))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":      len(violations) == 0,
+		"violations": violations,
+		"warnings":   warnings,
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+)
+
+const (
+	// defaultSlots is the only allocation compiled unless
+	// BREVIS_CIRCUIT_SIZES says otherwise.
+	defaultSlots = 32
+	// minSlots and maxSlots bound a variant's allocation. The SDK's setup
+	// only accepts multiples of 32 storage slots.
+	minSlots = 32
+	maxSlots = 256
+)
+
+// circuitSizes are the storage slot allocations compiled for each emissions
+// spec, ascending. Requests are routed to the smallest that fits.
+var circuitSizes = []int{defaultSlots}
+
+// validSlots reports whether n is an allocation a variant can compile to:
+// a power of two, as BuildCircuitInput pads to them, within the bounds.
+func validSlots(n int) bool {
+	return n >= minSlots && n <= maxSlots && n&(n-1) == 0
+}
+
+// circuitVariant is one compiled size of a prepared spec. Hash is the
+// circuitHash of CCS.
+type circuitVariant struct {
+	Spec CircuitSpec
+	CCS  constraint.ConstraintSystem
+	PK   plonk.ProvingKey
+	Hash string
+}
+
+// parseCircuitSizes reads a comma-separated list of slot allocations such
+// as "32,128".
+func parseCircuitSizes(s string) ([]int, error) {
+	var sizes []int
+	seen := map[int]bool{}
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || !validSlots(n) {
+			return nil, fmt.Errorf("invalid circuit size %q: want a power of two from %d to %d", v, minSlots, maxSlots)
+		}
+		if !seen[n] {
+			seen[n] = true
+			sizes = append(sizes, n)
+		}
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// slots is the storage slot allocation the spec compiles to. A spec not yet
+// routed to a variant is checked against the largest configured size.
+func (s CircuitSpec) slots() int {
+	if s.Slots > 0 {
+		return s.Slots
+	}
+	return circuitSizes[len(circuitSizes)-1]
+}
+
+// variants lists the specs compiled for s, smallest first. Stock flow,
+// receipt emissions and block range circuits and specs pinned to an
+// allocation have a single variant, and
+// sizes too small for the spec's own parameters are skipped.
+func (s CircuitSpec) variants() []CircuitSpec {
+	if s.Circuit != CircuitEmissions || s.Slots > 0 {
+		return []CircuitSpec{s}
+	}
+	var out []CircuitSpec
+	for _, size := range circuitSizes {
+		v := s
+		v.Slots = size
+		if v.validate() == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// base is the spec a variant was derived from.
+func (s CircuitSpec) base() CircuitSpec {
+	s.Slots = 0
+	return s
+}
+
+// variantDir is where a variant's artifacts are compiled to: a directory
+// named for its circuit and allocation, and a hash of the whole spec so
+// specs of the same circuit do not share one.
+func variantDir(spec CircuitSpec) string {
+	sum := sha256.Sum256([]byte(spec.String()))
+	return filepath.Join(circuitDir, fmt.Sprintf("%s-%d-%s", spec.Circuit, spec.slots(), hex.EncodeToString(sum[:6])))
+}
+
+// preparedCircuit is a compiled spec and its variants, smallest first.
+type preparedCircuit struct {
+	Spec     CircuitSpec
+	Variants []*circuitVariant
+}
+
+// lookupPrepared returns the prepared circuit of spec, or nil.
+func lookupPrepared(spec CircuitSpec) *preparedCircuit {
+	circuitMutex.Lock()
+	defer circuitMutex.Unlock()
+	return preparedCircuits[spec.String()]
+}
+
+// preparedVariantsOf returns the variants of spec, or nil if it is not
+// prepared.
+func preparedVariantsOf(spec CircuitSpec) []*circuitVariant {
+	if p := lookupPrepared(spec); p != nil {
+		return p.Variants
+	}
+	return nil
+}
+
+// findVariant returns the prepared variant compiled for exactly spec, or
+// nil.
+func findVariant(spec CircuitSpec) *circuitVariant {
+	circuitMutex.Lock()
+	defer circuitMutex.Unlock()
+	for _, p := range preparedCircuits {
+		for _, v := range p.Variants {
+			if v.Spec.equal(spec) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// installPrepared makes spec's variants available to requests, replacing
+// any it had.
+func installPrepared(spec CircuitSpec, variants []*circuitVariant) {
+	circuitMutex.Lock()
+	defer circuitMutex.Unlock()
+	preparedCircuits[spec.String()] = &preparedCircuit{Spec: spec, Variants: variants}
+}
+
+func preparedCount() int {
+	circuitMutex.Lock()
+	defer circuitMutex.Unlock()
+	return len(preparedCircuits)
+}
+
+// preparedList lists the prepared circuits by spec.
+func preparedList() []*preparedCircuit {
+	circuitMutex.Lock()
+	list := make([]*preparedCircuit, 0, len(preparedCircuits))
+	for _, p := range preparedCircuits {
+		list = append(list, p)
+	}
+	circuitMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Spec.String() < list[j].Spec.String() })
+	return list
+}
+
+// routeVariant picks the smallest variant with room for needed storage
+// queries.
+func routeVariant(variants []*circuitVariant, needed int) (*circuitVariant, error) {
+	for _, v := range variants {
+		if v.Spec.slots() >= needed {
+			return v, nil
+		}
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no circuit variant prepared")
+	}
+	return nil, fmt.Errorf("request needs %d storage slots; the largest prepared circuit has %d", needed, variants[len(variants)-1].Spec.slots())
+}
+
+// preparedVariantDirs lists the variant directories compiled on this node.
+func preparedVariantDirs() []string {
+	entries, err := os.ReadDir(circuitDir)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(circuitDir, e.Name(), circuitSpecFile)); e.IsDir() && err == nil {
+			dirs = append(dirs, filepath.Join(circuitDir, e.Name()))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// verifyRequest is the /verify body, in the form GET /proofs returns so its
+// response can be posted back as is. Parts left out are filled in from the
+// stored request_id, and the verifying key from the spec's circuit.
+type verifyRequest struct {
+	RequestID     string        `json:"request_id"`
+	Spec          string        `json:"spec"`
+	Proof         hexutil.Bytes `json:"proof"`
+	PublicWitness hexutil.Bytes `json:"public_witness"`
+	VerifyingKey  hexutil.Bytes `json:"verifying_key"`
+}
+
+// handleVerify checks a proof against its public witness and verifying key
+// without submitting anything, reporting whether it is valid.
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req verifyRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxQueryBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.RequestID != "" && (len(req.Proof) == 0 || len(req.PublicWitness) == 0 || req.Spec == "") {
+		if requestDB == nil {
+			http.Error(w, "No request store to read request_id from; set BREVIS_REQUEST_STORE", http.StatusNotFound)
+			return
+		}
+		rec, err := getStoredRequest(r.Context(), req.RequestID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && !mayRead(r, rec) {
+			http.Error(w, fmt.Sprintf("No request %q", req.RequestID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading request store: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(req.Proof) == 0 {
+			req.Proof = rec.Proof
+		}
+		if len(req.PublicWitness) == 0 {
+			req.PublicWitness = rec.PublicWitness
+		}
+		if req.Spec == "" {
+			req.Spec = rec.Spec
+		}
+	}
+	if len(req.Proof) == 0 || len(req.PublicWitness) == 0 {
+		http.Error(w, "proof and public_witness are required, or a request_id that has them", http.StatusBadRequest)
+		return
+	}
+	if len(req.VerifyingKey) == 0 {
+		if req.Spec == "" {
+			http.Error(w, "verifying_key is required, or the spec whose circuit it is", http.StatusBadRequest)
+			return
+		}
+		vk, err := verifyingKey(req.Spec)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No verifying key for spec %s: %v", req.Spec, err), http.StatusNotFound)
+			return
+		}
+		req.VerifyingKey = vk
+	}
+
+	proof, public, vk, err := decodeVerification(req.Proof, req.PublicWitness, req.VerifyingKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := map[string]interface{}{"valid": true}
+	if err := sdk.Verify(vk, public, proof); err != nil {
+		result = map[string]interface{}{"valid": false, "error": err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// decodeVerification reads a proof, its public witness and a verifying key in the
+// binary forms GET /proofs returns them in.
+func decodeVerification(proofBytes, publicBytes, vkBytes []byte) (plonk.Proof, witness.Witness, plonk.VerifyingKey, error) {
+	proof := plonk.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofBytes)); err != nil {
+		return nil, nil, nil, fmt.Errorf("Invalid proof: %v", err)
+	}
+	public, err := witness.New(ecc.BN254.ScalarField())
+	if err == nil {
+		err = public.UnmarshalBinary(publicBytes)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Invalid public_witness: %v", err)
+	}
+	vk := plonk.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(bytes.NewReader(vkBytes)); err != nil {
+		return nil, nil, nil, fmt.Errorf("Invalid verifying_key: %v", err)
+	}
+	return proof, public, vk, nil
+}
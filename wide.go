@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+const (
+	// ValueModeUint248 treats slot values as Uint248 and rejects wider values
+	// before proving.
+	ValueModeUint248 = "uint248"
+	// ValueModeSplit accepts full uint256 values and outputs the total as
+	// separate sums of the high and low 128-bit halves.
+	ValueModeSplit = "split"
+)
+
+const halfWordBits = 128
+
+// checkValueWidths reports the first queried slot whose value does not fit
+// in 248 bits. Without it such values only surface as an unsatisfied
+// constraint deep inside witness generation.
+func (c *AppCircuit) checkValueWidths(in sdk.CircuitInput) error {
+	if c.Spec.ValueMode == ValueModeSplit || c.Spec.packedEmissions() {
+		return nil
+	}
+	for i, slot := range in.StorageSlots.Raw {
+		hi, ok := slot.Value.Val[1].(*big.Int)
+		if !ok || hi.Sign() == 0 {
+			continue
+		}
+		lo, _ := slot.Value.Val[0].(*big.Int)
+		value := new(big.Int).Add(new(big.Int).Lsh(hi, 248), lo)
+		return fmt.Errorf("storage slot %d value 0x%x exceeds 248 bits; use value_mode=%s to prove it as hi/lo halves", i, value, ValueModeSplit)
+	}
+	return nil
+}
+
+// defineSplit checks each slot value against EmissionsData as a full 256-bit
+// word and outputs the hi and lo 128-bit half sums, so the total is
+// hi*2^128 + lo.
+func (c *AppCircuit) defineSplit(api *sdk.CircuitAPI, slots *sdk.DataStream[sdk.StorageSlot]) error {
+	expected := sdk.ConstFromBigEndianBytes(c.EmissionsData.Bytes())
+	sdk.AssertEach(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		return api.Bytes32.IsEqual(slot.Value, expected)
+	})
+
+	lo := sdk.Map(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		bits := api.Bytes32.ToBinary(slot.Value)
+		return api.Uint248.FromBinary(bits[:halfWordBits]...)
+	})
+	hi := sdk.Map(slots, func(slot sdk.StorageSlot) sdk.Uint248 {
+		bits := api.Bytes32.ToBinary(slot.Value)
+		return api.Uint248.FromBinary(bits[halfWordBits:]...)
+	})
+
+	api.OutputUint(248, sdk.Sum(hi))
+	api.OutputUint(248, sdk.Sum(lo))
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsUpgrader accepts sockets from the server's own origin and those of
+// config.WSOrigins. A socket's requests carry the browser's cookies and
+// credentials, so unlike plain requests it is not open to every origin.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: checkWSOrigin,
+}
+
+// checkWSOrigin admits a socket opened without an Origin header, as
+// non-browser clients do, or from an allowed origin.
+func checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.WSOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	slog.WarnContext(r.Context(), "Refusing websocket from origin", "origin", origin)
+	return false
+}
+
+// wsMessage is a message either way on /ws. Clients send submit, with the
+// /submit-proof query string in params and its JSON body in body, and
+// cancel, naming job. The server answers with queued, cancelled or error,
+// and pushes progress for each stage a submitted job reaches, then done
+// once it finishes.
+type wsMessage struct {
+	Type   string          `json:"type"`
+	Params string          `json:"params,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Job    string          `json:"job,omitempty"`
+	Stage  string          `json:"stage,omitempty"`
+	Time   *time.Time      `json:"time,omitempty"`
+	Result *job            `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Status int             `json:"status,omitempty"`
+}
+
+// wsSession is one client's socket. Gorilla allows one writer at a time.
+type wsSession struct {
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+}
+
+func (s *wsSession) send(m wsMessage) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := s.conn.WriteJSON(m); err != nil {
+		slog.Debug("Error writing to websocket", "err", err)
+	}
+}
+
+func (s *wsSession) sendError(job string, err error) {
+	s.send(wsMessage{Type: "error", Job: job, Error: err.Error(), Status: httpStatus(err)})
+}
+
+// handleWS runs a proof session over a websocket: the client submits
+// requests and cancels jobs, and is pushed each job's progress without
+// polling. Jobs outlive the socket; closing it only stops the pushes.
+func handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request already.
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	s := &wsSession{conn: conn}
+
+	for {
+		var m wsMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.DebugContext(ctx, "Closing websocket", "err", err)
+			}
+			return
+		}
+		switch m.Type {
+		case "submit":
+			j, err := s.submit(r, m)
+			if err != nil {
+				s.sendError("", err)
+				continue
+			}
+			view := j.view()
+			s.send(wsMessage{Type: "queued", Job: j.ID, Result: &view})
+			go s.follow(ctx, j)
+		case "cancel":
+			if _, err := cancelOwnJob(ctx, m.Job); err != nil {
+				s.sendError(m.Job, err)
+				continue
+			}
+			s.send(wsMessage{Type: "cancelled", Job: m.Job})
+		default:
+			s.sendError(m.Job, &statusError{http.StatusBadRequest, fmt.Errorf("unknown message type %q, want submit or cancel", m.Type)})
+		}
+	}
+}
+
+// submit queues the request m carries as /submit-proof would, on behalf of
+// the client that opened the socket with r.
+func (s *wsSession) submit(r *http.Request, m wsMessage) (*job, error) {
+	if isDraining() {
+		return nil, errDraining
+	}
+	// withRateLimit counted the upgrade only; each submit counts as the
+	// request it stands for.
+	client := clientFor(r)
+	if wait, ok := takeToken(client); !ok {
+		rateLimitedTotal.WithLabelValues("rate").Inc()
+		return nil, &statusError{http.StatusTooManyRequests, fmt.Errorf("Rate limit of %d requests a minute exceeded; try again in %ds", limitsFor(client).RateLimit, int(wait.Seconds())+1)}
+	}
+	req := r.Clone(r.Context())
+	req.Method = http.MethodPost
+	req.URL.Path, req.URL.RawQuery = "/submit-proof", m.Params
+	req.Body = io.NopCloser(bytes.NewReader(m.Body))
+	if err := checkRequest(req); err != nil {
+		return nil, err
+	}
+	sub, err := parseSubmission(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := useProofQuota(r.Context(), client); err != nil {
+		return nil, err
+	}
+	j, err := enqueueJob(r.Context(), sub.spec, sub.queries, sub.receipts, sub.pin, sub.opts)
+	if err != nil {
+		releaseProofQuota(r.Context(), client)
+		return nil, err
+	}
+	return j, nil
+}
+
+// follow pushes j's progress until it finishes or the socket closes,
+// pinging while it is idle.
+func (s *wsSession) follow(ctx context.Context, j *job) {
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	final, ok := followJob(ctx, j, 0, keepAlive.C, func(e jobEvent) {
+		s.send(wsMessage{Type: "progress", Job: j.ID, Stage: e.Stage, Time: &e.Time})
+	}, func() {
+		s.writeMutex.Lock()
+		defer s.writeMutex.Unlock()
+		s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+	})
+	if ok {
+		s.send(wsMessage{Type: "done", Job: j.ID, Result: &final})
+	}
+}